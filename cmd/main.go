@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/avantifellows/nex-gen-cms/internal/constants"
 	"github.com/avantifellows/nex-gen-cms/internal/handlers"
 	"github.com/avantifellows/nex-gen-cms/internal/middleware"
+	servicev1 "github.com/avantifellows/nex-gen-cms/internal/serviceapi/v1"
 )
 
 func main() {
@@ -25,24 +27,36 @@ func main() {
 	}
 
 	setup(new(Config), mux, appComponentPtr)
+	go appComponentPtr.WebhookWorker.Run(context.Background())
 
 	// Paths that don't require a session cookie.
 	exceptions := []string{
 		"/login",
 		"/favicon.ico",
 		"/web/static/css/output.css",
-		"/auth/google/start",
-		"/auth/google/callback",
 		"/dev-login",
-		// Service-to-service JSON APIs — guarded by CMS_SERVICE_TOKEN instead (see setup()).
+		// Service-to-service JSON APIs — guarded by service-client tokens instead (see setup()).
 		"/api/service/tests",
 		"/api/service/test",
 		"/api/service/test-pdf",
+		servicev1.BasePath + "/",
+		// Images lifted out of service API content, loaded by students' browsers (see ImagesHandler.Get).
+		"/images/",
+	}
+	for _, provider := range appComponentPtr.OIDCProviders.List() {
+		exceptions = append(exceptions, "/auth/"+provider.ID()+"/start", "/auth/"+provider.ID()+"/callback")
 	}
 
 	addr := "0.0.0.0:8080"
 	log.Printf("listening on %s", addr)
-	if err := http.ListenAndServe(addr, middleware.RequireLogin(mux, exceptions...)); err != nil {
+	// VerifySession, CSRF and LoadGrants sit inside RequireLogin so the session claims are on the context.
+	// PersonalToken sits outside it, so a bearer token stands in for the session cookie.
+	handler := middleware.PersonalToken(appComponentPtr.PersonalTokens,
+		middleware.RequireLogin(
+			middleware.VerifySession(appComponentPtr.Sessions,
+				middleware.CSRF(middleware.LoadGrants(appComponentPtr.Grants, mux))),
+			exceptions...))
+	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatalf("server: %v", err)
 	}
 }
@@ -62,18 +76,40 @@ type MuxHandler interface {
 	HandleFunc(string, func(http.ResponseWriter, *http.Request))
 }
 
-// editor and admin are short aliases to keep the route table readable.
+// editor and admin are short aliases to keep the route table readable. admin needs the global
+// role and guards /admin/*; editor also accepts an editor grant on any scope (see auth.RoleIn).
 func editor(h http.HandlerFunc) http.HandlerFunc {
-	return middleware.RequireRoleFunc(auth.RoleEditor, h)
+	return middleware.AuthorizeFunc(auth.RoleEditor, nil, h)
 }
 func admin(h http.HandlerFunc) http.HandlerFunc {
 	return middleware.RequireRoleFunc(auth.RoleAdmin, h)
 }
 
+// editorIn and adminIn check the role on the curriculum/grade/subject scope of the content a
+// route touches, counting scoped grants. A nil resolver accepts the role on any scope.
+func editorIn(resolve middleware.ScopeResolver, h http.HandlerFunc) http.HandlerFunc {
+	return middleware.AuthorizeFunc(auth.RoleEditor, resolve, h)
+}
+func adminIn(resolve middleware.ScopeResolver, h http.HandlerFunc) http.HandlerFunc {
+	return middleware.AuthorizeFunc(auth.RoleAdmin, resolve, h)
+}
+
 func setup(configLoader ConfigLoader, muxHandler MuxHandler, appComponentPtr *di.AppComponent) {
 	constants.InitRuntimeConstant()
 	configLoader.LoadEnv(new(config.Env))
 
+	// service guards a /api/service route with a service-client token carrying scope (see
+	// middleware.RequireServiceScope); the shared CMS_SERVICE_TOKEN still passes as a fallback.
+	service := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		return middleware.RequireServiceScopeFunc(appComponentPtr.ServiceClients, scope, h)
+	}
+
+	// audited records every request to a mutating route in the audit log (see middleware.Audit).
+	// It goes inside editor/admin so the actor is on the context.
+	audited := func(entityType, action string, h http.HandlerFunc) http.HandlerFunc {
+		return middleware.AuditFunc(appComponentPtr.AuditLog, entityType, action, h)
+	}
+
 	muxHandler.Handle("/web/", appComponentPtr.CssPathHandler)
 
 	muxHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -89,21 +125,60 @@ func setup(configLoader ConfigLoader, muxHandler MuxHandler, appComponentPtr *di
 
 	loginHandler := appComponentPtr.LoginHandler
 	muxHandler.HandleFunc("/login", loginHandler.Login)
-	muxHandler.HandleFunc("/logout", loginHandler.Logout)
-	muxHandler.HandleFunc("/auth/google/start", loginHandler.StartGoogleAuth)
-	muxHandler.HandleFunc("/auth/google/callback", loginHandler.GoogleCallback)
+	muxHandler.HandleFunc("POST /logout", loginHandler.Logout)
+	muxHandler.HandleFunc("/auth/{provider}/start", loginHandler.StartOIDC)
+	muxHandler.HandleFunc("/auth/{provider}/callback", loginHandler.OIDCCallback)
 	// Dev-only bypass — guarded inside the handler by DEV_LOGIN_EMAIL being unset.
-	muxHandler.HandleFunc("/dev-login", loginHandler.DevLogin)
+	muxHandler.HandleFunc("POST /dev-login", loginHandler.DevLogin)
+	muxHandler.HandleFunc("/reauth-done", loginHandler.ReauthDone)
+	muxHandler.HandleFunc("/session/status", loginHandler.SessionStatus)
+
+	// Profile and personal access tokens, for every signed-in user
+	profile := appComponentPtr.ProfileHandler
+	muxHandler.HandleFunc("/profile", profile.Show)
+	muxHandler.HandleFunc("POST /profile/tokens", audited("personal_token", "create", profile.CreateToken))
+	muxHandler.HandleFunc("POST /profile/tokens/revoke", audited("personal_token", "revoke", profile.RevokeToken))
+	muxHandler.Handle("/profile/tokens/uses", middleware.RequireHTMX(http.HandlerFunc(profile.TokenUses)))
 
 	muxHandler.HandleFunc("/home", handlers.GenericHandler)
-	muxHandler.HandleFunc("/add-chapter", admin(handlers.GenericHandler))
+	muxHandler.HandleFunc("/add-chapter", adminIn(nil, handlers.GenericHandler))
 
 	// Admin user management
 	adminUsers := appComponentPtr.AdminUsersHandler
 	muxHandler.HandleFunc("/admin/users", admin(adminUsers.List))
-	muxHandler.HandleFunc("/admin/users/create", admin(adminUsers.Create))
-	muxHandler.HandleFunc("/admin/users/active", admin(adminUsers.SetActive))
-	muxHandler.HandleFunc("/admin/users/role", admin(adminUsers.UpdateRole))
+	muxHandler.HandleFunc("POST /admin/users/create", admin(audited("user", "create", adminUsers.Create)))
+	muxHandler.HandleFunc("POST /admin/users/import/preview", admin(adminUsers.ImportPreview))
+	muxHandler.HandleFunc("POST /admin/users/import", admin(audited("user", "import", adminUsers.Import)))
+	muxHandler.HandleFunc("POST /admin/users/active", admin(audited("user", "set-active", adminUsers.SetActive)))
+	muxHandler.HandleFunc("POST /admin/users/role", admin(audited("user", "update-role", adminUsers.UpdateRole)))
+	muxHandler.Handle("/admin/users/grants", middleware.RequireHTMX(admin(adminUsers.Grants)))
+	muxHandler.HandleFunc("POST /admin/users/grants/create", admin(audited("user", "grant", adminUsers.CreateGrant)))
+	muxHandler.HandleFunc("POST /admin/users/grants/delete", admin(audited("user", "revoke-grant", adminUsers.DeleteGrant)))
+	muxHandler.Handle("/admin/users/sessions", middleware.RequireHTMX(admin(adminUsers.Sessions)))
+	muxHandler.HandleFunc("POST /admin/users/sessions/revoke", admin(audited("user", "revoke-session", adminUsers.RevokeSession)))
+
+	duplicatesHandler := appComponentPtr.DuplicatesHandler
+	muxHandler.HandleFunc("/admin/duplicates", admin(duplicatesHandler.Report))
+	muxHandler.HandleFunc("POST /admin/duplicates/rebuild", admin(audited("problem", "rebuild-fingerprints", duplicatesHandler.Rebuild)))
+
+	exposureHandler := appComponentPtr.ExposureHandler
+	muxHandler.HandleFunc("/admin/exposure", admin(exposureHandler.Report))
+	muxHandler.HandleFunc("POST /admin/exposure/rebuild", admin(audited("test", "rebuild-exposure", exposureHandler.Rebuild)))
+	muxHandler.HandleFunc("/admin/audit", admin(appComponentPtr.AuditHandler.List))
+
+	serviceClients := appComponentPtr.ServiceClientsHandler
+	muxHandler.HandleFunc("/admin/service-clients", admin(serviceClients.List))
+	muxHandler.HandleFunc("POST /admin/service-clients/create", admin(audited("service_client", "create", serviceClients.Create)))
+	muxHandler.HandleFunc("POST /admin/service-clients/token", admin(audited("service_client", "issue-token", serviceClients.IssueToken)))
+	muxHandler.HandleFunc("POST /admin/service-clients/revoke-token", admin(audited("service_client", "revoke-token", serviceClients.RevokeToken)))
+	muxHandler.HandleFunc("POST /admin/service-clients/revoke", admin(audited("service_client", "revoke", serviceClients.Revoke)))
+
+	webhooks := appComponentPtr.WebhooksHandler
+	muxHandler.HandleFunc("/admin/webhooks", admin(webhooks.List))
+	muxHandler.Handle("GET /admin/webhooks/deliveries", middleware.RequireHTMX(admin(webhooks.Deliveries)))
+	muxHandler.HandleFunc("POST /admin/webhooks/create", admin(audited("webhook", "create", webhooks.Create)))
+	muxHandler.HandleFunc("POST /admin/webhooks/disable", admin(audited("webhook", "disable", webhooks.Disable)))
+	muxHandler.HandleFunc("POST /admin/webhooks/replay", admin(audited("webhook", "replay", webhooks.Replay)))
 
 	chaptersHandler := appComponentPtr.ChaptersHandler
 	muxHandler.HandleFunc("/chapters", chaptersHandler.LoadChapters)
@@ -113,10 +188,10 @@ func setup(configLoader ConfigLoader, muxHandler MuxHandler, appComponentPtr *di
 	muxHandler.HandleFunc("/api/skills", appComponentPtr.SkillsHandler.GetSkills)
 
 	muxHandler.HandleFunc("/api/chapters", chaptersHandler.GetChapters)
-	muxHandler.Handle("/edit-chapter", middleware.RequireHTMX(middleware.RequireRole(auth.RoleAdmin, http.HandlerFunc(chaptersHandler.EditChapter))))
-	muxHandler.HandleFunc("/update-chapter", admin(chaptersHandler.UpdateChapter))
-	muxHandler.HandleFunc("/create-chapter", admin(chaptersHandler.AddChapter))
-	muxHandler.HandleFunc("/archive-chapter", admin(chaptersHandler.ArchiveChapter))
+	muxHandler.Handle("/edit-chapter", middleware.RequireHTMX(adminIn(chaptersHandler.ChapterScope, chaptersHandler.EditChapter)))
+	muxHandler.HandleFunc("PATCH /update-chapter", adminIn(chaptersHandler.ChapterScope, audited("chapter", "update", chaptersHandler.UpdateChapter)))
+	muxHandler.HandleFunc("POST /create-chapter", adminIn(chaptersHandler.ChapterScope, audited("chapter", "create", chaptersHandler.AddChapter)))
+	muxHandler.HandleFunc("DELETE /archive-chapter", adminIn(chaptersHandler.ChapterScope, audited("chapter", "archive", chaptersHandler.ArchiveChapter)))
 	muxHandler.HandleFunc("/chapter", chaptersHandler.GetChapter)
 	muxHandler.HandleFunc("/chapter/tests", chaptersHandler.LoadChapterTests)
 	muxHandler.HandleFunc("/topics", chaptersHandler.LoadTopics)
@@ -124,23 +199,23 @@ func setup(configLoader ConfigLoader, muxHandler MuxHandler, appComponentPtr *di
 	muxHandler.HandleFunc("/chapter/resources", chaptersHandler.LoadResources)
 
 	topicsHandler := appComponentPtr.TopicsHandler
-	muxHandler.HandleFunc("/add-topic", admin(topicsHandler.OpenAddTopic))
-	muxHandler.HandleFunc("/create-topic", admin(topicsHandler.AddTopic))
-	muxHandler.HandleFunc("/archive-topic", admin(topicsHandler.ArchiveTopic))
-	muxHandler.Handle("/edit-topic", middleware.RequireHTMX(middleware.RequireRole(auth.RoleAdmin, http.HandlerFunc(topicsHandler.EditTopic))))
-	muxHandler.HandleFunc("/update-topic", admin(topicsHandler.UpdateTopic))
+	muxHandler.HandleFunc("/add-topic", adminIn(topicsHandler.TopicScope, topicsHandler.OpenAddTopic))
+	muxHandler.HandleFunc("POST /create-topic", adminIn(topicsHandler.TopicScope, audited("topic", "create", topicsHandler.AddTopic)))
+	muxHandler.HandleFunc("DELETE /archive-topic", adminIn(topicsHandler.TopicScope, audited("topic", "archive", topicsHandler.ArchiveTopic)))
+	muxHandler.Handle("/edit-topic", middleware.RequireHTMX(adminIn(topicsHandler.TopicScope, topicsHandler.EditTopic)))
+	muxHandler.HandleFunc("PATCH /update-topic", adminIn(topicsHandler.TopicScope, audited("topic", "update", topicsHandler.UpdateTopic)))
 	muxHandler.HandleFunc("/topic", topicsHandler.GetTopic)
 	muxHandler.HandleFunc("/topic/resources", topicsHandler.LoadResources)
 
 	resourcesHandler := appComponentPtr.ResourcesHandler
 	muxHandler.HandleFunc("/add-resource", admin(resourcesHandler.OpenAddResource))
-	muxHandler.HandleFunc("/create-resource", admin(resourcesHandler.AddResource))
+	muxHandler.HandleFunc("POST /create-resource", admin(audited("resource", "create", resourcesHandler.AddResource)))
 	muxHandler.HandleFunc("/api/resources", resourcesHandler.GetResources)
 	muxHandler.Handle("/edit-resource", middleware.RequireHTMX(middleware.RequireRole(auth.RoleAdmin, http.HandlerFunc(resourcesHandler.EditResource))))
-	muxHandler.HandleFunc("/update-resource", admin(resourcesHandler.UpdateResource))
-	muxHandler.HandleFunc("/delete-resource", admin(resourcesHandler.DeleteResource))
-	muxHandler.HandleFunc("/resources/move-resource", editor(resourcesHandler.LoadMoveResources))
-	muxHandler.HandleFunc("/move-resource", editor(resourcesHandler.MoveResource))
+	muxHandler.HandleFunc("PATCH /update-resource", admin(audited("resource", "update", resourcesHandler.UpdateResource)))
+	muxHandler.HandleFunc("DELETE /delete-resource", admin(audited("resource", "delete", resourcesHandler.DeleteResource)))
+	muxHandler.HandleFunc("/resources/move-resource", editorIn(resourcesHandler.MoveResourcesScope, resourcesHandler.LoadMoveResources))
+	muxHandler.HandleFunc("POST /move-resource", editorIn(resourcesHandler.MoveResourcesScope, audited("resource", "move", resourcesHandler.MoveResource)))
 
 	conceptsHandler := appComponentPtr.ConceptsHandler
 	muxHandler.HandleFunc("/api/concepts", conceptsHandler.GetConcepts)
@@ -157,44 +232,96 @@ func setup(configLoader ConfigLoader, muxHandler MuxHandler, appComponentPtr *di
 	muxHandler.HandleFunc("/api/test/subjectwise-problems", testsHandler.GetSubjectwiseTestProblems)
 	muxHandler.HandleFunc("/tests/add-test", editor(testsHandler.AddTest))
 	muxHandler.HandleFunc("/add-question-to-test", editor(testsHandler.AddQuestionToTest))
-	muxHandler.HandleFunc("/create-test", editor(testsHandler.CreateTest))
-	muxHandler.HandleFunc("/tests/edit-test", editor(testsHandler.EditTest))
+	muxHandler.HandleFunc("POST /create-test", editorIn(testsHandler.TestScope, audited("test", "create", testsHandler.CreateTest)))
+	muxHandler.HandleFunc("/tests/edit-test", editorIn(testsHandler.TestScope, testsHandler.EditTest))
 	muxHandler.Handle("/tests/add-test-dialog", middleware.RequireHTMX(middleware.RequireRole(auth.RoleEditor, http.HandlerFunc(testsHandler.AddTestModal))))
 	muxHandler.HandleFunc("/add-curriculum-grade-selects", editor(testsHandler.AddCurriculumGradeDropdowns))
-	muxHandler.HandleFunc("/update-test", editor(testsHandler.UpdateTest))
-	muxHandler.HandleFunc("/update-test-subject", editor(testsHandler.UpdateTestSubject))
-	muxHandler.HandleFunc("/archive-test", admin(testsHandler.ArchiveTest))
+	muxHandler.HandleFunc("PATCH /update-test", editorIn(testsHandler.TestScope, audited("test", "update", testsHandler.UpdateTest)))
+	muxHandler.HandleFunc("PATCH /update-test-subject", editorIn(testsHandler.TestScope, audited("test", "update-subject", testsHandler.UpdateTestSubject)))
+	muxHandler.Handle("/tests/history", middleware.RequireHTMX(http.HandlerFunc(testsHandler.GetTestHistory)))
+	muxHandler.Handle("/tests/history/diff", middleware.RequireHTMX(http.HandlerFunc(testsHandler.GetTestVersionDiff)))
+	muxHandler.HandleFunc("POST /tests/restore", editorIn(testsHandler.RestoreTestScope, audited("test", "restore", testsHandler.RestoreTest)))
+	muxHandler.HandleFunc("DELETE /archive-test", adminIn(testsHandler.TestScope, audited("test", "archive", testsHandler.ArchiveTest)))
 	muxHandler.HandleFunc("/download-pdf", testsHandler.DownloadPdf)
 	muxHandler.HandleFunc("/tests/copy-test", editor(testsHandler.CopyTest))
 	muxHandler.HandleFunc("/tests/validate-test", testsHandler.ValidateTest)
+	// Student-mode preview; grading it saves nothing, so any signed-in user may.
+	muxHandler.HandleFunc("GET /tests/preview", testsHandler.PreviewTest)
+	muxHandler.Handle("POST /tests/preview/grade", middleware.RequireHTMX(http.HandlerFunc(testsHandler.GradePreview)))
+	muxHandler.Handle("GET /tests/analytics", middleware.RequireHTMX(http.HandlerFunc(testsHandler.GetTestAnalytics)))
+	muxHandler.HandleFunc("GET /tests/analytics.json", testsHandler.GetTestAnalyticsJSON)
 
 	// Service-to-service JSON APIs for session creation (af_lms, quiz-creator). Guarded by
-	// CMS_SERVICE_TOKEN (bearer), not the Google-OIDC session — so they are also listed in
-	// RequireLogin's exceptions in main().
-	muxHandler.HandleFunc("/api/service/tests", middleware.RequireServiceTokenFunc(testsHandler.GetTestsJSON))
-	muxHandler.HandleFunc("/api/service/test", middleware.RequireServiceTokenFunc(testsHandler.GetAssembledTestJSON))
+	// service-client bearer tokens (see /admin/service-clients), not the Google-OIDC session — so they
+	// are also listed in RequireLogin's exceptions in main(). They serve published tests only unless
+	// include_unpublished=true.
+	muxHandler.HandleFunc("/api/service/tests", service(auth.ScopeTestsRead, testsHandler.GetTestsJSON))
+	muxHandler.HandleFunc("/api/service/test", service(auth.ScopeTestsRead, testsHandler.GetAssembledTestJSON))
 	// Service PDF: the same generator behind /download-pdf (type=questions|questions_with_answers|answers),
-	// exposed under the service token so af_lms can offer question/answer PDFs on CMS sessions.
-	muxHandler.HandleFunc("/api/service/test-pdf", middleware.RequireServiceTokenFunc(testsHandler.DownloadPdf))
+	// exposed to service clients so af_lms can offer question/answer PDFs on CMS sessions.
+	muxHandler.HandleFunc("/api/service/test-pdf", service(auth.ScopePDFRender, testsHandler.DownloadServicePdf))
+	// Versioned service API: explicit response types (package serviceapi/v1) instead of the internal
+	// models the routes above encode, described by the OpenAPI document. New callers should use these.
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/tests", service(auth.ScopeTestsRead, testsHandler.GetTestsV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/tests/{id}", service(auth.ScopeTestsRead, testsHandler.GetAssembledTestV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/tests/{id}/grading-key", service(auth.ScopeTestsRead, testsHandler.GetGradingKeyV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/tests/{id}/pdf", service(auth.ScopePDFRender, testsHandler.DownloadPdfV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/openapi.json", handlers.GetServiceOpenAPI)
+	// The curriculum tree, for LMS practice features.
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/curriculums", service(auth.ScopeCurriculumRead, appComponentPtr.CurriculumsHandler.GetCurriculumsV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/grades", service(auth.ScopeCurriculumRead, appComponentPtr.GradesHandler.GetGradesV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/subjects", service(auth.ScopeCurriculumRead, appComponentPtr.SubjectsHandler.GetSubjectsV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/chapters", service(auth.ScopeCurriculumRead, appComponentPtr.ChaptersHandler.GetChaptersV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/concepts", service(auth.ScopeCurriculumRead, appComponentPtr.ConceptsHandler.GetConceptsV1))
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/topics/{id}/problems", service(auth.ScopeCurriculumRead, appComponentPtr.ProblemsHandler.GetTopicProblemsV1))
+	// The change feed, for incremental sync.
+	muxHandler.HandleFunc("GET "+servicev1.BasePath+"/changes", service(auth.ScopeChangesRead, appComponentPtr.ChangesHandler.GetChangesV1))
+	// Images of assembled tests fetched with images=url; public, like the login exception says.
+	muxHandler.HandleFunc("GET /images/{hash}", appComponentPtr.ImagesHandler.Get)
 
 	problemsHandler := appComponentPtr.ProblemsHandler
 	muxHandler.HandleFunc("/problems", problemsHandler.LoadProblems)
 	muxHandler.HandleFunc("/problem", problemsHandler.GetProblem)
 	muxHandler.HandleFunc("/api/topic/problems", problemsHandler.GetTopicProblems)
 	muxHandler.HandleFunc("/topic/problems", problemsHandler.LoadTopicProblems)
-	muxHandler.HandleFunc("/topic/add-problem", editor(problemsHandler.AddProblem))
-	muxHandler.HandleFunc("/topic/copy-problem", editor(problemsHandler.CopyProblem))
+	muxHandler.HandleFunc("/topic/add-problem", editorIn(problemsHandler.ProblemScope, problemsHandler.AddProblem))
+	muxHandler.HandleFunc("/topic/copy-problem", editorIn(problemsHandler.CopyProblemScope, problemsHandler.CopyProblem))
 	muxHandler.Handle("/topic/copy-problem-dialog", middleware.RequireHTMX(middleware.RequireRole(auth.RoleEditor, http.HandlerFunc(problemsHandler.LoadCopyProblemDialog))))
 	muxHandler.HandleFunc("/topic/add-problem/add-concept-dialog", editor(problemsHandler.AddConceptModal))
-	muxHandler.HandleFunc("/create-problem", editor(problemsHandler.CreateProblem))
-	muxHandler.HandleFunc("/create-problems", editor(problemsHandler.CreateProblems))
-	muxHandler.HandleFunc("/problems/edit-problem", editor(problemsHandler.EditProblem))
-	muxHandler.HandleFunc("/update-problem", editor(problemsHandler.UpdateProblem))
-	muxHandler.HandleFunc("/archive-problem", editor(problemsHandler.ArchiveProblem))
+	muxHandler.HandleFunc("POST /create-problem", editorIn(problemsHandler.ProblemScope, audited("problem", "create", problemsHandler.CreateProblem)))
+	muxHandler.HandleFunc("POST /create-problems", editorIn(problemsHandler.ProblemScope, audited("problem", "create-batch", problemsHandler.CreateProblems)))
+	muxHandler.HandleFunc("/problems/edit-problem", editorIn(problemsHandler.ProblemScope, problemsHandler.EditProblem))
+	muxHandler.HandleFunc("PATCH /update-problem", editorIn(problemsHandler.ProblemScope, audited("problem", "update", problemsHandler.UpdateProblem)))
+	muxHandler.HandleFunc("POST /problems/check-duplicates", editor(problemsHandler.CheckDuplicates))
+	muxHandler.Handle("/problems/history", middleware.RequireHTMX(http.HandlerFunc(problemsHandler.GetProblemHistory)))
+	muxHandler.Handle("/problems/history/diff", middleware.RequireHTMX(http.HandlerFunc(problemsHandler.GetProblemVersionDiff)))
+	muxHandler.HandleFunc("POST /problems/revert", editorIn(problemsHandler.RevertProblemScope, audited("problem", "revert", problemsHandler.RevertProblem)))
+	muxHandler.HandleFunc("DELETE /archive-problem", editorIn(problemsHandler.ProblemScope, audited("problem", "archive", problemsHandler.ArchiveProblem)))
 	muxHandler.HandleFunc("/api/search-problems", problemsHandler.GetSearchProblems)
 	muxHandler.HandleFunc("/problems/test-associations", problemsHandler.LoadTestAssociations)
-	muxHandler.HandleFunc("/problems/move-problems", editor(problemsHandler.LoadMoveProblems))
-	muxHandler.HandleFunc("/move-problems", editor(problemsHandler.MoveProblems))
+	muxHandler.HandleFunc("/problems/move-problems", editorIn(problemsHandler.MoveProblemsScope, problemsHandler.LoadMoveProblems))
+	muxHandler.HandleFunc("POST /move-problems", editorIn(problemsHandler.MoveProblemsScope, audited("problem", "move", problemsHandler.MoveProblems)))
+
+	// Review workflow for tests and problems; which transitions a role may make is checked per
+	// action inside the handler.
+	reviewHandler := appComponentPtr.ReviewHandler
+	muxHandler.Handle("/review", middleware.RequireHTMX(http.HandlerFunc(reviewHandler.GetReview)))
+	muxHandler.HandleFunc("POST /review/transition", editorIn(reviewHandler.ReviewScope, audited("review", "transition", reviewHandler.Transition)))
+	muxHandler.HandleFunc("POST /review/comment", editorIn(reviewHandler.ReviewScope, audited("review", "comment", reviewHandler.AddComment)))
+
+	// Review comment threads anchored to problem fields
+	commentsHandler := appComponentPtr.CommentsHandler
+	muxHandler.Handle("/problems/comments", middleware.RequireHTMX(http.HandlerFunc(commentsHandler.GetProblemComments)))
+	muxHandler.HandleFunc("POST /problems/comments/create", editorIn(problemsHandler.ProblemScope, audited("problem", "comment", commentsHandler.CreateThread)))
+	muxHandler.HandleFunc("POST /problems/comments/reply", editorIn(commentsHandler.ThreadScope, audited("problem", "comment-reply", commentsHandler.Reply)))
+	muxHandler.HandleFunc("POST /problems/comments/status", editorIn(commentsHandler.ThreadScope, audited("problem", "comment-status", commentsHandler.SetThreadStatus)))
+	muxHandler.HandleFunc("/comments/inbox", commentsHandler.Inbox)
+
+	// Soft "X is editing this" locks on the test and problem edit screens. Not audited: they are
+	// presence heartbeats, not content changes.
+	editLockHandler := appComponentPtr.EditLockHandler
+	muxHandler.HandleFunc("POST /edit-lock/heartbeat", editor(editLockHandler.Heartbeat))
+	muxHandler.HandleFunc("POST /edit-lock/release", editor(editLockHandler.Release))
 
 	tagsHandler := appComponentPtr.TagsHandler
 	muxHandler.HandleFunc("/api/tags", tagsHandler.GetTags)
@@ -78,17 +78,17 @@ func TestSetup(t *testing.T) {
 		{"/api/subjects", http.HandlerFunc(appComponentPtr.SubjectsHandler.GetSubjects)},
 		{"/api/chapters", http.HandlerFunc(chaptersHandler.GetChapters)},
 		{"/edit-chapter", middleware.RequireHTMX(http.HandlerFunc(chaptersHandler.EditChapter))},
-		{"/update-chapter", http.HandlerFunc(chaptersHandler.UpdateChapter)},
-		{"/create-chapter", http.HandlerFunc(chaptersHandler.AddChapter)},
-		{"/archive-chapter", http.HandlerFunc(chaptersHandler.ArchiveChapter)},
+		{"PATCH /update-chapter", http.HandlerFunc(chaptersHandler.UpdateChapter)},
+		{"POST /create-chapter", http.HandlerFunc(chaptersHandler.AddChapter)},
+		{"DELETE /archive-chapter", http.HandlerFunc(chaptersHandler.ArchiveChapter)},
 		{"/chapter", http.HandlerFunc(chaptersHandler.GetChapter)},
 		{"/topics", http.HandlerFunc(chaptersHandler.LoadTopics)},
 		{"/api/topics", http.HandlerFunc(chaptersHandler.GetTopics)},
 		{"/add-topic", http.HandlerFunc(topicsHandler.OpenAddTopic)},
-		{"/create-topic", http.HandlerFunc(topicsHandler.AddTopic)},
-		{"/archive-topic", http.HandlerFunc(topicsHandler.ArchiveTopic)},
+		{"POST /create-topic", http.HandlerFunc(topicsHandler.AddTopic)},
+		{"DELETE /archive-topic", http.HandlerFunc(topicsHandler.ArchiveTopic)},
 		{"/edit-topic", middleware.RequireHTMX(http.HandlerFunc(topicsHandler.EditTopic))},
-		{"/update-topic", http.HandlerFunc(topicsHandler.UpdateTopic)},
+		{"PATCH /update-topic", http.HandlerFunc(topicsHandler.UpdateTopic)},
 	}
 
 	setup(mockConfig, mockServeMux, appComponentPtr)
@@ -7,31 +7,51 @@ import (
 	"time"
 
 	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/changelog"
 	"github.com/avantifellows/nex-gen-cms/internal/handlers"
 	"github.com/avantifellows/nex-gen-cms/internal/models"
 	pgrepo "github.com/avantifellows/nex-gen-cms/internal/repositories/db"
 	local_repo "github.com/avantifellows/nex-gen-cms/internal/repositories/local"
 	remote_repo "github.com/avantifellows/nex-gen-cms/internal/repositories/remote"
 	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/webhook"
 )
 
 type AppComponent struct {
-	DB                 *sql.DB
-	CssPathHandler     http.Handler
-	LoginHandler       *handlers.LoginHandler
-	AdminUsersHandler  *handlers.AdminUsersHandler
-	ChaptersHandler    *handlers.ChaptersHandler
-	ResourcesHandler   *handlers.ResourcesHandler
-	TopicsHandler      *handlers.TopicsHandler
-	ConceptsHandler    *handlers.ConceptsHandler
-	CurriculumsHandler *handlers.CurriculumsHandler
-	GradesHandler      *handlers.GradesHandler
-	SubjectsHandler    *handlers.SubjectsHandler
-	SkillsHandler      *handlers.SkillsHandler
-	TestsHandler       *handlers.TestsHandler
-	ProblemsHandler    *handlers.ProblemsHandler
-	TagsHandler        *handlers.TagsHandler
-	ExamsHandler       *handlers.ExamsHandler
+	DB                    *sql.DB
+	AuditLog              *pgrepo.AuditLogRepo
+	Grants                *pgrepo.UserGrantRepo
+	Sessions              *pgrepo.SessionRepo
+	PersonalTokens        *pgrepo.PersonalTokenRepo
+	ServiceClients        *pgrepo.ServiceClientRepo
+	WebhookWorker         *webhook.Worker
+	OIDCProviders         *auth.OIDCProviders
+	CssPathHandler        http.Handler
+	LoginHandler          *handlers.LoginHandler
+	AdminUsersHandler     *handlers.AdminUsersHandler
+	ChaptersHandler       *handlers.ChaptersHandler
+	ResourcesHandler      *handlers.ResourcesHandler
+	TopicsHandler         *handlers.TopicsHandler
+	ConceptsHandler       *handlers.ConceptsHandler
+	CurriculumsHandler    *handlers.CurriculumsHandler
+	GradesHandler         *handlers.GradesHandler
+	SubjectsHandler       *handlers.SubjectsHandler
+	SkillsHandler         *handlers.SkillsHandler
+	TestsHandler          *handlers.TestsHandler
+	ProblemsHandler       *handlers.ProblemsHandler
+	TagsHandler           *handlers.TagsHandler
+	ExamsHandler          *handlers.ExamsHandler
+	DuplicatesHandler     *handlers.DuplicatesHandler
+	ExposureHandler       *handlers.ExposureHandler
+	AuditHandler          *handlers.AuditHandler
+	ReviewHandler         *handlers.ReviewHandler
+	CommentsHandler       *handlers.CommentsHandler
+	EditLockHandler       *handlers.EditLockHandler
+	ServiceClientsHandler *handlers.ServiceClientsHandler
+	WebhooksHandler       *handlers.WebhooksHandler
+	ChangesHandler        *handlers.ChangesHandler
+	ImagesHandler         *handlers.ImagesHandler
+	ProfileHandler        *handlers.ProfileHandler
 }
 
 func NewAppComponent() (*AppComponent, error) {
@@ -41,11 +61,30 @@ func NewAppComponent() (*AppComponent, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := pgrepo.EnsureSchema(database); err != nil {
+		return nil, err
+	}
 	usersRepo := pgrepo.NewCmsUserRepo(database)
+	fingerprintsRepo := pgrepo.NewProblemFingerprintRepo(database)
+	problemVersionsRepo := pgrepo.NewProblemVersionRepo(database)
+	testVersionsRepo := pgrepo.NewTestVersionRepo(database)
+	auditLogRepo := pgrepo.NewAuditLogRepo(database)
+	reviewCommentsRepo := pgrepo.NewReviewCommentRepo(database)
+	commentsRepo := pgrepo.NewCommentRepo(database)
+	editLocksRepo := pgrepo.NewEditLockRepo(database)
+	grantsRepo := pgrepo.NewUserGrantRepo(database)
+	serviceClientsRepo := pgrepo.NewServiceClientRepo(database)
+	sessionsRepo := pgrepo.NewSessionRepo(database)
+	invitationsRepo := pgrepo.NewInvitationRepo(database)
+	personalTokensRepo := pgrepo.NewPersonalTokenRepo(database)
+	webhooksRepo := pgrepo.NewWebhookRepo(database)
+	changeLogRepo := pgrepo.NewChangeLogRepo(database)
+	imagesRepo := pgrepo.NewImageRepo(database)
+	exposuresRepo := pgrepo.NewProblemExposureRepo(database)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	googleAuth, err := auth.NewGoogleAuth(ctx)
+	oidcProviders, err := auth.NewOIDCProviders(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +107,24 @@ func NewAppComponent() (*AppComponent, error) {
 	testRulesService := services.NewService[models.TestRule](cacheRepo, apiRepo)
 	examsService := services.NewService[models.Exam](cacheRepo, apiRepo)
 
+	// Outbound webhooks: content writes queue events, the worker (started in main) delivers them.
+	webhookWorker := webhook.NewWorker(webhooksRepo)
+	notifier := webhook.NewNotifier(webhooksRepo, webhookWorker)
+	webhook.Watch(testsService, notifier, "test")
+	webhook.Watch(problemsService, notifier, "problem")
+	webhook.Watch(chaptersService, notifier, "chapter")
+
+	// Change feed: every content write is appended to cms_change_log for /api/service/v1/changes.
+	changelog.Watch(testsService, changeLogRepo, changelog.Test)
+	changelog.Watch(problemsService, changeLogRepo, changelog.Problem)
+	changelog.Watch(chaptersService, changeLogRepo, changelog.Chapter)
+	changelog.Watch(topicsService, changeLogRepo, changelog.Topic)
+	changelog.Watch(resourcesService, changeLogRepo, changelog.Resource)
+
 	cssPathHandler := http.StripPrefix("/web/", http.FileServer(http.Dir("./web")))
-	loginHandler := handlers.NewLoginHandler(googleAuth, usersRepo)
-	adminUsersHandler := handlers.NewAdminUsersHandler(usersRepo)
+	loginHandler := handlers.NewLoginHandler(oidcProviders, usersRepo, sessionsRepo, invitationsRepo)
+	adminUsersHandler := handlers.NewAdminUsersHandler(usersRepo, grantsRepo, sessionsRepo, invitationsRepo, oidcProviders,
+		curriculumsService, gradesService, subjectsService)
 	chaptersHandler := handlers.NewChaptersHandler(chaptersService, topicsService)
 	resourcesHandler := handlers.NewResourcesHandler(resourcesService)
 	topicsHandler := handlers.NewTopicsHandler(topicsService, chaptersService)
@@ -80,28 +134,58 @@ func NewAppComponent() (*AppComponent, error) {
 	subjectsHandler := handlers.NewSubjectsHandler(subjectsService)
 	skillsHandler := handlers.NewSkillsHandler(skillsService)
 	testsHandler := handlers.NewTestsHandler(testsService, subjectsService, problemsService, testRulesService,
-		curriculumsService, gradesService, examsService)
+		curriculumsService, gradesService, examsService, skillsService, topicsService, testVersionsRepo, imagesRepo,
+		exposuresRepo)
 	problemsHandler := handlers.NewProblemsHandler(problemsService, skillsService, subjectsService, topicsService,
-		chaptersService, tagsService)
+		chaptersService, tagsService, fingerprintsRepo, problemVersionsRepo, exposuresRepo)
 	tagsHandler := handlers.NewTagsHandler(tagsService)
 	examsHandler := handlers.NewExamsHandler(examsService)
+	duplicatesHandler := handlers.NewDuplicatesHandler(problemsService, subjectsService, fingerprintsRepo)
+	exposureHandler := handlers.NewExposureHandler(testsService, exposuresRepo)
+	auditHandler := handlers.NewAuditHandler(auditLogRepo)
+	reviewHandler := handlers.NewReviewHandler(testsService, problemsService, reviewCommentsRepo)
+	commentsHandler := handlers.NewCommentsHandler(commentsRepo, problemsService)
+	editLockHandler := handlers.NewEditLockHandler(editLocksRepo)
+	serviceClientsHandler := handlers.NewServiceClientsHandler(serviceClientsRepo)
+	webhooksHandler := handlers.NewWebhooksHandler(webhooksRepo)
+	changesHandler := handlers.NewChangesHandler(changeLogRepo)
+	imagesHandler := handlers.NewImagesHandler(imagesRepo)
+	profileHandler := handlers.NewProfileHandler(personalTokensRepo)
 
 	return &AppComponent{
-		DB:                 database,
-		CssPathHandler:     cssPathHandler,
-		LoginHandler:       loginHandler,
-		AdminUsersHandler:  adminUsersHandler,
-		ChaptersHandler:    chaptersHandler,
-		ResourcesHandler:   resourcesHandler,
-		TopicsHandler:      topicsHandler,
-		ConceptsHandler:    conceptsHandler,
-		CurriculumsHandler: curriculumsHandler,
-		GradesHandler:      gradesHandler,
-		SubjectsHandler:    subjectsHandler,
-		SkillsHandler:      skillsHandler,
-		TestsHandler:       testsHandler,
-		ProblemsHandler:    problemsHandler,
-		TagsHandler:        tagsHandler,
-		ExamsHandler:       examsHandler,
+		DB:                    database,
+		AuditLog:              auditLogRepo,
+		Grants:                grantsRepo,
+		Sessions:              sessionsRepo,
+		PersonalTokens:        personalTokensRepo,
+		ServiceClients:        serviceClientsRepo,
+		WebhookWorker:         webhookWorker,
+		OIDCProviders:         oidcProviders,
+		CssPathHandler:        cssPathHandler,
+		LoginHandler:          loginHandler,
+		AdminUsersHandler:     adminUsersHandler,
+		ChaptersHandler:       chaptersHandler,
+		ResourcesHandler:      resourcesHandler,
+		TopicsHandler:         topicsHandler,
+		ConceptsHandler:       conceptsHandler,
+		CurriculumsHandler:    curriculumsHandler,
+		GradesHandler:         gradesHandler,
+		SubjectsHandler:       subjectsHandler,
+		SkillsHandler:         skillsHandler,
+		TestsHandler:          testsHandler,
+		ProblemsHandler:       problemsHandler,
+		TagsHandler:           tagsHandler,
+		ExamsHandler:          examsHandler,
+		DuplicatesHandler:     duplicatesHandler,
+		ExposureHandler:       exposureHandler,
+		AuditHandler:          auditHandler,
+		ReviewHandler:         reviewHandler,
+		CommentsHandler:       commentsHandler,
+		EditLockHandler:       editLockHandler,
+		ServiceClientsHandler: serviceClientsHandler,
+		WebhooksHandler:       webhooksHandler,
+		ChangesHandler:        changesHandler,
+		ImagesHandler:         imagesHandler,
+		ProfileHandler:        profileHandler,
 	}, nil
 }
@@ -0,0 +1,263 @@
+// Package analytics reports how a test's problems spread over difficulty levels, skills, concepts,
+// chapters and topics, for the whole test and per subject and section, and compares each subject's
+// difficulty mix with the target in its test rule.
+//
+// A problem's difficulty is the level set on it in the test, else its own. Problems without a level
+// are counted as unrated and left out of the difficulty mix. Targets are compared as shares of the
+// rated problems, so a rule may give them as question counts or as percentages.
+package analytics
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Difficulty levels, as stored on problems.
+const (
+	Easy   = "easy"
+	Medium = "medium"
+	Hard   = "hard"
+)
+
+// Tolerance is how many percentage points a level's share may stray from its target before it is
+// flagged.
+const Tolerance = 10
+
+// Names resolves the IDs problems carry without a name. Missing entries leave Count.Name empty.
+type Names struct {
+	Skills map[int16]string
+	Topics map[int16]string
+}
+
+type Report struct {
+	TestID int `json:"test_id"`
+	Breakdown
+	Subjects []Subject `json:"subjects"`
+}
+
+type Subject struct {
+	SubjectID int8   `json:"subject_id"`
+	Name      string `json:"name"`
+	Breakdown
+	// Target is nil when the test rule sets no difficulty mix for the subject.
+	Target   []LevelTarget `json:"difficulty_target,omitempty"`
+	Sections []Section     `json:"sections"`
+}
+
+type Section struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Breakdown
+}
+
+// Breakdown counts the problems of a test, subject or section along each dimension. Count lists are
+// sorted by most problems first.
+type Breakdown struct {
+	Problems   int        `json:"problems"`
+	Difficulty Difficulty `json:"difficulty"`
+	Skills     []Count    `json:"skills"`
+	Concepts   []Count    `json:"concepts"`
+	Chapters   []Count    `json:"chapters"`
+	Topics     []Count    `json:"topics"`
+}
+
+type Difficulty struct {
+	Easy    int `json:"easy"`
+	Medium  int `json:"medium"`
+	Hard    int `json:"hard"`
+	Unrated int `json:"unrated"`
+}
+
+func (d Difficulty) rated() int {
+	return d.Easy + d.Medium + d.Hard
+}
+
+type Count struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Problems int    `json:"problems"`
+}
+
+// LevelTarget compares one difficulty level of a subject with its test rule. Shares are percentages,
+// rounded to one decimal.
+type LevelTarget struct {
+	Level       string  `json:"level"`
+	Target      int     `json:"target"`
+	TargetShare float64 `json:"target_share"`
+	Actual      int     `json:"actual"`
+	ActualShare float64 `json:"actual_share"`
+	// OffTarget is set when the shares differ by more than Tolerance points.
+	OffTarget bool `json:"off_target"`
+}
+
+// NewReport builds the report for test from its problems. rule may be nil.
+func NewReport(test *models.Test, problems []*models.Problem, rule *models.TestRule, names Names) Report {
+	byID := make(map[int]*models.Problem, len(problems))
+	for _, p := range problems {
+		byID[p.ID] = p
+	}
+
+	report := Report{TestID: test.ID}
+	total := newTally()
+	for _, s := range test.TypeParams.Subjects {
+		subjectTally := newTally()
+		subject := Subject{SubjectID: s.SubjectID, Name: s.Name}
+		for _, sec := range s.Sections {
+			sectionTally := newTally()
+			refs := slices.Clip(sec.Compulsory.Problems)
+			if sec.Optional != nil {
+				refs = append(refs, sec.Optional.Problems...)
+			}
+			for _, ref := range refs {
+				p := byID[ref.ID]
+				level := ref.DifficultyLevel
+				if level == "" && p != nil {
+					level = p.DifficultyLevel
+				}
+				for _, t := range []*tally{sectionTally, subjectTally, total} {
+					t.add(level, p, names)
+				}
+			}
+			subject.Sections = append(subject.Sections, Section{Type: sec.Type, Name: sec.Name,
+				Breakdown: sectionTally.breakdown()})
+		}
+		subject.Breakdown = subjectTally.breakdown()
+		subject.Target = compare(subject.Difficulty, subjectRule(rule, s.SubjectID))
+		report.Subjects = append(report.Subjects, subject)
+	}
+	report.Breakdown = total.breakdown()
+	return report
+}
+
+func subjectRule(rule *models.TestRule, subjectID int8) *models.Difficulty {
+	if rule == nil {
+		return nil
+	}
+	for _, s := range rule.Config.Subjects {
+		if s.SubjectID == subjectID {
+			return &s.Rules.Difficulty
+		}
+	}
+	return nil
+}
+
+// compare lines up actual against target level by level; nil when target sets no mix.
+func compare(actual Difficulty, target *models.Difficulty) []LevelTarget {
+	if target == nil || target.Easy+target.Medium+target.Hard <= 0 {
+		return nil
+	}
+	targetTotal, actualTotal := target.Easy+target.Medium+target.Hard, actual.rated()
+	share := func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return math.Round(float64(n)*1000/float64(total)) / 10
+	}
+	levels := []struct {
+		level          string
+		target, actual int
+	}{
+		{Easy, target.Easy, actual.Easy},
+		{Medium, target.Medium, actual.Medium},
+		{Hard, target.Hard, actual.Hard},
+	}
+	rows := make([]LevelTarget, 0, len(levels))
+	for _, l := range levels {
+		row := LevelTarget{Level: l.level, Target: l.target, TargetShare: share(l.target, targetTotal),
+			Actual: l.actual, ActualShare: share(l.actual, actualTotal)}
+		row.OffTarget = math.Abs(row.ActualShare-row.TargetShare) > Tolerance
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+type tally struct {
+	problems   int
+	difficulty Difficulty
+	skills     map[int]*Count
+	concepts   map[int]*Count
+	chapters   map[int]*Count
+	topics     map[int]*Count
+}
+
+func newTally() *tally {
+	return &tally{skills: map[int]*Count{}, concepts: map[int]*Count{}, chapters: map[int]*Count{},
+		topics: map[int]*Count{}}
+}
+
+// add counts one problem at level. p is nil for a problem that no longer exists, which counts only
+// towards the totals and its level.
+func (t *tally) add(level string, p *models.Problem, names Names) {
+	t.problems++
+	switch level {
+	case Easy:
+		t.difficulty.Easy++
+	case Medium:
+		t.difficulty.Medium++
+	case Hard:
+		t.difficulty.Hard++
+	default:
+		t.difficulty.Unrated++
+	}
+	if p == nil {
+		return
+	}
+	for _, id := range uniq(p.SkillIDs) {
+		bump(t.skills, int(id), names.Skills[id])
+	}
+	seen := map[int32]bool{}
+	for _, c := range p.Concepts {
+		if !seen[c.ID] {
+			seen[c.ID] = true
+			bump(t.concepts, int(c.ID), c.GetNameByLang("en"))
+		}
+	}
+	if p.ChapterID != 0 {
+		bump(t.chapters, int(p.ChapterID), p.GetChapterNameByLang("en"))
+	}
+	if p.TopicID != 0 {
+		bump(t.topics, int(p.TopicID), names.Topics[p.TopicID])
+	}
+}
+
+func bump(counts map[int]*Count, id int, name string) {
+	c, ok := counts[id]
+	if !ok {
+		c = &Count{ID: id}
+		counts[id] = c
+	}
+	if c.Name == "" {
+		c.Name = name
+	}
+	c.Problems++
+}
+
+func (t *tally) breakdown() Breakdown {
+	return Breakdown{
+		Problems:   t.problems,
+		Difficulty: t.difficulty,
+		Skills:     sorted(t.skills),
+		Concepts:   sorted(t.concepts),
+		Chapters:   sorted(t.chapters),
+		Topics:     sorted(t.topics),
+	}
+}
+
+// sorted lists counts by most problems, then name and ID, so reports are stable.
+func sorted(counts map[int]*Count) []Count {
+	list := make([]Count, 0, len(counts))
+	for _, c := range counts {
+		list = append(list, *c)
+	}
+	slices.SortFunc(list, func(a, b Count) int {
+		return cmp.Or(cmp.Compare(b.Problems, a.Problems), cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+	return list
+}
+
+func uniq(ids []int16) []int16 {
+	return slices.Compact(slices.Sorted(slices.Values(ids)))
+}
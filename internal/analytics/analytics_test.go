@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name   string
+		actual Difficulty
+		target *models.Difficulty
+		want   []LevelTarget
+	}{
+		{"no rule", Difficulty{Easy: 3}, nil, nil},
+		{"rule without a mix", Difficulty{Easy: 3}, &models.Difficulty{}, nil},
+		{"percentages on target", Difficulty{Easy: 3, Medium: 5, Hard: 2, Unrated: 4},
+			&models.Difficulty{Easy: 30, Medium: 50, Hard: 20}, []LevelTarget{
+				{Level: Easy, Target: 30, TargetShare: 30, Actual: 3, ActualShare: 30},
+				{Level: Medium, Target: 50, TargetShare: 50, Actual: 5, ActualShare: 50},
+				{Level: Hard, Target: 20, TargetShare: 20, Actual: 2, ActualShare: 20},
+			}},
+		{"counts off target", Difficulty{Easy: 1, Medium: 1, Hard: 1},
+			&models.Difficulty{Easy: 2, Medium: 1, Hard: 0}, []LevelTarget{
+				{Level: Easy, Target: 2, TargetShare: 66.7, Actual: 1, ActualShare: 33.3, OffTarget: true},
+				{Level: Medium, Target: 1, TargetShare: 33.3, Actual: 1, ActualShare: 33.3},
+				{Level: Hard, Target: 0, TargetShare: 0, Actual: 1, ActualShare: 33.3, OffTarget: true},
+			}},
+		{"nothing rated yet", Difficulty{Unrated: 2},
+			&models.Difficulty{Easy: 1, Medium: 1, Hard: 2}, []LevelTarget{
+				{Level: Easy, Target: 1, TargetShare: 25, OffTarget: true},
+				{Level: Medium, Target: 1, TargetShare: 25, OffTarget: true},
+				{Level: Hard, Target: 2, TargetShare: 50, OffTarget: true},
+			}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := compare(tc.actual, tc.target); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("compare =\n%+v\nwant\n%+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	test := &models.Test{
+		ID: 501,
+		TypeParams: models.ResTypeParams{Subjects: []models.ResSubject{
+			{SubjectID: 3, Name: "Physics", Sections: []models.ResSection{
+				{Type: "mcq_single_answer", Name: "A", Compulsory: models.ResCompulsory{Problems: []models.ResProblem{
+					{ID: 1}, {ID: 2, DifficultyLevel: Hard}, // the test's level wins over the problem's
+				}}},
+				{Type: "integer_type", Name: "B",
+					Compulsory: models.ResCompulsory{Problems: []models.ResProblem{{ID: 3}}},
+					Optional:   &models.ResOptional{MandatoryCount: 1, Problems: []models.ResProblem{{ID: 99}}}},
+			}},
+		}},
+	}
+	kinematics := []models.ChapterLang{{LangCode: "en", ChapterName: "Kinematics"}}
+	problems := []*models.Problem{
+		{ID: 1, DifficultyLevel: Easy, SkillIDs: []int16{7, 8, 7}, ChapterID: 10, ChapterName: kinematics,
+			TopicID: 100, Concepts: []models.Concept{{ID: 5, Name: []models.ConceptLang{{LangCode: "en", ConceptName: "Velocity"}}}}},
+		{ID: 2, DifficultyLevel: Easy, SkillIDs: []int16{7}, ChapterID: 10, ChapterName: kinematics, TopicID: 101},
+		{ID: 3, DifficultyLevel: Medium, ChapterID: 11, TopicID: 110},
+	}
+	rule := &models.TestRule{Config: models.Config{Subjects: []models.SubjectRule{
+		{SubjectID: 3, Rules: models.RuleDetails{Difficulty: models.Difficulty{Easy: 1, Medium: 1, Hard: 1}}},
+		{SubjectID: 4, Rules: models.RuleDetails{Difficulty: models.Difficulty{Easy: 1}}},
+	}}}
+	names := Names{Skills: map[int16]string{7: "Recall", 8: "Analysis"}, Topics: map[int16]string{100: "Speed"}}
+
+	sectionA := Breakdown{
+		Problems:   2,
+		Difficulty: Difficulty{Easy: 1, Hard: 1},
+		Skills:     []Count{{ID: 7, Name: "Recall", Problems: 2}, {ID: 8, Name: "Analysis", Problems: 1}},
+		Concepts:   []Count{{ID: 5, Name: "Velocity", Problems: 1}},
+		Chapters:   []Count{{ID: 10, Name: "Kinematics", Problems: 2}},
+		Topics:     []Count{{ID: 101, Problems: 1}, {ID: 100, Name: "Speed", Problems: 1}},
+	}
+	sectionB := Breakdown{
+		Problems:   2,
+		Difficulty: Difficulty{Medium: 1, Unrated: 1},
+		Skills:     []Count{},
+		Concepts:   []Count{},
+		Chapters:   []Count{{ID: 11, Problems: 1}},
+		Topics:     []Count{{ID: 110, Problems: 1}},
+	}
+	physics := Breakdown{
+		Problems:   4,
+		Difficulty: Difficulty{Easy: 1, Medium: 1, Hard: 1, Unrated: 1},
+		Skills:     sectionA.Skills,
+		Concepts:   sectionA.Concepts,
+		Chapters:   []Count{{ID: 10, Name: "Kinematics", Problems: 2}, {ID: 11, Problems: 1}},
+		Topics:     []Count{{ID: 101, Problems: 1}, {ID: 110, Problems: 1}, {ID: 100, Name: "Speed", Problems: 1}},
+	}
+	want := Report{
+		TestID:    501,
+		Breakdown: physics,
+		Subjects: []Subject{{
+			SubjectID: 3, Name: "Physics", Breakdown: physics,
+			Target: []LevelTarget{
+				{Level: Easy, Target: 1, TargetShare: 33.3, Actual: 1, ActualShare: 33.3},
+				{Level: Medium, Target: 1, TargetShare: 33.3, Actual: 1, ActualShare: 33.3},
+				{Level: Hard, Target: 1, TargetShare: 33.3, Actual: 1, ActualShare: 33.3},
+			},
+			Sections: []Section{
+				{Type: "mcq_single_answer", Name: "A", Breakdown: sectionA},
+				{Type: "integer_type", Name: "B", Breakdown: sectionB},
+			},
+		}},
+	}
+	if got := NewReport(test, problems, rule, names); !reflect.DeepEqual(got, want) {
+		t.Errorf("NewReport =\n%+v\nwant\n%+v", got, want)
+	}
+}
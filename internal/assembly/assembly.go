@@ -0,0 +1,180 @@
+// Package assembly shapes an assembled test (a test with its problems) for a service caller: one
+// language, text or Markdown instead of HTML, image URLs instead of inline base64, and no answers for
+// student-facing clients. The zero Options leave the test as the CMS holds it.
+//
+// The test and problems handed in usually come from the shared cache, so they are never modified;
+// Apply returns copies.
+package assembly
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/url"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/richtext"
+)
+
+// fallbackLang is served when a test or problem has no version in the requested language.
+const fallbackLang = "en"
+
+// Options are the query params of the assembled-test routes.
+type Options struct {
+	// Lang keeps only this language's versions, falling back to English. Empty keeps all.
+	Lang string
+	// Render is the format of rich-text fields.
+	Render richtext.Mode
+	// ImageURLs replaces inline base64 images with URLs served by the CMS.
+	ImageURLs bool
+	// OmitAnswers empties every problem's answers and solutions.
+	OmitAnswers bool
+}
+
+var ErrInvalidOptions = errors.New("render must be html, text or markdown and images inline or url")
+
+// ParseOptions reads lang, render (html, text or markdown), images (inline or url) and omit_answers.
+func ParseOptions(query url.Values) (Options, error) {
+	render, ok := richtext.ParseMode(query.Get("render"))
+	if !ok {
+		return Options{}, ErrInvalidOptions
+	}
+	opts := Options{Lang: query.Get("lang"), Render: render, OmitAnswers: query.Get("omit_answers") == "true"}
+	switch query.Get("images") {
+	case "", "inline":
+	case "url":
+		opts.ImageURLs = true
+	default:
+		return Options{}, ErrInvalidOptions
+	}
+	return opts, nil
+}
+
+// Images stores an image lifted out of the HTML and returns the URL it is served at.
+type Images interface {
+	Save(ctx context.Context, contentType string, data []byte) (url string, err error)
+}
+
+// Apply returns the test and problems shaped by opts. images is only used with ImageURLs.
+func Apply(ctx context.Context, test *models.Test, problems []*models.Problem, opts Options,
+	images Images) (*models.Test, []*models.Problem, error) {
+	if opts == (Options{Render: richtext.HTML}) || opts == (Options{}) {
+		return test, problems, nil
+	}
+	s := shaper{ctx: ctx, opts: opts, images: images}
+
+	t := *test
+	t.Name = pick(test.Name, opts.Lang, func(n models.ResName) string { return n.LangCode })
+	if opts.Lang != "" {
+		instructions := models.ResolveInstructions(test.TypeParams.Instructions, test.TypeParams.InstructionLangVersions,
+			opts.Lang)
+		lang := opts.Lang
+		if instructions == "" {
+			lang = fallbackLang
+			instructions = models.ResolveInstructions(test.TypeParams.Instructions,
+				test.TypeParams.InstructionLangVersions, lang)
+		}
+		t.TypeParams.InstructionLangVersions = nil
+		if instructions != "" {
+			t.TypeParams.InstructionLangVersions = []models.InstructionLangVersion{{LangCode: lang, Instructions: instructions}}
+		}
+		// the legacy field is English; it goes when another language was picked
+		if lang != fallbackLang {
+			t.TypeParams.Instructions = ""
+		}
+	}
+	t.TypeParams.Instructions = s.html(t.TypeParams.Instructions)
+	if versions := t.TypeParams.InstructionLangVersions; versions != nil {
+		t.TypeParams.InstructionLangVersions = make([]models.InstructionLangVersion, len(versions))
+		for i, v := range versions {
+			t.TypeParams.InstructionLangVersions[i] = models.InstructionLangVersion{LangCode: v.LangCode,
+				Instructions: s.html(v.Instructions)}
+		}
+	}
+
+	shaped := make([]*models.Problem, len(problems))
+	for i, p := range problems {
+		shaped[i] = s.problem(p)
+	}
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return &t, shaped, nil
+}
+
+// shaper converts fields one by one, keeping the first image-store error.
+type shaper struct {
+	ctx    context.Context
+	opts   Options
+	images Images
+	err    error
+}
+
+func (s *shaper) problem(p *models.Problem) *models.Problem {
+	shaped := *p
+	shaped.ChapterName = pick(p.ChapterName, s.opts.Lang, func(n models.ChapterLang) string { return n.LangCode })
+	if p.Paragraph != nil {
+		paragraph := *p.Paragraph
+		paragraph.Body = s.html(paragraph.Body)
+		shaped.Paragraph = &paragraph
+	}
+	// the top-level meta_data is the legacy English copy, which consumers (grading) fall back to
+	shaped.MetaData = s.metaData(p.MetaData)
+	if versions := pick(p.LangVersions, s.opts.Lang, func(v models.LangVersion) string { return v.LangCode }); versions != nil {
+		shaped.LangVersions = make([]models.LangVersion, len(versions))
+		for i, v := range versions {
+			shaped.LangVersions[i] = models.LangVersion{LangCode: v.LangCode, MetaData: s.metaData(v.MetaData)}
+		}
+	}
+	return &shaped
+}
+
+func (s *shaper) metaData(m models.ProbMetaData) models.ProbMetaData {
+	shaped := models.ProbMetaData{Question: s.html(m.Question), Answers: m.Answers}
+	if m.Options != nil {
+		shaped.Options = make([]template.HTML, len(m.Options))
+		for i, o := range m.Options {
+			shaped.Options[i] = s.html(o)
+		}
+	}
+	if s.opts.OmitAnswers {
+		shaped.Answers, shaped.Solutions = []string{}, []models.Solution{}
+		return shaped
+	}
+	if m.Solutions != nil {
+		shaped.Solutions = make([]models.Solution, len(m.Solutions))
+		for i, sol := range m.Solutions {
+			shaped.Solutions[i] = models.Solution{Type: sol.Type, Value: s.html(sol.Value)}
+		}
+	}
+	return shaped
+}
+
+// html converts one rich-text field: images first, so Markdown and text see their URLs.
+func (s *shaper) html(fragment template.HTML) template.HTML {
+	out := string(fragment)
+	if s.opts.ImageURLs && s.err == nil {
+		var err error
+		if out, err = richtext.ExtractImages(out, func(contentType string, data []byte) (string, error) {
+			return s.images.Save(s.ctx, contentType, data)
+		}); err != nil {
+			s.err = err
+		}
+	}
+	return template.HTML(richtext.Render(out, s.opts.Render))
+}
+
+// pick keeps the version in lang, else the English one, else the first. With lang empty it keeps all.
+func pick[T any](versions []T, lang string, code func(T) string) []T {
+	if lang == "" || len(versions) == 0 {
+		return versions
+	}
+	for _, want := range []string{lang, fallbackLang} {
+		for _, v := range versions {
+			if code(v) == want {
+				return []T{v}
+			}
+		}
+	}
+	return versions[:1]
+}
@@ -0,0 +1,188 @@
+package assembly
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/richtext"
+)
+
+var png = base64.StdEncoding.EncodeToString([]byte("png-bytes"))
+
+func fixture() (*models.Test, []*models.Problem) {
+	test := &models.Test{
+		ID:   1,
+		Name: []models.ResName{{LangCode: "en", Resource: "Kinematics"}, {LangCode: "hi", Resource: "गतिकी"}},
+		TypeParams: models.ResTypeParams{
+			Instructions: "<p>Read <b>carefully</b></p>",
+			InstructionLangVersions: []models.InstructionLangVersion{
+				{LangCode: "en", Instructions: "<p>Read <b>carefully</b></p>"},
+				{LangCode: "hi", Instructions: "<p>ध्यान से पढ़ें</p>"},
+			},
+		},
+	}
+	problems := []*models.Problem{{
+		ID:        10,
+		Paragraph: &models.ProblemParagraph{ID: 3, Body: `<p>A car <img src="data:image/png;base64,` + template.HTML(png) + `"></p>`},
+		MetaData: models.ProbMetaData{Question: "<p>Speed?</p>", Answers: []string{"0"},
+			Solutions: []models.Solution{{Type: "html", Value: "<p>Because</p>"}}},
+		LangVersions: []models.LangVersion{
+			{LangCode: "en", MetaData: models.ProbMetaData{Question: "<p>Speed?</p>", Options: []template.HTML{"<i>1</i>", "2"},
+				Answers: []string{"0"}, Solutions: []models.Solution{{Type: "html", Value: "<p>Because</p>"}}}},
+			{LangCode: "hi", MetaData: models.ProbMetaData{Question: "<p>गति?</p>", Answers: []string{"0"}}},
+		},
+	}, {
+		ID:           11,
+		LangVersions: []models.LangVersion{{LangCode: "en", MetaData: models.ProbMetaData{Question: "Only English"}}},
+	}}
+	return test, problems
+}
+
+type fakeImages struct{ saved int }
+
+func (f *fakeImages) Save(ctx context.Context, contentType string, data []byte) (string, error) {
+	f.saved++
+	return "https://cms.example.org/images/" + contentType, nil
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    Options
+		wantErr bool
+	}{
+		{"", Options{Render: richtext.HTML}, false},
+		{"lang=hi&render=markdown&images=url&omit_answers=true",
+			Options{Lang: "hi", Render: richtext.Markdown, ImageURLs: true, OmitAnswers: true}, false},
+		{"images=inline&render=text", Options{Render: richtext.Text}, false},
+		{"render=pdf", Options{}, true},
+		{"images=base64", Options{}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tc.query)
+			got, err := ParseOptions(query)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("ParseOptions = %+v, %v; want %+v, error %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyDefaultIsUnchanged(t *testing.T) {
+	test, problems := fixture()
+	gotTest, gotProblems, err := Apply(context.Background(), test, problems, Options{Render: richtext.HTML}, nil)
+	if err != nil || gotTest != test || !reflect.DeepEqual(gotProblems, problems) {
+		t.Errorf("default options changed the test: %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		check func(t *testing.T, test *models.Test, problems []*models.Problem, images *fakeImages)
+	}{
+		{"lang picks one version", Options{Lang: "hi", Render: richtext.HTML},
+			func(t *testing.T, test *models.Test, problems []*models.Problem, _ *fakeImages) {
+				if len(test.Name) != 1 || test.Name[0].LangCode != "hi" {
+					t.Errorf("name = %v", test.Name)
+				}
+				iv := test.TypeParams.InstructionLangVersions
+				if len(iv) != 1 || iv[0].LangCode != "hi" || test.TypeParams.Instructions != "" {
+					t.Errorf("instructions = %q, %v", test.TypeParams.Instructions, iv)
+				}
+				if lv := problems[0].LangVersions; len(lv) != 1 || lv[0].LangCode != "hi" {
+					t.Errorf("problem 10 versions = %v", lv)
+				}
+			}},
+		{"missing lang falls back to English", Options{Lang: "mr", Render: richtext.HTML},
+			func(t *testing.T, test *models.Test, problems []*models.Problem, _ *fakeImages) {
+				if test.Name[0].LangCode != "en" || test.TypeParams.InstructionLangVersions[0].LangCode != "en" {
+					t.Errorf("test = %v, %v", test.Name, test.TypeParams.InstructionLangVersions)
+				}
+				if test.TypeParams.Instructions == "" {
+					t.Error("legacy English instructions dropped")
+				}
+				if lv := problems[1].LangVersions; len(lv) != 1 || lv[0].MetaData.Question != "Only English" {
+					t.Errorf("problem 11 versions = %v", lv)
+				}
+			}},
+		{"text render", Options{Render: richtext.Text},
+			func(t *testing.T, test *models.Test, problems []*models.Problem, _ *fakeImages) {
+				if test.TypeParams.Instructions != "Read carefully" {
+					t.Errorf("instructions = %q", test.TypeParams.Instructions)
+				}
+				md := problems[0].LangVersions[0].MetaData
+				if md.Question != "Speed?" || md.Options[0] != "1" || md.Solutions[0].Value != "Because" {
+					t.Errorf("meta data = %+v", md)
+				}
+				if md := problems[0].MetaData; md.Question != "Speed?" || md.Solutions[0].Value != "Because" {
+					t.Errorf("top-level meta data = %+v", md)
+				}
+				if problems[0].Paragraph.Body != "A car [image]" {
+					t.Errorf("paragraph = %q", problems[0].Paragraph.Body)
+				}
+			}},
+		{"image urls in markdown", Options{Render: richtext.Markdown, ImageURLs: true},
+			func(t *testing.T, _ *models.Test, problems []*models.Problem, images *fakeImages) {
+				if got := problems[0].Paragraph.Body; got != "A car ![](https://cms.example.org/images/image/png)" {
+					t.Errorf("paragraph = %q", got)
+				}
+				if images.saved != 1 {
+					t.Errorf("saved %d images, want 1", images.saved)
+				}
+			}},
+		{"omit answers", Options{Render: richtext.HTML, OmitAnswers: true},
+			func(t *testing.T, _ *models.Test, problems []*models.Problem, _ *fakeImages) {
+				for _, v := range problems[0].LangVersions {
+					if v.MetaData.Answers == nil || len(v.MetaData.Answers) != 0 || len(v.MetaData.Solutions) != 0 {
+						t.Errorf("%s still has answers: %+v", v.LangCode, v.MetaData)
+					}
+				}
+				if md := problems[0].MetaData; len(md.Answers) != 0 || len(md.Solutions) != 0 {
+					t.Errorf("top-level meta data still has answers: %+v", md)
+				}
+				if problems[0].LangVersions[0].MetaData.Question != "<p>Speed?</p>" {
+					t.Error("question changed")
+				}
+			}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test, problems := fixture()
+			wantTest, wantProblems := fixture()
+			images := &fakeImages{}
+			gotTest, gotProblems, err := Apply(context.Background(), test, problems, tc.opts, images)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, gotTest, gotProblems, images)
+			// the inputs are the cached copies; they must come out untouched
+			if !reflect.DeepEqual(test, wantTest) || !reflect.DeepEqual(problems, wantProblems) {
+				t.Error("Apply modified its input")
+			}
+		})
+	}
+}
+
+type failingImages struct{}
+
+func (failingImages) Save(context.Context, string, []byte) (string, error) {
+	return "", errors.New("db down")
+}
+
+func TestApplyImageError(t *testing.T) {
+	test, problems := fixture()
+	if _, _, err := Apply(context.Background(), test, problems, Options{Render: richtext.HTML, ImageURLs: true},
+		failingImages{}); err == nil {
+		t.Error("Apply = nil error, want the image store's")
+	}
+}
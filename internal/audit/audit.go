@@ -0,0 +1,84 @@
+// Package audit carries the audit entry of a mutating request through its context, so that
+// handlers can attach the entity they touched and its state before and after the change. The
+// entry itself is written by middleware.Audit once the handler returns.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// RequestIDHeader is read from incoming requests (so a proxy's ID is kept) and echoed on responses.
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey struct{}
+
+var entryKey ctxKey
+
+// WithEntry returns a context carrying the audit entry of the current request.
+func WithEntry(ctx context.Context, e *models.AuditEntry) context.Context {
+	return context.WithValue(ctx, entryKey, e)
+}
+
+// FromContext returns the audit entry attached to ctx, or nil on routes that are not audited.
+func FromContext(ctx context.Context) *models.AuditEntry {
+	e, _ := ctx.Value(entryKey).(*models.AuditEntry)
+	return e
+}
+
+// SetEntity overrides the entity ID taken from the request, e.g. with the ID of a created object.
+func SetEntity(ctx context.Context, entityID any) {
+	if e := FromContext(ctx); e != nil {
+		e.EntityID = fmt.Sprint(entityID)
+	}
+}
+
+// SetEntityType overrides the route's entity type, for routes that act on several kinds of entity.
+func SetEntityType(ctx context.Context, entityType string) {
+	if e := FromContext(ctx); e != nil {
+		e.EntityType = entityType
+	}
+}
+
+// SetBefore records the entity's state before the change. v is marshalled straight away, so
+// callers may go on to modify it.
+func SetBefore(ctx context.Context, v any) {
+	if e := FromContext(ctx); e != nil {
+		e.Before = Payload(v)
+	}
+}
+
+// SetAfter records the entity's state after the change, replacing the request payload the
+// middleware records by default.
+func SetAfter(ctx context.Context, v any) {
+	if e := FromContext(ctx); e != nil {
+		e.After = Payload(v)
+	}
+}
+
+// Payload marshals v for an audit entry. Values that can't be marshalled are recorded as null
+// rather than failing the request.
+func Payload(v any) json.RawMessage {
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// NewRequestID returns a random 16-byte hex ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	// CSRFCookieName is a non-HttpOnly copy of the session's CSRF token that home.html sends back in
+	// CSRFHeader. A cross-site page can make the browser send cookies but can't read them.
+	CSRFCookieName = "cms_csrf"
+	CSRFHeader     = "X-CSRF-Token"
+	// CSRFFormField carries the token where no header can be set, e.g. navigator.sendBeacon.
+	CSRFFormField = "csrf_token"
+)
+
+// CSRFToken derives a session's CSRF token from its session ID, so it needs no storage and changes
+// with every sign-in.
+func CSRFToken(claims *SessionClaims) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte("csrf:" + claims.ID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidCSRFToken reports whether got is the CSRF token of the session.
+func ValidCSRFToken(claims *SessionClaims, got string) bool {
+	if got == "" || claims.ID == "" {
+		return false
+	}
+	return hmac.Equal([]byte(got), []byte(CSRFToken(claims)))
+}
+
+// SetCSRFCookie sets the JS-readable copy of the session's CSRF token.
+func SetCSRFCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionMaxAge.Seconds()),
+		HttpOnly: false,
+		Secure:   isSecureCookie(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
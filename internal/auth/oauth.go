@@ -4,9 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
@@ -15,56 +19,113 @@ import (
 )
 
 const (
+	googleProviderID    = "google"
 	googleIssuer        = "https://accounts.google.com"
 	allowedHostedDomain = "avantifellows.org"
 	oauthStateCookie    = "cms_oauth_state"
 )
 
-// GoogleAuth bundles the OIDC provider + OAuth2 config for Google sign-in.
-type GoogleAuth struct {
-	provider *oidc.Provider
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// ProviderConfig describes one OIDC identity provider users can sign in with. Extra providers come
+// from OIDC_PROVIDERS, a JSON array of these; Google is configured from GOOGLE_* as before.
+type ProviderConfig struct {
+	// ID names the provider in its routes: /auth/{id}/start and /auth/{id}/callback.
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURL  string `json:"redirect_url"`
+	// AllowedDomains are the email domains accepted from this provider. Required.
+	AllowedDomains []string     `json:"allowed_domains"`
+	Claims         ClaimMapping `json:"claims"`
+	// AllowUnverifiedEmail accepts ID tokens without a true email_verified claim, for providers that
+	// only issue verified addresses and don't send it.
+	AllowUnverifiedEmail bool `json:"allow_unverified_email"`
+	// AuthParams are extra authorization request parameters, e.g. Google's "hd" or Entra's "domain_hint".
+	AuthParams map[string]string `json:"auth_params"`
+	Scopes     []string          `json:"scopes"`
+}
+
+// ClaimMapping names the ID token claims a provider puts each value in. Empty fields use the
+// standard claim; an empty Domain checks only the domain of the email address, which is checked
+// either way.
+type ClaimMapping struct {
+	Email         string `json:"email"`
+	EmailVerified string `json:"email_verified"`
+	Domain        string `json:"domain"`
+	Name          string `json:"name"`
+}
+
+// OIDCProvider bundles the OIDC verifier + OAuth2 config for one configured provider.
+type OIDCProvider struct {
+	cfg      ProviderConfig
 	verifier *oidc.IDTokenVerifier
 	config   *oauth2.Config
 }
 
-// NewGoogleAuth constructs a GoogleAuth from env vars. Returns (nil, nil) when OAuth is
-// unconfigured — callers that need Google must check for that case. Returns an error only when
-// the OIDC discovery itself fails.
-func NewGoogleAuth(ctx context.Context) (*GoogleAuth, error) {
-	clientID := config.GetEnv("GOOGLE_CLIENT_ID", "")
-	clientSecret := config.GetEnv("GOOGLE_CLIENT_SECRET", "")
-	redirectURL := config.GetEnv("OAUTH_REDIRECT_URL", "")
-	if clientID == "" || clientSecret == "" || redirectURL == "" {
-		return nil, nil
+// NewOIDCProvider validates cfg and runs OIDC discovery against its issuer.
+func NewOIDCProvider(ctx context.Context, cfg ProviderConfig) (*OIDCProvider, error) {
+	if !providerIDPattern.MatchString(cfg.ID) {
+		return nil, fmt.Errorf("oidc provider id %q: use lowercase letters, digits and dashes", cfg.ID)
+	}
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc provider %s: issuer, client_id, client_secret and redirect_url are required",
+			cfg.ID)
+	}
+	if len(cfg.AllowedDomains) == 0 {
+		return nil, fmt.Errorf("oidc provider %s: allowed_domains is required", cfg.ID)
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.ID
+	}
+	if cfg.Claims.Email == "" {
+		cfg.Claims.Email = "email"
+	}
+	if cfg.Claims.EmailVerified == "" {
+		cfg.Claims.EmailVerified = "email_verified"
+	}
+	if cfg.Claims.Name == "" {
+		cfg.Claims.Name = "name"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
 	}
 
-	provider, err := oidc.NewProvider(ctx, googleIssuer)
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
 	if err != nil {
-		return nil, fmt.Errorf("create OIDC provider: %w", err)
+		return nil, fmt.Errorf("create OIDC provider %s: %w", cfg.ID, err)
 	}
-
-	return &GoogleAuth{
-		provider: provider,
-		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	return &OIDCProvider{
+		cfg:      cfg,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
 		config: &oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			RedirectURL:  redirectURL,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
 			Endpoint:     provider.Endpoint(),
-			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+			Scopes:       cfg.Scopes,
 		},
 	}, nil
 }
 
-// AuthCodeURL builds the redirect URL to Google's consent screen and stamps a state cookie.
-func (g *GoogleAuth) AuthCodeURL(w http.ResponseWriter) (string, error) {
+func (p *OIDCProvider) ID() string   { return p.cfg.ID }
+func (p *OIDCProvider) Name() string { return p.cfg.Name }
+
+// AllowedDomains are the email domains accepted from this provider, for the login page's hint.
+func (p *OIDCProvider) AllowedDomains() []string { return p.cfg.AllowedDomains }
+
+// AuthCodeURL builds the redirect URL to the provider's consent screen and stamps a state cookie
+// bound to this provider.
+func (p *OIDCProvider) AuthCodeURL(w http.ResponseWriter) (string, error) {
 	state, err := randomState()
 	if err != nil {
 		return "", err
 	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     oauthStateCookie,
-		Value:    state,
+		Value:    p.cfg.ID + ":" + state,
 		Path:     "/",
 		MaxAge:   600, // 10 minutes
 		HttpOnly: true,
@@ -72,29 +133,34 @@ func (g *GoogleAuth) AuthCodeURL(w http.ResponseWriter) (string, error) {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	// "hd" pins Google's account chooser to our workspace. We still verify the hd claim server-side below.
-	return g.config.AuthCodeURL(state, oauth2.SetAuthURLParam("hd", allowedHostedDomain)), nil
+	// e.g. "hd" pins Google's account chooser to our workspace; the domain is still verified below.
+	var opts []oauth2.AuthCodeOption
+	for k, v := range p.cfg.AuthParams {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+	return p.config.AuthCodeURL(state, opts...), nil
 }
 
-// IDTokenClaims is the subset of Google's ID token we use.
+// IDTokenClaims is what we take from a provider's ID token, after claim mapping.
 type IDTokenClaims struct {
-	Email         string `json:"email"`
-	EmailVerified bool   `json:"email_verified"`
-	HostedDomain  string `json:"hd"`
-	Name          string `json:"name"`
+	Email  string
+	Name   string
+	Domain string
 }
 
-// Exchange validates state, exchanges the code for tokens, verifies the ID token, and returns the claims.
-func (g *GoogleAuth) Exchange(ctx context.Context, r *http.Request) (*IDTokenClaims, error) {
-	wantState, err := r.Cookie(oauthStateCookie)
+// Exchange validates state, exchanges the code for tokens, verifies the ID token, and returns the
+// mapped claims. Unverified emails and emails outside the provider's allowed domains are rejected.
+func (p *OIDCProvider) Exchange(ctx context.Context, r *http.Request) (*IDTokenClaims, error) {
+	cookie, err := r.Cookie(oauthStateCookie)
 	if err != nil {
 		return nil, errors.New("missing oauth state cookie")
 	}
-	if r.URL.Query().Get("state") != wantState.Value {
+	providerID, wantState, _ := strings.Cut(cookie.Value, ":")
+	if providerID != p.cfg.ID || wantState == "" || r.URL.Query().Get("state") != wantState {
 		return nil, errors.New("oauth state mismatch")
 	}
 
-	tok, err := g.config.Exchange(ctx, r.URL.Query().Get("code"))
+	tok, err := p.config.Exchange(ctx, r.URL.Query().Get("code"))
 	if err != nil {
 		return nil, fmt.Errorf("token exchange failed: %w", err)
 	}
@@ -102,22 +168,138 @@ func (g *GoogleAuth) Exchange(ctx context.Context, r *http.Request) (*IDTokenCla
 	if !ok || raw == "" {
 		return nil, errors.New("no id_token in response")
 	}
-	idTok, err := g.verifier.Verify(ctx, raw)
+	idTok, err := p.verifier.Verify(ctx, raw)
 	if err != nil {
 		return nil, fmt.Errorf("verify id_token: %w", err)
 	}
 
-	var claims IDTokenClaims
-	if err := idTok.Claims(&claims); err != nil {
+	var raws map[string]any
+	if err := idTok.Claims(&raws); err != nil {
 		return nil, fmt.Errorf("decode id_token claims: %w", err)
 	}
-	if !claims.EmailVerified {
-		return nil, errors.New("google email not verified")
+	return p.mapClaims(raws)
+}
+
+func (p *OIDCProvider) mapClaims(raws map[string]any) (*IDTokenClaims, error) {
+	email, _ := raws[p.cfg.Claims.Email].(string)
+	if email == "" {
+		return nil, fmt.Errorf("no %s claim in id_token", p.cfg.Claims.Email)
+	}
+	if !p.cfg.AllowUnverifiedEmail && !isTrue(raws[p.cfg.Claims.EmailVerified]) {
+		return nil, fmt.Errorf("%s email not verified", p.cfg.ID)
+	}
+
+	// the email's own domain must always be allowed; a domain claim (e.g. Google's hd) is an extra
+	// check on top, since the tenant a token comes from needn't own the address it carries
+	_, emailDomain, _ := strings.Cut(email, "@")
+	claims := &IDTokenClaims{Email: email, Domain: emailDomain}
+	claims.Name, _ = raws[p.cfg.Claims.Name].(string)
+	if !p.allowedDomain(emailDomain) {
+		return nil, fmt.Errorf("email not in an allowed domain for %s", p.cfg.ID)
+	}
+	if p.cfg.Claims.Domain != "" {
+		claims.Domain, _ = raws[p.cfg.Claims.Domain].(string)
+		if !p.allowedDomain(claims.Domain) {
+			return nil, fmt.Errorf("%s claim not an allowed domain for %s", p.cfg.Claims.Domain, p.cfg.ID)
+		}
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) allowedDomain(domain string) bool {
+	return domain != "" && slices.ContainsFunc(p.cfg.AllowedDomains, func(d string) bool { return strings.EqualFold(d, domain) })
+}
+
+// isTrue reads a boolean claim; some providers send email_verified as the string "true".
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// OIDCProviders is the set of configured sign-in providers, in login page order.
+type OIDCProviders struct {
+	list []*OIDCProvider
+}
+
+// NewOIDCProviders builds the providers from env: Google from GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET
+// and OAUTH_REDIRECT_URL when all are set, then any in OIDC_PROVIDERS. No providers is not an error;
+// a provider that is misconfigured or fails discovery is.
+func NewOIDCProviders(ctx context.Context) (*OIDCProviders, error) {
+	var configs []ProviderConfig
+	clientID := config.GetEnv("GOOGLE_CLIENT_ID", "")
+	clientSecret := config.GetEnv("GOOGLE_CLIENT_SECRET", "")
+	redirectURL := config.GetEnv("OAUTH_REDIRECT_URL", "")
+	if clientID != "" && clientSecret != "" && redirectURL != "" {
+		configs = append(configs, ProviderConfig{
+			ID:             googleProviderID,
+			Name:           "Google",
+			Issuer:         googleIssuer,
+			ClientID:       clientID,
+			ClientSecret:   clientSecret,
+			RedirectURL:    redirectURL,
+			AllowedDomains: []string{allowedHostedDomain},
+			Claims:         ClaimMapping{Domain: "hd"},
+			AuthParams:     map[string]string{"hd": allowedHostedDomain},
+		})
+	}
+	if raw := config.GetEnv("OIDC_PROVIDERS", ""); raw != "" {
+		var extra []ProviderConfig
+		if err := json.Unmarshal([]byte(raw), &extra); err != nil {
+			return nil, fmt.Errorf("parse OIDC_PROVIDERS: %w", err)
+		}
+		configs = append(configs, extra...)
+	}
+
+	providers := &OIDCProviders{}
+	for _, cfg := range configs {
+		if providers.Get(cfg.ID) != nil {
+			return nil, fmt.Errorf("oidc provider %s is configured twice", cfg.ID)
+		}
+		p, err := NewOIDCProvider(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		providers.list = append(providers.list, p)
+	}
+	return providers, nil
+}
+
+// List returns the providers in configuration order.
+func (ps *OIDCProviders) List() []*OIDCProvider {
+	return ps.list
+}
+
+// Get returns the provider with the given ID, or nil.
+func (ps *OIDCProviders) Get(id string) *OIDCProvider {
+	for _, p := range ps.list {
+		if p.cfg.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// AcceptsEmail reports whether email is in a domain some provider allows, so the user could sign in.
+// With no providers configured (dev login only) the Avanti workspace domain is assumed.
+func (ps *OIDCProviders) AcceptsEmail(email string) bool {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return false
+	}
+	if len(ps.list) == 0 {
+		return strings.EqualFold(domain, allowedHostedDomain)
 	}
-	if claims.HostedDomain != allowedHostedDomain {
-		return nil, fmt.Errorf("email not in %s domain", allowedHostedDomain)
+	for _, p := range ps.list {
+		if slices.ContainsFunc(p.cfg.AllowedDomains, func(d string) bool { return strings.EqualFold(d, domain) }) {
+			return true
+		}
 	}
-	return &claims, nil
+	return false
 }
 
 // ClearStateCookie removes the OAuth state cookie after a callback completes.
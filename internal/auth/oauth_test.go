@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIDP is a minimal stand-in OIDC provider: discovery, JWKS and a token endpoint that answers
+// every code with an ID token carrying claims.
+type stubIDP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newStubIDP(t *testing.T) *stubIDP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIDP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		writeTestJSON(w, map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		writeTestJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": "k1",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, _ *http.Request) {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		tok.Header["kid"] = "k1"
+		signed, err := tok.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeTestJSON(w, map[string]any{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	idp := newStubIDP(t)
+	baseClaims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": idp.URL, "aud": "cms", "sub": "u1",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	standard := ProviderConfig{AllowedDomains: []string{"partner.org"}}
+	mapped := ProviderConfig{
+		AllowedDomains:       []string{"partner.org"},
+		Claims:               ClaimMapping{Email: "upn", Domain: "tenant_domain"},
+		AllowUnverifiedEmail: true,
+	}
+
+	tests := []struct {
+		name      string
+		cfg       ProviderConfig
+		claims    jwt.MapClaims
+		badState  bool
+		wantEmail string
+	}{
+		{"verified email in an allowed domain", standard,
+			baseClaims(jwt.MapClaims{"email": "a@partner.org", "email_verified": true}), false, "a@partner.org"},
+		{"email_verified sent as a string", standard,
+			baseClaims(jwt.MapClaims{"email": "a@Partner.org", "email_verified": "true"}), false, "a@Partner.org"},
+		{"unverified email", standard,
+			baseClaims(jwt.MapClaims{"email": "a@partner.org", "email_verified": false}), false, ""},
+		{"domain not allowed", standard,
+			baseClaims(jwt.MapClaims{"email": "a@elsewhere.org", "email_verified": true}), false, ""},
+		{"mapped claims", mapped,
+			baseClaims(jwt.MapClaims{"upn": "b@partner.org", "tenant_domain": "partner.org"}), false, "b@partner.org"},
+		{"mapped domain claim not allowed", mapped,
+			baseClaims(jwt.MapClaims{"upn": "b@partner.org", "tenant_domain": "other.org"}), false, ""},
+		{"email outside the allowed domains despite the domain claim", mapped,
+			baseClaims(jwt.MapClaims{"upn": "b@other.org", "tenant_domain": "partner.org"}), false, ""},
+		{"token for another client", standard,
+			jwt.MapClaims{"iss": idp.URL, "aud": "someone-else", "exp": time.Now().Add(time.Hour).Unix(),
+				"email": "a@partner.org", "email_verified": true}, false, ""},
+		{"state mismatch", standard,
+			baseClaims(jwt.MapClaims{"email": "a@partner.org", "email_verified": true}), true, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.ID, cfg.Issuer, cfg.ClientID, cfg.ClientSecret = "partner", idp.URL, "cms", "secret"
+			cfg.RedirectURL = "http://cms.test/auth/partner/callback"
+			provider, err := NewOIDCProvider(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idp.claims = tc.claims
+
+			// start: the consent URL carries the state that the cookie binds to this provider
+			rec := httptest.NewRecorder()
+			consent, err := provider.AuthCodeURL(rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, _ := url.Parse(consent)
+			state := parsed.Query().Get("state")
+			if !strings.HasPrefix(consent, idp.URL+"/authorize") || state == "" {
+				t.Fatalf("consent URL = %s", consent)
+			}
+			if tc.badState {
+				state = "forged"
+			}
+
+			// callback
+			req := httptest.NewRequest(http.MethodGet, "/auth/partner/callback?code=c1&state="+state, nil)
+			for _, c := range rec.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			claims, err := provider.Exchange(context.Background(), req)
+			if tc.wantEmail == "" {
+				if err == nil {
+					t.Fatalf("Exchange accepted %+v, want an error", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if claims.Email != tc.wantEmail {
+				t.Errorf("email = %q, want %q", claims.Email, tc.wantEmail)
+			}
+		})
+	}
+}
+
+func TestNewOIDCProvidersFromEnv(t *testing.T) {
+	idp := newStubIDP(t)
+	t.Setenv("GOOGLE_CLIENT_ID", "")
+	entry := func(id, domains string) string {
+		return fmt.Sprintf(`{"id":%q,"name":"Partner","issuer":%q,"client_id":"cms","client_secret":"s",`+
+			`"redirect_url":"http://cms.test/auth/%s/callback","allowed_domains":[%s]}`, id, idp.URL, id, domains)
+	}
+
+	tests := []struct {
+		name    string
+		env     string
+		wantIDs []string
+		wantErr bool
+	}{
+		{"none configured", "", nil, false},
+		{"one provider", "[" + entry("partner", `"partner.org"`) + "]", []string{"partner"}, false},
+		{"duplicate ids", "[" + entry("partner", `"partner.org"`) + "," + entry("partner", `"p.org"`) + "]", nil, true},
+		{"invalid id", "[" + entry("Partner X", `"partner.org"`) + "]", nil, true},
+		{"missing allowed domains", "[" + entry("partner", "") + "]", nil, true},
+		{"not json", "partner", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("OIDC_PROVIDERS", tc.env)
+			providers, err := NewOIDCProviders(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var ids []string
+			for _, p := range providers.List() {
+				ids = append(ids, p.ID())
+			}
+			if strings.Join(ids, ",") != strings.Join(tc.wantIDs, ",") {
+				t.Errorf("providers = %v, want %v", ids, tc.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	personalTokenPrefix = "cmsp_"
+	// PersonalTokenPrefixLen is how much of a token is kept in clear so users can tell tokens apart.
+	PersonalTokenPrefixLen = len(personalTokenPrefix) + 8
+	// MaxPersonalTokenLifetime bounds how far out a personal token may expire; every token expires.
+	MaxPersonalTokenLifetime = 365 * 24 * time.Hour
+)
+
+// NewPersonalToken returns a fresh personal access token and its hash. Only the hash is stored;
+// the token itself is shown to its owner once.
+func NewPersonalToken() (token, hash string, err error) {
+	return newToken(personalTokenPrefix)
+}
+
+// IsPersonalToken reports whether a bearer token is a personal access token, as opposed to a
+// service token.
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, personalTokenPrefix)
+}
+
+type personalTokenCtxKey struct{}
+
+var personalTokenKey personalTokenCtxKey
+
+// WithPersonalToken marks a request as authenticated by the personal token with the given ID
+// rather than by a session cookie.
+func WithPersonalToken(ctx context.Context, tokenID int64) context.Context {
+	return context.WithValue(ctx, personalTokenKey, tokenID)
+}
+
+// PersonalTokenFromContext returns the ID of the personal token that authenticated the request, or
+// 0 for session requests.
+func PersonalTokenFromContext(ctx context.Context) int64 {
+	id, _ := ctx.Value(personalTokenKey).(int64)
+	return id
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type grantsCtxKey struct{}
+
+var grantsKey grantsCtxKey
+
+// WithGrants returns a context carrying the signed-in user's scoped grants.
+func WithGrants(ctx context.Context, grants []models.UserGrant) context.Context {
+	return context.WithValue(ctx, grantsKey, grants)
+}
+
+// GrantsFromContext returns the scoped grants attached to ctx, or nil.
+func GrantsFromContext(ctx context.Context) []models.UserGrant {
+	grants, _ := ctx.Value(grantsKey).([]models.UserGrant)
+	return grants
+}
+
+// RoleIn returns the role a user holds on all of scopes. On one scope that is the highest of the
+// global role and the roles of the grants covering it; content spanning several scopes (a test
+// with two subjects) needs the role on each, so the lowest of those wins. With no scopes it is the
+// highest role held anywhere, for routes that don't touch one piece of content.
+func RoleIn(global string, grants []models.UserGrant, scopes ...models.Scope) string {
+	if len(scopes) == 0 {
+		role := global
+		for _, g := range grants {
+			role = higher(role, g.Role)
+		}
+		return role
+	}
+
+	var lowest string
+	for i, scope := range scopes {
+		role := global
+		for _, g := range grants {
+			if g.Covers(scope) {
+				role = higher(role, g.Role)
+			}
+		}
+		if i == 0 || rank(role) < rank(lowest) {
+			lowest = role
+		}
+	}
+	return lowest
+}
+
+// Allowed reports whether the user signed in on ctx holds at least need on all of scopes.
+func Allowed(ctx context.Context, need string, scopes ...models.Scope) bool {
+	claims := FromContext(ctx)
+	if claims == nil {
+		return false
+	}
+	return AtLeast(RoleIn(claims.Role, GrantsFromContext(ctx), scopes...), need)
+}
+
+func higher(a, b string) string {
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestRoleIn(t *testing.T) {
+	gseb, cbse := int16(2), int16(1)
+	grade11 := int8(11)
+	physics, chemistry := int8(3), int8(4)
+	// editor for GSEB Physics, any grade; viewer-only elsewhere
+	gsebPhysics := models.UserGrant{CurriculumID: &gseb, SubjectID: &physics, Role: RoleEditor}
+	// admin for grade 11 Chemistry in any curriculum
+	chem11 := models.UserGrant{GradeID: &grade11, SubjectID: &chemistry, Role: RoleAdmin}
+	grants := []models.UserGrant{gsebPhysics, chem11}
+
+	tests := []struct {
+		name   string
+		global string
+		grants []models.UserGrant
+		scopes []models.Scope
+		want   string
+	}{
+		{"no grants keeps global role", RoleEditor, nil, []models.Scope{{CurriculumID: cbse, SubjectID: chemistry}}, RoleEditor},
+		{"grant raises role in its scope", RoleViewer, grants, []models.Scope{{CurriculumID: gseb, GradeID: 12, SubjectID: physics}}, RoleEditor},
+		{"grant doesn't reach other curriculums", RoleViewer, grants, []models.Scope{{CurriculumID: cbse, GradeID: 12, SubjectID: physics}}, RoleViewer},
+		{"grant doesn't reach other subjects", RoleViewer, grants, []models.Scope{{CurriculumID: gseb, SubjectID: chemistry, GradeID: 12}}, RoleViewer},
+		{"grant never lowers the global role", RoleAdmin, grants, []models.Scope{{CurriculumID: gseb, SubjectID: physics}}, RoleAdmin},
+		{"highest covering grant wins", RoleViewer, grants, []models.Scope{{CurriculumID: cbse, GradeID: grade11, SubjectID: chemistry}}, RoleAdmin},
+		{"pinned grant field doesn't cover an unknown one", RoleViewer, grants, []models.Scope{{SubjectID: physics}}, RoleViewer},
+		{"curriculum grant doesn't cover a subject-only problem", RoleViewer, []models.UserGrant{gsebPhysics}, []models.Scope{{SubjectID: physics, GradeID: 12}}, RoleViewer},
+		{"open grant field covers an unknown one", RoleViewer, grants, []models.Scope{{CurriculumID: gseb, SubjectID: physics}}, RoleEditor},
+		{"content spanning scopes needs all of them", RoleViewer, grants, []models.Scope{
+			{CurriculumID: gseb, GradeID: grade11, SubjectID: physics},
+			{CurriculumID: gseb, GradeID: grade11, SubjectID: chemistry},
+		}, RoleEditor},
+		{"one uncovered scope drops to global", RoleViewer, grants, []models.Scope{
+			{CurriculumID: gseb, SubjectID: physics},
+			{CurriculumID: cbse, SubjectID: physics},
+		}, RoleViewer},
+		{"no scopes means highest role anywhere", RoleViewer, grants, nil, RoleAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RoleIn(tt.global, tt.grants, tt.scopes...); got != tt.want {
+				t.Errorf("RoleIn = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
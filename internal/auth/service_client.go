@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+)
+
+// Scopes a service client can hold. Each /api/service route needs one of them.
+const (
+	ScopeTestsRead      = "tests:read"
+	ScopePDFRender      = "pdf:render"
+	ScopeCurriculumRead = "curriculum:read"
+	ScopeChangesRead    = "changes:read"
+)
+
+// ServiceScopes lists the scopes in the order the admin screen offers them.
+func ServiceScopes() []string {
+	return []string{ScopeTestsRead, ScopePDFRender, ScopeCurriculumRead, ScopeChangesRead}
+}
+
+// ValidServiceScope reports whether s is one of ServiceScopes.
+func ValidServiceScope(s string) bool {
+	return slices.Contains(ServiceScopes(), s)
+}
+
+const (
+	serviceTokenPrefix = "cms_"
+	// ServiceTokenPrefixLen is how much of a token is kept in clear so admins can tell tokens apart.
+	ServiceTokenPrefixLen = len(serviceTokenPrefix) + 8
+)
+
+// NewServiceToken returns a fresh service token and its hash. Only the hash is stored; the token
+// itself is shown to the admin once.
+func NewServiceToken() (token, hash string, err error) {
+	return newToken(serviceTokenPrefix)
+}
+
+func newToken(prefix string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = prefix + hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken is the lookup key of a service or personal token in its table. Tokens carry 256 random
+// bits, so a plain SHA-256 is enough; there's nothing to brute-force.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,8 +1,13 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,9 +20,15 @@ const (
 	// RoleCookieName is a non-HttpOnly mirror of the session's role claim. JS uses it to gate UI elements
 	// (e.g., the Admin nav link). Real authorization always happens server-side against the signed session.
 	RoleCookieName = "cms_role"
-	sessionMaxAge  = 12 * time.Hour
+	// ReauthCookieName marks a sign-in started from the in-page re-auth prompt, so the callback lands
+	// on /reauth-done (which hands control back to the waiting page) instead of /home.
+	ReauthCookieName   = "cms_reauth"
+	sessionMaxAge      = 12 * time.Hour
+	defaultIdleTimeout = 2 * time.Hour
 )
 
+// SessionClaims is the signed session cookie. RegisteredClaims.ID (jti) names the session's
+// cms_session row, which is checked on each request so sessions can be revoked.
 type SessionClaims struct {
 	UserID int64  `json:"uid"`
 	Email  string `json:"email"`
@@ -29,24 +40,60 @@ func signingKey() []byte {
 	return []byte(config.GetEnv("SESSION_SECRET", ""))
 }
 
-// IssueSession signs a JWT and sets it as an HttpOnly cookie.
-func IssueSession(w http.ResponseWriter, userID int64, email, role string) error {
-	key := signingKey()
-	if len(key) == 0 {
-		return errors.New("SESSION_SECRET is not set")
+// NewSession builds the claims of a new session for a user, with a fresh session ID (jti) for
+// the server-side session record.
+func NewSession(userID int64, email, role string) (*SessionClaims, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
 	}
-
 	now := time.Now()
-	claims := SessionClaims{
+	return &SessionClaims{
 		UserID: userID,
 		Email:  email,
 		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(b),
 			Subject:   email,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(sessionMaxAge)),
 		},
+	}, nil
+}
+
+// NeedsRenewal reports whether a session is past half its lifetime and should be reissued on
+// activity, so that someone working steadily is never signed out by sessionMaxAge.
+func NeedsRenewal(claims *SessionClaims, now time.Time) bool {
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return now.Sub(claims.IssuedAt.Time) > sessionMaxAge/2
+}
+
+// Renewed returns a copy of the claims with the same session ID and a fresh lifetime.
+func Renewed(claims *SessionClaims, now time.Time) *SessionClaims {
+	renewed := *claims
+	renewed.IssuedAt = jwt.NewNumericDate(now)
+	renewed.ExpiresAt = jwt.NewNumericDate(now.Add(sessionMaxAge))
+	return &renewed
+}
+
+// IdleTimeout is how long a session may go without a request before it is ended, from
+// SESSION_IDLE_TIMEOUT (a Go duration such as "90m"). Defaults to 2h.
+func IdleTimeout() time.Duration {
+	if d, err := time.ParseDuration(config.GetEnv("SESSION_IDLE_TIMEOUT", "")); err == nil && d > 0 {
+		return d
+	}
+	return defaultIdleTimeout
+}
+
+// IssueSession signs the claims as a JWT and sets it as an HttpOnly cookie.
+func IssueSession(w http.ResponseWriter, claims *SessionClaims) error {
+	key := signingKey()
+	if len(key) == 0 {
+		return errors.New("SESSION_SECRET is not set")
 	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, err := token.SignedString(key)
 	if err != nil {
@@ -62,6 +109,12 @@ func IssueSession(w http.ResponseWriter, userID int64, email, role string) error
 		Secure:   isSecureCookie(),
 		SameSite: http.SameSiteLaxMode,
 	})
+	SetRoleCookie(w, claims.Role)
+	return nil
+}
+
+// SetRoleCookie (re)sets the JS-readable role mirror, e.g. after the role was changed mid-session.
+func SetRoleCookie(w http.ResponseWriter, role string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     RoleCookieName,
 		Value:    role,
@@ -71,10 +124,9 @@ func IssueSession(w http.ResponseWriter, userID int64, email, role string) error
 		Secure:   isSecureCookie(),
 		SameSite: http.SameSiteLaxMode,
 	})
-	return nil
 }
 
-// ClearSession removes the session cookie.
+// ClearSession removes the session cookie and its JS-readable companions.
 func ClearSession(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     SessionCookieName,
@@ -85,12 +137,46 @@ func ClearSession(w http.ResponseWriter) {
 		Secure:   isSecureCookie(),
 		SameSite: http.SameSiteLaxMode,
 	})
+	for _, name := range []string{RoleCookieName, CSRFCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: false,
+			Secure:   isSecureCookie(),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// SetReauthCookie marks the sign-in about to start as a re-auth from an open page.
+func SetReauthCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     RoleCookieName,
+		Name:     ReauthCookieName,
+		Value:    "1",
+		Path:     "/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureCookie(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// IsReauth reports whether the request carries the re-auth marker.
+func IsReauth(r *http.Request) bool {
+	_, err := r.Cookie(ReauthCookieName)
+	return err == nil
+}
+
+// ClearReauthCookie removes the re-auth marker once the sign-in it belongs to has finished.
+func ClearReauthCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ReauthCookieName,
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
-		HttpOnly: false,
+		HttpOnly: true,
 		Secure:   isSecureCookie(),
 		SameSite: http.SameSiteLaxMode,
 	})
@@ -127,3 +213,58 @@ func isSecureCookie() bool {
 	// "production" is the explicit gate; local dev runs over HTTP and would silently drop a Secure cookie.
 	return config.GetEnv("APP_ENV", "") == "production"
 }
+
+// ClientIP is the address the request came from. X-Forwarded-For is only read on requests arriving
+// from a proxy listed in TRUSTED_PROXIES (comma-separated IPs or CIDRs, e.g. the load balancer's
+// subnets), and then from the right: the client is the right-most hop that isn't a trusted proxy,
+// since every hop to its left is whatever the client sent. Otherwise it is the connection's address.
+func ClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	proxies := trustedProxies()
+	if !isTrustedProxy(proxies, remote) {
+		return remote
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if isTrustedProxy(proxies, hop) {
+			continue
+		}
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		return hop
+	}
+	return remote
+}
+
+// trustedProxies parses TRUSTED_PROXIES, skipping entries that are neither an IP nor a CIDR.
+func trustedProxies() []netip.Prefix {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(config.GetEnv("TRUSTED_PROXIES", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return proxies
+}
+
+func isTrustedProxy(proxies []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
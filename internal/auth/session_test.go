@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name, trusted, remote string
+		forwarded             []string
+		want                  string
+	}{
+		{"no proxies trusted ignores the header", "", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"untrusted peer ignores the header", "10.0.0.0/8", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy names the client", "10.0.0.0/8", "10.0.1.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"forged hops left of the client are skipped", "10.0.0.0/8", "10.0.1.2:5000",
+			[]string{"192.0.2.66, 198.51.100.1"}, "198.51.100.1"},
+		{"chained trusted proxies are skipped", "10.0.0.0/8, 172.16.0.5", "10.0.1.2:5000",
+			[]string{"192.0.2.66, 198.51.100.1", "172.16.0.5"}, "198.51.100.1"},
+		{"garbage hop falls back to the peer", "10.0.0.0/8", "10.0.1.2:5000", []string{"not-an-ip"}, "10.0.1.2"},
+		{"missing header falls back to the peer", "10.0.0.0/8", "10.0.1.2:5000", nil, "10.0.1.2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tc.trusted)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remote
+			for _, value := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(req); got != tc.want {
+				t.Errorf("ClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Package changelog records every content write made through a Service in an append-only log, which
+// downstream systems read through /api/service/v1/changes to sync incrementally instead of re-fetching
+// full lists.
+package changelog
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+)
+
+// Entity types the log records.
+const (
+	Test     = "test"
+	Problem  = "problem"
+	Chapter  = "chapter"
+	Topic    = "topic"
+	Resource = "resource"
+)
+
+// EntityTypes lists the entity types the log records.
+func EntityTypes() []string {
+	return []string{Test, Problem, Chapter, Topic, Resource}
+}
+
+// ValidEntityType reports whether t is one of EntityTypes.
+func ValidEntityType(t string) bool {
+	return slices.Contains(EntityTypes(), t)
+}
+
+// Log stores entries (db.ChangeLogRepo).
+type Log interface {
+	Append(ctx context.Context, entityType string, entityID int64, operation string) error
+}
+
+// appendTimeout bounds the insert done in the request that made the change.
+const appendTimeout = 5 * time.Second
+
+// Watch records the changes made through svc as writes to entityType, e.g. "test". A failure to record
+// is logged, not returned: the content write it follows has already succeeded.
+func Watch[T any](svc *services.Service[T], l Log, entityType string) {
+	svc.OnChange(func(c services.Change) {
+		id, err := strconv.ParseInt(c.ID, 10, 64)
+		if err != nil {
+			log.Printf("change log %s %s: bad entity id %q", entityType, c.Kind, c.ID)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), appendTimeout)
+		defer cancel()
+		if err := l.Append(ctx, entityType, id, c.Kind); err != nil {
+			log.Printf("change log %s %s id=%d: %v", entityType, c.Kind, id, err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package changelog
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+)
+
+type entry struct {
+	entityType string
+	entityID   int64
+	operation  string
+}
+
+type fakeLog struct {
+	entries []entry
+	err     error
+}
+
+func (l *fakeLog) Append(ctx context.Context, entityType string, entityID int64, operation string) error {
+	l.entries = append(l.entries, entry{entityType, entityID, operation})
+	return l.err
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name string
+		kind string
+		ids  []string
+		want []entry
+	}{
+		{"one update", services.Updated, []string{"42"}, []entry{{Test, 42, "updated"}}},
+		{"move of several", services.Moved, []string{"1", "2"}, []entry{{Test, 1, "moved"}, {Test, 2, "moved"}}},
+		{"bad id skipped", services.Created, []string{"", "x", "7"}, []entry{{Test, 7, "created"}}},
+		{"nothing changed", services.Moved, nil, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := services.NewService[models.Test](nil, nil)
+			l := &fakeLog{}
+			Watch(svc, l, Test)
+			svc.Changed(tc.kind, tc.ids...)
+			if !reflect.DeepEqual(l.entries, tc.want) {
+				t.Errorf("entries = %v, want %v", l.entries, tc.want)
+			}
+		})
+	}
+}
+
+func TestWatchSurvivesLogErrors(t *testing.T) {
+	svc := services.NewService[models.Problem](nil, nil)
+	l := &fakeLog{err: errors.New("db down")}
+	Watch(svc, l, Problem)
+	svc.Changed(services.Archived, "3", "4")
+	if len(l.entries) != 2 {
+		t.Errorf("appended %d entries, want 2", len(l.entries))
+	}
+}
@@ -13,7 +13,14 @@ const (
 	SortOrderAsc  SortOrder = "asc"
 	SortOrderDesc SortOrder = "desc"
 
-	StatusArchived = 1
+	// cms_status_id values, mirroring the rows of db-service's cms_status table. Content saved
+	// before the review workflow existed has no status and counts as published; see
+	// internal/workflow.
+	StatusArchived  = 1
+	StatusDraft     = 2
+	StatusInReview  = 3
+	StatusApproved  = 4
+	StatusPublished = 5
 )
 
 // runtime constant
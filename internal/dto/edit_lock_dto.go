@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+// EditConflict describes a save rejected because the test or problem changed after the editor
+// loaded it.
+type EditConflict struct {
+	EntityType  string // "test" or "problem"
+	EntityID    int
+	Token       int // version the editor loaded
+	Latest      int // version saved since
+	LatestEmail string
+	LatestAt    time.Time
+	// DiffURL shows what changed between Token and Latest; empty when there's nothing to diff.
+	DiffURL string
+}
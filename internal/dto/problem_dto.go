@@ -7,4 +7,6 @@ type ProblemData struct {
 	ProblemPtr *models.Problem
 	TopicPtr   *models.Topic
 	ChapterPtr *models.Chapter
+	// Latest CMS-saved version when loaded for editing, sent back on save to detect conflicts.
+	VersionToken int
 }
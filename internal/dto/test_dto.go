@@ -9,4 +9,6 @@ type TestData struct {
 	TestRule *models.TestRule
 	// Resolved from exams API (name JeeAdvancedExamName); 0 if not found.
 	JeeAdvancedExamID int16 `json:"jee_advanced_exam_id"`
+	// Latest CMS-saved version when loaded for editing, sent back on save to detect conflicts.
+	VersionToken int
 }
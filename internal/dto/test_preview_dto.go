@@ -0,0 +1,56 @@
+package dto
+
+import (
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/scoring"
+)
+
+// TestPreviewData renders a test the way a student sees it.
+type TestPreviewData struct {
+	HomeData
+	TestPtr  *models.Test
+	Sections []PreviewSection
+	// LangCodes are the languages any of the test's problems has, English first.
+	LangCodes       []string
+	DurationSeconds int
+}
+
+type PreviewSection struct {
+	SubjectName string
+	Name        string
+	// MandatoryCount of the optional problems; 0 when the section has none.
+	MandatoryCount int
+	Problems       []PreviewProblem
+}
+
+type PreviewProblem struct {
+	Number   int
+	Optional bool
+	// Problem is nil when the test references a problem that no longer exists.
+	Problem      *models.Problem
+	Key          grading.Problem
+	OptionLayout *models.OptionLayout
+}
+
+// PreviewResultData is a graded preview, section by section.
+type PreviewResultData struct {
+	Result   scoring.Result
+	Sections []PreviewResultSection
+}
+
+type PreviewResultSection struct {
+	SubjectName string
+	Name        string
+	Marks       int
+	MaxMarks    int
+	Rows        []PreviewResultRow
+}
+
+type PreviewResultRow struct {
+	Number   int
+	Code     string
+	Response string
+	Answer   string
+	scoring.ProblemResult
+}
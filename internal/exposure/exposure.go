@@ -0,0 +1,134 @@
+// Package exposure tracks how often problems appear in tests, so that authors can prefer fresh problems
+// and are warned before reusing one that students of the same curriculum and grade saw recently.
+//
+// An appearance is a problem in a test for one of the test's curriculum/grade pairs, dated when the
+// problem was first saved into the test. Appearances are kept in cms_problem_exposure as tests are saved
+// (db.ProblemExposureRepo); archived tests keep theirs, since students may already have taken them.
+package exposure
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/config"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// DefaultWindowDays is how far back a recent appearance is looked for when EXPOSURE_WINDOW_DAYS is unset.
+const DefaultWindowDays = 180
+
+// Window is how far back an appearance for the same curriculum and grade counts as recent: the
+// EXPOSURE_WINDOW_DAYS setting, else DefaultWindowDays.
+func Window() time.Duration {
+	days, err := strconv.Atoi(config.GetEnv("EXPOSURE_WINDOW_DAYS", ""))
+	if err != nil || days <= 0 {
+		days = DefaultWindowDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+type Appearance struct {
+	ProblemID    int
+	TestID       int
+	TestSubtype  string
+	CurriculumID int16
+	GradeID      int8
+}
+
+// Appearances lists one appearance per problem of test per curriculum/grade pair, or per problem alone
+// when the test has no pair. A problem placed twice in the test appears once.
+func Appearances(test *models.Test) []Appearance {
+	pairs := test.CurriculumGrades
+	if len(pairs) == 0 {
+		pairs = []models.CurriculumGrade{{}}
+	}
+	var out []Appearance
+	seen := map[int]bool{}
+	add := func(problems []models.ResProblem) {
+		for _, p := range problems {
+			if p.ID == 0 || seen[p.ID] {
+				continue
+			}
+			seen[p.ID] = true
+			for _, pair := range pairs {
+				out = append(out, Appearance{ProblemID: p.ID, TestID: test.ID, TestSubtype: test.Subtype,
+					CurriculumID: pair.CurriculumID, GradeID: pair.GradeID})
+			}
+		}
+	}
+	for _, s := range test.TypeParams.Subjects {
+		for _, sec := range s.Sections {
+			add(sec.Compulsory.Problems)
+			if sec.Optional != nil {
+				add(sec.Optional.Problems)
+			}
+		}
+	}
+	return out
+}
+
+// Summary is how much one problem has been used.
+type Summary struct {
+	ProblemID int
+	// Tests is the number of tests the problem appears in, and BySubtype splits it by test subtype.
+	Tests     int
+	BySubtype map[string]int
+	// LastUsed is the newest dated appearance; zero when there is none.
+	LastUsed time.Time
+	// Recent is the number of tests for the curriculum/grade asked about that took the problem within
+	// the Window.
+	Recent int
+}
+
+// Warn reports whether the problem appeared in a test for the same curriculum and grade within the
+// window.
+func (s Summary) Warn() bool {
+	return s.Recent > 0
+}
+
+// Detail describes the usage in words, e.g. "2 major_test, 1 chapter_test; last used 3 Aug 2026".
+func (s Summary) Detail() string {
+	if s.Tests == 0 {
+		return "Not used in any test"
+	}
+	subtypes := make([]string, 0, len(s.BySubtype))
+	for subtype := range s.BySubtype {
+		subtypes = append(subtypes, subtype)
+	}
+	slices.SortFunc(subtypes, func(a, b string) int {
+		return cmp.Or(cmp.Compare(s.BySubtype[b], s.BySubtype[a]), cmp.Compare(a, b))
+	})
+	parts := make([]string, len(subtypes))
+	for i, subtype := range subtypes {
+		name := subtype
+		if name == "" {
+			name = "untyped"
+		}
+		parts[i] = fmt.Sprintf("%d %s", s.BySubtype[subtype], name)
+	}
+	detail := strings.Join(parts, ", ")
+	if !s.LastUsed.IsZero() {
+		detail += "; last used " + s.LastUsed.Format("2 Jan 2006")
+	}
+	return detail
+}
+
+// SortLeastUsed orders problems by fewest tests, then least recently used. Problems tied on both keep
+// their order.
+func SortLeastUsed(problems []*models.Problem, summaries map[int]Summary) {
+	slices.SortStableFunc(problems, func(a, b *models.Problem) int {
+		sa, sb := summaries[a.ID], summaries[b.ID]
+		return cmp.Or(cmp.Compare(sa.Tests, sb.Tests), sa.LastUsed.Compare(sb.LastUsed))
+	})
+}
+
+// Filter keeps the problems used in at most maxTests tests.
+func Filter(problems []*models.Problem, summaries map[int]Summary, maxTests int) []*models.Problem {
+	return slices.DeleteFunc(problems, func(p *models.Problem) bool {
+		return summaries[p.ID].Tests > maxTests
+	})
+}
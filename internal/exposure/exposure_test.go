@@ -0,0 +1,104 @@
+package exposure
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestAppearances(t *testing.T) {
+	sections := []models.ResSection{
+		{Compulsory: models.ResCompulsory{Problems: []models.ResProblem{{ID: 1}, {ID: 2}}}},
+		{
+			Compulsory: models.ResCompulsory{Problems: []models.ResProblem{{ID: 1}}}, // placed twice
+			Optional:   &models.ResOptional{Problems: []models.ResProblem{{ID: 3}}},
+		},
+	}
+	test := func(pairs ...models.CurriculumGrade) *models.Test {
+		return &models.Test{ID: 9, Subtype: "major_test", CurriculumGrades: pairs,
+			TypeParams: models.ResTypeParams{Subjects: []models.ResSubject{{Sections: sections}}}}
+	}
+
+	tests := []struct {
+		name string
+		test *models.Test
+		want []Appearance
+	}{
+		{"no curriculum", test(), []Appearance{
+			{ProblemID: 1, TestID: 9, TestSubtype: "major_test"},
+			{ProblemID: 2, TestID: 9, TestSubtype: "major_test"},
+			{ProblemID: 3, TestID: 9, TestSubtype: "major_test"},
+		}},
+		{"one per pair", test(models.CurriculumGrade{CurriculumID: 1, GradeID: 11},
+			models.CurriculumGrade{CurriculumID: 2, GradeID: 11}), []Appearance{
+			{1, 9, "major_test", 1, 11}, {1, 9, "major_test", 2, 11},
+			{2, 9, "major_test", 1, 11}, {2, 9, "major_test", 2, 11},
+			{3, 9, "major_test", 1, 11}, {3, 9, "major_test", 2, 11},
+		}},
+		{"no problems", &models.Test{ID: 9}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Appearances(tc.test); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Appearances =\n%v\nwant\n%v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSummaryDetail(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary Summary
+		want    string
+	}{
+		{"unused", Summary{}, "Not used in any test"},
+		{"most used subtype first", Summary{Tests: 3, BySubtype: map[string]int{"chapter_test": 1, "major_test": 2},
+			LastUsed: time.Date(2026, 8, 3, 10, 0, 0, 0, time.UTC)}, "2 major_test, 1 chapter_test; last used 3 Aug 2026"},
+		{"undated", Summary{Tests: 1, BySubtype: map[string]int{"": 1}}, "1 untyped"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.summary.Detail(); got != tc.want {
+				t.Errorf("Detail = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortAndFilter(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	summaries := map[int]Summary{
+		1: {Tests: 3, LastUsed: day(5)},
+		2: {Tests: 1, LastUsed: day(9)},
+		3: {Tests: 1, LastUsed: day(2)},
+		// 4 has never been used
+		5: {Tests: 1, LastUsed: day(2)},
+	}
+	problems := func() []*models.Problem {
+		return []*models.Problem{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}
+	}
+	ids := func(ps []*models.Problem) []int {
+		out := []int{}
+		for _, p := range ps {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	sorted := problems()
+	SortLeastUsed(sorted, summaries)
+	if got, want := ids(sorted), []int{4, 3, 5, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SortLeastUsed = %v, want %v", got, want)
+	}
+
+	for maxTests, want := range map[int][]int{0: {4}, 1: {2, 3, 4, 5}, 3: {1, 2, 3, 4, 5}} {
+		if got := ids(Filter(problems(), summaries, maxTests)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Filter(%d) = %v, want %v", maxTests, got, want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package grading resolves a test's answer key: for every problem the marks it carries once the test →
+// subject → section → problem cascade is applied, its answer in a form a grader can compare responses
+// against, and the optional blocks' mandatory counts.
+package grading
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Problem subtypes the CMS authors.
+const (
+	SingleAnswer   = "mcq_single_answer"
+	MultipleAnswer = "mcq_multiple_answer"
+	MatrixMatch    = "matrix_match"
+	IntegerType    = "integer_type"
+	Numerical      = "numerical_answer"
+	Comprehension  = "comprehension"
+)
+
+// Answer kinds.
+const (
+	// Choice answers are option indices.
+	Choice = "choice"
+	// Numeric answers are a closed range; a single value is a range with Min == Max.
+	Numeric = "numeric"
+	// None is for problems with no answer a machine can check: unknown subtypes and missing or
+	// malformed answers. They are graded by hand, or not at all.
+	None = "none"
+)
+
+// NumericTolerance is the slack of numerical_answer problems. Their answers are entered to two decimal
+// places, so a response is right when it rounds to a value in range.
+const NumericTolerance = 0.005
+
+// Key is a test's answer key.
+type Key struct {
+	TestID int
+	// Marks is the most a student can score, the sum of the sections' MaxMarks.
+	Marks    int
+	Subjects []Subject
+}
+
+type Subject struct {
+	SubjectID int
+	Sections  []Section
+}
+
+type Section struct {
+	Type       string
+	Name       string
+	Compulsory []Problem
+	// Optional is nil when the section has no optional block.
+	Optional *Optional
+}
+
+// Optional is a block of which a student answers MandatoryCount problems. If they answer more, the
+// best MandatoryCount count.
+type Optional struct {
+	MandatoryCount int
+	Problems       []Problem
+}
+
+type Problem struct {
+	ID      int
+	Subtype string
+	// PosMarks and NegMarks are the first level of the cascade that sets either. The largest of
+	// PosMarks is the full marks; NegMarks are deducted for a wrong answer.
+	PosMarks  []int
+	NegMarks  []int
+	FullMarks int
+	Answer    Answer
+}
+
+type Answer struct {
+	Kind string
+	// Options are the zero-based indices of the correct options, ascending. Any one of them is right
+	// for single-answer subtypes; multiple-answer ones need all of them. A matrix_match problem is a
+	// single choice among options that each spell out a full pairing.
+	Options []int
+	// Min, Max and Tolerance bound a numeric answer: a response r is right when
+	// Min - Tolerance <= r <= Max + Tolerance.
+	Min, Max  float64
+	Tolerance float64
+}
+
+// NewKey builds the key of test from its problems. Problems the test references but problems lacks
+// (deleted since, say) get an answer of kind None.
+func NewKey(test *models.Test, problems []*models.Problem) Key {
+	byID := make(map[int]*models.Problem, len(problems))
+	for _, p := range problems {
+		byID[p.ID] = p
+	}
+
+	params := test.TypeParams
+	key := Key{TestID: test.ID, Subjects: make([]Subject, 0, len(params.Subjects))}
+	for _, s := range params.Subjects {
+		subject := Subject{SubjectID: int(s.SubjectID), Sections: make([]Section, 0, len(s.Sections))}
+		for _, sec := range s.Sections {
+			inherited := firstMarks(
+				marks{sec.PosMarks, sec.NegMarks},
+				marks{s.PosMarks, s.NegMarks},
+				marks{params.PosMarks, params.NegMarks})
+			resolve := func(refs []models.ResProblem) []Problem {
+				out := make([]Problem, 0, len(refs))
+				for _, ref := range refs {
+					out = append(out, newProblem(ref, byID[ref.ID], firstMarks(marks{ref.PosMarks, ref.NegMarks}, inherited)))
+				}
+				return out
+			}
+
+			section := Section{Type: sec.Type, Name: sec.Name, Compulsory: resolve(sec.Compulsory.Problems)}
+			if sec.Optional != nil {
+				optional := &Optional{Problems: resolve(sec.Optional.Problems)}
+				optional.MandatoryCount = min(max(int(sec.Optional.MandatoryCount), 0), len(optional.Problems))
+				section.Optional = optional
+			}
+			key.Marks += section.MaxMarks()
+			subject.Sections = append(subject.Sections, section)
+		}
+		key.Subjects = append(key.Subjects, subject)
+	}
+	return key
+}
+
+// marks is one cascade level's marking scheme.
+type marks struct {
+	pos, neg []int8
+}
+
+// firstMarks returns the first level that sets any marks, as the add-test screen fills in a new
+// problem row: section, then subject, then test.
+func firstMarks(levels ...marks) marks {
+	for _, m := range levels {
+		if len(m.pos) > 0 || len(m.neg) > 0 {
+			return m
+		}
+	}
+	return marks{}
+}
+
+func newProblem(ref models.ResProblem, p *models.Problem, m marks) Problem {
+	problem := Problem{ID: ref.ID, PosMarks: ints(m.pos), NegMarks: ints(m.neg), Answer: Answer{Kind: None}}
+	if len(problem.PosMarks) > 0 {
+		problem.FullMarks = slices.Max(problem.PosMarks)
+	}
+	if p == nil {
+		return problem
+	}
+	problem.Subtype = p.Subtype
+	meta := p.MetaData
+	if en := p.GetLangVersion("en"); en != nil {
+		meta = en.MetaData
+	}
+	problem.Answer = NormalizeAnswer(p.Subtype, meta.Answers, len(meta.Options))
+	return problem
+}
+
+// NormalizeAnswer converts a problem's stored answer: one-based option numbers for the MCQ subtypes
+// and matrix_match, one value or a [min, max] pair for numerical_answer and comprehension, one whole
+// number for integer_type. optionCount bounds the option numbers; 0 skips the check. Anything else
+// comes back as kind None.
+func NormalizeAnswer(subtype string, answers []string, optionCount int) Answer {
+	none := Answer{Kind: None}
+	switch subtype {
+	case SingleAnswer, MultipleAnswer, MatrixMatch:
+		options := make([]int, 0, len(answers))
+		for _, a := range answers {
+			n, err := strconv.Atoi(strings.TrimSpace(a))
+			if err != nil || n < 1 || (optionCount > 0 && n > optionCount) {
+				return none
+			}
+			options = append(options, n-1)
+		}
+		slices.Sort(options)
+		options = slices.Compact(options)
+		if len(options) == 0 {
+			return none
+		}
+		return Answer{Kind: Choice, Options: options}
+
+	case IntegerType:
+		if len(answers) != 1 {
+			return none
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(answers[0]), 10, 64)
+		if err != nil {
+			return none
+		}
+		return Answer{Kind: Numeric, Min: float64(n), Max: float64(n)}
+
+	case Numerical, Comprehension:
+		if len(answers) != 1 && len(answers) != 2 {
+			return none
+		}
+		values := make([]float64, len(answers))
+		for i, a := range answers {
+			v, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return none
+			}
+			values[i] = v
+		}
+		lo, hi := values[0], values[len(values)-1]
+		if lo > hi {
+			return none
+		}
+		return Answer{Kind: Numeric, Min: lo, Max: hi, Tolerance: NumericTolerance}
+	}
+	return none
+}
+
+// MaxMarks is the most a student can score in the section: every compulsory problem's full marks plus
+// the full marks of the optional block's MandatoryCount best-paid problems.
+func (s Section) MaxMarks() int {
+	total := 0
+	for _, p := range s.Compulsory {
+		total += p.FullMarks
+	}
+	if s.Optional == nil {
+		return total
+	}
+	full := make([]int, 0, len(s.Optional.Problems))
+	for _, p := range s.Optional.Problems {
+		full = append(full, p.FullMarks)
+	}
+	slices.Sort(full)
+	for _, m := range full[len(full)-s.Optional.MandatoryCount:] {
+		total += m
+	}
+	return total
+}
+
+func ints(in []int8) []int {
+	out := make([]int, 0, len(in))
+	for _, v := range in {
+		out = append(out, int(v))
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package grading
+
+import (
+	"html/template"
+	"reflect"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		name        string
+		subtype     string
+		answers     []string
+		optionCount int
+		want        Answer
+	}{
+		{"single answer", SingleAnswer, []string{"2"}, 4, Answer{Kind: Choice, Options: []int{1}}},
+		{"multiple answers sorted and deduplicated", MultipleAnswer, []string{"4", " 1", "4"}, 4,
+			Answer{Kind: Choice, Options: []int{0, 3}}},
+		{"matrix match is one option", MatrixMatch, []string{"3"}, 4, Answer{Kind: Choice, Options: []int{2}}},
+		{"option past the last", SingleAnswer, []string{"5"}, 4, Answer{Kind: None}},
+		{"option count unknown", SingleAnswer, []string{"5"}, 0, Answer{Kind: Choice, Options: []int{4}}},
+		{"option zero", SingleAnswer, []string{"0"}, 4, Answer{Kind: None}},
+		{"option letter", SingleAnswer, []string{"B"}, 4, Answer{Kind: None}},
+		{"no answer", MultipleAnswer, nil, 4, Answer{Kind: None}},
+		{"integer", IntegerType, []string{"-12"}, 0, Answer{Kind: Numeric, Min: -12, Max: -12}},
+		{"integer with decimals", IntegerType, []string{"1.5"}, 0, Answer{Kind: None}},
+		{"numerical value", Numerical, []string{"9.81"}, 0,
+			Answer{Kind: Numeric, Min: 9.81, Max: 9.81, Tolerance: NumericTolerance}},
+		{"numerical range", Numerical, []string{"1.2", "1.25"}, 0,
+			Answer{Kind: Numeric, Min: 1.2, Max: 1.25, Tolerance: NumericTolerance}},
+		{"comprehension range", Comprehension, []string{"-1", "1"}, 0,
+			Answer{Kind: Numeric, Min: -1, Max: 1, Tolerance: NumericTolerance}},
+		{"range upside down", Numerical, []string{"2", "1"}, 0, Answer{Kind: None}},
+		{"not a number", Numerical, []string{"NaN"}, 0, Answer{Kind: None}},
+		{"three values", Numerical, []string{"1", "2", "3"}, 0, Answer{Kind: None}},
+		{"unknown subtype", "subjective", []string{"anything"}, 0, Answer{Kind: None}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NormalizeAnswer(tc.subtype, tc.answers, tc.optionCount); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("NormalizeAnswer = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	test := &models.Test{
+		ID: 501,
+		TypeParams: models.ResTypeParams{
+			PosMarks: []int8{4},
+			NegMarks: []int8{1},
+			Subjects: []models.ResSubject{
+				{
+					SubjectID: 3,
+					Sections: []models.ResSection{
+						{
+							Type: "mcq_multiple_answer", Name: "Section A",
+							Compulsory: models.ResCompulsory{Problems: []models.ResProblem{
+								{ID: 1}, // test's marks
+								{ID: 2, PosMarks: []int8{4, 3, 2, 1}, NegMarks: []int8{2}}, // its own
+							}},
+						},
+						{
+							Type: "numerical_answer", Name: "Section B", PosMarks: []int8{3},
+							Compulsory: models.ResCompulsory{Problems: []models.ResProblem{{ID: 3}}},
+							Optional: &models.ResOptional{MandatoryCount: 1, Problems: []models.ResProblem{
+								{ID: 4}, {ID: 5, PosMarks: []int8{6}},
+							}},
+						},
+					},
+				},
+				{
+					SubjectID: 4, PosMarks: []int8{2},
+					Sections: []models.ResSection{{
+						Type: "integer_type",
+						// a count past the block's size means all of it
+						Optional: &models.ResOptional{MandatoryCount: 5, Problems: []models.ResProblem{{ID: 6}, {ID: 404}}},
+					}},
+				},
+			},
+		},
+	}
+	options := []template.HTML{"a", "b", "c", "d"}
+	problems := []*models.Problem{
+		{ID: 1, Subtype: SingleAnswer, LangVersions: []models.LangVersion{
+			{LangCode: "hi", MetaData: models.ProbMetaData{Options: options, Answers: []string{"4"}}},
+			{LangCode: "en", MetaData: models.ProbMetaData{Options: options, Answers: []string{"1"}}},
+		}},
+		{ID: 2, Subtype: MultipleAnswer, MetaData: models.ProbMetaData{Options: options, Answers: []string{"1", "3"}}},
+		{ID: 3, Subtype: Numerical, MetaData: models.ProbMetaData{Answers: []string{"2.5"}}},
+		{ID: 4, Subtype: Numerical, MetaData: models.ProbMetaData{Answers: []string{"1", "2"}}},
+		{ID: 5, Subtype: "subjective"},
+		{ID: 6, Subtype: IntegerType, MetaData: models.ProbMetaData{Answers: []string{"7"}}},
+	}
+
+	want := Key{
+		TestID: 501,
+		// section B counts the better of its optional problems; the missing problem still has marks
+		Marks: 4 + 4 + 3 + 6 + 2 + 2,
+		Subjects: []Subject{
+			{SubjectID: 3, Sections: []Section{
+				{Type: "mcq_multiple_answer", Name: "Section A", Compulsory: []Problem{
+					{ID: 1, Subtype: SingleAnswer, PosMarks: []int{4}, NegMarks: []int{1}, FullMarks: 4,
+						Answer: Answer{Kind: Choice, Options: []int{0}}},
+					{ID: 2, Subtype: MultipleAnswer, PosMarks: []int{4, 3, 2, 1}, NegMarks: []int{2}, FullMarks: 4,
+						Answer: Answer{Kind: Choice, Options: []int{0, 2}}},
+				}},
+				{Type: "numerical_answer", Name: "Section B",
+					Compulsory: []Problem{
+						{ID: 3, Subtype: Numerical, PosMarks: []int{3}, NegMarks: []int{}, FullMarks: 3,
+							Answer: Answer{Kind: Numeric, Min: 2.5, Max: 2.5, Tolerance: NumericTolerance}},
+					},
+					Optional: &Optional{MandatoryCount: 1, Problems: []Problem{
+						{ID: 4, Subtype: Numerical, PosMarks: []int{3}, NegMarks: []int{}, FullMarks: 3,
+							Answer: Answer{Kind: Numeric, Min: 1, Max: 2, Tolerance: NumericTolerance}},
+						{ID: 5, Subtype: "subjective", PosMarks: []int{6}, NegMarks: []int{}, FullMarks: 6,
+							Answer: Answer{Kind: None}},
+					}},
+				},
+			}},
+			{SubjectID: 4, Sections: []Section{
+				{Type: "integer_type", Compulsory: []Problem{}, Optional: &Optional{MandatoryCount: 2, Problems: []Problem{
+					{ID: 6, Subtype: IntegerType, PosMarks: []int{2}, NegMarks: []int{}, FullMarks: 2,
+						Answer: Answer{Kind: Numeric, Min: 7, Max: 7}},
+					{ID: 404, PosMarks: []int{2}, NegMarks: []int{}, FullMarks: 2, Answer: Answer{Kind: None}},
+				}}},
+			}},
+		},
+	}
+
+	got := NewKey(test, problems)
+	if got.Marks != want.Marks {
+		t.Errorf("Marks = %d, want %d", got.Marks, want.Marks)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewKey =\n%+v\nwant\n%+v", got, want)
+	}
+}
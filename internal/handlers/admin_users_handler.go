@@ -2,32 +2,53 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
 	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
 	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
 	"github.com/avantifellows/nex-gen-cms/internal/views"
 )
 
 const (
-	adminUsersTemplate   = "admin_users.html"
-	adminUserRowTemplate = "admin_user_row.html"
+	adminUsersTemplate        = "admin_users.html"
+	adminUserRowTemplate      = "admin_user_row.html"
+	adminNavTemplate          = "admin_nav.html"
+	adminUserGrantsTemplate   = "admin_user_grants.html"
+	adminUserSessionsTemplate = "admin_user_sessions.html"
+	adminUserImportTemplate   = "admin_user_import.html"
 )
 
 type AdminUsersHandler struct {
-	users *db.CmsUserRepo
+	users              *db.CmsUserRepo
+	grants             *db.UserGrantRepo
+	sessions           *db.SessionRepo
+	invitations        *db.InvitationRepo
+	providers          *auth.OIDCProviders
+	curriculumsService *services.Service[models.Curriculum]
+	gradesService      *services.Service[models.Grade]
+	subjectsService    *services.Service[models.Subject]
 }
 
-func NewAdminUsersHandler(users *db.CmsUserRepo) *AdminUsersHandler {
-	return &AdminUsersHandler{users: users}
+func NewAdminUsersHandler(users *db.CmsUserRepo, grants *db.UserGrantRepo, sessions *db.SessionRepo,
+	invitations *db.InvitationRepo, providers *auth.OIDCProviders,
+	curriculumsService *services.Service[models.Curriculum], gradesService *services.Service[models.Grade],
+	subjectsService *services.Service[models.Subject]) *AdminUsersHandler {
+	return &AdminUsersHandler{users: users, grants: grants, sessions: sessions, invitations: invitations,
+		providers: providers, curriculumsService: curriculumsService, gradesService: gradesService,
+		subjectsService: subjectsService}
 }
 
 // List renders the admin users page (full page via base template).
 func (h *AdminUsersHandler) List(w http.ResponseWriter, r *http.Request) {
-	users, err := h.users.List(r.Context())
+	users, err := h.listUsers(r)
 	if err != nil {
 		log.Printf("admin users list: %v", err)
 		http.Error(w, "Could not load users", http.StatusInternalServerError)
@@ -37,9 +58,9 @@ func (h *AdminUsersHandler) List(w http.ResponseWriter, r *http.Request) {
 		"Users": users,
 		"Roles": []string{auth.RoleViewer, auth.RoleEditor, auth.RoleAdmin},
 	}
-	// adminUserRowTemplate is referenced from inside adminUsersTemplate via {{ template }}, so it must
-	// be part of the parsed template set.
-	views.ExecuteTemplates(w, data, nil, baseTemplate, adminUsersTemplate, adminUserRowTemplate)
+	// adminUserRowTemplate and adminNavTemplate are referenced from inside adminUsersTemplate via
+	// {{ template }}, so they must be part of the parsed template set.
+	views.ExecuteTemplates(w, data, nil, baseTemplate, adminUsersTemplate, adminUserRowTemplate, adminNavTemplate)
 }
 
 // Create adds a new user. HTMX POST returns the new row.
@@ -60,8 +81,8 @@ func (h *AdminUsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid role", http.StatusBadRequest)
 		return
 	}
-	if !strings.HasSuffix(strings.ToLower(email), "@avantifellows.org") {
-		http.Error(w, "Only @avantifellows.org emails can be added", http.StatusBadRequest)
+	if !h.providers.AcceptsEmail(email) {
+		http.Error(w, "This email's domain can't sign in to the CMS", http.StatusBadRequest)
 		return
 	}
 
@@ -77,12 +98,15 @@ func (h *AdminUsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	created, err := h.users.GetByEmail(r.Context(), email)
-	if err != nil {
+	audit.SetEntity(r.Context(), id)
+	h.invite(r, id, email, models.InvitationManual)
+	created, err := h.findUser(r, id)
+	if err != nil || created == nil {
 		log.Printf("admin users lookup after create id=%d: %v", id, err)
 		http.Error(w, "Created but could not reload", http.StatusInternalServerError)
 		return
 	}
+	audit.SetAfter(r.Context(), created)
 	views.ExecuteTemplate(adminUserRowTemplate, w, created, nil)
 }
 
@@ -101,6 +125,7 @@ func (h *AdminUsersHandler) SetActive(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "You cannot deactivate your own account", http.StatusBadRequest)
 		return
 	}
+	h.auditBefore(r, id)
 
 	if err := h.users.SetActive(r.Context(), id, active); err != nil {
 		if errors.Is(err, db.ErrUserNotFound) {
@@ -111,6 +136,16 @@ func (h *AdminUsersHandler) SetActive(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Could not update user", http.StatusInternalServerError)
 		return
 	}
+	if !active {
+		// The session check already rejects inactive users; revoking also clears their session list.
+		by := ""
+		if claims != nil {
+			by = claims.Email
+		}
+		if _, err := h.sessions.RevokeAll(r.Context(), id, by); err != nil {
+			log.Printf("admin users revoke sessions id=%d: %v", id, err)
+		}
+	}
 	h.renderRowByID(w, r, id)
 }
 
@@ -137,6 +172,7 @@ func (h *AdminUsersHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "You cannot demote your own admin role", http.StatusBadRequest)
 		return
 	}
+	h.auditBefore(r, id)
 
 	if err := h.users.UpdateRole(r.Context(), id, role); err != nil {
 		log.Printf("admin users update role id=%d: %v", id, err)
@@ -147,17 +183,310 @@ func (h *AdminUsersHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AdminUsersHandler) renderRowByID(w http.ResponseWriter, r *http.Request, id int64) {
-	users, err := h.users.List(r.Context())
+	u, err := h.findUser(r, id)
 	if err != nil {
 		log.Printf("admin users reload: %v", err)
 		http.Error(w, "Could not reload user", http.StatusInternalServerError)
 		return
 	}
+	if u == nil {
+		http.NotFound(w, r)
+		return
+	}
+	audit.SetAfter(r.Context(), u)
+	views.ExecuteTemplate(adminUserRowTemplate, w, u, nil)
+}
+
+// auditBefore records the user's current row as the audit before-state.
+func (h *AdminUsersHandler) auditBefore(r *http.Request, id int64) {
+	if audit.FromContext(r.Context()) == nil {
+		return
+	}
+	u, err := h.findUser(r, id)
+	if err != nil {
+		log.Printf("admin users audit lookup id=%d: %v", id, err)
+		return
+	}
+	if u != nil {
+		audit.SetBefore(r.Context(), u)
+	}
+}
+
+// invite records a pending invitation for a newly added user. Failing to record it doesn't undo
+// the user, so it is only logged.
+func (h *AdminUsersHandler) invite(r *http.Request, userID int64, email, source string) {
+	inv := &models.Invitation{UserID: userID, Email: email, Source: source}
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		inv.InvitedBy = claims.Email
+	}
+	if err := h.invitations.Create(r.Context(), inv); err != nil {
+		log.Printf("admin users invite id=%d: %v", userID, err)
+	}
+}
+
+// listUsers lists all users with their invitations attached.
+func (h *AdminUsersHandler) listUsers(r *http.Request) ([]*models.CmsUser, error) {
+	users, err := h.users.List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := h.invitations.ByUser(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		u.Invitation = invitations[u.ID]
+	}
+	return users, nil
+}
+
+// findUser returns the user with the given ID, or nil if there is none.
+func (h *AdminUsersHandler) findUser(r *http.Request, id int64) (*models.CmsUser, error) {
+	users, err := h.listUsers(r)
+	if err != nil {
+		return nil, err
+	}
 	for _, u := range users {
 		if u.ID == id {
-			views.ExecuteTemplate(adminUserRowTemplate, w, u, nil)
-			return
+			return u, nil
 		}
 	}
-	http.NotFound(w, r)
+	return nil, nil
+}
+
+// grantRow is a scoped grant as shown in the grants modal, with its scope spelled out.
+type grantRow struct {
+	ID         int64
+	Curriculum string
+	Grade      string
+	Subject    string
+	Role       string
+	CreatedBy  string
+}
+
+// Grants renders the modal listing a user's scoped grants (see models.UserGrant), with a form to
+// add one. Query params: id (user id).
+func (h *AdminUsersHandler) Grants(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	h.renderGrants(w, r, id)
+}
+
+// CreateGrant grants a role on a curriculum/grade/subject scope, replacing the role of an existing
+// grant on the same scope. Form: user_id, curriculum_id, grade_id, subject_id (empty for any), role.
+func (h *AdminUsersHandler) CreateGrant(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	grant := &models.UserGrant{UserID: userID, Role: r.FormValue("role")}
+	if !auth.ValidRole(grant.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	if v, err := strconv.ParseInt(r.FormValue("curriculum_id"), 10, 16); err == nil && v > 0 {
+		curriculumID := int16(v)
+		grant.CurriculumID = &curriculumID
+	}
+	if v, err := strconv.ParseInt(r.FormValue("grade_id"), 10, 8); err == nil && v > 0 {
+		gradeID := int8(v)
+		grant.GradeID = &gradeID
+	}
+	if v, err := strconv.ParseInt(r.FormValue("subject_id"), 10, 8); err == nil && v > 0 {
+		subjectID := int8(v)
+		grant.SubjectID = &subjectID
+	}
+	if grant.CurriculumID == nil && grant.GradeID == nil && grant.SubjectID == nil {
+		http.Error(w, "Pick a curriculum, grade or subject; use the role column for a global role",
+			http.StatusBadRequest)
+		return
+	}
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		grant.CreatedBy = claims.Email
+	}
+
+	audit.SetEntity(r.Context(), userID)
+	if grant.ID, err = h.grants.Upsert(r.Context(), grant); err != nil {
+		log.Printf("admin users grant user=%d: %v", userID, err)
+		http.Error(w, "Could not save grant", http.StatusInternalServerError)
+		return
+	}
+	audit.SetAfter(r.Context(), grant)
+	h.renderGrants(w, r, userID)
+}
+
+// DeleteGrant removes one of a user's scoped grants. Query params: id (user id), grant.
+func (h *AdminUsersHandler) DeleteGrant(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	grantID, err := strconv.ParseInt(r.URL.Query().Get("grant"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid grant", http.StatusBadRequest)
+		return
+	}
+	audit.SetEntity(r.Context(), userID)
+	audit.SetBefore(r.Context(), map[string]int64{"grant_id": grantID})
+	if err := h.grants.Delete(r.Context(), userID, grantID); err != nil {
+		log.Printf("admin users delete grant user=%d grant=%d: %v", userID, grantID, err)
+		http.Error(w, "Could not delete grant", http.StatusInternalServerError)
+		return
+	}
+	h.renderGrants(w, r, userID)
+}
+
+func (h *AdminUsersHandler) renderGrants(w http.ResponseWriter, r *http.Request, userID int64) {
+	u, err := h.findUser(r, userID)
+	if err != nil {
+		log.Printf("admin users grants lookup id=%d: %v", userID, err)
+		http.Error(w, "Could not load user", http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.NotFound(w, r)
+		return
+	}
+	grants, err := h.grants.ListByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("admin users grants list id=%d: %v", userID, err)
+		http.Error(w, "Could not load grants", http.StatusInternalServerError)
+		return
+	}
+	curriculums, err := h.curriculumsService.GetList(getCurriculumsEndPoint, curriculumsKey, false, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching curriculums: %v", err), http.StatusInternalServerError)
+		return
+	}
+	grades, err := h.gradesService.GetList(getGradesEndPoint, gradesKey, false, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching grades: %v", err), http.StatusInternalServerError)
+		return
+	}
+	subjects, err := h.subjectsService.GetList(handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey, false, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching subjects: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]grantRow, 0, len(grants))
+	for _, g := range grants {
+		row := grantRow{ID: g.ID, Curriculum: "Any", Grade: "Any", Subject: "Any", Role: g.Role, CreatedBy: g.CreatedBy}
+		if g.CurriculumID != nil {
+			row.Curriculum = strconv.Itoa(int(*g.CurriculumID))
+			for _, c := range *curriculums {
+				if c.ID == *g.CurriculumID {
+					row.Curriculum = c.Name
+				}
+			}
+		}
+		if g.GradeID != nil {
+			row.Grade = strconv.Itoa(int(*g.GradeID))
+			for _, gr := range *grades {
+				if gr.ID == *g.GradeID {
+					row.Grade = strconv.Itoa(int(gr.Number))
+				}
+			}
+		}
+		if g.SubjectID != nil {
+			row.Subject = strconv.Itoa(int(*g.SubjectID))
+			for _, s := range *subjects {
+				if s.ID == *g.SubjectID {
+					row.Subject = s.GetNameByLang("en")
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	data := map[string]any{
+		"User":        u,
+		"Grants":      rows,
+		"Curriculums": curriculums,
+		"Grades":      grades,
+		"Subjects":    subjects,
+		"Roles":       []string{auth.RoleViewer, auth.RoleEditor, auth.RoleAdmin},
+	}
+	views.ExecuteTemplate(adminUserGrantsTemplate, w, data, nil)
+}
+
+// Sessions renders the modal listing a user's live sessions. Query params: id (user id).
+func (h *AdminUsersHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	h.renderSessions(w, r, id)
+}
+
+// RevokeSession ends one of a user's sessions, or all of them when session is "all". It takes
+// effect on the user's next request after the session check cache expires (30s at most). Query
+// params: id (user id), session.
+func (h *AdminUsersHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	sessionID := r.URL.Query().Get("session")
+	if sessionID == "" {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+	by := ""
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		by = claims.Email
+	}
+
+	audit.SetEntity(r.Context(), id)
+	if sessionID == "all" {
+		_, err = h.sessions.RevokeAll(r.Context(), id, by)
+	} else {
+		err = h.sessions.Revoke(r.Context(), id, sessionID, by)
+	}
+	if err != nil {
+		log.Printf("admin users revoke session id=%d session=%s: %v", id, sessionID, err)
+		http.Error(w, "Could not revoke session", http.StatusInternalServerError)
+		return
+	}
+	audit.SetAfter(r.Context(), map[string]string{"revoked": sessionID})
+	h.renderSessions(w, r, id)
+}
+
+func (h *AdminUsersHandler) renderSessions(w http.ResponseWriter, r *http.Request, userID int64) {
+	u, err := h.findUser(r, userID)
+	if err != nil {
+		log.Printf("admin users sessions lookup id=%d: %v", userID, err)
+		http.Error(w, "Could not load user", http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.NotFound(w, r)
+		return
+	}
+	sessions, err := h.sessions.ListActive(r.Context(), userID, auth.IdleTimeout())
+	if err != nil {
+		log.Printf("admin users sessions list id=%d: %v", userID, err)
+		http.Error(w, "Could not load sessions", http.StatusInternalServerError)
+		return
+	}
+	current := ""
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		current = claims.ID
+	}
+	views.ExecuteTemplate(adminUserSessionsTemplate, w, map[string]any{
+		"User":     u,
+		"Sessions": sessions,
+		"Current":  current,
+	}, nil)
 }
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/userimport"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+)
+
+// maxImportBytes bounds an uploaded CSV; MaxRows users fit in far less.
+const maxImportBytes = 1 << 20
+
+// importResult is what an import committed, for the result panel and the audit log.
+type importResult struct {
+	Created []string `json:"created"`
+	Failed  []string `json:"failed,omitempty"`
+	Skipped int      `json:"skipped"`
+}
+
+// ImportPreview validates an uploaded CSV (see package userimport) without changing anything and
+// renders the rows with their problems. Form: file (multipart upload) or csv (the text).
+func (h *AdminUsersHandler) ImportPreview(w http.ResponseWriter, r *http.Request) {
+	text, rows, ok := h.parseImport(w, r)
+	if !ok {
+		return
+	}
+	valid := 0
+	for i := range rows {
+		if rows[i].Valid() {
+			valid++
+		}
+	}
+	views.ExecuteTemplates(w, map[string]any{
+		"CSV":   text,
+		"Rows":  rows,
+		"Valid": valid,
+	}, nil, adminUserImportTemplate, adminUserRowTemplate)
+}
+
+// Import re-validates the CSV from the preview and adds its valid rows: each user is created with a
+// pending invitation and their scoped grants. Rows that became invalid since the preview are skipped.
+func (h *AdminUsersHandler) Import(w http.ResponseWriter, r *http.Request) {
+	_, rows, ok := h.parseImport(w, r)
+	if !ok {
+		return
+	}
+	createdBy := ""
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		createdBy = claims.Email
+	}
+
+	var result importResult
+	var created []*models.CmsUser
+	for i := range rows {
+		row := &rows[i]
+		if !row.Valid() {
+			result.Skipped++
+			continue
+		}
+		var fullName *string
+		if row.FullName != "" {
+			fullName = &row.FullName
+		}
+		id, err := h.users.Create(r.Context(), row.Email, row.Role, fullName)
+		if err != nil {
+			log.Printf("admin users import %s: %v", row.Email, err)
+			result.Failed = append(result.Failed, row.Email)
+			continue
+		}
+		h.invite(r, id, row.Email, models.InvitationImport)
+		for _, grant := range row.Grants {
+			grant.UserID, grant.CreatedBy = id, createdBy
+			if _, err := h.grants.Upsert(r.Context(), &grant); err != nil {
+				log.Printf("admin users import grant user=%d: %v", id, err)
+			}
+		}
+		result.Created = append(result.Created, row.Email)
+		created = append(created, &models.CmsUser{ID: id})
+	}
+	audit.SetAfter(r.Context(), result)
+
+	// Reload so the new rows render like the rest of the table.
+	if len(created) > 0 {
+		users, err := h.listUsers(r)
+		if err != nil {
+			log.Printf("admin users import reload: %v", err)
+		}
+		for i, c := range created {
+			for _, u := range users {
+				if u.ID == c.ID {
+					created[i] = u
+				}
+			}
+		}
+	}
+	views.ExecuteTemplates(w, map[string]any{
+		"Result":  result,
+		"Created": created,
+	}, nil, adminUserImportTemplate, adminUserRowTemplate)
+}
+
+// parseImport reads the CSV from the request and validates it against the current users and
+// curriculum data. It writes the error response itself when it returns false.
+func (h *AdminUsersHandler) parseImport(w http.ResponseWriter, r *http.Request) (string, []userimport.Row, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var text string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Choose a CSV file to import", http.StatusBadRequest)
+			return "", nil, false
+		}
+		defer file.Close()
+		b, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, "Could not read the file", http.StatusBadRequest)
+			return "", nil, false
+		}
+		text = string(b)
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return "", nil, false
+		}
+		text = r.FormValue("csv")
+	}
+
+	users, err := h.users.List(r.Context())
+	if err != nil {
+		log.Printf("admin users import list: %v", err)
+		http.Error(w, "Could not load users", http.StatusInternalServerError)
+		return "", nil, false
+	}
+	existing := make(map[string]bool, len(users))
+	for _, u := range users {
+		existing[strings.ToLower(u.Email)] = true
+	}
+	curriculums, err := h.curriculumsService.GetList(getCurriculumsEndPoint, curriculumsKey, false, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching curriculums: %v", err), http.StatusInternalServerError)
+		return "", nil, false
+	}
+	grades, err := h.gradesService.GetList(getGradesEndPoint, gradesKey, false, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching grades: %v", err), http.StatusInternalServerError)
+		return "", nil, false
+	}
+	subjects, err := h.subjectsService.GetList(handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey, false, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching subjects: %v", err), http.StatusInternalServerError)
+		return "", nil, false
+	}
+
+	rows, err := userimport.Parse(strings.NewReader(text), userimport.Options{
+		AllowEmail: h.providers.AcceptsEmail,
+		Existing:   existing,
+		Lookup:     userimport.NewLookup(*curriculums, *grades, *subjects),
+	})
+	if err != nil {
+		msg := err.Error()
+		if !errors.Is(err, userimport.ErrMissingColumns) && !errors.Is(err, userimport.ErrTooManyRows) {
+			msg = fmt.Sprintf("Could not read the CSV: %v", err)
+		}
+		http.Error(w, msg, http.StatusBadRequest)
+		return "", nil, false
+	}
+	return text, rows, true
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const adminAuditTemplate = "admin_audit.html"
+
+// auditPageSize is the number of audit entries shown per page.
+const auditPageSize = 50
+
+// auditEntityTypes lists the entity types audited routes record, for the filter dropdown.
+var auditEntityTypes = []string{"chapter", "topic", "resource", "test", "problem", "user", "service_client",
+	"personal_token", "webhook"}
+
+type AuditHandler struct {
+	auditLog *db.AuditLogRepo
+}
+
+func NewAuditHandler(auditLog *db.AuditLogRepo) *AuditHandler {
+	return &AuditHandler{auditLog: auditLog}
+}
+
+// List renders the admin audit log page. Query params (all optional): user (actor email), entity
+// (type), entity_id, from and to (YYYY-MM-DD, both inclusive), page (1-based).
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	urlVals := r.URL.Query()
+	page := utils.StringToIntOrDefault(urlVals.Get("page"), 1, 1)
+	filter := db.AuditFilter{
+		ActorEmail: urlVals.Get("user"),
+		EntityType: urlVals.Get("entity"),
+		EntityID:   urlVals.Get("entity_id"),
+		From:       parseAuditDate(urlVals.Get("from")),
+		To:         parseAuditDate(urlVals.Get("to")),
+		// one extra row tells whether there is a next page
+		Limit:  auditPageSize + 1,
+		Offset: (page - 1) * auditPageSize,
+	}
+	if !filter.To.IsZero() {
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	entries, err := h.auditLog.List(r.Context(), filter)
+	if err != nil {
+		log.Printf("admin audit list: %v", err)
+		http.Error(w, "Could not load audit log", http.StatusInternalServerError)
+		return
+	}
+	hasNext := len(entries) > auditPageSize
+	if hasNext {
+		entries = entries[:auditPageSize]
+	}
+	actors, err := h.auditLog.Actors(r.Context())
+	if err != nil {
+		log.Printf("admin audit actors: %v", err)
+	}
+
+	data := map[string]any{
+		"Entries":     entries,
+		"Actors":      actors,
+		"EntityTypes": auditEntityTypes,
+		"Filter":      urlVals,
+		"Page":        page,
+		"HasNext":     hasNext,
+	}
+	views.ExecuteTemplates(w, data, template.FuncMap{
+		"pageURL": func(page int) string {
+			vals := url.Values{}
+			for k, v := range urlVals {
+				vals[k] = v
+			}
+			vals.Set("page", strconv.Itoa(page))
+			return "/admin/audit?" + vals.Encode()
+		},
+		"add":        utils.Add,
+		"prettyJSON": prettyJSON,
+	}, baseTemplate, adminAuditTemplate, adminNavTemplate)
+}
+
+// prettyJSON indents a stored payload for display.
+func prettyJSON(raw json.RawMessage) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return out.String()
+}
+
+func parseAuditDate(s string) time.Time {
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// auditBefore records the current state of the object a handler is about to change as the audit
+// entry's before-state. It does nothing on routes that are not audited, and a failed lookup only
+// loses the before-state.
+func auditBefore[T any](ctx context.Context, service *services.Service[T], idStr string,
+	objFindingPredicate func(*T) bool, cacheKey string, urlEndPoint string) {
+	if audit.FromContext(ctx) == nil {
+		return
+	}
+	obj, err := service.GetObject(idStr, objFindingPredicate, cacheKey, urlEndPoint)
+	if err != nil {
+		log.Printf("audit before %s id=%s: %v", urlEndPoint, idStr, err)
+		return
+	}
+	audit.SetBefore(ctx, obj)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/avantifellows/nex-gen-cms/internal/changelog"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	servicev1 "github.com/avantifellows/nex-gen-cms/internal/serviceapi/v1"
+)
+
+// ChangesHandler serves the change feed (see package changelog).
+type ChangesHandler struct {
+	changes *db.ChangeLogRepo
+}
+
+func NewChangesHandler(changes *db.ChangeLogRepo) *ChangesHandler {
+	return &ChangesHandler{changes: changes}
+}
+
+// GetChangesV1 serves GET /api/service/v1/changes: content writes after cursor, oldest first. Query
+// params: cursor, entity_type (repeatable), limit.
+func (h *ChangesHandler) GetChangesV1(responseWriter http.ResponseWriter, request *http.Request) {
+	urlVals := request.URL.Query()
+	after, limit, err := servicev1.ParseChangesQuery(urlVals)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entityTypes := urlVals["entity_type"]
+	for _, entityType := range entityTypes {
+		if !changelog.ValidEntityType(entityType) {
+			http.Error(responseWriter, "Invalid entity_type", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// one extra entry tells whether another page is waiting
+	entries, err := h.changes.List(request.Context(), after, entityTypes, limit+1)
+	if err != nil {
+		log.Printf("change feed after=%d: %v", after, err)
+		http.Error(responseWriter, "Could not load changes", http.StatusInternalServerError)
+		return
+	}
+	writeServiceJSON(responseWriter, request, servicev1.NewChangeList(entries, after, limit))
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/thoas/go-funk"
 
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
 	"github.com/avantifellows/nex-gen-cms/internal/constants"
 	"github.com/avantifellows/nex-gen-cms/internal/dto"
 	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
@@ -83,9 +84,9 @@ func (h *ChaptersHandler) GetChapters(responseWriter http.ResponseWriter, reques
 	} else {
 		filename = chapterDropdownTemplate
 	}
-	views.ExecuteTemplate(filename, responseWriter, chapters, template.FuncMap{
+	views.ExecuteTemplate(filename, responseWriter, chapters, scopeFuncs(request, template.FuncMap{
 		"getName": getChapterName,
-	})
+	}))
 }
 
 func getChapterName(ch models.Chapter, lang string) string {
@@ -93,16 +94,27 @@ func getChapterName(ch models.Chapter, lang string) string {
 }
 
 func (h *ChaptersHandler) getTopics(responseWriter http.ResponseWriter, chapterPtrs []*models.Chapter) {
-	topics, err := h.topicsService.GetList(handlerutils.TopicsEndPoint+"?limit=5000", handlerutils.TopicsKey, false, false)
+	topics, err := h.listTopics()
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error fetching topics: %v", err), http.StatusInternalServerError)
 	} else {
-		*topics = funk.Filter(*topics, func(t *models.Topic) bool {
-			return t.StatusID != constants.StatusArchived
-		}).([]*models.Topic)
+		associateTopicsWithChapters(chapterPtrs, topics)
+	}
+}
 
-		associateTopicsWithChapters(chapterPtrs, *topics)
+// listTopics returns every topic that isn't archived.
+func (h *ChaptersHandler) listTopics() ([]*models.Topic, error) {
+	topics, err := h.topicsService.GetList(handlerutils.TopicsEndPoint+"?limit=5000", handlerutils.TopicsKey, false, false)
+	if err != nil {
+		return nil, err
 	}
+	return activeTopics(*topics), nil
+}
+
+func activeTopics(topics []*models.Topic) []*models.Topic {
+	return funk.Filter(topics, func(t *models.Topic) bool {
+		return t.StatusID != constants.StatusArchived
+	}).([]*models.Topic)
 }
 
 func associateTopicsWithChapters(chapterPtrs []*models.Chapter, topicPtrs []*models.Topic) {
@@ -159,6 +171,9 @@ func (h *ChaptersHandler) UpdateChapter(responseWriter http.ResponseWriter, requ
 	dummyChapterPtr := &models.Chapter{}
 	chapterMap := dummyChapterPtr.BuildMap(chapterCode, chapterName)
 
+	auditBefore(request.Context(), h.chaptersService, chapterIdStr, func(chapter *models.Chapter) bool {
+		return chapter.ID == chapterId
+	}, handlerutils.ChaptersKey, handlerutils.ChaptersEndPoint)
 	_, err = h.chaptersService.UpdateObject(chapterIdStr, handlerutils.ChaptersEndPoint, chapterMap, handlerutils.ChaptersKey,
 		func(chapter *models.Chapter) bool {
 			return (*chapter).ID == chapterId
@@ -199,11 +214,13 @@ func (h *ChaptersHandler) AddChapter(responseWriter http.ResponseWriter, request
 		http.Error(responseWriter, fmt.Sprintf("Error adding chapter: %v", err), http.StatusInternalServerError)
 		return
 	}
+	audit.SetEntity(request.Context(), newChapterPtr.ID)
+	audit.SetAfter(request.Context(), newChapterPtr)
 
 	chapterPtrs := []*models.Chapter{newChapterPtr}
-	views.ExecuteTemplate(chapterRowTemplate, responseWriter, chapterPtrs, template.FuncMap{
+	views.ExecuteTemplate(chapterRowTemplate, responseWriter, chapterPtrs, scopeFuncs(request, template.FuncMap{
 		"getName": getChapterName,
-	})
+	}))
 }
 
 func (h *ChaptersHandler) ArchiveChapter(responseWriter http.ResponseWriter, request *http.Request) {
@@ -217,6 +234,9 @@ func (h *ChaptersHandler) ArchiveChapter(responseWriter http.ResponseWriter, req
 	chapterMap := map[string]any{
 		"cms_status_id": constants.StatusArchived,
 	}
+	auditBefore(request.Context(), h.chaptersService, chapterIdStr, func(chapter *models.Chapter) bool {
+		return chapter.ID == chapterId
+	}, handlerutils.ChaptersKey, handlerutils.ChaptersEndPoint)
 
 	err = h.chaptersService.ArchiveObject(chapterIdStr, handlerutils.ChaptersEndPoint, chapterMap, handlerutils.ChaptersKey,
 		func(chapter *models.Chapter) bool {
@@ -346,9 +366,9 @@ func (h *ChaptersHandler) GetTopics(responseWriter http.ResponseWriter, request
 		 * then just return empty response.
 		 */
 		if chapterDropdownVal == "Select Chapter" || chapterDropdownVal == "" {
-			views.ExecuteTemplate(filename, responseWriter, nil, template.FuncMap{
+			views.ExecuteTemplate(filename, responseWriter, nil, scopeFuncs(request, template.FuncMap{
 				"getName": getTopicName,
-			})
+			}))
 		} else {
 			http.Error(responseWriter, err.Error(), code)
 		}
@@ -367,7 +387,7 @@ func (h *ChaptersHandler) GetTopics(responseWriter http.ResponseWriter, request
 	sortOrder := urlVals.Get("sortOrder")
 	sortTopics(localChapter.Topics, sortColumn, sortOrder)
 
-	views.ExecuteTemplate(filename, responseWriter, localChapter.Topics, template.FuncMap{
+	views.ExecuteTemplate(filename, responseWriter, localChapter.Topics, scopeFuncs(request, template.FuncMap{
 		"getName": getTopicName,
-	})
+	}, localChapter.Scope()))
 }
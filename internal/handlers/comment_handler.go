@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const (
+	problemCommentsTemplate = "problem_comments.html"
+	commentThreadTemplate   = "comment_thread.html"
+	commentsInboxTemplate   = "comments_inbox.html"
+)
+
+// CommentsHandler serves the review comment threads anchored to problem fields, and each user's
+// inbox of open threads on problems they authored.
+type CommentsHandler struct {
+	comments        *db.CommentRepo
+	problemsService *services.Service[models.Problem]
+}
+
+func NewCommentsHandler(comments *db.CommentRepo, problemsService *services.Service[models.Problem]) *CommentsHandler {
+	return &CommentsHandler{comments: comments, problemsService: problemsService}
+}
+
+// GetProblemComments renders the comment panel of a problem. Query params: id (problem id).
+func (h *CommentsHandler) GetProblemComments(responseWriter http.ResponseWriter, request *http.Request) {
+	h.renderPanel(responseWriter, request, utils.StringToInt(request.URL.Query().Get("id")))
+}
+
+// CreateThread opens a thread on a problem field. Query params: id (problem id). Form: field,
+// field_index (options and solutions, 0-based), lang_code, body.
+func (h *CommentsHandler) CreateThread(responseWriter http.ResponseWriter, request *http.Request) {
+	problemId := utils.StringToInt(request.URL.Query().Get("id"))
+	field := request.FormValue("field")
+	body := strings.TrimSpace(request.FormValue("body"))
+	if problemId == 0 || !models.ValidCommentField(field) || body == "" {
+		http.Error(responseWriter, "A field and a comment are required", http.StatusBadRequest)
+		return
+	}
+
+	thread := &models.CommentThread{ProblemID: problemId, Field: field, LangCode: request.FormValue("lang_code")}
+	if field == models.CommentFieldOption || field == models.CommentFieldSolution {
+		problem, err := h.problemsService.GetObject(strconv.Itoa(problemId), func(problem *models.Problem) bool {
+			return problem.ID == problemId
+		}, problemsKey, resourcesEndPoint)
+		if err != nil {
+			http.Error(responseWriter, fmt.Sprintf("Error fetching problem: %v", err), http.StatusInternalServerError)
+			return
+		}
+		index, err := strconv.Atoi(request.FormValue("field_index"))
+		if err != nil || index < 0 || index >= anchorCount(problem, field, thread.LangCode) {
+			http.Error(responseWriter, "Invalid option or solution number", http.StatusBadRequest)
+			return
+		}
+		thread.FieldIndex = &index
+	}
+	first := &models.Comment{Body: body}
+	if claims := auth.FromContext(request.Context()); claims != nil {
+		thread.CreatedByUserID, thread.CreatedByEmail = &claims.UserID, claims.Email
+		first.AuthorUserID, first.AuthorEmail = &claims.UserID, claims.Email
+	}
+
+	if _, err := h.comments.CreateThread(request.Context(), thread, first); err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error saving comment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.renderPanel(responseWriter, request, problemId)
+}
+
+// anchorCount returns how many options or solutions (field) a problem has in langCode, or in its
+// fullest version when it has none in langCode.
+func anchorCount(problem *models.Problem, field, langCode string) int {
+	count := func(meta models.ProbMetaData) int {
+		if field == models.CommentFieldOption {
+			return len(meta.Options)
+		}
+		return len(meta.Solutions)
+	}
+	if version := problem.GetLangVersion(langCode); version != nil {
+		return count(version.MetaData)
+	}
+	most := count(problem.MetaData)
+	for _, version := range problem.LangVersions {
+		most = max(most, count(version.MetaData))
+	}
+	return most
+}
+
+// Reply adds a comment to a thread and renders the thread. Query params: thread. Form: body.
+func (h *CommentsHandler) Reply(responseWriter http.ResponseWriter, request *http.Request) {
+	thread, ok := h.getThread(responseWriter, request)
+	if !ok {
+		return
+	}
+	body := strings.TrimSpace(request.FormValue("body"))
+	if body == "" {
+		http.Error(responseWriter, "Comment is empty", http.StatusBadRequest)
+		return
+	}
+	comment := &models.Comment{ThreadID: thread.ID, Body: body}
+	if claims := auth.FromContext(request.Context()); claims != nil {
+		comment.AuthorUserID, comment.AuthorEmail = &claims.UserID, claims.Email
+	}
+	if err := h.comments.Reply(request.Context(), comment); err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error saving comment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.renderThread(responseWriter, request, thread.ID)
+}
+
+// SetThreadStatus resolves or reopens a thread and renders it. Query params: thread, status
+// (resolved|open).
+func (h *CommentsHandler) SetThreadStatus(responseWriter http.ResponseWriter, request *http.Request) {
+	thread, ok := h.getThread(responseWriter, request)
+	if !ok {
+		return
+	}
+	var err error
+	switch request.URL.Query().Get("status") {
+	case models.ThreadResolved:
+		email := ""
+		if claims := auth.FromContext(request.Context()); claims != nil {
+			email = claims.Email
+		}
+		err = h.comments.Resolve(request.Context(), thread.ID, email)
+	case models.ThreadOpen:
+		err = h.comments.Reopen(request.Context(), thread.ID)
+	default:
+		http.Error(responseWriter, "status must be resolved or open", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error updating comment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	audit.SetAfter(request.Context(), map[string]string{"status": request.URL.Query().Get("status")})
+	h.renderThread(responseWriter, request, thread.ID)
+}
+
+// Inbox renders the signed-in user's open threads on problems they authored.
+func (h *CommentsHandler) Inbox(responseWriter http.ResponseWriter, request *http.Request) {
+	claims := auth.FromContext(request.Context())
+	if claims == nil {
+		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	threads, err := h.comments.Inbox(request.Context(), claims.UserID)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching comments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	views.ExecuteTemplates(responseWriter, threads, nil, baseTemplate, commentsInboxTemplate, commentThreadTemplate)
+}
+
+// getThread loads the thread named by the thread query param, writing the error response itself
+// when it can't. The thread's problem becomes the audited entity.
+func (h *CommentsHandler) getThread(responseWriter http.ResponseWriter, request *http.Request) (*models.CommentThread, bool) {
+	threadId, err := strconv.ParseInt(request.URL.Query().Get("thread"), 10, 64)
+	if err != nil {
+		http.Error(responseWriter, "Invalid thread", http.StatusBadRequest)
+		return nil, false
+	}
+	thread, err := h.comments.GetThread(request.Context(), threadId)
+	if errors.Is(err, db.ErrThreadNotFound) {
+		http.Error(responseWriter, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching comment: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	audit.SetEntity(request.Context(), thread.ProblemID)
+	return thread, true
+}
+
+func (h *CommentsHandler) renderPanel(responseWriter http.ResponseWriter, request *http.Request, problemId int) {
+	threads, err := h.comments.ListByProblem(request.Context(), problemId)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching comments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	openCount := 0
+	for _, t := range threads {
+		if t.Open() {
+			openCount++
+		}
+	}
+	data := map[string]any{
+		"ProblemID": problemId,
+		"Threads":   threads,
+		"OpenCount": openCount,
+		"Fields":    models.CommentFields(),
+		"LangCodes": utils.LangCodes(),
+		// option letters; solutions use the matching number
+		"IndexLetters": []string{"A", "B", "C", "D", "E", "F", "G", "H"},
+	}
+	views.ExecuteTemplates(responseWriter, data, template.FuncMap{
+		"add": utils.Add,
+	}, problemCommentsTemplate, commentThreadTemplate)
+}
+
+func (h *CommentsHandler) renderThread(responseWriter http.ResponseWriter, request *http.Request, threadId int64) {
+	thread, err := h.comments.GetThread(request.Context(), threadId)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching comment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	views.ExecuteTemplate(commentThreadTemplate, responseWriter, thread, nil)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+)
+
+// commentedProblem has four options in English, two in Hindi, and one solution.
+var commentedProblem = models.Problem{ID: 4, LangVersions: []models.LangVersion{
+	{LangCode: "en", MetaData: models.ProbMetaData{Options: []template.HTML{"1", "2", "3", "4"},
+		Solutions: []models.Solution{{Value: "Because"}}}},
+	{LangCode: "hi", MetaData: models.ProbMetaData{Options: []template.HTML{"1", "2"}}},
+}}
+
+func TestAnchorCount(t *testing.T) {
+	tests := []struct {
+		field, lang string
+		want        int
+	}{
+		{models.CommentFieldOption, "en", 4},
+		{models.CommentFieldOption, "hi", 2},
+		{models.CommentFieldOption, "", 4},
+		{models.CommentFieldOption, "mr", 4},
+		{models.CommentFieldSolution, "en", 1},
+		{models.CommentFieldSolution, "hi", 0},
+	}
+	for _, tc := range tests {
+		if got := anchorCount(&commentedProblem, tc.field, tc.lang); got != tc.want {
+			t.Errorf("anchorCount(%s, %q) = %d, want %d", tc.field, tc.lang, got, tc.want)
+		}
+	}
+}
+
+func TestCreateThreadFieldIndex(t *testing.T) {
+	t.Chdir("../..")
+	constants.InitRuntimeConstant()
+
+	tests := []struct {
+		name, field, index, lang string
+		wantStatus               int
+	}{
+		{"option in range", models.CommentFieldOption, "3", "en", http.StatusOK},
+		{"option past the last", models.CommentFieldOption, "4", "en", http.StatusBadRequest},
+		{"option the language lacks", models.CommentFieldOption, "2", "hi", http.StatusBadRequest},
+		{"solution in range", models.CommentFieldSolution, "0", "en", http.StatusOK},
+		{"solution past the last", models.CommentFieldSolution, "1", "en", http.StatusBadRequest},
+		{"far out of range", models.CommentFieldOption, "1000000", "", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			problem, _ := json.Marshal(commentedProblem)
+			newFakeDBService(t, map[string]string{"resource/4": string(problem)})
+			inserted := false
+			comments := newScriptDB(func(query string, _ []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				if strings.Contains(query, "INSERT INTO cms_comment_thread") {
+					inserted = true
+					return []string{"id"}, [][]driver.Value{{int64(12)}}, nil
+				}
+				return []string{"id"}, nil, nil
+			})
+			h := NewCommentsHandler(db.NewCommentRepo(comments), newTestService[models.Problem]())
+
+			form := url.Values{"field": {tc.field}, "field_index": {tc.index}, "lang_code": {tc.lang},
+				"body": {"Check this"}}
+			req := httptest.NewRequest(http.MethodPost, "/problems/comments/create?id=4",
+				strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			h.CreateThread(rec, withUser(req, auth.RoleEditor))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d %q, want %d", rec.Code, rec.Body, tc.wantStatus)
+			}
+			if inserted != (tc.wantStatus == http.StatusOK) {
+				t.Errorf("thread saved = %v", inserted)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/thoas/go-funk"
+
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	servicev1 "github.com/avantifellows/nex-gen-cms/internal/serviceapi/v1"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/workflow"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+// The curriculum tree as service JSON (scope curriculum:read), so LMS practice features can browse
+// what the CMS holds: curriculums, grades, subjects, chapters with their topics, concepts and the
+// problems of a topic. Every list takes limit and offset (see servicev1.Page) and carries an ETag.
+
+// GetCurriculumsV1 serves GET /api/service/v1/curriculums.
+func (h *CurriculumsHandler) GetCurriculumsV1(responseWriter http.ResponseWriter, request *http.Request) {
+	offset, limit, ok := servicePaging(responseWriter, request)
+	if !ok {
+		return
+	}
+	curriculums, err := listWithoutCaching(h.service, getCurriculumsEndPoint, curriculumsKey)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching curriculums: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var list servicev1.CurriculumList
+	list.Curriculums, list.Page = servicev1.Paginate(servicev1.Convert(*curriculums, servicev1.NewCurriculum), offset, limit)
+	writeServiceJSON(responseWriter, request, list)
+}
+
+// GetGradesV1 serves GET /api/service/v1/grades.
+func (h *GradesHandler) GetGradesV1(responseWriter http.ResponseWriter, request *http.Request) {
+	offset, limit, ok := servicePaging(responseWriter, request)
+	if !ok {
+		return
+	}
+	grades, err := listWithoutCaching(h.service, getGradesEndPoint, gradesKey)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching grades: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var list servicev1.GradeList
+	list.Grades, list.Page = servicev1.Paginate(servicev1.Convert(*grades, servicev1.NewGrade), offset, limit)
+	writeServiceJSON(responseWriter, request, list)
+}
+
+// GetSubjectsV1 serves GET /api/service/v1/subjects. Query params: parent_id (only the sub-subjects
+// of that subject).
+func (h *SubjectsHandler) GetSubjectsV1(responseWriter http.ResponseWriter, request *http.Request) {
+	offset, limit, ok := servicePaging(responseWriter, request)
+	if !ok {
+		return
+	}
+	urlVals := request.URL.Query()
+	var parentId int8
+	if urlVals.Has("parent_id") {
+		var err error
+		if parentId, err = utils.StringToIntType[int8](urlVals.Get("parent_id")); err != nil {
+			http.Error(responseWriter, "Invalid parent_id", http.StatusBadRequest)
+			return
+		}
+	}
+	subjects, err := listWithoutCaching(h.service, handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching subjects: %v", err), http.StatusInternalServerError)
+		return
+	}
+	filtered := *subjects
+	if parentId != 0 {
+		filtered = funk.Filter(filtered, func(s *models.Subject) bool {
+			return s.ParentID == parentId
+		}).([]*models.Subject)
+	}
+	var list servicev1.SubjectList
+	list.Subjects, list.Page = servicev1.Paginate(servicev1.Convert(filtered, servicev1.NewSubject), offset, limit)
+	writeServiceJSON(responseWriter, request, list)
+}
+
+// GetChaptersV1 serves GET /api/service/v1/chapters, each chapter with its topics in the curriculum.
+// Query params: curriculum_id, subject_id, grade_id (optional), q (matches code or any name),
+// include_topics (false to leave topics out).
+func (h *ChaptersHandler) GetChaptersV1(responseWriter http.ResponseWriter, request *http.Request) {
+	offset, limit, ok := servicePaging(responseWriter, request)
+	if !ok {
+		return
+	}
+	urlVals := request.URL.Query()
+	curriculumId, err1 := utils.StringToIntType[int16](urlVals.Get("curriculum_id"))
+	subjectId, err2 := utils.StringToIntType[int8](urlVals.Get("subject_id"))
+	if err1 != nil || err2 != nil || curriculumId == 0 || subjectId == 0 {
+		http.Error(responseWriter, "curriculum_id and subject_id are required", http.StatusBadRequest)
+		return
+	}
+	queryParams := fmt.Sprintf("?"+QUERY_PARAM_CURRICULUM_ID+"=%d&subject_id=%d", curriculumId, subjectId)
+	if urlVals.Has("grade_id") {
+		gradeId, err := utils.StringToIntType[int8](urlVals.Get("grade_id"))
+		if err != nil {
+			http.Error(responseWriter, "Invalid grade_id", http.StatusBadRequest)
+			return
+		}
+		queryParams += fmt.Sprintf("&grade_id=%d", gradeId)
+	}
+
+	chapters, err := h.chaptersService.GetList(handlerutils.ChaptersEndPoint+queryParams, "", false, true)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching chapters: %v", err), http.StatusInternalServerError)
+		return
+	}
+	q := strings.ToLower(strings.TrimSpace(urlVals.Get("q")))
+	filtered := funk.Filter(*chapters, func(c *models.Chapter) bool {
+		return c.StatusID != constants.StatusArchived && (q == "" || chapterMatches(c, q))
+	}).([]*models.Chapter)
+	for _, chapterPtr := range filtered {
+		chapterPtr.CurriculumID = curriculumId
+	}
+	sortChapters(filtered, urlVals.Get("sortColumn"), urlVals.Get("sortOrder"))
+
+	filtered, page := servicev1.Paginate(filtered, offset, limit)
+	includeTopics := urlVals.Get("include_topics") != "false"
+	if includeTopics {
+		topics, err := listWithoutCaching(h.topicsService, handlerutils.TopicsEndPoint+"?limit=5000", handlerutils.TopicsKey)
+		if err != nil {
+			http.Error(responseWriter, fmt.Sprintf("Error fetching topics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		associateTopicsWithChapters(filtered, activeTopics(*topics))
+	}
+	list := servicev1.ChapterList{Chapters: servicev1.Convert(filtered, servicev1.NewChapter), Page: page}
+	writeServiceJSON(responseWriter, request, list)
+}
+
+func chapterMatches(c *models.Chapter, q string) bool {
+	return strings.Contains(strings.ToLower(c.Code), q) || slices.ContainsFunc(c.Name, func(n models.ChapterLang) bool {
+		return strings.Contains(strings.ToLower(n.ChapterName), q)
+	})
+}
+
+// GetConceptsV1 serves GET /api/service/v1/concepts. Query params: topic_id.
+func (h *ConceptsHandler) GetConceptsV1(responseWriter http.ResponseWriter, request *http.Request) {
+	offset, limit, ok := servicePaging(responseWriter, request)
+	if !ok {
+		return
+	}
+	topicId, err := utils.StringToIntType[int16](request.URL.Query().Get(QUERY_PARAM_TOPIC_ID))
+	if err != nil || topicId == 0 {
+		http.Error(responseWriter, "topic_id is required", http.StatusBadRequest)
+		return
+	}
+	concepts, err := h.service.GetList(conceptsEndPoint+fmt.Sprintf("?"+QUERY_PARAM_TOPIC_ID+"=%d", topicId),
+		"", false, true)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching concepts: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var list servicev1.ConceptList
+	list.Concepts, list.Page = servicev1.Paginate(servicev1.Convert(*concepts, servicev1.NewConcept), offset, limit)
+	writeServiceJSON(responseWriter, request, list)
+}
+
+// GetTopicProblemsV1 serves GET /api/service/v1/topics/{id}/problems. Query params: difficulty
+// (repeatable: easy, medium, hard), subtype, include_unpublished.
+func (h *ProblemsHandler) GetTopicProblemsV1(responseWriter http.ResponseWriter, request *http.Request) {
+	offset, limit, ok := servicePaging(responseWriter, request)
+	if !ok {
+		return
+	}
+	topicId, err := utils.StringToIntType[int16](request.PathValue("id"))
+	if err != nil {
+		http.Error(responseWriter, "Invalid topic id", http.StatusBadRequest)
+		return
+	}
+	problems, err := h.problemsService.GetList(problemsEndPoint+fmt.Sprintf("?topic_id=%d", topicId), "", false, true)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching problems: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	urlVals := request.URL.Query()
+	// filterProblems drops archived problems too
+	filterProblems(problems, urlVals["difficulty"], urlVals.Get("subtype"), "")
+	filtered := *problems
+	if !includeUnpublished(urlVals) {
+		filtered = funk.Filter(filtered, func(p *models.Problem) bool {
+			return workflow.IsPublished(p.StatusID)
+		}).([]*models.Problem)
+	}
+	var list servicev1.ProblemList
+	list.Problems, list.Page = servicev1.Paginate(servicev1.Convert(filtered, servicev1.NewProblem), offset, limit)
+	writeServiceJSON(responseWriter, request, list)
+}
+
+// listWithoutCaching returns the list the CMS screens cached under cacheKey or, when they haven't,
+// fetches it without caching it, so that service reads never fill a UI cache key. Lists filtered by
+// query params are fetched with an empty cache key instead.
+func listWithoutCaching[T any](service *services.Service[T], urlEndPoint, cacheKey string) (*[]*T, error) {
+	if list, _ := service.GetList(urlEndPoint, cacheKey, true, false); list != nil {
+		return list, nil
+	}
+	return service.GetList(urlEndPoint, "", false, true)
+}
+
+// servicePaging reads limit and offset, writing the 400 itself when it returns false.
+func servicePaging(responseWriter http.ResponseWriter, request *http.Request) (offset, limit int, ok bool) {
+	offset, limit, err := servicev1.ParsePaging(request.URL.Query())
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return offset, limit, true
+}
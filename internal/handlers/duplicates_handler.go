@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"text/template"
+
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/similarity"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+)
+
+const adminDuplicatesTemplate = "admin_duplicates.html"
+
+// rebuildPageSize is how many problems are pulled from problems/search per request while
+// rebuilding the fingerprint index.
+const rebuildPageSize = 200
+
+type DuplicatesHandler struct {
+	problemsService *services.Service[models.Problem]
+	subjectsService *services.Service[models.Subject]
+	fingerprints    *db.ProblemFingerprintRepo
+}
+
+func NewDuplicatesHandler(problemsService *services.Service[models.Problem],
+	subjectsService *services.Service[models.Subject], fingerprints *db.ProblemFingerprintRepo) *DuplicatesHandler {
+	return &DuplicatesHandler{problemsService: problemsService, subjectsService: subjectsService,
+		fingerprints: fingerprints}
+}
+
+// Report renders the admin page listing clusters of near-duplicate problems, grouped per subject.
+func (h *DuplicatesHandler) Report(w http.ResponseWriter, r *http.Request) {
+	fps, err := h.fingerprints.List(r.Context())
+	if err != nil {
+		log.Printf("admin duplicates list: %v", err)
+		http.Error(w, "Could not load fingerprints", http.StatusInternalServerError)
+		return
+	}
+
+	subjectNames := map[int8]string{}
+	subjects, err := h.subjectsService.GetList(handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey, false, false)
+	if err == nil {
+		for _, subject := range *subjects {
+			subjectNames[subject.ID] = subject.GetNameByLang("en")
+		}
+	}
+
+	data := map[string]interface{}{
+		"Clusters": similarity.Clusters(fps, similarity.DuplicateThreshold),
+		"Indexed":  len(fps),
+	}
+	views.ExecuteTemplates(w, data, template.FuncMap{
+		"percent": similarityPercent,
+		"subjectName": func(id int8) string {
+			if name, ok := subjectNames[id]; ok {
+				return name
+			}
+			return strconv.Itoa(int(id))
+		},
+	}, baseTemplate, adminDuplicatesTemplate, adminNavTemplate)
+}
+
+// Rebuild re-fingerprints every non-archived problem by paging through problems/search. Problems
+// saved through the CMS are indexed as they are saved; this backfills everything else.
+func (h *DuplicatesHandler) Rebuild(w http.ResponseWriter, r *http.Request) {
+	indexed := 0
+	for offset := 0; ; offset += rebuildPageSize {
+		endPoint := fmt.Sprintf("%s?search=&limit=%d&offset=%d", searchProblemsEndPoint, rebuildPageSize, offset)
+		problems, err := h.problemsService.GetList(endPoint, "", false, true)
+		if err != nil {
+			log.Printf("admin duplicates rebuild offset=%d: %v", offset, err)
+			http.Error(w, fmt.Sprintf("Error fetching problems: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		for _, problemPtr := range *problems {
+			if problemPtr.StatusID == constants.StatusArchived {
+				continue
+			}
+			fp := similarity.Fingerprint{
+				ProblemID: problemPtr.ID,
+				Code:      problemPtr.Code,
+				SubjectID: problemPtr.SubjectID,
+				Signature: similarity.Compute(similarity.ProblemText(problemPtr)),
+			}
+			if err := h.fingerprints.Upsert(r.Context(), fp); err != nil {
+				log.Printf("admin duplicates rebuild problem=%d: %v", problemPtr.ID, err)
+				http.Error(w, "Could not store fingerprints", http.StatusInternalServerError)
+				return
+			}
+			indexed++
+		}
+
+		if len(*problems) < rebuildPageSize {
+			break
+		}
+	}
+
+	log.Printf("admin duplicates rebuild: indexed %d problems", indexed)
+	w.Header().Set("HX-Refresh", "true")
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/dto"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const (
+	editLockBannerTemplate    = "edit_lock_banner.html"
+	editConflictModalTemplate = "edit_conflict_modal.html"
+)
+
+// The edit screens heartbeat every 30s; a lock is dropped after missing a few of them.
+const editLockTTL = 90 * time.Second
+
+// Optimistic concurrency on test and problem saves. The edit screens send the version they loaded
+// in versionTokenHeader; a save based on an older version is answered 409 with a conflict prompt,
+// unless forceSaveHeader is set because the editor chose to overwrite. Such a save claims its
+// version before it reaches db-service, and only while its token is still the latest version, so
+// that of two saves from the same token only one gets through. Successful saves answer with the new
+// version in versionTokenHeader.
+const (
+	versionTokenHeader = "X-Version-Token"
+	forceSaveHeader    = "X-Force-Save"
+)
+
+// EditLockHandler keeps the soft "X is editing this" locks of the test and problem edit screens.
+// Locks are advisory only: saving is guarded by version tokens, not by the lock.
+type EditLockHandler struct {
+	locks *db.EditLockRepo
+}
+
+func NewEditLockHandler(locks *db.EditLockRepo) *EditLockHandler {
+	return &EditLockHandler{locks: locks}
+}
+
+// Heartbeat takes or refreshes the signed-in user's lock and renders a banner naming the other
+// users currently editing the same entity (empty when there are none). Query params: entity
+// (test|problem), id.
+func (h *EditLockHandler) Heartbeat(responseWriter http.ResponseWriter, request *http.Request) {
+	entityType, entityId, ok := editLockTarget(responseWriter, request)
+	if !ok {
+		return
+	}
+	claims := auth.FromContext(request.Context())
+	if claims == nil {
+		http.Error(responseWriter, "Not signed in", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.locks.Heartbeat(request.Context(), entityType, entityId, claims.UserID, claims.Email); err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error saving edit lock: %v", err), http.StatusInternalServerError)
+		return
+	}
+	others, err := h.locks.Others(request.Context(), entityType, entityId, claims.UserID, editLockTTL)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error loading edit locks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	views.ExecuteTemplate(editLockBannerTemplate, responseWriter, map[string]any{
+		"EntityType": entityType,
+		"Others":     others,
+	}, template.FuncMap{
+		"since": editingSince,
+	})
+}
+
+// Release drops the signed-in user's lock when the edit screen is left. It is sent with
+// navigator.sendBeacon, so it answers 204 and never fails loudly. Query params: entity, id.
+func (h *EditLockHandler) Release(responseWriter http.ResponseWriter, request *http.Request) {
+	entityType, entityId, ok := editLockTarget(responseWriter, request)
+	if !ok {
+		return
+	}
+	if claims := auth.FromContext(request.Context()); claims != nil {
+		if err := h.locks.Release(request.Context(), entityType, entityId, claims.UserID); err != nil {
+			log.Printf("edit lock release %s=%d: %v", entityType, entityId, err)
+		}
+	}
+	responseWriter.WriteHeader(http.StatusNoContent)
+}
+
+func editLockTarget(responseWriter http.ResponseWriter, request *http.Request) (string, int, bool) {
+	urlVals := request.URL.Query()
+	entityType := urlVals.Get("entity")
+	entityId := utils.StringToInt(urlVals.Get("id"))
+	if (entityType != reviewEntityTest && entityType != reviewEntityProblem) || entityId == 0 {
+		http.Error(responseWriter, "Invalid entity", http.StatusBadRequest)
+		return "", 0, false
+	}
+	return entityType, entityId, true
+}
+
+func editingSince(t time.Time) string {
+	minutes := int(time.Since(t).Minutes())
+	if minutes < 1 {
+		return "just now"
+	}
+	return fmt.Sprintf("for %d min", minutes)
+}
+
+// staleSave reports whether a save was based on an older version than latest. Requests without a
+// token (anything other than the edit screens) and forced saves are never stale.
+func staleSave(request *http.Request, latest int) (token int, stale bool) {
+	token, checked := checkedToken(request)
+	return token, checked && token != latest
+}
+
+// checkedToken returns the version token of a save that must be based on the latest version, i.e.
+// one from an edit screen that the editor didn't force.
+func checkedToken(request *http.Request) (token int, checked bool) {
+	if request.Header.Get(forceSaveHeader) == "true" {
+		return 0, false
+	}
+	token, err := strconv.Atoi(request.Header.Get(versionTokenHeader))
+	if err != nil {
+		return 0, false
+	}
+	return token, true
+}
+
+// writeEditConflict answers 409 with the conflict prompt the edit screens show in a modal.
+func writeEditConflict(responseWriter http.ResponseWriter, conflict dto.EditConflict) {
+	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	responseWriter.WriteHeader(http.StatusConflict)
+	views.ExecuteTemplate(editConflictModalTemplate, responseWriter, conflict, nil)
+}
+
+// conflictDiffURL links the history diff of what was saved after the editor's version. Content
+// first saved through the CMS after it was loaded (token 0) is diffed from its baseline, v1.
+func conflictDiffURL(historyPath string, entityId, token, latest int) string {
+	from := max(token, 1)
+	if from >= latest {
+		return ""
+	}
+	return fmt.Sprintf("%s/diff?id=%d&from=%d&to=%d", historyPath, entityId, from, latest)
+}
+
+// setVersionToken hands the version a save just recorded back to the edit screen, so that its
+// next save isn't mistaken for a stale one. A failed version record leaves the header unset.
+func setVersionToken(responseWriter http.ResponseWriter, version int) {
+	if version > 0 {
+		responseWriter.Header().Set(versionTokenHeader, strconv.Itoa(version))
+	}
+}
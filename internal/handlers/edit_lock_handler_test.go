@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+)
+
+func TestStaleSave(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		force     bool
+		latest    int
+		wantToken int
+		wantStale bool
+	}{
+		{"latest version", "4", false, 4, 4, false},
+		{"older version", "3", false, 4, 3, true},
+		{"loaded before any CMS save", "0", false, 2, 0, true},
+		{"no token", "", false, 4, 0, false},
+		{"unreadable token", "v3", false, 4, 0, false},
+		{"forced", "3", true, 4, 0, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/update-test?id=9", nil)
+			if tc.token != "" {
+				req.Header.Set(versionTokenHeader, tc.token)
+			}
+			if tc.force {
+				req.Header.Set(forceSaveHeader, "true")
+			}
+			token, stale := staleSave(req, tc.latest)
+			if token != tc.wantToken || stale != tc.wantStale {
+				t.Errorf("staleSave = %d, %v; want %d, %v", token, stale, tc.wantToken, tc.wantStale)
+			}
+		})
+	}
+}
+
+func TestConflictDiffURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		token, latest int
+		want          string
+	}{
+		{"one save in between", 3, 4, "/tests/history/diff?id=9&from=3&to=4"},
+		{"first CMS save diffs from the baseline", 0, 3, "/tests/history/diff?id=9&from=1&to=3"},
+		{"nothing to diff", 0, 1, ""},
+		{"token not older", 4, 4, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := conflictDiffURL("/tests/history", 9, tc.token, tc.latest); got != tc.want {
+				t.Errorf("conflictDiffURL = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// versionsDB is a cms_test_version table for the test 9 with CMS-saved versions up to latest. A
+// conditional insert succeeds only when its expected version is latest, as in Postgres. With race
+// set, another save records a version right after the first version check; deleted records the
+// versions the handler gave back.
+type versionsDB struct {
+	mu      sync.Mutex
+	latest  int64
+	race    bool
+	deleted []int64
+}
+
+func (v *versionsDB) script(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch {
+	case strings.Contains(query, "SELECT EXISTS"):
+		return []string{"exists"}, [][]driver.Value{{true}}, nil
+	case strings.Contains(query, "pg_advisory_xact_lock"):
+		return nil, nil, nil
+	case strings.HasPrefix(strings.TrimSpace(query), "INSERT INTO cms_test_version"):
+		if expected, ok := args[6].Value.(int64); ok && expected != v.latest {
+			return []string{"version"}, nil, nil
+		}
+		v.latest++
+		return []string{"version"}, [][]driver.Value{{v.latest}}, nil
+	case strings.HasPrefix(strings.TrimSpace(query), "DELETE FROM cms_test_version"):
+		v.deleted = append(v.deleted, args[1].Value.(int64))
+		return nil, [][]driver.Value{{}}, nil
+	case strings.Contains(query, "FROM cms_test_version"):
+		row := []driver.Value{v.latest, int64(9), v.latest, "update", "", nil, "other@example.org", time.Now()}
+		if v.race {
+			v.latest, v.race = v.latest+1, false
+		}
+		return []string{"id", "test_id", "version", "action", "note", "actor_user_id", "actor_email", "created_at"},
+			[][]driver.Value{row}, nil
+	}
+	return nil, nil, nil
+}
+
+func TestUpdateTestVersionClaim(t *testing.T) {
+	t.Chdir("../..")
+	constants.InitRuntimeConstant()
+
+	tests := []struct {
+		name        string
+		race        bool
+		rejectPatch bool
+		wantStatus  int
+		wantPatched bool
+		wantToken   string
+		wantDeleted []int64
+	}{
+		{"based on the latest version", false, false, http.StatusOK, true, "4", nil},
+		{"lost the claim to a save from the same token", true, false, http.StatusConflict, false, "", nil},
+		{"db-service rejects the save", false, true, http.StatusUnprocessableEntity, true, "", []int64{4}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stored, _ := json.Marshal(models.Test{ID: 9, Subtype: "major_test", StatusID: constants.StatusDraft})
+			fake := newFakeDBService(t, map[string]string{"resource/9": string(stored)})
+			fake.rejectPatches = tc.rejectPatch
+			versions := &versionsDB{latest: 3, race: tc.race}
+			noDB := newScriptDB(nil)
+			h := NewTestsHandler(newTestService[models.Test](), nil, nil, nil, nil, nil, nil, nil, nil,
+				db.NewTestVersionRepo(newScriptDB(versions.script)), db.NewImageRepo(noDB),
+				db.NewProblemExposureRepo(noDB))
+			req := withUser(httptest.NewRequest(http.MethodPatch, "/update-test?id=9",
+				strings.NewReader(`{"code":"T9","subtype":"major_test"}`)), auth.RoleEditor)
+			req.Header.Set(versionTokenHeader, "3")
+			rec := httptest.NewRecorder()
+			h.UpdateTest(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d %q, want %d", rec.Code, rec.Body, tc.wantStatus)
+			}
+			if patched := fake.patch("resource/9") != nil; patched != tc.wantPatched {
+				t.Errorf("patched = %v, want %v", patched, tc.wantPatched)
+			}
+			if got := rec.Header().Get(versionTokenHeader); got != tc.wantToken {
+				t.Errorf("version token = %q, want %q", got, tc.wantToken)
+			}
+			if !slices.Equal(versions.deleted, tc.wantDeleted) {
+				t.Errorf("released versions = %v, want %v", versions.deleted, tc.wantDeleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/exposure"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const adminExposureTemplate = "admin_exposure.html"
+
+// mostUsedLimit is how many of the most used problems the admin page lists.
+const mostUsedLimit = 50
+
+// rebuildTestsPageSize is how many tests are pulled per request while rebuilding exposure.
+const rebuildTestsPageSize = 200
+
+type ExposureHandler struct {
+	testsService *services.Service[models.Test]
+	exposures    *db.ProblemExposureRepo
+}
+
+func NewExposureHandler(testsService *services.Service[models.Test], exposures *db.ProblemExposureRepo) *ExposureHandler {
+	return &ExposureHandler{testsService: testsService, exposures: exposures}
+}
+
+// Report renders the admin page listing the problems used in the most tests.
+func (h *ExposureHandler) Report(w http.ResponseWriter, r *http.Request) {
+	problems, tests, err := h.exposures.Count(r.Context())
+	if err != nil {
+		log.Printf("admin exposure count: %v", err)
+		http.Error(w, "Could not load exposure", http.StatusInternalServerError)
+		return
+	}
+	ids, err := h.exposures.MostUsed(r.Context(), mostUsedLimit)
+	if err != nil {
+		log.Printf("admin exposure most used: %v", err)
+		http.Error(w, "Could not load exposure", http.StatusInternalServerError)
+		return
+	}
+	summaries, err := h.exposures.Summaries(r.Context(), ids, 0, nil, time.Time{})
+	if err != nil {
+		log.Printf("admin exposure summaries: %v", err)
+		http.Error(w, "Could not load exposure", http.StatusInternalServerError)
+		return
+	}
+	mostUsed := make([]exposure.Summary, 0, len(ids))
+	for _, id := range ids {
+		mostUsed = append(mostUsed, summaries[id])
+	}
+
+	data := map[string]interface{}{
+		"MostUsed":   mostUsed,
+		"Problems":   problems,
+		"Tests":      tests,
+		"WindowDays": exposureWindowDays(),
+	}
+	views.ExecuteTemplates(w, data, nil, baseTemplate, adminExposureTemplate, adminNavTemplate)
+}
+
+// Rebuild records the appearances of every test by paging through the tests list. Tests saved through
+// the CMS are recorded as they are saved; this backfills the rest and dates them from delivery or
+// version history (see db.ProblemExposureRepo.Backfill).
+func (h *ExposureHandler) Rebuild(w http.ResponseWriter, r *http.Request) {
+	recorded := 0
+	for offset := 0; ; offset += rebuildTestsPageSize {
+		endPoint := fmt.Sprintf("%s?search=&type=test&limit=%d&offset=%d", resourcesEndPoint, rebuildTestsPageSize, offset)
+		tests, err := h.testsService.GetList(endPoint, "", false, true)
+		if err != nil {
+			log.Printf("admin exposure rebuild offset=%d: %v", offset, err)
+			http.Error(w, fmt.Sprintf("Error fetching tests: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		for _, testPtr := range *tests {
+			if err := h.exposures.Backfill(r.Context(), testPtr.ID, exposure.Appearances(testPtr)); err != nil {
+				log.Printf("admin exposure rebuild test=%d: %v", testPtr.ID, err)
+				http.Error(w, "Could not store exposure", http.StatusInternalServerError)
+				return
+			}
+			recorded++
+		}
+
+		if len(*tests) < rebuildTestsPageSize {
+			break
+		}
+	}
+
+	log.Printf("admin exposure rebuild: recorded %d tests", recorded)
+	w.Header().Set("HX-Refresh", "true")
+}
+
+// recordExposure records the problems of a saved test. Edit saves carry neither the subtype nor the
+// curriculum grades, so those come from the stored test. Failures are logged only, so that exposure
+// never blocks a save.
+func (h *TestsHandler) recordExposure(ctx context.Context, test *models.Test) {
+	if test == nil || test.ID == 0 {
+		return
+	}
+	saved := *test
+	if saved.Subtype == "" || len(saved.CurriculumGrades) == 0 {
+		stored, err := h.testsService.GetObject(strconv.Itoa(saved.ID),
+			func(t *models.Test) bool {
+				return t.ID == saved.ID
+			}, testsKey, resourcesEndPoint)
+		if err != nil {
+			log.Printf("problem exposure test=%d: %v", saved.ID, err)
+			return
+		}
+		if saved.Subtype == "" {
+			saved.Subtype = stored.Subtype
+		}
+		if len(saved.CurriculumGrades) == 0 {
+			saved.CurriculumGrades = stored.CurriculumGrades
+		}
+	}
+	if err := h.exposures.Sync(ctx, saved.ID, exposure.Appearances(&saved)); err != nil {
+		log.Printf("problem exposure test=%d: %v", saved.ID, err)
+	}
+}
+
+// problemExposure looks up the usage of problems for the add-test screen. The exposure-test-id param
+// names the test being edited, whose own appearances don't count; exposure-scope holds its curriculum
+// grades as JSON, for the recent-use warning. A failed lookup is logged and shows no badges.
+func problemExposure(ctx context.Context, exposures *db.ProblemExposureRepo, problems []*models.Problem,
+	urlValues url.Values) map[int]exposure.Summary {
+	var pairs []models.CurriculumGrade
+	if scope := urlValues.Get("exposure-scope"); scope != "" {
+		if err := json.Unmarshal([]byte(scope), &pairs); err != nil {
+			log.Printf("problem exposure scope %q: %v", scope, err)
+		}
+	}
+	ids := make([]int, len(problems))
+	for i, p := range problems {
+		ids[i] = p.ID
+	}
+	summaries, err := exposures.Summaries(ctx, ids, utils.StringToInt(urlValues.Get("exposure-test-id")), pairs,
+		time.Now().Add(-exposure.Window()))
+	if err != nil {
+		log.Printf("problem exposure: %v", err)
+		return nil
+	}
+	return summaries
+}
+
+// exposureFuncs lets src_problem_row.html look up each problem's badge.
+func exposureFuncs(summaries map[int]exposure.Summary) template.FuncMap {
+	return template.FuncMap{
+		"exposure": func(problemID int) exposure.Summary {
+			return summaries[problemID]
+		},
+		"exposureWindowDays": exposureWindowDays,
+		"exposureShown":      func() bool { return summaries != nil },
+	}
+}
+
+func exposureWindowDays() int {
+	return int(exposure.Window() / (24 * time.Hour))
+}
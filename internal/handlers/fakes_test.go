@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	local_repo "github.com/avantifellows/nex-gen-cms/internal/repositories/local"
+	remote_repo "github.com/avantifellows/nex-gen-cms/internal/repositories/remote"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+)
+
+// fakeDBService stands in for db-service: GETs answer from objects by path, PATCHes are recorded and
+// echo the stored object, or fail with rejectPatches set.
+type fakeDBService struct {
+	mu            sync.Mutex
+	objects       map[string]string
+	patches       map[string][]byte
+	rejectPatches bool
+}
+
+// newFakeDBService starts a fake db-service and points DB_SERVICE_ENDPOINT at it for the test.
+func newFakeDBService(t *testing.T, objects map[string]string) *fakeDBService {
+	f := &fakeDBService{objects: objects, patches: map[string][]byte{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	t.Setenv("DB_SERVICE_ENDPOINT", srv.URL+"/")
+	return f
+}
+
+func (f *fakeDBService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodPatch {
+		f.patches[path], _ = io.ReadAll(r.Body)
+		if f.rejectPatches {
+			http.Error(w, "invalid test", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	obj, ok := f.objects[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	io.WriteString(w, obj)
+}
+
+// patch returns the body last PATCHed to path, or nil.
+func (f *fakeDBService) patch(path string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.patches[path]
+}
+
+func newTestService[T any]() *services.Service[T] {
+	return services.NewService[T](local_repo.NewCacheRepository(time.Minute, time.Minute), remote_repo.NewAPIRepository())
+}
+
+// scriptDB answers the queries of a fake database: it returns the rows of a query, or the rows it
+// affected for statements. A nil scriptDB fails every query, like a database that is down.
+type scriptDB func(query string, args []driver.NamedValue) (columns []string, rows [][]driver.Value, err error)
+
+var errNoDatabase = errors.New("no database")
+
+func newScriptDB(script scriptDB) *sql.DB {
+	return sql.OpenDB(scriptConnector{script})
+}
+
+type scriptConnector struct{ script scriptDB }
+
+func (c scriptConnector) Connect(context.Context) (driver.Conn, error) { return scriptConn(c), nil }
+func (c scriptConnector) Driver() driver.Driver                        { return nil }
+
+type scriptConn struct{ script scriptDB }
+
+func (c scriptConn) run(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	if c.script == nil {
+		return nil, nil, errNoDatabase
+	}
+	return c.script(query, args)
+}
+
+func (c scriptConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := c.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &scriptRows{columns: columns, rows: rows}, nil
+}
+
+func (c scriptConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, rows, err := c.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (c scriptConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c scriptConn) Close() error              { return nil }
+func (c scriptConn) Begin() (driver.Tx, error) { return scriptTx{}, nil }
+
+type scriptTx struct{}
+
+func (scriptTx) Commit() error   { return nil }
+func (scriptTx) Rollback() error { return nil }
+
+type scriptRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *scriptRows) Columns() []string { return r.columns }
+func (r *scriptRows) Close() error      { return nil }
+func (r *scriptRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// withUser signs request in as a user with a global role.
+func withUser(request *http.Request, role string) *http.Request {
+	return request.WithContext(auth.WithSession(request.Context(), &auth.SessionClaims{UserID: 7, Role: role,
+		Email: "author@example.org"}))
+}
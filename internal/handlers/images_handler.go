@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/config"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+)
+
+// imageHashRe matches the hex SHA-256 images are stored under.
+var imageHashRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ImagesHandler serves the images the service API lifts out of problem HTML (images=url).
+type ImagesHandler struct {
+	images *db.ImageRepo
+}
+
+func NewImagesHandler(images *db.ImageRepo) *ImagesHandler {
+	return &ImagesHandler{images: images}
+}
+
+// Get serves GET /images/{hash}. It needs no login: students' browsers load these from quiz and LMS
+// pages, and a hash can only be learnt from an assembled test. Content never changes under a hash,
+// so it may be cached forever.
+func (h *ImagesHandler) Get(responseWriter http.ResponseWriter, request *http.Request) {
+	hash := request.PathValue("hash")
+	if !imageHashRe.MatchString(hash) {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	contentType, data, err := h.images.Get(request.Context(), hash)
+	if err != nil {
+		if errors.Is(err, db.ErrImageNotFound) {
+			http.NotFound(responseWriter, request)
+			return
+		}
+		log.Printf("image %s: %v", hash, err)
+		http.Error(responseWriter, "Could not load image", http.StatusInternalServerError)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", contentType)
+	responseWriter.Header().Set("X-Content-Type-Options", "nosniff")
+	responseWriter.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	_, _ = responseWriter.Write(data)
+}
+
+// serviceImages stores images for assembly.Apply and returns their absolute URLs.
+type serviceImages struct {
+	repo    *db.ImageRepo
+	baseURL string
+}
+
+func (i serviceImages) Save(ctx context.Context, contentType string, data []byte) (string, error) {
+	hash, err := i.repo.Save(ctx, contentType, data)
+	if err != nil {
+		return "", err
+	}
+	return i.baseURL + "/images/" + hash, nil
+}
+
+// publicBaseURL is where callers reach the CMS: CMS_PUBLIC_URL when set, else the scheme and host of
+// the request (honouring X-Forwarded-Proto from the load balancer).
+func publicBaseURL(request *http.Request) string {
+	if base := config.GetEnv("CMS_PUBLIC_URL", ""); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := request.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + request.Host
+}
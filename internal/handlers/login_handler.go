@@ -4,35 +4,64 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/avantifellows/nex-gen-cms/config"
 	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
 	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
 	"github.com/avantifellows/nex-gen-cms/internal/views"
 )
 
-const loginTemplate = "login.html"
+const (
+	loginTemplate      = "login.html"
+	reauthDoneTemplate = "reauth_done.html"
+)
 
 type LoginHandler struct {
-	google *auth.GoogleAuth
-	users  *db.CmsUserRepo
+	providers   *auth.OIDCProviders
+	users       *db.CmsUserRepo
+	sessions    *db.SessionRepo
+	invitations *db.InvitationRepo
+}
+
+func NewLoginHandler(providers *auth.OIDCProviders, users *db.CmsUserRepo, sessions *db.SessionRepo,
+	invitations *db.InvitationRepo) *LoginHandler {
+	return &LoginHandler{providers: providers, users: users, sessions: sessions, invitations: invitations}
 }
 
-func NewLoginHandler(google *auth.GoogleAuth, users *db.CmsUserRepo) *LoginHandler {
-	return &LoginHandler{google: google, users: users}
+// loginProvider is a sign-in button on the login page.
+type loginProvider struct {
+	ID      string
+	Name    string
+	Domains string
 }
 
 // Login renders the login page (GET) or shows an error message after a failed OAuth callback.
+// ?reauth=1 (from the expired-session prompt's popup) marks the sign-in so it ends on /reauth-done.
 func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
+	reauth := auth.IsReauth(r)
+	if r.URL.Query().Get("reauth") == "1" {
+		auth.SetReauthCookie(w)
+		reauth = true
+	}
 	if auth.ReadSession(r) != nil {
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
+		http.Redirect(w, r, afterLogin(reauth), http.StatusSeeOther)
 		return
 	}
 	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
 
+	var providers []loginProvider
+	for _, p := range h.providers.List() {
+		providers = append(providers, loginProvider{
+			ID:      p.ID(),
+			Name:    p.Name(),
+			Domains: "@" + strings.Join(p.AllowedDomains(), ", @"),
+		})
+	}
 	data := map[string]interface{}{
-		"DevLoginEmail":    config.GetEnv("DEV_LOGIN_EMAIL", ""),
-		"GoogleConfigured": h.google != nil,
+		"DevLoginEmail": config.GetEnv("DEV_LOGIN_EMAIL", ""),
+		"Providers":     providers,
 	}
 	if msg := r.URL.Query().Get("error"); msg != "" {
 		data["Error"] = msg
@@ -40,33 +69,36 @@ func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
 	views.ExecuteTemplate(loginTemplate, w, data, nil)
 }
 
-// StartGoogleAuth redirects to Google's OAuth consent screen.
-func (h *LoginHandler) StartGoogleAuth(w http.ResponseWriter, r *http.Request) {
-	if h.google == nil {
-		http.Redirect(w, r, "/login?error=Google+sign-in+is+not+configured", http.StatusSeeOther)
+// StartOIDC redirects to the consent screen of the provider named in /auth/{provider}/start.
+func (h *LoginHandler) StartOIDC(w http.ResponseWriter, r *http.Request) {
+	provider := h.providers.Get(r.PathValue("provider"))
+	if provider == nil {
+		http.Redirect(w, r, "/login?error=This+sign-in+option+is+not+configured", http.StatusSeeOther)
 		return
 	}
-	url, err := h.google.AuthCodeURL(w)
+	url, err := provider.AuthCodeURL(w)
 	if err != nil {
-		log.Printf("oauth start: %v", err)
+		log.Printf("oauth start %s: %v", provider.ID(), err)
 		http.Redirect(w, r, "/login?error=Could+not+start+sign-in", http.StatusSeeOther)
 		return
 	}
 	http.Redirect(w, r, url, http.StatusSeeOther)
 }
 
-// GoogleCallback handles Google's OAuth redirect: validates the ID token, looks up the user in
-// cms_user_permission, and issues a session cookie. Rejects unknown or deactivated users.
-func (h *LoginHandler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
+// OIDCCallback handles a provider's OAuth redirect to /auth/{provider}/callback: validates the ID
+// token, looks up the user in cms_user_permission, and issues a session cookie. Rejects unknown or
+// deactivated users.
+func (h *LoginHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
 	defer auth.ClearStateCookie(w)
 
-	if h.google == nil {
-		http.Redirect(w, r, "/login?error=Google+sign-in+is+not+configured", http.StatusSeeOther)
+	provider := h.providers.Get(r.PathValue("provider"))
+	if provider == nil {
+		http.Redirect(w, r, "/login?error=This+sign-in+option+is+not+configured", http.StatusSeeOther)
 		return
 	}
-	claims, err := h.google.Exchange(r.Context(), r)
+	claims, err := provider.Exchange(r.Context(), r)
 	if err != nil {
-		log.Printf("oauth callback: %v", err)
+		log.Printf("oauth callback %s: %v", provider.ID(), err)
 		http.Redirect(w, r, "/login?error=Sign-in+failed", http.StatusSeeOther)
 		return
 	}
@@ -86,14 +118,17 @@ func (h *LoginHandler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := auth.IssueSession(w, user.ID, user.Email, user.Role); err != nil {
+	if err := h.startSession(w, r, user); err != nil {
 		log.Printf("issue session: %v", err)
 		http.Redirect(w, r, "/login?error=Sign-in+failed", http.StatusSeeOther)
 		return
 	}
 	_ = h.users.UpdateLastLogin(r.Context(), user.ID)
+	if err := h.invitations.Accept(r.Context(), user.ID); err != nil {
+		log.Printf("accept invitation user=%d: %v", user.ID, err)
+	}
 
-	http.Redirect(w, r, "/home", http.StatusSeeOther)
+	http.Redirect(w, r, h.finishLogin(w, r), http.StatusSeeOther)
 }
 
 // DevLogin is a non-production bypass: POST /dev-login signs in as the email named in DEV_LOGIN_EMAIL.
@@ -113,19 +148,86 @@ func (h *LoginHandler) DevLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "dev login user is deactivated", http.StatusForbidden)
 		return
 	}
-	if err := auth.IssueSession(w, user.ID, user.Email, user.Role); err != nil {
+	if err := h.startSession(w, r, user); err != nil {
+		log.Printf("dev login session: %v", err)
 		http.Error(w, "could not issue session", http.StatusInternalServerError)
 		return
 	}
 	_ = h.users.UpdateLastLogin(r.Context(), user.ID)
+	if err := h.invitations.Accept(r.Context(), user.ID); err != nil {
+		log.Printf("accept invitation user=%d: %v", user.ID, err)
+	}
 
-	w.Header().Set("HX-Redirect", "/home")
+	w.Header().Set("HX-Redirect", h.finishLogin(w, r))
 	w.WriteHeader(http.StatusOK)
 }
 
-// Logout clears the session and redirects to /login.
-func (h *LoginHandler) Logout(w http.ResponseWriter, _ *http.Request) {
+// ReauthDone is where a re-auth popup lands after signing in: it tells the page that opened it
+// to retry its pending request, then closes.
+func (h *LoginHandler) ReauthDone(w http.ResponseWriter, r *http.Request) {
+	auth.ClearReauthCookie(w)
+	w.Header().Set("Cache-Control", "no-store")
+	views.ExecuteTemplate(reauthDoneTemplate, w, nil, nil)
+}
+
+// SessionStatus reports the session's idle timeout and expiry for the idle warning in home.html.
+// Calling it counts as activity, so it doubles as the warning's "stay signed in" keepalive.
+func (h *LoginHandler) SessionStatus(w http.ResponseWriter, r *http.Request) {
+	claims := auth.FromContext(r.Context())
+	if claims == nil || claims.ExpiresAt == nil {
+		http.Error(w, "Not signed in", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, map[string]int64{
+		"idle_timeout": int64(auth.IdleTimeout().Seconds()),
+		"expires_at":   claims.ExpiresAt.Unix(),
+	})
+}
+
+// Logout revokes the session, clears its cookie and redirects to /login.
+func (h *LoginHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if claims := auth.FromContext(r.Context()); claims != nil && claims.ID != "" {
+		if err := h.sessions.Revoke(r.Context(), claims.UserID, claims.ID, claims.Email); err != nil {
+			log.Printf("logout revoke session user=%d: %v", claims.UserID, err)
+		}
+	}
 	auth.ClearSession(w)
 	w.Header().Set("HX-Redirect", "/login")
 	w.WriteHeader(http.StatusOK)
 }
+
+// startSession records a new session for user in cms_session and sets its cookie.
+func (h *LoginHandler) startSession(w http.ResponseWriter, r *http.Request, user *models.CmsUser) error {
+	claims, err := auth.NewSession(user.ID, user.Email, user.Role)
+	if err != nil {
+		return err
+	}
+	session := &models.Session{
+		ID:        claims.ID,
+		UserID:    user.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		UserAgent: r.UserAgent(),
+		IP:        auth.ClientIP(r),
+	}
+	if err := h.sessions.Create(r.Context(), session); err != nil {
+		return err
+	}
+	return auth.IssueSession(w, claims)
+}
+
+// finishLogin returns where a successful sign-in goes: /home, or /reauth-done for a re-auth.
+func (h *LoginHandler) finishLogin(w http.ResponseWriter, r *http.Request) string {
+	reauth := auth.IsReauth(r)
+	if reauth {
+		auth.ClearReauthCookie(w)
+	}
+	return afterLogin(reauth)
+}
+
+func afterLogin(reauth bool) string {
+	if reauth {
+		return "/reauth-done"
+	}
+	return "/home"
+}
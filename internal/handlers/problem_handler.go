@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,12 +12,17 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
 	"github.com/avantifellows/nex-gen-cms/internal/constants"
 	"github.com/avantifellows/nex-gen-cms/internal/dto"
+	"github.com/avantifellows/nex-gen-cms/internal/exposure"
 	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
 	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
 	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/similarity"
 	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/internal/workflow"
 	"github.com/avantifellows/nex-gen-cms/utils"
 )
 
@@ -44,6 +50,7 @@ const inputTagsTemplate = "input_tags.html"
 const problemTestAssociationTemplate = "problem_test_association_modal.html"
 const moveProblemsTemplate = "move_problems_modal.html"
 const copyProblemModalTemplate = "copy_problem_modal.html"
+const duplicateProblemsWarningTemplate = "duplicate_problems_warning.html"
 
 type ProblemsHandler struct {
 	problemsService *services.Service[models.Problem]
@@ -52,15 +59,20 @@ type ProblemsHandler struct {
 	topicsService   *services.Service[models.Topic]
 	chaptersService *services.Service[models.Chapter]
 	tagsService     *services.Service[models.Tag]
+	fingerprints    *db.ProblemFingerprintRepo
+	versions        *db.ProblemVersionRepo
+	exposures       *db.ProblemExposureRepo
 }
 
 func NewProblemsHandler(problemsService *services.Service[models.Problem],
 	skillsService *services.Service[models.Skill], subjectsService *services.Service[models.Subject],
 	topicsService *services.Service[models.Topic], chaptersService *services.Service[models.Chapter],
-	tagsService *services.Service[models.Tag]) *ProblemsHandler {
+	tagsService *services.Service[models.Tag], fingerprints *db.ProblemFingerprintRepo,
+	versions *db.ProblemVersionRepo, exposures *db.ProblemExposureRepo) *ProblemsHandler {
 	return &ProblemsHandler{problemsService: problemsService, skillsService: skillsService,
 		subjectsService: subjectsService, topicsService: topicsService, chaptersService: chaptersService,
-		tagsService: tagsService}
+		tagsService: tagsService, fingerprints: fingerprints, versions: versions,
+		exposures: exposures}
 }
 
 func (h *ProblemsHandler) GetProblem(responseWriter http.ResponseWriter, request *http.Request) {
@@ -96,6 +108,8 @@ func (h *ProblemsHandler) GetProblem(responseWriter http.ResponseWriter, request
 		"seq":         utils.Seq,
 		"getName":     getConceptName,
 		"langName":    utils.LangName,
+		"statusName":  workflow.StatusName,
+		"statusBadge": statusBadgeClass,
 	}, baseTemplate, problemTemplate)
 }
 
@@ -204,11 +218,19 @@ func (h *ProblemsHandler) GetTopicProblems(responseWriter http.ResponseWriter, r
 
 	if urlValues.Has("ptype-dropdown") {
 		// for add/edit test screen
-		views.ExecuteTemplates(responseWriter, problems, nil, srcProblemRowParentTemplate, srcProblemRowTemplate)
+		summaries := problemExposure(request.Context(), h.exposures, *problems, urlValues)
+		if maxUses, err := strconv.Atoi(urlValues.Get("max-uses")); err == nil && maxUses >= 0 {
+			*problems = exposure.Filter(*problems, summaries, maxUses)
+		}
+		if urlValues.Get("exposure-sort") == "least-used" {
+			exposure.SortLeastUsed(*problems, summaries)
+		}
+		views.ExecuteTemplates(responseWriter, problems, exposureFuncs(summaries), srcProblemRowParentTemplate,
+			srcProblemRowTemplate)
 
 	} else {
 		// for topic screen's Problems tab
-		views.ExecuteTemplate(topicProblemRowTemplate, responseWriter, problems, nil)
+		views.ExecuteTemplate(topicProblemRowTemplate, responseWriter, problems, scopeFuncs(request, nil))
 	}
 }
 
@@ -320,11 +342,18 @@ func (h *ProblemsHandler) CreateProblem(responseWriter http.ResponseWriter, requ
 		return
 	}
 
-	_, err = h.problemsService.AddObject(reqBodyBytes, problemsKey, resourcesEndPoint)
+	// new problems start in draft and reach af_lms only once reviewed and published
+	if reqBodyBytes, err = withStatus(reqBodyBytes, 0, constants.StatusDraft); err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	createdPtr, err := h.problemsService.AddObject(reqBodyBytes, problemsKey, resourcesEndPoint)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error adding problem: %v", err), http.StatusInternalServerError)
 		return
 	}
+	audit.SetEntity(request.Context(), createdPtr.ID)
+	h.afterSave(request.Context(), createdPtr, reqBodyBytes, db.VersionActionCreate, "")
 }
 
 func (h *ProblemsHandler) CreateProblems(responseWriter http.ResponseWriter, request *http.Request) {
@@ -335,12 +364,65 @@ func (h *ProblemsHandler) CreateProblems(responseWriter http.ResponseWriter, req
 	}
 
 	// Endpoint expects a JSON object with "problems" array & "paragraph".
+	var batch map[string]json.RawMessage
+	if err := json.Unmarshal(reqBodyBytes, &batch); err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	var problems []json.RawMessage
+	if err := json.Unmarshal(batch["problems"], &problems); err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	for i := range problems {
+		if problems[i], err = withStatus(problems[i], 0, constants.StatusDraft); err != nil {
+			http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+	if batch["problems"], err = json.Marshal(problems); err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if reqBodyBytes, err = json.Marshal(batch); err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
 	var result any
 	err = h.problemsService.Post(batchProblemsEndPoint, json.RawMessage(reqBodyBytes), &result)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error adding problems: %v", err), http.StatusInternalServerError)
 		return
 	}
+	createdIDs := batchCreatedIDs(result)
+	h.problemsService.Changed(services.Created, createdIDs...)
+	// the create versions record who authored each problem (see db.CommentRepo.Inbox); ids only
+	// line up with the payload when db-service returned one per problem
+	if len(createdIDs) == len(problems) {
+		for i, idStr := range createdIDs {
+			h.afterSave(request.Context(), &models.Problem{ID: utils.StringToInt(idStr)}, problems[i],
+				db.VersionActionCreate, "")
+		}
+	}
+}
+
+// batchCreatedIDs reads the ids of the problems a batch create returned, either as a list or under
+// "problems".
+func batchCreatedIDs(result any) []string {
+	if obj, ok := result.(map[string]any); ok {
+		result = obj["problems"]
+	}
+	list, _ := result.([]any)
+	var ids []string
+	for _, item := range list {
+		if obj, ok := item.(map[string]any); ok {
+			if id, ok := obj["id"].(float64); ok {
+				ids = append(ids, strconv.FormatInt(int64(id), 10))
+			}
+		}
+	}
+	return ids
 }
 
 func (h *ProblemsHandler) EditProblem(responseWriter http.ResponseWriter, request *http.Request) {
@@ -356,7 +438,8 @@ func (h *ProblemsHandler) EditProblem(responseWriter http.ResponseWriter, reques
 			GradeID:      selectedProblemPtr.GradeID,
 			SubjectID:    selectedProblemPtr.SubjectID,
 		},
-		ProblemPtr: selectedProblemPtr,
+		ProblemPtr:   selectedProblemPtr,
+		VersionToken: h.problemVersionToken(request.Context(), selectedProblemPtr.ID),
 	}
 
 	views.ExecuteTemplates(responseWriter, data, template.FuncMap{
@@ -380,15 +463,48 @@ func (h *ProblemsHandler) UpdateProblem(responseWriter http.ResponseWriter, requ
 
 	problemIdStr := request.URL.Query().Get("id")
 	problemId := utils.StringToInt(problemIdStr)
+	if !h.checkProblemVersion(responseWriter, request, problemId) {
+		return
+	}
+
+	stored, storedScopes, err := fetchProblemScopes(h.problemsService, problemId)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// status only moves through review (ReviewHandler.Transition); an edit can only send it back
+	reqBodyBytes, err = withStatus(reqBodyBytes, stored.StatusID,
+		editedStatus(request.Context(), stored.StatusID, storedScopes...))
+	if err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
 
-	_, err = h.problemsService.UpdateObject(problemIdStr, resourcesEndPoint, reqBodyBytes, problemsKey,
+	// keep the pre-save state: the first CMS save of a problem records it as a baseline version
+	h.recordBaseline(request.Context(), problemId)
+	version, ok := h.claimProblemVersion(responseWriter, request, stored, reqBodyBytes)
+	if !ok {
+		return
+	}
+	auditBefore(request.Context(), h.problemsService, problemIdStr, func(problem *models.Problem) bool {
+		return problem.ID == problemId
+	}, problemsKey, resourcesEndPoint)
+
+	updatedPtr, err := h.problemsService.UpdateObject(problemIdStr, resourcesEndPoint, reqBodyBytes, problemsKey,
 		func(problem *models.Problem) bool {
 			return (*problem).ID == problemId
 		})
 	if err != nil {
+		h.releaseProblemVersion(request.Context(), problemId, version)
 		http.Error(responseWriter, fmt.Sprintf("Error updating problem: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if version == 0 {
+		version = h.afterSave(request.Context(), updatedPtr, reqBodyBytes, db.VersionActionUpdate, "")
+	} else if snapshot, err := mergeProblemPayload(updatedPtr, reqBodyBytes); err == nil {
+		h.refreshFingerprint(request.Context(), updatedPtr, snapshot)
+	}
+	setVersionToken(responseWriter, version)
 }
 
 func (h *ProblemsHandler) ArchiveProblem(responseWriter http.ResponseWriter, request *http.Request) {
@@ -398,6 +514,9 @@ func (h *ProblemsHandler) ArchiveProblem(responseWriter http.ResponseWriter, req
 		"cms_status_id": constants.StatusArchived,
 		"lang_code":     "en",
 	}
+	auditBefore(request.Context(), h.problemsService, problemIdStr, func(problem *models.Problem) bool {
+		return problem.ID == problemId
+	}, problemsKey, resourcesEndPoint)
 
 	err := h.problemsService.ArchiveObject(problemIdStr, resourcesEndPoint, body, problemsKey,
 		func(problem *models.Problem) bool {
@@ -407,6 +526,178 @@ func (h *ProblemsHandler) ArchiveProblem(responseWriter http.ResponseWriter, req
 		http.Error(responseWriter, fmt.Sprintf("Error archiving problem: %v", err), http.StatusInternalServerError)
 		return
 	}
+	// an archived problem is no longer a duplicate candidate
+	if err := h.fingerprints.Delete(request.Context(), problemId); err != nil {
+		log.Printf("fingerprint delete problem=%d: %v", problemId, err)
+	}
+}
+
+// CheckDuplicates fingerprints the problem payload the add/edit form is about to save and
+// renders a warning listing likely duplicates in the same subject. It answers 204 when
+// nothing crosses similarity.DuplicateThreshold, so the form can save straight away.
+// Query params: id (the problem being edited, excluded from matches; absent on create).
+func (h *ProblemsHandler) CheckDuplicates(responseWriter http.ResponseWriter, request *http.Request) {
+	reqBodyBytes, err := io.ReadAll(request.Body)
+	if err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	problem, err := decodeProblemPayload(reqBodyBytes)
+	if err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := h.fingerprints.ListBySubject(request.Context(), problem.SubjectID)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error loading fingerprints: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	signature := similarity.Compute(similarity.ProblemText(problem))
+	excludeID := utils.StringToInt(request.URL.Query().Get("id"))
+	matches := similarity.FindSimilar(signature, candidates, excludeID, similarity.DuplicateThreshold)
+	if len(matches) == 0 {
+		responseWriter.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	views.ExecuteTemplate(duplicateProblemsWarningTemplate, responseWriter, matches, template.FuncMap{
+		"percent": similarityPercent,
+	})
+}
+
+// afterSave records a version of a just-saved problem and refreshes its duplicate-detection
+// fingerprint. It returns the recorded version number, or 0. The snapshot is the db-service response
+// overlaid with the request payload, since the payload always carries every lang_version while some
+// responses don't. Failures are logged only: the save itself already succeeded. Saves that claimed
+// their version before saving (UpdateProblem) only refresh the fingerprint.
+func (h *ProblemsHandler) afterSave(ctx context.Context, saved *models.Problem, payload []byte, action, note string) int {
+	if saved == nil || saved.ID == 0 {
+		return 0
+	}
+	snapshot, err := mergeProblemPayload(saved, payload)
+	if err != nil {
+		log.Printf("problem snapshot problem=%d: %v", saved.ID, err)
+		return 0
+	}
+	version := recordProblemVersion(ctx, h.versions, saved.ID, action, note, snapshot)
+	h.refreshFingerprint(ctx, saved, snapshot)
+	return version
+}
+
+// refreshFingerprint updates the duplicate-detection fingerprint of a just-saved problem from its
+// snapshot (see afterSave).
+func (h *ProblemsHandler) refreshFingerprint(ctx context.Context, saved *models.Problem, snapshot json.RawMessage) {
+	var problem models.Problem
+	if err := json.Unmarshal(snapshot, &problem); err != nil {
+		return
+	}
+	fp := similarity.Fingerprint{
+		ProblemID: saved.ID,
+		Code:      saved.Code,
+		SubjectID: problem.SubjectID,
+		Signature: similarity.Compute(similarity.ProblemText(&problem)),
+	}
+	if err := h.fingerprints.Upsert(ctx, fp); err != nil {
+		log.Printf("fingerprint upsert problem=%d: %v", saved.ID, err)
+	}
+}
+
+// recordBaseline stores the current db-service state of a problem as its first version, unless
+// the CMS has already recorded versions for it.
+func (h *ProblemsHandler) recordBaseline(ctx context.Context, problemID int) {
+	exists, err := h.versions.Exists(ctx, problemID)
+	if err != nil || exists {
+		return
+	}
+	current, err := h.problemsService.GetObject("",
+		func(problem *models.Problem) bool {
+			return problem.ID == problemID
+		}, problemsKey, fmt.Sprintf(problemEndPoint, problemID))
+	if err != nil {
+		log.Printf("problem baseline problem=%d: %v", problemID, err)
+		return
+	}
+	snapshot, err := mergeProblemPayload(current, nil)
+	if err != nil {
+		return
+	}
+	recordProblemVersion(ctx, h.versions, problemID, db.VersionActionBaseline, "", snapshot)
+}
+
+// decodeProblemPayload reads the problem JSON built by add_problem.html.
+func decodeProblemPayload(payload []byte) (*models.Problem, error) {
+	merged, err := mergeProblemPayload(nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	var problem models.Problem
+	if err := json.Unmarshal(merged, &problem); err != nil {
+		return nil, err
+	}
+	return &problem, nil
+}
+
+// mergeProblemPayload overlays the top-level keys of a save payload onto base (which may be nil)
+// and returns the combined JSON. Keys only the payload knows about (concept_ids, curriculum_grades)
+// are kept. The edit page sends a comprehension paragraph as a plain HTML string rather than the
+// {id, body} object the API returns, so that is normalized to the object form.
+func mergeProblemPayload(base *models.Problem, payload []byte) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if base != nil {
+		baseBytes, err := json.Marshal(base)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(baseBytes, &fields); err != nil {
+			return nil, err
+		}
+		// display-only fields filled in by handlers, not part of the problem itself
+		delete(fields, "Skills")
+		delete(fields, "Subject")
+		delete(fields, "TagNames")
+	}
+
+	if len(payload) > 0 {
+		var changes map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &changes); err != nil {
+			return nil, err
+		}
+		for key, value := range changes {
+			fields[key] = value
+		}
+
+		if raw, ok := changes["paragraph"]; ok {
+			var paragraph models.ProblemParagraph
+			if base != nil && base.Paragraph != nil {
+				paragraph.ID = base.Paragraph.ID
+			}
+			if json.Unmarshal(raw, &paragraph.Body) == nil {
+				paragraphBytes, _ := json.Marshal(paragraph)
+				fields["paragraph"] = paragraphBytes
+			}
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// withStatus replaces whatever cms_status_id a problem payload carries with status. When status is the
+// stored one, the key is left out, so that legacy problems with no status keep theirs.
+func withStatus(payload []byte, stored, status int8) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "cms_status_id")
+	if status != stored {
+		fields["cms_status_id"] = json.RawMessage(strconv.Itoa(int(status)))
+	}
+	return json.Marshal(fields)
+}
+
+func similarityPercent(score float64) int {
+	return int(score*100 + 0.5)
 }
 
 func (h *ProblemsHandler) GetSearchProblems(responseWriter http.ResponseWriter, request *http.Request) {
@@ -477,7 +768,7 @@ func (h *ProblemsHandler) GetSearchProblems(responseWriter http.ResponseWriter,
 	}
 
 	filterProblems(problems, nil, "", "")
-	views.ExecuteTemplate(searchProblemRowTemplate, responseWriter, problems, nil)
+	views.ExecuteTemplate(searchProblemRowTemplate, responseWriter, problems, scopeFuncs(request, nil))
 }
 
 func (h *ProblemsHandler) LoadTestAssociations(responseWriter http.ResponseWriter, request *http.Request) {
@@ -594,6 +885,7 @@ func (h *ProblemsHandler) MoveProblems(responseWriter http.ResponseWriter, reque
 	topicIdPtr := &topicId
 
 	problemIdsStr := request.Form.Get("problem_ids")
+	audit.SetEntity(request.Context(), problemIdsStr)
 	problemIds := utils.StringSliceToIntSlice(strings.Split(problemIdsStr, ","))
 
 	reqBody := dto.MoveResourcesRequest{
@@ -618,4 +910,5 @@ func (h *ProblemsHandler) MoveProblems(responseWriter http.ResponseWriter, reque
 		http.Error(responseWriter, "Failed to move problems", http.StatusInternalServerError)
 		return
 	}
+	h.problemsService.Changed(services.Moved, utils.IntSliceToStringSlice(problemIds)...)
 }
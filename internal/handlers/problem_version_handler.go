@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/dto"
+	"github.com/avantifellows/nex-gen-cms/internal/htmldiff"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/internal/workflow"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const problemHistoryTemplate = "problem_history.html"
+const problemVersionDiffTemplate = "problem_version_diff.html"
+
+// revertableProblemKeys are the snapshot keys replayed to db-service on revert — the same keys
+// add_problem.html sends on save.
+var revertableProblemKeys = []string{"type", "subtype", "skill_ids", "type_params", "curriculum_grades",
+	"subject_id", "topic_id", "chapter_id", "difficulty_level", "lang_versions", "concept_ids", "tag_ids"}
+
+// versionDiffRow is one side-by-side line of the version diff panel.
+type versionDiffRow struct {
+	Label       string
+	Left, Right template.HTML
+}
+
+// GetProblemHistory renders the history panel listing every recorded version of a problem.
+// Query params: id (problem id).
+func (h *ProblemsHandler) GetProblemHistory(responseWriter http.ResponseWriter, request *http.Request) {
+	problemId := utils.StringToInt(request.URL.Query().Get("id"))
+	versions, err := h.versions.List(request.Context(), problemId)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching versions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"ProblemID": problemId,
+		"Versions":  versions,
+	}
+	views.ExecuteTemplate(problemHistoryTemplate, responseWriter, data, nil)
+}
+
+// GetProblemVersionDiff renders a side-by-side diff of two versions of a problem. Query params:
+// id (problem id), to (version), from (optional; defaults to the version before to).
+func (h *ProblemsHandler) GetProblemVersionDiff(responseWriter http.ResponseWriter, request *http.Request) {
+	urlVals := request.URL.Query()
+	problemId := utils.StringToInt(urlVals.Get("id"))
+	toVersion := utils.StringToInt(urlVals.Get("to"))
+	fromVersion := utils.StringToIntOrDefault(urlVals.Get("from"), toVersion-1, 0)
+
+	to, code, err := h.getProblemVersion(request.Context(), problemId, toVersion)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), code)
+		return
+	}
+	// the first version is diffed against an empty problem
+	from := &models.Problem{}
+	if fromVersion > 0 {
+		if from, code, err = h.getProblemVersion(request.Context(), problemId, fromVersion); err != nil {
+			http.Error(responseWriter, err.Error(), code)
+			return
+		}
+	}
+
+	data := map[string]any{
+		"ProblemID":   problemId,
+		"FromVersion": fromVersion,
+		"ToVersion":   toVersion,
+		"Rows":        diffProblems(from, to),
+	}
+	views.ExecuteTemplate(problemVersionDiffTemplate, responseWriter, data, nil)
+}
+
+// RevertProblem saves an earlier version of a problem as its current state. The revert is itself
+// recorded as a new version, so it can be undone the same way. Query params: id, version.
+func (h *ProblemsHandler) RevertProblem(responseWriter http.ResponseWriter, request *http.Request) {
+	urlVals := request.URL.Query()
+	problemIdStr := urlVals.Get("id")
+	problemId := utils.StringToInt(problemIdStr)
+	version := utils.StringToInt(urlVals.Get("version"))
+
+	versionPtr, err := h.versions.Get(request.Context(), problemId, version)
+	if errors.Is(err, db.ErrVersionNotFound) {
+		http.Error(responseWriter, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching version: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	current, err := h.problemsService.GetObject(problemIdStr, func(problem *models.Problem) bool {
+		return problem.ID == problemId
+	}, problemsKey, resourcesEndPoint)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching problem: %v", err), http.StatusInternalServerError)
+		return
+	}
+	body, err := revertPayload(versionPtr.Snapshot)
+	if err == nil {
+		// reverting doesn't restore review status: the reverted problem is reviewed again
+		body, err = withStatus(body, current.StatusID, workflow.AfterRestore(current.StatusID))
+	}
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error reading version: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.recordBaseline(request.Context(), problemId)
+	auditBefore(request.Context(), h.problemsService, problemIdStr, func(problem *models.Problem) bool {
+		return problem.ID == problemId
+	}, problemsKey, resourcesEndPoint)
+	updatedPtr, err := h.problemsService.UpdateObject(problemIdStr, resourcesEndPoint, body, problemsKey,
+		func(problem *models.Problem) bool {
+			return problem.ID == problemId
+		})
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error reverting problem: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.afterSave(request.Context(), updatedPtr, body, db.VersionActionRevert, fmt.Sprintf("Reverted to version %d", version))
+
+	responseWriter.Header().Set("HX-Refresh", "true")
+}
+
+func (h *ProblemsHandler) getProblemVersion(ctx context.Context, problemId, version int) (*models.Problem, int, error) {
+	versionPtr, err := h.versions.Get(ctx, problemId, version)
+	if errors.Is(err, db.ErrVersionNotFound) {
+		return nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error fetching version: %v", err)
+	}
+	problemPtr, err := versionPtr.Problem()
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error reading version: %v", err)
+	}
+	return problemPtr, http.StatusOK, nil
+}
+
+// recordProblemVersion appends a version attributed to the signed-in user and returns its number,
+// or 0 when nothing was recorded. Failures are logged only, so that history never blocks a save.
+func recordProblemVersion(ctx context.Context, versions *db.ProblemVersionRepo, problemID int, action, note string,
+	snapshot json.RawMessage) int {
+	number, err := versions.Insert(ctx, newProblemVersion(ctx, problemID, action, note, snapshot))
+	if err != nil {
+		log.Printf("problem version problem=%d action=%s: %v", problemID, action, err)
+		return 0
+	}
+	return number
+}
+
+func newProblemVersion(ctx context.Context, problemID int, action, note string,
+	snapshot json.RawMessage) *models.ProblemVersion {
+	version := &models.ProblemVersion{ProblemID: problemID, Action: action, Note: note, Snapshot: snapshot}
+	if claims := auth.FromContext(ctx); claims != nil {
+		version.ActorUserID = &claims.UserID
+		version.ActorEmail = claims.Email
+	}
+	return version
+}
+
+// claimProblemVersion records stored with payload applied as the update a save from an edit screen
+// is about to make, before it reaches db-service, and only if no other save recorded a version since
+// the one the editor loaded. It returns the claimed version, or 0 for saves that aren't checked (see
+// checkedToken), which record their version once saved. Otherwise it answers 409 with a conflict
+// prompt, or 500 when the version can't be recorded, since a missing version would let the next
+// stale save through, and reports that the save may not go ahead.
+func (h *ProblemsHandler) claimProblemVersion(responseWriter http.ResponseWriter, request *http.Request,
+	stored *models.Problem, payload []byte) (int, bool) {
+	token, checked := checkedToken(request)
+	if !checked {
+		return 0, true
+	}
+	snapshot, err := mergeProblemPayload(stored, payload)
+	if err != nil {
+		http.Error(responseWriter, "Invalid input", http.StatusBadRequest)
+		return 0, false
+	}
+	number, err := h.versions.InsertIfLatest(request.Context(),
+		newProblemVersion(request.Context(), stored.ID, db.VersionActionUpdate, "", snapshot), token)
+	if errors.Is(err, db.ErrVersionConflict) {
+		latest, err := h.versions.Latest(request.Context(), stored.ID)
+		if err != nil || latest == nil {
+			http.Error(responseWriter, "This problem was saved by someone else; reload it", http.StatusConflict)
+			return 0, false
+		}
+		writeProblemConflict(responseWriter, stored.ID, token, latest)
+		return 0, false
+	}
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error recording version: %v", err), http.StatusInternalServerError)
+		return 0, false
+	}
+	return number, true
+}
+
+// releaseProblemVersion gives back a version claimed by a save that db-service then rejected.
+func (h *ProblemsHandler) releaseProblemVersion(ctx context.Context, problemId, version int) {
+	if version == 0 {
+		return
+	}
+	if err := h.versions.Delete(ctx, problemId, version); err != nil {
+		log.Printf("problem version release problem=%d version=%d: %v", problemId, version, err)
+	}
+}
+
+// problemVersionToken returns the version token the edit screen loads a problem with: its latest
+// CMS-saved version, or 0 when it has none.
+func (h *ProblemsHandler) problemVersionToken(ctx context.Context, problemId int) int {
+	latest, err := h.versions.Latest(ctx, problemId)
+	if err != nil {
+		log.Printf("problem version token problem=%d: %v", problemId, err)
+		return 0
+	}
+	if latest == nil {
+		return 0
+	}
+	return latest.Version
+}
+
+// checkProblemVersion answers 409 with a conflict prompt when a save is based on an older version
+// of the problem than the latest one (see staleSave), and reports whether the save may go ahead. It
+// only spares an obviously stale save the work of saving: claimProblemVersion has the final say.
+func (h *ProblemsHandler) checkProblemVersion(responseWriter http.ResponseWriter, request *http.Request,
+	problemId int) bool {
+	latest, err := h.versions.Latest(request.Context(), problemId)
+	if err != nil {
+		log.Printf("problem version check problem=%d: %v", problemId, err)
+		return true
+	}
+	if latest == nil {
+		return true
+	}
+	token, stale := staleSave(request, latest.Version)
+	if !stale {
+		return true
+	}
+	writeProblemConflict(responseWriter, problemId, token, latest)
+	return false
+}
+
+func writeProblemConflict(responseWriter http.ResponseWriter, problemId, token int, latest *models.ProblemVersion) {
+	writeEditConflict(responseWriter, dto.EditConflict{
+		EntityType:  reviewEntityProblem,
+		EntityID:    problemId,
+		Token:       token,
+		Latest:      latest.Version,
+		LatestEmail: latest.ActorEmail,
+		LatestAt:    latest.CreatedAt,
+		DiffURL:     conflictDiffURL("/problems/history", problemId, token, latest.Version),
+	})
+}
+
+// revertPayload turns a stored snapshot back into the PATCH body add_problem.html would send.
+func revertPayload(snapshot json.RawMessage) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(snapshot, &fields); err != nil {
+		return nil, err
+	}
+	var problem models.Problem
+	if err := json.Unmarshal(snapshot, &problem); err != nil {
+		return nil, err
+	}
+
+	body := map[string]any{}
+	for _, key := range revertableProblemKeys {
+		if value, ok := fields[key]; ok {
+			body[key] = value
+		}
+	}
+	// baseline snapshots come from GET responses, which carry these in a different shape
+	if _, ok := body["concept_ids"]; !ok {
+		conceptIds := []int32{}
+		for _, concept := range problem.Concepts {
+			conceptIds = append(conceptIds, concept.ID)
+		}
+		body["concept_ids"] = conceptIds
+	}
+	if _, ok := body["curriculum_grades"]; !ok && problem.CurriculumID != 0 {
+		body["curriculum_grades"] = []map[string]any{
+			{"curriculum_id": problem.CurriculumID, "grade_id": problem.GradeID},
+		}
+	}
+	if problem.Paragraph != nil {
+		body["paragraph"] = problem.Paragraph.Body
+	}
+	return json.Marshal(body)
+}
+
+// diffProblems lists the fields that differ between two versions: the paragraph, then per
+// language the question, options, answers and solutions, then the classification fields.
+func diffProblems(from, to *models.Problem) []versionDiffRow {
+	var rows []versionDiffRow
+	add := func(label, left, right string) {
+		if l, r, changed := htmldiff.Diff(left, right); changed {
+			rows = append(rows, versionDiffRow{Label: label, Left: l, Right: r})
+		}
+	}
+
+	add("Paragraph", paragraphBody(from), paragraphBody(to))
+
+	for _, langCode := range versionLangCodes(from, to) {
+		prefix := ""
+		if langCode != "en" || len(from.LangVersions) > 1 || len(to.LangVersions) > 1 {
+			prefix = utils.LangName(langCode) + " · "
+		}
+		left, right := langMetaData(from, langCode), langMetaData(to, langCode)
+
+		add(prefix+"Question", string(left.Question), string(right.Question))
+		for i := 0; i < max(len(left.Options), len(right.Options)); i++ {
+			add(fmt.Sprintf("%sOption %c", prefix, 'A'+i), htmlAt(left.Options, i), htmlAt(right.Options, i))
+		}
+		add(prefix+"Answer", html.EscapeString(strings.Join(left.Answers, ", ")),
+			html.EscapeString(strings.Join(right.Answers, ", ")))
+		for i := 0; i < max(len(left.Solutions), len(right.Solutions)); i++ {
+			add(fmt.Sprintf("%sSolution %d", prefix, i+1), solutionAt(left.Solutions, i), solutionAt(right.Solutions, i))
+		}
+	}
+
+	add("Subtype", html.EscapeString(from.Subtype), html.EscapeString(to.Subtype))
+	add("Difficulty", html.EscapeString(from.DifficultyLevel), html.EscapeString(to.DifficultyLevel))
+	add("Topic ID", idString(from.TopicID), idString(to.TopicID))
+	add("Skill IDs", utils.JoinInt16(from.SkillIDs, ", "), utils.JoinInt16(to.SkillIDs, ", "))
+	add("Tag IDs", joinInts(from.TagIDs), joinInts(to.TagIDs))
+	return rows
+}
+
+// versionLangCodes returns the union of both versions' languages, English first.
+func versionLangCodes(problems ...*models.Problem) []string {
+	seen := map[string]bool{}
+	var codes []string
+	for _, p := range problems {
+		for _, lv := range p.LangVersions {
+			if !seen[lv.LangCode] {
+				seen[lv.LangCode] = true
+				codes = append(codes, lv.LangCode)
+			}
+		}
+	}
+	sort.SliceStable(codes, func(i, j int) bool { return codes[i] == "en" && codes[j] != "en" })
+	return codes
+}
+
+func langMetaData(p *models.Problem, langCode string) models.ProbMetaData {
+	if lv := p.GetLangVersion(langCode); lv != nil {
+		return lv.MetaData
+	}
+	return models.ProbMetaData{}
+}
+
+func paragraphBody(p *models.Problem) string {
+	if p.Paragraph == nil {
+		return ""
+	}
+	return string(p.Paragraph.Body)
+}
+
+func htmlAt(values []template.HTML, i int) string {
+	if i < len(values) {
+		return string(values[i])
+	}
+	return ""
+}
+
+func solutionAt(solutions []models.Solution, i int) string {
+	if i < len(solutions) {
+		return string(solutions[i].Value)
+	}
+	return ""
+}
+
+func idString(id int16) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(id))
+}
+
+func joinInts(values []int) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = strconv.Itoa(v)
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+)
+
+const (
+	profileTemplate           = "profile.html"
+	profileTokensTemplate     = "profile_tokens.html"
+	profileTokenUsesTemplate  = "profile_token_uses.html"
+	defaultPersonalTokenDays  = 90
+	personalTokenUsesPageSize = 100
+)
+
+// personalTokenLifetimes are the expiry choices offered when creating a token, in days.
+var personalTokenLifetimes = []int{7, 30, defaultPersonalTokenDays, 365}
+
+// ProfileHandler serves the signed-in user's profile page, where they manage their personal access
+// tokens (see middleware.PersonalToken).
+type ProfileHandler struct {
+	tokens *db.PersonalTokenRepo
+}
+
+func NewProfileHandler(tokens *db.PersonalTokenRepo) *ProfileHandler {
+	return &ProfileHandler{tokens: tokens}
+}
+
+// Show renders the profile page.
+func (h *ProfileHandler) Show(w http.ResponseWriter, r *http.Request) {
+	claims := auth.FromContext(r.Context())
+	tokens, err := h.tokens.ListByUser(r.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("profile tokens list user=%d: %v", claims.UserID, err)
+		http.Error(w, "Could not load tokens", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]any{
+		"Email":     claims.Email,
+		"Role":      claims.Role,
+		"Tokens":    tokens,
+		"Lifetimes": personalTokenLifetimes,
+	}
+	views.ExecuteTemplates(w, data, personalTokenFuncs(), baseTemplate, profileTemplate, profileTokensTemplate)
+}
+
+// CreateToken creates a personal access token, shown once. Tokens can only be created from a
+// signed-in session, not with another token. Form: name, expires_in_days.
+func (h *ProfileHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if auth.PersonalTokenFromContext(r.Context()) != 0 {
+		http.Error(w, "Sign in to create tokens", http.StatusForbidden)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	claims := auth.FromContext(r.Context())
+	t := &models.PersonalToken{UserID: claims.UserID, Name: strings.TrimSpace(r.FormValue("name"))}
+	if t.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("expires_in_days"))
+	if err != nil || days <= 0 || time.Duration(days)*24*time.Hour > auth.MaxPersonalTokenLifetime {
+		http.Error(w, "Pick an expiry of at most a year", http.StatusBadRequest)
+		return
+	}
+	t.ExpiresAt = time.Now().AddDate(0, 0, days)
+
+	token, hash, err := auth.NewPersonalToken()
+	if err != nil {
+		log.Printf("profile new token user=%d: %v", claims.UserID, err)
+		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		return
+	}
+	t.Prefix = token[:auth.PersonalTokenPrefixLen]
+	if t.ID, err = h.tokens.Create(r.Context(), t, hash); err != nil {
+		log.Printf("profile create token user=%d: %v", claims.UserID, err)
+		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		return
+	}
+	audit.SetEntity(r.Context(), t.ID)
+	audit.SetAfter(r.Context(), t)
+	h.renderTokens(w, r, token)
+}
+
+// RevokeToken revokes one of the user's tokens. Query params: id.
+func (h *ProfileHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	claims := auth.FromContext(r.Context())
+	if err := h.tokens.Revoke(r.Context(), claims.UserID, id); err != nil {
+		if errors.Is(err, db.ErrPersonalTokenNotFound) {
+			http.Error(w, "Token not found or already revoked", http.StatusNotFound)
+			return
+		}
+		log.Printf("profile revoke token user=%d token=%d: %v", claims.UserID, id, err)
+		http.Error(w, "Could not revoke token", http.StatusInternalServerError)
+		return
+	}
+	h.renderTokens(w, r, "")
+}
+
+// TokenUses renders the modal listing the latest requests made with one of the user's tokens.
+// Query params: id.
+func (h *ProfileHandler) TokenUses(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	claims := auth.FromContext(r.Context())
+	uses, err := h.tokens.ListUses(r.Context(), claims.UserID, id, personalTokenUsesPageSize)
+	if err != nil {
+		log.Printf("profile token uses user=%d token=%d: %v", claims.UserID, id, err)
+		http.Error(w, "Could not load token uses", http.StatusInternalServerError)
+		return
+	}
+	views.ExecuteTemplate(profileTokenUsesTemplate, w, map[string]any{
+		"Uses":  uses,
+		"Limit": personalTokenUsesPageSize,
+	}, nil)
+}
+
+// renderTokens renders the token list. newToken, when set, is shown once above it.
+func (h *ProfileHandler) renderTokens(w http.ResponseWriter, r *http.Request, newToken string) {
+	claims := auth.FromContext(r.Context())
+	tokens, err := h.tokens.ListByUser(r.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("profile tokens reload user=%d: %v", claims.UserID, err)
+		http.Error(w, "Could not reload tokens", http.StatusInternalServerError)
+		return
+	}
+	views.ExecuteTemplate(profileTokensTemplate, w, map[string]any{
+		"Tokens":    tokens,
+		"NewToken":  newToken,
+		"Lifetimes": personalTokenLifetimes,
+	}, personalTokenFuncs())
+}
+
+func personalTokenFuncs() template.FuncMap {
+	now := time.Now()
+	return template.FuncMap{
+		"tokenActive": func(t models.PersonalToken) bool {
+			return t.Active(now)
+		},
+		"defaultLifetime": func(days int) bool {
+			return days == defaultPersonalTokenDays
+		},
+	}
+}
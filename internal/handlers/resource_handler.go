@@ -7,6 +7,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
 	"github.com/avantifellows/nex-gen-cms/internal/dto"
 	"github.com/avantifellows/nex-gen-cms/internal/models"
 	"github.com/avantifellows/nex-gen-cms/internal/services"
@@ -165,6 +166,9 @@ func (h *ResourcesHandler) UpdateResource(responseWriter http.ResponseWriter, re
 	dummyResourcePtr := &models.Resource{}
 	resourceMap := dummyResourcePtr.BuildMap(resourceCode, resourceName, resourceType, resourceSubtype, srcLink)
 
+	auditBefore(request.Context(), h.service, resourceIdStr, func(resource *models.Resource) bool {
+		return resource.ID == int(resourceId)
+	}, resourcesKey, resourcesEndPoint)
 	_, err = h.service.UpdateObject(resourceIdStr, resourcesEndPoint, resourceMap, resourcesKey,
 		func(resource *models.Resource) bool {
 			return resource.ID == int(resourceId)
@@ -185,6 +189,10 @@ func (h *ResourcesHandler) DeleteResource(responseWriter http.ResponseWriter, re
 		return
 	}
 
+	auditBefore(request.Context(), h.service, resourceIdStr, func(resource *models.Resource) bool {
+		return resource.ID == int(resourceId)
+	}, resourcesKey, resourcesEndPoint)
+
 	err = h.service.DeleteObject(resourceIdStr,
 		func(resource *models.Resource) bool {
 			return resource.ID != int(resourceId)
@@ -250,6 +258,8 @@ func (h *ResourcesHandler) AddResource(responseWriter http.ResponseWriter, reque
 		http.Error(responseWriter, fmt.Sprintf("Error adding resource: %v", err), http.StatusInternalServerError)
 		return
 	}
+	audit.SetEntity(request.Context(), newResourcePtr.ID)
+	audit.SetAfter(request.Context(), newResourcePtr)
 
 	resourcePtrs := []*models.Resource{newResourcePtr}
 	views.ExecuteTemplate(resourceRowTemplate, responseWriter, resourcePtrs, template.FuncMap{
@@ -304,6 +314,7 @@ func (h *ResourcesHandler) MoveResource(responseWriter http.ResponseWriter, requ
 	}
 
 	resourceIDsStr := strings.TrimSpace(request.Form.Get("resource_ids"))
+	audit.SetEntity(request.Context(), resourceIDsStr)
 	if resourceIDsStr == "" {
 		http.Error(responseWriter, "Missing resource IDs", http.StatusBadRequest)
 		return
@@ -328,6 +339,7 @@ func (h *ResourcesHandler) MoveResource(responseWriter http.ResponseWriter, requ
 		http.Error(responseWriter, "Failed to move resource", http.StatusInternalServerError)
 		return
 	}
+	h.service.Changed(services.Moved, utils.IntSliceToStringSlice(resourceIDs)...)
 }
 
 func getResourceName(r models.Resource, lang string) string {
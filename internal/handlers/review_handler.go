@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/internal/workflow"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const reviewPanelTemplate = "review_panel.html"
+
+// Entity types that go through the review workflow.
+const (
+	reviewEntityTest    = "test"
+	reviewEntityProblem = "problem"
+)
+
+var errUnknownReviewEntity = errors.New("unknown entity")
+
+// ReviewHandler moves tests and problems through the review workflow (see internal/workflow) and
+// keeps reviewers' comments on them.
+type ReviewHandler struct {
+	testsService    *services.Service[models.Test]
+	problemsService *services.Service[models.Problem]
+	comments        *db.ReviewCommentRepo
+}
+
+func NewReviewHandler(testsService *services.Service[models.Test], problemsService *services.Service[models.Problem],
+	comments *db.ReviewCommentRepo) *ReviewHandler {
+	return &ReviewHandler{testsService: testsService, problemsService: problemsService, comments: comments}
+}
+
+// GetReview renders the review panel of a test or problem: its status, the transitions open to the
+// signed-in user and the comment thread. Query params: entity (test|problem), id.
+func (h *ReviewHandler) GetReview(responseWriter http.ResponseWriter, request *http.Request) {
+	entity, id := reviewTarget(request)
+	status, err := h.status(entity, id)
+	if err != nil {
+		writeReviewError(responseWriter, err)
+		return
+	}
+	h.renderPanel(responseWriter, request, entity, id, status)
+}
+
+// Transition applies a workflow action to a test or problem and records it, with the optional
+// comment, in its review thread. Query params: entity, id, action. Form: comment.
+func (h *ReviewHandler) Transition(responseWriter http.ResponseWriter, request *http.Request) {
+	entity, id := reviewTarget(request)
+	audit.SetEntityType(request.Context(), entity)
+	claims := auth.FromContext(request.Context())
+	if claims == nil {
+		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := h.status(entity, id)
+	if err != nil {
+		writeReviewError(responseWriter, err)
+		return
+	}
+	transition, err := workflow.Find(status, request.URL.Query().Get("action"), h.roleOn(request, entity, id))
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Cannot %s content that is %s", request.URL.Query().Get("action"),
+			strings.ToLower(workflow.StatusName(status))), http.StatusConflict)
+		return
+	}
+	comment := strings.TrimSpace(request.FormValue("comment"))
+	if transition.NeedsComment && comment == "" {
+		http.Error(responseWriter, "Please add a comment explaining what needs to change", http.StatusBadRequest)
+		return
+	}
+	// af_lms is served a published test with all of its problems
+	if entity == reviewEntityTest && transition.To == constants.StatusPublished {
+		problems, err := h.problemsService.GetList(fmt.Sprintf(testProblemsEndPoint, id), "", false, true)
+		if err != nil {
+			http.Error(responseWriter, fmt.Sprintf("Error fetching problems: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if codes := unpublishedProblemCodes(*problems); len(codes) > 0 {
+			http.Error(responseWriter, "Publish the test's problems first: "+strings.Join(codes, ", "),
+				http.StatusConflict)
+			return
+		}
+	}
+
+	audit.SetBefore(request.Context(), map[string]int8{"cms_status_id": status})
+	if err := h.setStatus(entity, id, transition.To); err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error updating status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	audit.SetAfter(request.Context(), map[string]int8{"cms_status_id": transition.To})
+
+	from, to := workflow.Normalize(status), transition.To
+	h.addComment(request, &models.ReviewComment{EntityType: entity, EntityID: id, Action: transition.Action,
+		FromStatus: &from, ToStatus: &to, Body: comment})
+	h.renderPanel(responseWriter, request, entity, id, transition.To)
+}
+
+// AddComment adds a comment to the review thread without changing status. Query params: entity,
+// id. Form: comment.
+func (h *ReviewHandler) AddComment(responseWriter http.ResponseWriter, request *http.Request) {
+	entity, id := reviewTarget(request)
+	audit.SetEntityType(request.Context(), entity)
+	comment := strings.TrimSpace(request.FormValue("comment"))
+	if comment == "" {
+		http.Error(responseWriter, "Comment is empty", http.StatusBadRequest)
+		return
+	}
+	status, err := h.status(entity, id)
+	if err != nil {
+		writeReviewError(responseWriter, err)
+		return
+	}
+	h.addComment(request, &models.ReviewComment{EntityType: entity, EntityID: id, Body: comment})
+	h.renderPanel(responseWriter, request, entity, id, status)
+}
+
+func (h *ReviewHandler) renderPanel(responseWriter http.ResponseWriter, request *http.Request, entity string, id int,
+	status int8) {
+	comments, err := h.comments.List(request.Context(), entity, id)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching comments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var transitions []workflow.Transition
+	if auth.FromContext(request.Context()) != nil {
+		transitions = workflow.Available(status, h.roleOn(request, entity, id))
+	}
+
+	data := map[string]any{
+		"Entity":      entity,
+		"ID":          id,
+		"Status":      status,
+		"Transitions": transitions,
+		"Comments":    comments,
+	}
+	views.ExecuteTemplate(reviewPanelTemplate, responseWriter, data, template.FuncMap{
+		"statusName":  workflow.StatusName,
+		"statusBadge": statusBadgeClass,
+		"deref": func(status *int8) int8 {
+			if status == nil {
+				return 0
+			}
+			return *status
+		},
+	})
+}
+
+func (h *ReviewHandler) addComment(request *http.Request, comment *models.ReviewComment) {
+	if claims := auth.FromContext(request.Context()); claims != nil {
+		comment.ActorUserID = &claims.UserID
+		comment.ActorEmail = claims.Email
+	}
+	if _, err := h.comments.Insert(request.Context(), comment); err != nil {
+		log.Printf("review comment %s=%d: %v", comment.EntityType, comment.EntityID, err)
+	}
+}
+
+func (h *ReviewHandler) status(entity string, id int) (int8, error) {
+	idStr := strconv.Itoa(id)
+	switch entity {
+	case reviewEntityTest:
+		test, err := h.testsService.GetObject(idStr, func(test *models.Test) bool {
+			return test.ID == id
+		}, testsKey, resourcesEndPoint)
+		if err != nil {
+			return 0, err
+		}
+		return test.StatusID, nil
+	case reviewEntityProblem:
+		problem, err := h.problemsService.GetObject(idStr, func(problem *models.Problem) bool {
+			return problem.ID == id
+		}, problemsKey, resourcesEndPoint)
+		if err != nil {
+			return 0, err
+		}
+		return problem.StatusID, nil
+	}
+	return 0, errUnknownReviewEntity
+}
+
+// roleOn returns the signed-in user's role on a test or problem, counting scoped grants. If the
+// content's scope can't be resolved only the global role counts.
+func (h *ReviewHandler) roleOn(request *http.Request, entity string, id int) string {
+	claims := auth.FromContext(request.Context())
+	scopes, err := h.scopes(entity, id)
+	if err != nil {
+		return claims.Role
+	}
+	return auth.RoleIn(claims.Role, auth.GrantsFromContext(request.Context()), scopes...)
+}
+
+// scopes returns the curriculum/grade/subject scopes of a test or problem, for scoped grants.
+func (h *ReviewHandler) scopes(entity string, id int) ([]models.Scope, error) {
+	idStr := strconv.Itoa(id)
+	switch entity {
+	case reviewEntityTest:
+		test, err := h.testsService.GetObject(idStr, func(test *models.Test) bool {
+			return test.ID == id
+		}, testsKey, resourcesEndPoint)
+		if err != nil {
+			return nil, err
+		}
+		return test.Scopes(), nil
+	case reviewEntityProblem:
+		_, scopes, err := fetchProblemScopes(h.problemsService, id)
+		return scopes, err
+	}
+	return nil, errUnknownReviewEntity
+}
+
+func (h *ReviewHandler) setStatus(entity string, id int, status int8) error {
+	idStr := strconv.Itoa(id)
+	switch entity {
+	case reviewEntityTest:
+		_, err := h.testsService.UpdateObject(idStr, resourcesEndPoint, map[string]any{"cms_status_id": status},
+			testsKey, func(test *models.Test) bool {
+				return test.ID == id
+			})
+		return err
+	case reviewEntityProblem:
+		_, err := h.problemsService.UpdateObject(idStr, resourcesEndPoint,
+			map[string]any{"cms_status_id": status, "lang_code": "en"}, problemsKey,
+			func(problem *models.Problem) bool {
+				return problem.ID == id
+			})
+		return err
+	}
+	return errUnknownReviewEntity
+}
+
+// unpublishedProblemCodes lists the codes of the problems that aren't published, or their IDs when
+// they have no code.
+func unpublishedProblemCodes(problems []*models.Problem) []string {
+	var codes []string
+	for _, p := range problems {
+		if workflow.IsPublished(p.StatusID) {
+			continue
+		}
+		if p.Code != "" {
+			codes = append(codes, p.Code)
+		} else {
+			codes = append(codes, "#"+strconv.Itoa(p.ID))
+		}
+	}
+	return codes
+}
+
+// editedStatus is the status content moves to when the signed-in user saves changes to it, given its
+// stored status and scopes (see workflow.AfterEdit).
+func editedStatus(ctx context.Context, status int8, scopes ...models.Scope) int8 {
+	role := ""
+	if claims := auth.FromContext(ctx); claims != nil {
+		role = auth.RoleIn(claims.Role, auth.GrantsFromContext(ctx), scopes...)
+	}
+	return workflow.AfterEdit(status, role)
+}
+
+func reviewTarget(request *http.Request) (string, int) {
+	urlVals := request.URL.Query()
+	return urlVals.Get("entity"), utils.StringToInt(urlVals.Get("id"))
+}
+
+func writeReviewError(responseWriter http.ResponseWriter, err error) {
+	if errors.Is(err, errUnknownReviewEntity) {
+		http.Error(responseWriter, "entity must be test or problem", http.StatusBadRequest)
+		return
+	}
+	http.Error(responseWriter, fmt.Sprintf("Error fetching status: %v", err), http.StatusInternalServerError)
+}
+
+// statusBadgeClass is the badge style of a workflow status.
+func statusBadgeClass(status int8) string {
+	switch workflow.Normalize(status) {
+	case constants.StatusDraft:
+		return "badge-muted"
+	case constants.StatusInReview:
+		return "badge-warning"
+	case constants.StatusApproved:
+		return "badge-info"
+	case constants.StatusPublished:
+		return "badge-success"
+	}
+	return "badge-danger"
+}
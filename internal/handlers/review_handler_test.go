@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+)
+
+// editStatusCases are saves of content whose stored status is stored, by a user with role, with a
+// payload claiming claimed; want is the cms_status_id that must reach db-service (0: none).
+var editStatusCases = []struct {
+	name    string
+	role    string
+	stored  int8
+	claimed int8
+	want    int8
+}{
+	{"editor saves published", auth.RoleEditor, constants.StatusPublished, constants.StatusPublished,
+		constants.StatusInReview},
+	{"editor saves approved", auth.RoleEditor, constants.StatusApproved, 0, constants.StatusInReview},
+	{"editor saves legacy content", auth.RoleEditor, 0, 0, constants.StatusInReview},
+	{"editor cannot publish own draft", auth.RoleEditor, constants.StatusDraft, constants.StatusPublished,
+		constants.StatusDraft},
+	{"admin saves published in place", auth.RoleAdmin, constants.StatusPublished, 0, constants.StatusPublished},
+	{"admin cannot publish through a save", auth.RoleAdmin, constants.StatusDraft, constants.StatusPublished,
+		constants.StatusDraft},
+}
+
+func TestUpdateTestStatus(t *testing.T) {
+	for _, tc := range editStatusCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stored, _ := json.Marshal(models.Test{ID: 9, Subtype: "major_test", StatusID: tc.stored,
+				CurriculumGrades: []models.CurriculumGrade{{CurriculumID: 1, GradeID: 11}}})
+			fake := newFakeDBService(t, map[string]string{"resource/9": string(stored)})
+			noDB := newScriptDB(nil)
+			h := NewTestsHandler(newTestService[models.Test](), nil, nil, nil, nil, nil, nil, nil, nil,
+				db.NewTestVersionRepo(noDB), db.NewImageRepo(noDB), db.NewProblemExposureRepo(noDB))
+
+			body := fmt.Sprintf(`{"code":"T9","subtype":"major_test","cms_status_id":%d}`, tc.claimed)
+			req := withUser(httptest.NewRequest(http.MethodPatch, "/update-test?id=9", strings.NewReader(body)), tc.role)
+			rec := httptest.NewRecorder()
+			h.UpdateTest(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var sent models.Test
+			if err := json.Unmarshal(fake.patch("resource/9"), &sent); err != nil {
+				t.Fatalf("PATCH body: %v", err)
+			}
+			if sent.StatusID != tc.want {
+				t.Errorf("sent cms_status_id = %d, want %d", sent.StatusID, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateProblemStatus(t *testing.T) {
+	for _, tc := range editStatusCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stored, _ := json.Marshal(models.Problem{ID: 4, SubjectID: 3, StatusID: tc.stored})
+			fake := newFakeDBService(t, map[string]string{"resource/4": string(stored),
+				"resource/problem/4": string(stored)})
+			noDB := newScriptDB(nil)
+			h := NewProblemsHandler(newTestService[models.Problem](), nil, nil, nil, nil, nil,
+				db.NewProblemFingerprintRepo(noDB), db.NewProblemVersionRepo(noDB), db.NewProblemExposureRepo(noDB))
+
+			body := fmt.Sprintf(`{"subject_id":3,"lang_versions":[],"cms_status_id":%d}`, tc.claimed)
+			req := withUser(httptest.NewRequest(http.MethodPatch, "/update-problem?id=4", strings.NewReader(body)), tc.role)
+			rec := httptest.NewRecorder()
+			h.UpdateProblem(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var sent map[string]json.RawMessage
+			if err := json.Unmarshal(fake.patch("resource/4"), &sent); err != nil {
+				t.Fatalf("PATCH body: %v", err)
+			}
+			// the stored status is kept by leaving the key out
+			want := tc.want
+			if want == tc.stored {
+				want = 0
+			}
+			var got int8
+			if raw, ok := sent["cms_status_id"]; ok {
+				json.Unmarshal(raw, &got)
+			}
+			if got != want {
+				t.Errorf("sent cms_status_id = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestUnpublishedProblemCodes(t *testing.T) {
+	problems := []*models.Problem{
+		{ID: 1, Code: "P1", StatusID: constants.StatusPublished},
+		{ID: 2, Code: "P2", StatusID: constants.StatusDraft},
+		{ID: 3, Code: "P3"}, // predates the workflow
+		{ID: 4, StatusID: constants.StatusInReview},
+	}
+	if got, want := unpublishedProblemCodes(problems), []string{"P2", "#4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unpublishedProblemCodes = %v, want %v", got, want)
+	}
+}
+
+func TestPublishTestWithDraftProblems(t *testing.T) {
+	test, _ := json.Marshal(models.Test{ID: 9, StatusID: constants.StatusApproved})
+	problems, _ := json.Marshal([]models.Problem{{ID: 1, Code: "P1", StatusID: constants.StatusPublished},
+		{ID: 2, Code: "P2", StatusID: constants.StatusDraft}})
+	fake := newFakeDBService(t, map[string]string{"resource/9": string(test), "resource/test/9/problems": string(problems)})
+	h := NewReviewHandler(newTestService[models.Test](), newTestService[models.Problem](),
+		db.NewReviewCommentRepo(newScriptDB(nil)))
+
+	req := withUser(httptest.NewRequest(http.MethodPost, "/review/transition?entity=test&id=9&action=publish", nil),
+		auth.RoleAdmin)
+	rec := httptest.NewRecorder()
+	h.Transition(rec, req)
+
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "P2") {
+		t.Errorf("status = %d %q, want 409 naming P2", rec.Code, rec.Body)
+	}
+	if fake.patch("resource/9") != nil {
+		t.Error("test was published")
+	}
+}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+// Scope resolvers for middleware.Authorize. Each returns the curriculum/grade/subject scopes of
+// the content a route touches, so that scoped grants (cms_user_grant) are checked before the
+// handler runs. They read the same params as the handlers they guard.
+
+// ChapterScope resolves the chapter named by the id param or, for a new chapter, the curriculum,
+// grade and subject dropdowns of the form. db-service doesn't always return a chapter's
+// curriculum, so the request's curriculum dropdown fills it in when present.
+func (h *ChaptersHandler) ChapterScope(request *http.Request) ([]models.Scope, error) {
+	fromForm := requestScope(request)
+	idStr := request.FormValue("id")
+	if idStr == "" {
+		return []models.Scope{fromForm}, nil
+	}
+	chapter, _, err := handlerutils.GetChapterByID(idStr, h.chaptersService)
+	if err != nil {
+		return nil, err
+	}
+	scope := chapter.Scope()
+	if scope.CurriculumID == 0 {
+		scope.CurriculumID = fromForm.CurriculumID
+	}
+	return []models.Scope{scope}, nil
+}
+
+// TopicScope resolves the chapter of the topic named by the id param or, for a new topic, the
+// chapter named by chapter_id (form) or chapterId (query).
+func (h *TopicsHandler) TopicScope(request *http.Request) ([]models.Scope, error) {
+	chapterIdStr := request.FormValue("chapter_id")
+	if chapterIdStr == "" {
+		chapterIdStr = request.FormValue("chapterId")
+	}
+	if idStr := request.FormValue("id"); idStr != "" {
+		topic, _, err := handlerutils.GetTopicByID(idStr, h.service)
+		if err != nil {
+			return nil, err
+		}
+		chapterIdStr = strconv.Itoa(int(topic.ChapterID))
+	}
+	return chapterScope(request, chapterIdStr, h.chaptersService)
+}
+
+// ProblemScope resolves the problem named by the id query param, the topic named by topic_id, and
+// the curriculum, grade and subject a JSON payload saves the problem into. All of them must be in the
+// user's scopes, so that a problem can neither be edited from outside them nor moved out of them.
+// Without an id it is a new problem: its payload (create-problem, create-problems) or the topic it
+// goes in (add-problem).
+func (h *ProblemsHandler) ProblemScope(request *http.Request) ([]models.Scope, error) {
+	body, err := jsonBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	urlVals := request.URL.Query()
+	var scopes []models.Scope
+	var stored *models.Problem
+	if idStr := urlVals.Get("id"); idStr != "" {
+		var storedScopes []models.Scope
+		if stored, storedScopes, err = fetchProblemScopes(h.problemsService, utils.StringToInt(idStr)); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, storedScopes...)
+	}
+	if topicIdStr := urlVals.Get(QUERY_PARAM_TOPIC_ID); topicIdStr != "" {
+		topicScopes, err := h.topicScopes(request, topicIdStr)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, topicScopes...)
+	}
+	if body != nil {
+		payloadScopes, err := problemPayloadScopes(stored, body)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, payloadScopes...)
+	}
+	return scopes, nil
+}
+
+// RevertProblemScope resolves the problem named by the id query param and where reverting it to the
+// version query param would put it, so that a revert can't move a problem out of the user's scopes.
+// A version that doesn't exist adds nothing: the handler answers 404.
+func (h *ProblemsHandler) RevertProblemScope(request *http.Request) ([]models.Scope, error) {
+	urlVals := request.URL.Query()
+	problemId := utils.StringToInt(urlVals.Get("id"))
+	stored, scopes, err := fetchProblemScopes(h.problemsService, problemId)
+	if err != nil {
+		return nil, err
+	}
+	versionPtr, err := h.versions.Get(request.Context(), problemId, utils.StringToInt(urlVals.Get("version")))
+	if errors.Is(err, db.ErrVersionNotFound) {
+		return scopes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	body, err := revertPayload(versionPtr.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	snapshotScopes, err := problemPayloadScopes(stored, body)
+	if err != nil {
+		return nil, err
+	}
+	return append(scopes, snapshotScopes...), nil
+}
+
+// CopyProblemScope resolves where a copy goes: the topic named by topic_id and the curriculum, grade
+// and subject dropdowns. The source problem is only read.
+func (h *ProblemsHandler) CopyProblemScope(request *http.Request) ([]models.Scope, error) {
+	scopes, err := h.topicScopes(request, request.URL.Query().Get(QUERY_PARAM_TOPIC_ID))
+	if err != nil {
+		return nil, err
+	}
+	return append(scopes, requestScope(request)), nil
+}
+
+func (h *ProblemsHandler) topicScopes(request *http.Request, topicIdStr string) ([]models.Scope, error) {
+	topic, _, err := handlerutils.GetTopicByID(topicIdStr, h.topicsService)
+	if err != nil {
+		return nil, err
+	}
+	return chapterScope(request, strconv.Itoa(int(topic.ChapterID)), h.chaptersService)
+}
+
+// problemPayloadScopes returns the scopes a save payload puts problems in: one per curriculum grade
+// of each problem, with its subject. A batch payload ({"problems": [...]}) is read problem by problem.
+// Whatever a problem's payload leaves out is kept from stored (nil for new problems).
+func problemPayloadScopes(stored *models.Problem, payload []byte) ([]models.Scope, error) {
+	var batch struct {
+		Problems []json.RawMessage `json:"problems"`
+	}
+	payloads := []json.RawMessage{payload}
+	if json.Unmarshal(payload, &batch) == nil && len(batch.Problems) > 0 {
+		payloads = batch.Problems
+	}
+
+	var scopes []models.Scope
+	for _, p := range payloads {
+		merged, err := mergeProblemPayload(stored, p)
+		if err != nil {
+			return nil, err
+		}
+		var problem struct {
+			models.Problem
+			CurriculumGrades []models.CurriculumGrade `json:"curriculum_grades"`
+		}
+		if err := json.Unmarshal(merged, &problem); err != nil {
+			return nil, err
+		}
+		if len(problem.CurriculumGrades) == 0 {
+			scopes = append(scopes, problem.Scope())
+		}
+		for _, cg := range problem.CurriculumGrades {
+			scopes = append(scopes, models.Scope{CurriculumID: cg.CurriculumID, GradeID: cg.GradeID,
+				SubjectID: problem.SubjectID})
+		}
+	}
+	return scopes, nil
+}
+
+// MoveProblemsScope resolves both ends of a move: every problem being moved and, once the move is
+// submitted, the destination curriculum, grade and subject. The move dialog only names the problems.
+func (h *ProblemsHandler) MoveProblemsScope(request *http.Request) ([]models.Scope, error) {
+	scopes := moveDestinationScope(request)
+	for _, idStr := range strings.Split(request.FormValue("problem_ids"), ",") {
+		if idStr == "" {
+			continue
+		}
+		_, problemScopes, err := fetchProblemScopes(h.problemsService, utils.StringToInt(idStr))
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, problemScopes...)
+	}
+	return scopes, nil
+}
+
+// MoveResourcesScope resolves both ends of a resource move like MoveProblemsScope: every resource
+// named by resource_ids, fetched uncached, and the destination once the move is submitted.
+func (h *ResourcesHandler) MoveResourcesScope(request *http.Request) ([]models.Scope, error) {
+	scopes := moveDestinationScope(request)
+	for _, idStr := range strings.Split(request.FormValue("resource_ids"), ",") {
+		if idStr = strings.TrimSpace(idStr); idStr == "" {
+			continue
+		}
+		var resource models.Resource
+		if err := h.service.Get(resourcesEndPoint+"/"+idStr, &resource); err != nil {
+			return nil, fmt.Errorf("error fetching resource: %v", err)
+		}
+		scopes = append(scopes, resource.Scopes()...)
+	}
+	return scopes, nil
+}
+
+// moveDestinationScope returns the destination a move form submits, or none while the request
+// doesn't name one (the dialog being opened).
+func moveDestinationScope(request *http.Request) []models.Scope {
+	if request.FormValue(CURRICULUM_DROPDOWN_NAME) == "" {
+		return nil
+	}
+	return []models.Scope{requestScope(request)}
+}
+
+// fetchProblemScopes fetches a problem from db-service, never from the cached problem lists whose
+// problems carry no curriculum or grade, and returns it with its scopes: one per curriculum grade
+// it is in, or the curriculum and grade it was fetched with when it lists none.
+func fetchProblemScopes(problemsService *services.Service[models.Problem], problemId int) (*models.Problem,
+	[]models.Scope, error) {
+
+	var fetched struct {
+		models.Problem
+		CurriculumGrades []models.CurriculumGrade `json:"curriculum_grades"`
+	}
+	if err := problemsService.Get(fmt.Sprintf(problemEndPoint, problemId), &fetched); err != nil {
+		return nil, nil, fmt.Errorf("error fetching problem: %v", err)
+	}
+	if len(fetched.CurriculumGrades) == 0 {
+		return &fetched.Problem, []models.Scope{fetched.Scope()}, nil
+	}
+	scopes := make([]models.Scope, 0, len(fetched.CurriculumGrades))
+	for _, cg := range fetched.CurriculumGrades {
+		scopes = append(scopes, models.Scope{CurriculumID: cg.CurriculumID, GradeID: cg.GradeID,
+			SubjectID: fetched.SubjectID})
+	}
+	return &fetched.Problem, scopes, nil
+}
+
+// TestScope resolves the test named by the id query param together with the curriculum grades and
+// subjects of a test JSON body, so that neither the stored nor the saved test may fall outside the
+// user's scopes.
+func (h *TestsHandler) TestScope(request *http.Request) ([]models.Scope, error) {
+	var scopes []models.Scope
+	if idStr := request.URL.Query().Get("id"); idStr != "" {
+		testId := utils.StringToInt(idStr)
+		test, err := h.testsService.GetObject(idStr, func(test *models.Test) bool {
+			return test.ID == testId
+		}, testsKey, resourcesEndPoint)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, test.Scopes()...)
+	}
+
+	body, err := jsonBody(request)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		var incoming models.Test
+		if err := json.Unmarshal(body, &incoming); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, incoming.Scopes()...)
+	}
+	return scopes, nil
+}
+
+// RestoreTestScope resolves the test named by the id query param together with the version query
+// param it is being restored to, so that a restore can't move a test out of the user's scopes. A
+// version that doesn't exist adds nothing: the handler answers 404.
+func (h *TestsHandler) RestoreTestScope(request *http.Request) ([]models.Scope, error) {
+	scopes, err := h.TestScope(request)
+	if err != nil {
+		return nil, err
+	}
+	urlVals := request.URL.Query()
+	snapshot, code, err := h.getTestVersion(request.Context(), utils.StringToInt(urlVals.Get("id")),
+		utils.StringToInt(urlVals.Get("version")))
+	if code == http.StatusNotFound {
+		return scopes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(scopes, snapshot.Scopes()...), nil
+}
+
+// ReviewScope resolves the test or problem named by the entity and id query params.
+func (h *ReviewHandler) ReviewScope(request *http.Request) ([]models.Scope, error) {
+	entity, id := reviewTarget(request)
+	return h.scopes(entity, id)
+}
+
+// ThreadScope resolves the problem of the comment thread named by the thread query param.
+func (h *CommentsHandler) ThreadScope(request *http.Request) ([]models.Scope, error) {
+	threadId, err := strconv.ParseInt(request.URL.Query().Get("thread"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	thread, err := h.comments.GetThread(request.Context(), threadId)
+	if err != nil {
+		return nil, err
+	}
+	_, scopes, err := fetchProblemScopes(h.problemsService, thread.ProblemID)
+	return scopes, err
+}
+
+// chapterScope returns the scope of a chapter, filling a missing curriculum from the request.
+func chapterScope(request *http.Request, chapterIdStr string, chaptersService *services.Service[models.Chapter]) ([]models.Scope, error) {
+	chapter, _, err := handlerutils.GetChapterByID(chapterIdStr, chaptersService)
+	if err != nil {
+		return nil, err
+	}
+	scope := chapter.Scope()
+	if scope.CurriculumID == 0 {
+		scope.CurriculumID = requestScope(request).CurriculumID
+	}
+	return []models.Scope{scope}, nil
+}
+
+// requestScope reads the curriculum, grade and subject dropdowns sent with a request. The
+// "Common" grade isn't a grade, so it leaves the grade open.
+func requestScope(request *http.Request) models.Scope {
+	if err := request.ParseForm(); err != nil {
+		return models.Scope{}
+	}
+	curriculumId, gradeId, subjectId := getCurriculumGradeSubjectIds(request.Form)
+	if gradeId == GRADE_COMMON_VALUE {
+		gradeId = 0
+	}
+	return models.Scope{CurriculumID: curriculumId, GradeID: gradeId, SubjectID: subjectId}
+}
+
+// jsonBody peeks at the request body when it holds JSON, whatever its Content-Type says, since the
+// handlers decode it regardless. Other bodies (forms) and empty ones read as nil, but a body declared
+// as JSON (charset and other parameters aside) that isn't is an error rather than no scope at all.
+func jsonBody(request *http.Request) ([]byte, error) {
+	body, err := peekBody(request)
+	if err != nil {
+		return nil, err
+	}
+	if json.Valid(body) {
+		return body, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if mediaType == "application/json" && len(bytes.TrimSpace(body)) > 0 {
+		return nil, errors.New("request body is not valid JSON")
+	}
+	return nil, nil
+}
+
+// peekBody reads the request body and puts it back for the handler.
+func peekBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// scopeFuncs adds canEdit and canAdmin to funcMap, so list rows only show the edit and archive
+// controls the signed-in user holds the role for on that row's content. Rows with no scope of their
+// own (topics) use fallback, e.g. the scope of the chapter being listed.
+func scopeFuncs(request *http.Request, funcMap template.FuncMap, fallback ...models.Scope) template.FuncMap {
+	if funcMap == nil {
+		funcMap = template.FuncMap{}
+	}
+	scopesOf := func(content any) []models.Scope {
+		switch c := content.(type) {
+		case *models.Chapter:
+			return []models.Scope{c.Scope()}
+		case *models.Problem:
+			// listed problems carry no curriculum or grade, so take those being browsed; the
+			// routes behind the controls check the problem itself
+			scope, browsed := c.Scope(), requestScope(request)
+			if scope.CurriculumID == 0 {
+				scope.CurriculumID = browsed.CurriculumID
+			}
+			if scope.GradeID == 0 {
+				scope.GradeID = browsed.GradeID
+			}
+			return []models.Scope{scope}
+		case *models.Test:
+			return c.Scopes()
+		}
+		return fallback
+	}
+	funcMap["canEdit"] = func(content any) bool {
+		return auth.Allowed(request.Context(), auth.RoleEditor, scopesOf(content)...)
+	}
+	funcMap["canAdmin"] = func(content any) bool {
+		return auth.Allowed(request.Context(), auth.RoleAdmin, scopesOf(content)...)
+	}
+	return funcMap
+}
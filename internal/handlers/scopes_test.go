@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+)
+
+// physicsEditor holds the editor role on physics (subject 3) only.
+func physicsEditor() []models.UserGrant {
+	subject := int8(3)
+	return []models.UserGrant{{SubjectID: &subject, Role: auth.RoleEditor}}
+}
+
+// editAllowed is what middleware.Authorize decides for a physics editor on the resolved scopes.
+func editAllowed(scopes []models.Scope) bool {
+	return len(scopes) > 0 && auth.AtLeast(auth.RoleIn(auth.RoleViewer, physicsEditor(), scopes...), auth.RoleEditor)
+}
+
+func TestProblemScope(t *testing.T) {
+	const physics, chemistry = 3, 4
+	chemistryProblem, _ := json.Marshal(models.Problem{ID: 4, CurriculumID: 1, GradeID: 11, SubjectID: chemistry})
+	physicsProblem, _ := json.Marshal(models.Problem{ID: 6, CurriculumID: 1, GradeID: 11, SubjectID: physics})
+	physicsTopic, _ := json.Marshal(models.Topic{ID: 5, ChapterID: 2})
+	physicsChapter, _ := json.Marshal(models.Chapter{ID: 2, CurriculumID: 1, GradeID: 11, SubjectID: physics})
+	newFakeDBService(t, map[string]string{
+		"resource/problem/4": string(chemistryProblem),
+		"resource/problem/6": string(physicsProblem),
+		"topic/5":            string(physicsTopic),
+		"chapter/2":          string(physicsChapter),
+		"skill":              "[]",
+	})
+
+	tests := []struct {
+		name, method, target, body string
+		wantAllowed                bool
+	}{
+		{"own problem", http.MethodPatch, "/update-problem?id=6", `{"subject_id":3}`, true},
+		{"other problem", http.MethodPatch, "/update-problem?id=4", `{"subject_id":3}`, false},
+		{"other problem through own topic", http.MethodPatch, "/update-problem?id=4&topic_id=5", `{"subject_id":3}`, false},
+		{"archive other problem through own topic", http.MethodDelete, "/archive-problem?id=4&topic_id=5", "", false},
+		{"move own problem out of scope", http.MethodPatch, "/update-problem?id=6",
+			`{"subject_id":4,"curriculum_grades":[{"curriculum_id":1,"grade_id":11}]}`, false},
+		{"payload with charset content type", http.MethodPatch, "/update-problem?id=6", `{"subject_id":4}`, false},
+		{"new problem in scope", http.MethodPost, "/create-problem",
+			`{"subject_id":3,"curriculum_grades":[{"curriculum_id":1,"grade_id":11}]}`, true},
+		{"batch with one problem out of scope", http.MethodPost, "/create-problems",
+			`{"problems":[{"subject_id":3},{"subject_id":4}]}`, false},
+		{"add problem to own topic", http.MethodGet, "/topic/add-problem?topic_id=5", "", true},
+	}
+	h := NewProblemsHandler(newTestService[models.Problem](), newTestService[models.Skill](), nil,
+		newTestService[models.Topic](), newTestService[models.Chapter](), nil, nil, nil, nil)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+			scopes, err := h.ProblemScope(req)
+			if err != nil {
+				t.Fatalf("ProblemScope: %v", err)
+			}
+			if allowed := editAllowed(scopes); allowed != tc.wantAllowed {
+				t.Errorf("allowed = %v on %+v, want %v", allowed, scopes, tc.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestProblemScopeSkipsListCache(t *testing.T) {
+	gseb, physics := int16(2), int8(3)
+	gsebPhysicsEditor := []models.UserGrant{{CurriculumID: &gseb, SubjectID: &physics, Role: auth.RoleEditor}}
+	newFakeDBService(t, map[string]string{
+		// listed problems come without curriculum or grade
+		"listed-problems":    `[{"id":7,"subject_id":3},{"id":8,"subject_id":3}]`,
+		"resource/problem/7": `{"id":7,"subject_id":3,"curriculum_grades":[{"curriculum_id":1,"grade_id":11}]}`,
+		"resource/problem/8": `{"id":8,"subject_id":3,"curriculum_id":2,"grade_id":11}`,
+	})
+	problemsService := newTestService[models.Problem]()
+	if _, err := problemsService.GetList("listed-problems", problemsKey, false, false); err != nil {
+		t.Fatal(err)
+	}
+	h := NewProblemsHandler(problemsService, newTestService[models.Skill](), nil, newTestService[models.Topic](),
+		newTestService[models.Chapter](), nil, nil, nil, nil)
+
+	for id, want := range map[string]string{"7": auth.RoleViewer, "8": auth.RoleEditor} {
+		req := httptest.NewRequest(http.MethodDelete, "/archive-problem?id="+id, nil)
+		scopes, err := h.ProblemScope(req)
+		if err != nil {
+			t.Fatalf("ProblemScope(%s): %v", id, err)
+		}
+		if got := auth.RoleIn(auth.RoleViewer, gsebPhysicsEditor, scopes...); got != want {
+			t.Errorf("problem %s: role = %q on %+v, want %q", id, got, scopes, want)
+		}
+	}
+}
+
+func TestTestScope(t *testing.T) {
+	physicsTest, _ := json.Marshal(models.Test{ID: 9, CurriculumGrades: []models.CurriculumGrade{{CurriculumID: 1,
+		GradeID: 11}}, TypeParams: models.ResTypeParams{Subjects: []models.ResSubject{{SubjectID: 3}}}})
+	newFakeDBService(t, map[string]string{"resource/9": string(physicsTest)})
+	h := NewTestsHandler(newTestService[models.Test](), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	tests := []struct {
+		name, target, contentType, body string
+		wantAllowed                     bool
+		wantErr                         bool
+	}{
+		{"own test", "/update-test?id=9", "application/json", `{"type_params":{"subjects":[{"subject_id":3}]}}`, true, false},
+		{"move out with a charset", "/update-test?id=9", "application/json; charset=utf-8",
+			`{"type_params":{"subjects":[{"subject_id":4}]}}`, false, false},
+		{"new test out of scope without a content type", "/create-test", "", `{"type_params":{"subjects":[{"subject_id":4}]}}`,
+			false, false},
+		{"no test at all", "/create-test", "", "", false, false},
+		{"declared JSON that isn't", "/update-test?id=9", "application/json; charset=utf-8", "{", false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, tc.target, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			scopes, err := h.TestScope(req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("TestScope error = %v, want error %v", err, tc.wantErr)
+			}
+			if allowed := editAllowed(scopes); allowed != tc.wantAllowed {
+				t.Errorf("allowed = %v on %+v, want %v", allowed, scopes, tc.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestThreadScope(t *testing.T) {
+	chemistryProblem, _ := json.Marshal(models.Problem{ID: 4, CurriculumID: 1, GradeID: 11, SubjectID: 4})
+	newFakeDBService(t, map[string]string{"resource/problem/4": string(chemistryProblem),
+		"resource/4": string(chemistryProblem)})
+	threads := newScriptDB(func(query string, _ []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if !strings.Contains(query, "FROM cms_comment_thread t WHERE t.id") {
+			return []string{"id"}, nil, nil // the thread's comments
+		}
+		columns := make([]string, 11)
+		return columns, [][]driver.Value{{int64(12), int64(4), "question", nil, "en", "open", nil, "",
+			time.Now(), nil, ""}}, nil
+	})
+	h := NewCommentsHandler(db.NewCommentRepo(threads), newTestService[models.Problem]())
+
+	req := httptest.NewRequest(http.MethodPost, "/problems/comments/reply?thread=12", nil)
+	scopes, err := h.ThreadScope(req)
+	if err != nil {
+		t.Fatalf("ThreadScope: %v", err)
+	}
+	if editAllowed(scopes) {
+		t.Errorf("physics editor may reply on a chemistry problem's thread (%+v)", scopes)
+	}
+}
+
+// snapshotDB holds one version, number 2, with the given snapshot.
+func snapshotDB(snapshot string) *sql.DB {
+	return newScriptDB(func(_ string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		columns := make([]string, 9)
+		if args[1].Value != int64(2) {
+			return columns, nil, nil
+		}
+		return columns, [][]driver.Value{{int64(1), int64(6), int64(2), "update", "", nil, "", time.Now(),
+			[]byte(snapshot)}}, nil
+	})
+}
+
+func TestRevertProblemScope(t *testing.T) {
+	physicsProblem, _ := json.Marshal(models.Problem{ID: 6, CurriculumID: 1, GradeID: 11, SubjectID: 3})
+	newFakeDBService(t, map[string]string{"resource/problem/6": string(physicsProblem)})
+
+	tests := []struct {
+		name, snapshot, target string
+		wantAllowed            bool
+	}{
+		{"snapshot in scope", `{"subject_id":3,"lang_versions":[]}`, "/problems/revert?id=6&version=2", true},
+		{"snapshot out of scope", `{"subject_id":4,"lang_versions":[]}`, "/problems/revert?id=6&version=2", false},
+		{"missing version", `{"subject_id":4}`, "/problems/revert?id=6&version=3", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewProblemsHandler(newTestService[models.Problem](), nil, nil, nil, nil, nil, nil,
+				db.NewProblemVersionRepo(snapshotDB(tc.snapshot)), nil)
+			scopes, err := h.RevertProblemScope(httptest.NewRequest(http.MethodPost, tc.target, nil))
+			if err != nil {
+				t.Fatalf("RevertProblemScope: %v", err)
+			}
+			if allowed := editAllowed(scopes); allowed != tc.wantAllowed {
+				t.Errorf("allowed = %v on %+v, want %v", allowed, scopes, tc.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestRestoreTestScope(t *testing.T) {
+	physicsTest, _ := json.Marshal(models.Test{ID: 6, CurriculumGrades: []models.CurriculumGrade{{CurriculumID: 1,
+		GradeID: 11}}, TypeParams: models.ResTypeParams{Subjects: []models.ResSubject{{SubjectID: 3}}}})
+	newFakeDBService(t, map[string]string{"resource/6": string(physicsTest)})
+
+	tests := []struct {
+		name, snapshot string
+		wantAllowed    bool
+	}{
+		{"snapshot in scope", `{"type_params":{"subjects":[{"subject_id":3}]}}`, true},
+		{"snapshot out of scope", `{"type_params":{"subjects":[{"subject_id":4}]}}`, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewTestsHandler(newTestService[models.Test](), nil, nil, nil, nil, nil, nil, nil, nil,
+				db.NewTestVersionRepo(snapshotDB(tc.snapshot)), nil, nil)
+			scopes, err := h.RestoreTestScope(httptest.NewRequest(http.MethodPost, "/tests/restore?id=6&version=2", nil))
+			if err != nil {
+				t.Fatalf("RestoreTestScope: %v", err)
+			}
+			if allowed := editAllowed(scopes); allowed != tc.wantAllowed {
+				t.Errorf("allowed = %v on %+v, want %v", allowed, scopes, tc.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestMoveResourcesScope(t *testing.T) {
+	newFakeDBService(t, map[string]string{
+		"resource/5": `{"id":5,"subject_id":3,"curriculum_grades":[{"curriculum_id":1,"grade_id":11}]}`,
+		"resource/7": `{"id":7,"subject_id":4,"curriculum_grades":[{"curriculum_id":1,"grade_id":11}]}`,
+	})
+	h := NewResourcesHandler(newTestService[models.Resource]())
+
+	tests := []struct {
+		name, form  string
+		wantAllowed bool
+	}{
+		{"open dialog on own resource", "resource_ids=5", true},
+		{"open dialog on other resource", "resource_ids=7", false},
+		{"move own resource within scope", "resource_ids=5&curriculum-dropdown=1&grade-dropdown=11&subject-dropdown=3", true},
+		{"move own resource out of scope", "resource_ids=5&curriculum-dropdown=1&grade-dropdown=11&subject-dropdown=4", false},
+		{"move other resource into scope", "resource_ids=7&curriculum-dropdown=1&grade-dropdown=11&subject-dropdown=3", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/move-resource", strings.NewReader(tc.form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			scopes, err := h.MoveResourcesScope(req)
+			if err != nil {
+				t.Fatalf("MoveResourcesScope: %v", err)
+			}
+			if allowed := editAllowed(scopes); allowed != tc.wantAllowed {
+				t.Errorf("allowed = %v on %+v, want %v", allowed, scopes, tc.wantAllowed)
+			}
+		})
+	}
+}
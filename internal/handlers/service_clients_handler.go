@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const (
+	adminServiceClientsTemplate = "admin_service_clients.html"
+	adminServiceClientTemplate  = "admin_service_client.html"
+)
+
+// defaultRotationGrace is how long the old tokens keep working after a rotation unless the admin
+// picks otherwise.
+const defaultRotationGrace = 24 * time.Hour
+
+// ServiceClientsHandler serves the admin screens of the service-client registry: the callers of
+// /api/service (af_lms, quiz-creator, ...), their scopes and their tokens.
+type ServiceClientsHandler struct {
+	clients *db.ServiceClientRepo
+}
+
+func NewServiceClientsHandler(clients *db.ServiceClientRepo) *ServiceClientsHandler {
+	return &ServiceClientsHandler{clients: clients}
+}
+
+// List renders the service clients page.
+func (h *ServiceClientsHandler) List(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.clients.List(r.Context())
+	if err != nil {
+		log.Printf("service clients list: %v", err)
+		http.Error(w, "Could not load service clients", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]any{
+		"Clients": clients,
+		"Scopes":  auth.ServiceScopes(),
+	}
+	views.ExecuteTemplates(w, data, serviceClientFuncs(), baseTemplate, adminServiceClientsTemplate,
+		adminServiceClientTemplate, adminNavTemplate)
+}
+
+// Create registers a client and issues its first token, which the response shows once. Form: name,
+// scope (repeated), expires_in_days (empty for no expiry).
+func (h *ServiceClientsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	client := &models.ServiceClient{Name: strings.TrimSpace(r.FormValue("name")), Scopes: r.Form["scope"]}
+	if client.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range client.Scopes {
+		if !auth.ValidServiceScope(scope) {
+			http.Error(w, "Invalid scope", http.StatusBadRequest)
+			return
+		}
+	}
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		client.CreatedBy = claims.Email
+	}
+
+	id, err := h.clients.Create(r.Context(), client)
+	if err != nil {
+		log.Printf("service clients create: %v", err)
+		http.Error(w, "Could not create client (name may already exist)", http.StatusBadRequest)
+		return
+	}
+	audit.SetEntity(r.Context(), id)
+	audit.SetAfter(r.Context(), client)
+	h.issue(w, r, id, nil)
+}
+
+// IssueToken issues another token for a client, shown once. With rotate=true the client's other
+// tokens expire after grace_hours (default 24, 0 for immediately). Query params: id. Form: rotate,
+// grace_hours, expires_in_days.
+func (h *ServiceClientsHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	audit.SetEntity(r.Context(), id)
+	var retireAfter *time.Duration
+	if r.FormValue("rotate") == "true" {
+		grace := defaultRotationGrace
+		if hours, err := strconv.Atoi(r.FormValue("grace_hours")); err == nil && hours >= 0 {
+			grace = time.Duration(hours) * time.Hour
+		}
+		retireAfter = &grace
+	}
+	h.issue(w, r, id, retireAfter)
+}
+
+// RevokeToken revokes one token. Query params: id (client), token.
+func (h *ServiceClientsHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	tokenID, err := strconv.ParseInt(r.URL.Query().Get("token"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusBadRequest)
+		return
+	}
+	audit.SetEntity(r.Context(), id)
+	audit.SetBefore(r.Context(), map[string]int64{"token_id": tokenID})
+	if err := h.clients.RevokeToken(r.Context(), id, tokenID); err != nil {
+		log.Printf("service clients revoke token client=%d token=%d: %v", id, tokenID, err)
+		http.Error(w, "Could not revoke token", http.StatusInternalServerError)
+		return
+	}
+	h.renderClient(w, r, id, "")
+}
+
+// Revoke revokes a client and all of its tokens. Query params: id.
+func (h *ServiceClientsHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	audit.SetEntity(r.Context(), id)
+	if err := h.clients.Revoke(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrServiceClientNotFound) {
+			http.Error(w, "Client not found or already revoked", http.StatusNotFound)
+			return
+		}
+		log.Printf("service clients revoke id=%d: %v", id, err)
+		http.Error(w, "Could not revoke client", http.StatusInternalServerError)
+		return
+	}
+	h.renderClient(w, r, id, "")
+}
+
+// issue creates a token for client id and renders the client card with the token shown once.
+func (h *ServiceClientsHandler) issue(w http.ResponseWriter, r *http.Request, id int64, retireAfter *time.Duration) {
+	token, hash, err := auth.NewServiceToken()
+	if err != nil {
+		log.Printf("service clients new token client=%d: %v", id, err)
+		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		return
+	}
+	t := &models.ServiceToken{ClientID: id, Prefix: token[:auth.ServiceTokenPrefixLen]}
+	if days, err := strconv.Atoi(r.FormValue("expires_in_days")); err == nil && days > 0 {
+		expiresAt := time.Now().AddDate(0, 0, days)
+		t.ExpiresAt = &expiresAt
+	}
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		t.CreatedBy = claims.Email
+	}
+
+	if t.ID, err = h.clients.IssueToken(r.Context(), t, hash, retireAfter); err != nil {
+		if errors.Is(err, db.ErrServiceClientNotFound) {
+			http.Error(w, "Client not found or revoked", http.StatusNotFound)
+			return
+		}
+		log.Printf("service clients issue token client=%d: %v", id, err)
+		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		return
+	}
+	audit.SetAfter(r.Context(), t)
+	h.renderClient(w, r, id, token)
+}
+
+// renderClient renders one client card. newToken, when set, is shown once above the token list.
+func (h *ServiceClientsHandler) renderClient(w http.ResponseWriter, r *http.Request, id int64, newToken string) {
+	client, err := h.clients.Get(r.Context(), id)
+	if err != nil {
+		log.Printf("service clients reload id=%d: %v", id, err)
+		http.Error(w, "Could not reload client", http.StatusInternalServerError)
+		return
+	}
+	views.ExecuteTemplate(adminServiceClientTemplate, w, map[string]any{
+		"Client":   client,
+		"NewToken": newToken,
+	}, serviceClientFuncs())
+}
+
+func serviceClientFuncs() template.FuncMap {
+	now := time.Now()
+	return template.FuncMap{
+		"dict": utils.Dict,
+		"tokenActive": func(t models.ServiceToken) bool {
+			return t.Active(now)
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/avantifellows/nex-gen-cms/internal/analytics"
+	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const testAnalyticsTemplate = "test_analytics.html"
+
+// GetTestAnalytics renders the coverage panel of the test page. Query params: id.
+func (h *TestsHandler) GetTestAnalytics(responseWriter http.ResponseWriter, request *http.Request) {
+	report, ok := h.testAnalytics(responseWriter, request)
+	if !ok {
+		return
+	}
+	views.ExecuteTemplate(testAnalyticsTemplate, responseWriter, report, template.FuncMap{
+		"sectionName": views.GetSectionName,
+		"dict":        utils.Dict,
+	})
+}
+
+// GetTestAnalyticsJSON serves the same report as GetTestAnalytics as JSON. Query params: id.
+func (h *TestsHandler) GetTestAnalyticsJSON(responseWriter http.ResponseWriter, request *http.Request) {
+	report, ok := h.testAnalytics(responseWriter, request)
+	if !ok {
+		return
+	}
+	writeJSON(responseWriter, report)
+}
+
+// testAnalytics builds the report for the test named by the id query param. It writes the error
+// response itself when it returns false.
+func (h *TestsHandler) testAnalytics(responseWriter http.ResponseWriter, request *http.Request) (analytics.Report, bool) {
+	testPtr, code, err := h.getTest(responseWriter, request)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), code)
+		return analytics.Report{}, false
+	}
+	problems := h.getTestProblems(responseWriter, request)
+	if problems == nil {
+		return analytics.Report{}, false
+	}
+	return analytics.NewReport(testPtr, *problems, h.ruleForTest(testPtr), h.analyticsNames()), true
+}
+
+// analyticsNames looks up skill and topic names. A failed lookup is logged and leaves those names out,
+// since the counts are still worth showing.
+func (h *TestsHandler) analyticsNames() analytics.Names {
+	names := analytics.Names{Skills: map[int16]string{}, Topics: map[int16]string{}}
+	if skills, err := h.skillsService.GetList(skillsEndPoint, skillsKey, false, false); err != nil {
+		log.Printf("test analytics skills: %v", err)
+	} else {
+		for _, s := range *skills {
+			names.Skills[s.ID] = s.Name
+		}
+	}
+	if topics, err := h.topicsService.GetList(handlerutils.TopicsEndPoint+"?limit=5000", handlerutils.TopicsKey,
+		false, false); err != nil {
+		log.Printf("test analytics topics: %v", err)
+	} else {
+		for _, t := range *topics {
+			names.Topics[t.ID] = t.GetNameByLang("en")
+		}
+	}
+	return names
+}
@@ -21,12 +21,15 @@ import (
 	"github.com/chromedp/chromedp"
 	"github.com/thoas/go-funk"
 
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
 	"github.com/avantifellows/nex-gen-cms/internal/constants"
 	"github.com/avantifellows/nex-gen-cms/internal/dto"
 	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
 	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
 	"github.com/avantifellows/nex-gen-cms/internal/services"
 	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/internal/workflow"
 	"github.com/avantifellows/nex-gen-cms/utils"
 )
 
@@ -75,12 +78,19 @@ type TestsHandler struct {
 	curriculumsService *services.Service[models.Curriculum]
 	gradesService      *services.Service[models.Grade]
 	examsService       *services.Service[models.Exam]
+	skillsService      *services.Service[models.Skill]
+	topicsService      *services.Service[models.Topic]
+	versions           *db.TestVersionRepo
+	images             *db.ImageRepo
+	exposures          *db.ProblemExposureRepo
 }
 
 func NewTestsHandler(testsService *services.Service[models.Test], subjectsService *services.Service[models.Subject],
 	problemsService *services.Service[models.Problem], testRulesService *services.Service[models.TestRule],
 	curriculumsService *services.Service[models.Curriculum], gradesService *services.Service[models.Grade],
-	examsService *services.Service[models.Exam]) *TestsHandler {
+	examsService *services.Service[models.Exam], skillsService *services.Service[models.Skill],
+	topicsService *services.Service[models.Topic], versions *db.TestVersionRepo, images *db.ImageRepo,
+	exposures *db.ProblemExposureRepo) *TestsHandler {
 	return &TestsHandler{
 		testsService:       testsService,
 		subjectsService:    subjectsService,
@@ -89,6 +99,11 @@ func NewTestsHandler(testsService *services.Service[models.Test], subjectsServic
 		curriculumsService: curriculumsService,
 		gradesService:      gradesService,
 		examsService:       examsService,
+		skillsService:      skillsService,
+		topicsService:      topicsService,
+		versions:           versions,
+		images:             images,
+		exposures:          exposures,
 	}
 }
 
@@ -122,22 +137,24 @@ func (h *TestsHandler) GetTests(responseWriter http.ResponseWriter, request *htt
 		return
 	}
 
-	tests, err := h.listTests(curriculumId, gradeId, urlVals.Get(TESTTYPE_DROPDOWN_NAME),
+	tests, err := h.listTests(testsKey, curriculumId, gradeId, urlVals.Get(TESTTYPE_DROPDOWN_NAME),
 		urlVals.Get("sortColumn"), urlVals.Get("sortOrder"))
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error fetching tests: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	views.ExecuteTemplate(testRowTemplate, responseWriter, tests, nil)
+	views.ExecuteTemplate(testRowTemplate, responseWriter, tests, scopeFuncs(request, nil))
 }
 
-// listTests fetches active tests for a curriculum/grade/subtype, sorted. Shared by the
-// HTMX row view (GetTests) and the service JSON API (GetTestsJSON).
-func (h *TestsHandler) listTests(curriculumId int16, gradeId int8, testtype, sortColumn, sortOrder string) (*[]*models.Test, error) {
+// listTests fetches active tests for a curriculum/grade/subtype, sorted, caching them under cacheKey.
+// Shared by the HTMX row view (GetTests) and the service JSON API (GetTestsJSON), which passes an empty
+// key so as not to fill the UI cache.
+func (h *TestsHandler) listTests(cacheKey string, curriculumId int16, gradeId int8, testtype, sortColumn,
+	sortOrder string) (*[]*models.Test, error) {
 	queryParams := fmt.Sprintf("?"+QUERY_PARAM_CURRICULUM_ID+"=%d&grade_id=%d&type=test&subtype=%s", curriculumId, gradeId, testtype)
 
-	tests, err := h.testsService.GetList(resourcesCurriculumEndPoint+queryParams, testsKey, false, true)
+	tests, err := h.testsService.GetList(resourcesCurriculumEndPoint+queryParams, cacheKey, false, true)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +186,7 @@ func (h *TestsHandler) GetChapterTests(responseWriter http.ResponseWriter, reque
 		return
 	}
 
-	tests, err := h.listTests(curriculumId, gradeId, "chapter_test", urlVals.Get("sortColumn"), urlVals.Get("sortOrder"))
+	tests, err := h.listTests(testsKey, curriculumId, gradeId, "chapter_test", urlVals.Get("sortColumn"), urlVals.Get("sortOrder"))
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error fetching tests: %v", err), http.StatusInternalServerError)
 		return
@@ -184,7 +201,7 @@ func (h *TestsHandler) GetChapterTests(responseWriter http.ResponseWriter, reque
 	}
 	*tests = filtered
 
-	views.ExecuteTemplate(testRowTemplate, responseWriter, tests, nil)
+	views.ExecuteTemplate(testRowTemplate, responseWriter, tests, scopeFuncs(request, nil))
 }
 
 // removes archived tests from the slice
@@ -281,9 +298,9 @@ func (h *TestsHandler) GetSearchTests(responseWriter http.ResponseWriter, reques
 		Curriculums: curriculumMap,
 		Grades:      gradeMap,
 	}
-	views.ExecuteTemplate(tmpl, responseWriter, data, template.FuncMap{
+	views.ExecuteTemplate(tmpl, responseWriter, data, scopeFuncs(request, template.FuncMap{
 		"dict": utils.Dict,
-	})
+	}))
 }
 
 func sortTests(testPtrs []*models.Test, sortColumn string, sortOrder string, curriculumMap map[int16]string,
@@ -380,8 +397,10 @@ func (h *TestsHandler) GetTest(responseWriter http.ResponseWriter, request *http
 	}
 
 	views.ExecuteTemplates(responseWriter, data, template.FuncMap{
-		"langName":  utils.LangName,
-		"langCodes": utils.LangCodes,
+		"langName":    utils.LangName,
+		"langCodes":   utils.LangCodes,
+		"statusName":  workflow.StatusName,
+		"statusBadge": statusBadgeClass,
 	}, baseTemplate, testTemplate)
 }
 
@@ -416,11 +435,11 @@ func (h *TestsHandler) GetSubjectwiseTestProblems(responseWriter http.ResponseWr
 		SelectedIDs: selectedIDs,
 	}
 
-	views.ExecuteTemplates(responseWriter, data, template.FuncMap{
-		"emptySlice": utils.EmptySlice[*models.Problem],
-		"append":     utils.Append[*models.Problem],
-		"isSelected": func(id int, m map[int]bool) bool { return m[id] },
-	}, addTestSearchedTemplate, srcProblemRowTemplate)
+	funcMap := exposureFuncs(problemExposure(request.Context(), h.exposures, *problems, request.URL.Query()))
+	funcMap["emptySlice"] = utils.EmptySlice[*models.Problem]
+	funcMap["append"] = utils.Append[*models.Problem]
+	funcMap["isSelected"] = func(id int, m map[int]bool) bool { return m[id] }
+	views.ExecuteTemplates(responseWriter, data, funcMap, addTestSearchedTemplate, srcProblemRowTemplate)
 }
 
 func (h *TestsHandler) getTest(responseWriter http.ResponseWriter, request *http.Request) (*models.Test, int, error) {
@@ -443,7 +462,8 @@ func (h *TestsHandler) getTest(responseWriter http.ResponseWriter, request *http
 }
 
 func (h *TestsHandler) fillSubjectNames(responseWriter http.ResponseWriter, testPtr *models.Test) {
-	subjectPtrs, err := h.subjectsService.GetList(handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey, false, false)
+	// the service API reads tests through here too
+	subjectPtrs, err := listWithoutCaching(h.subjectsService, handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error fetching subjects: %v", err), http.StatusInternalServerError)
 	} else {
@@ -533,15 +553,23 @@ func (h *TestsHandler) GetTestProblems(responseWriter http.ResponseWriter, reque
 }
 
 func (h *TestsHandler) getTestProblems(responseWriter http.ResponseWriter, request *http.Request) *[]*models.Problem {
+	return h.fetchTestProblems(responseWriter, request, problemsKey)
+}
+
+// fetchTestProblems fetches the problems of the test named by the id query param, caching them under
+// cacheKey; the service API passes an empty key so as not to fill the UI cache.
+func (h *TestsHandler) fetchTestProblems(responseWriter http.ResponseWriter, request *http.Request,
+	cacheKey string) *[]*models.Problem {
 	urlVals := request.URL.Query()
 	testIdStr := urlVals.Get("id")
 	testId := utils.StringToInt(testIdStr)
 
 	endPointWithID := fmt.Sprintf(testProblemsEndPoint, testId)
-	problems, err := h.problemsService.GetList(endPointWithID, problemsKey, false, true)
+	problems, err := h.problemsService.GetList(endPointWithID, cacheKey, false, true)
 
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error fetching problems: %v", err), http.StatusInternalServerError)
+		return nil
 	}
 
 	h.fillProblemSubjects(responseWriter, problems)
@@ -550,7 +578,7 @@ func (h *TestsHandler) getTestProblems(responseWriter http.ResponseWriter, reque
 }
 
 func (h *TestsHandler) fillProblemSubjects(responseWriter http.ResponseWriter, problems *[]*models.Problem) {
-	subjectPtrs, err := h.subjectsService.GetList(handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey, false, false)
+	subjectPtrs, err := listWithoutCaching(h.subjectsService, handlerutils.SubjectsEndPoint, handlerutils.SubjectsKey)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error fetching subjects: %v", err), http.StatusInternalServerError)
 	} else {
@@ -749,11 +777,17 @@ func (h *TestsHandler) CreateTest(responseWriter http.ResponseWriter, request *h
 		return
 	}
 
-	_, err = h.testsService.AddObject(testObj, testsKey, resourcesEndPoint)
+	// new tests start in draft and reach af_lms only once reviewed and published
+	testObj.StatusID = constants.StatusDraft
+	createdPtr, err := h.testsService.AddObject(testObj, testsKey, resourcesEndPoint)
 	if err != nil {
 		handlerutils.WriteRemoteAPIError(responseWriter, "Error adding test", err)
 		return
 	}
+	testObj.ID, testObj.Code = createdPtr.ID, createdPtr.Code
+	audit.SetEntity(request.Context(), createdPtr.ID)
+	h.recordTestVersion(request.Context(), &testObj, db.VersionActionCreate, "")
+	h.recordExposure(request.Context(), &testObj)
 }
 
 func (h *TestsHandler) EditTest(responseWriter http.ResponseWriter, request *http.Request) {
@@ -783,9 +817,10 @@ func (h *TestsHandler) EditTest(responseWriter http.ResponseWriter, request *htt
 	}
 
 	data := dto.TestData{
-		TestPtr:  selectedTestPtr,
-		Problems: problemsMap,
-		TestRule: testRule,
+		TestPtr:      selectedTestPtr,
+		Problems:     problemsMap,
+		TestRule:     testRule,
+		VersionToken: h.testVersionToken(request.Context(), selectedTestPtr.ID),
 	}
 	data.JeeAdvancedExamID = h.resolveJeeAdvancedExamID()
 
@@ -823,15 +858,46 @@ func (h *TestsHandler) UpdateTest(responseWriter http.ResponseWriter, request *h
 
 	testIdStr := request.URL.Query().Get("id")
 	testId := utils.StringToInt(testIdStr)
+	if !h.checkTestVersion(responseWriter, request, testId) {
+		return
+	}
+
+	stored, err := h.testsService.GetObject(testIdStr, func(test *models.Test) bool {
+		return test.ID == testId
+	}, testsKey, resourcesEndPoint)
+	if err != nil {
+		handlerutils.WriteRemoteAPIError(responseWriter, "Error fetching test", err)
+		return
+	}
+	// status only moves through review (ReviewHandler.Transition); an edit can only send it back
+	testObj.StatusID = editedStatus(request.Context(), stored.StatusID, stored.Scopes()...)
+
+	h.recordTestBaseline(request.Context(), testId)
+	auditBefore(request.Context(), h.testsService, testIdStr, func(test *models.Test) bool {
+		return test.ID == testId
+	}, testsKey, resourcesEndPoint)
+
+	saved := testObj
+	saved.ID = testId
+	version, ok := h.claimTestVersion(responseWriter, request, &saved)
+	if !ok {
+		return
+	}
 
 	_, err = h.testsService.UpdateObject(testIdStr, resourcesEndPoint, testObj, testsKey,
 		func(test *models.Test) bool {
 			return (*test).ID == testId
 		})
 	if err != nil {
+		h.releaseTestVersion(request.Context(), testId, version)
 		handlerutils.WriteRemoteAPIError(responseWriter, "Error updating test", err)
 		return
 	}
+	if version == 0 {
+		version = h.recordTestVersion(request.Context(), &saved, db.VersionActionUpdate, "")
+	}
+	setVersionToken(responseWriter, version)
+	h.recordExposure(request.Context(), &saved)
 }
 
 func (h *TestsHandler) UpdateTestSubject(responseWriter http.ResponseWriter, request *http.Request) {
@@ -844,12 +910,24 @@ func (h *TestsHandler) UpdateTestSubject(responseWriter http.ResponseWriter, req
 		return
 	}
 
+	testId := utils.StringToInt(request.URL.Query().Get("id"))
+	if !h.checkTestVersion(responseWriter, request, testId) {
+		return
+	}
+	// snapshot the pre-save state before the test is changed below
+	h.recordTestBaseline(request.Context(), testId)
+
 	// Fetch existing test
-	test, _, err := h.getTest(responseWriter, request)
+	cached, _, err := h.getTest(responseWriter, request)
 	if err != nil {
 		http.Error(responseWriter, "Test not found", http.StatusNotFound)
 		return
 	}
+	audit.SetBefore(request.Context(), cached)
+	// change a copy, so that a save turned away below leaves the cached test as it was
+	copied := *cached
+	copied.TypeParams.Subjects = slices.Clone(cached.TypeParams.Subjects)
+	test := &copied
 
 	// Find & update ONLY the matching subject
 	updated := false
@@ -868,15 +946,27 @@ func (h *TestsHandler) UpdateTestSubject(responseWriter http.ResponseWriter, req
 
 	// Recalculate total marks from subject marks
 	test.RecalculateTotalMarksFromSubjects()
+	test.StatusID = editedStatus(request.Context(), test.StatusID, test.Scopes()...)
+	version, ok := h.claimTestVersion(responseWriter, request, test)
+	if !ok {
+		return
+	}
 
 	// Persist updated test
 	if _, err = h.testsService.UpdateObject(strconv.Itoa(test.ID), resourcesEndPoint, test, testsKey,
 		func(t *models.Test) bool {
 			return (*t).ID == test.ID
 		}); err != nil {
+		h.releaseTestVersion(request.Context(), test.ID, version)
 		http.Error(responseWriter, fmt.Sprintf("Error updating subject: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if version == 0 {
+		version = h.recordTestVersion(request.Context(), test, db.VersionActionUpdate, "")
+	}
+	setVersionToken(responseWriter, version)
+	h.recordExposure(request.Context(), test)
+	audit.SetAfter(request.Context(), test)
 
 	responseWriter.WriteHeader(http.StatusOK)
 }
@@ -887,6 +977,9 @@ func (h *TestsHandler) ArchiveTest(responseWriter http.ResponseWriter, request *
 	body := map[string]any{
 		"cms_status_id": constants.StatusArchived,
 	}
+	auditBefore(request.Context(), h.testsService, testIdStr, func(test *models.Test) bool {
+		return test.ID == testId
+	}, testsKey, resourcesEndPoint)
 
 	err := h.testsService.ArchiveObject(testIdStr, resourcesEndPoint, body, testsKey,
 		func(test *models.Test) bool {
@@ -1050,10 +1143,19 @@ func (h *TestsHandler) DownloadPdf(responseWriter http.ResponseWriter, request *
 		http.Error(responseWriter, err.Error(), code)
 		return
 	}
+	// getTestProblems writes its own http.Error and returns nil on failure.
 	problems := h.getTestProblems(responseWriter, request)
+	if problems == nil {
+		return
+	}
+	h.writePdf(responseWriter, request, selectedTestPtr, *problems)
+}
 
+// writePdf renders the test and its problems as the PDF named by the type query param.
+func (h *TestsHandler) writePdf(responseWriter http.ResponseWriter, request *http.Request,
+	selectedTestPtr *models.Test, problems []*models.Problem) {
 	problemsMap := make(map[int]*models.Problem)
-	for _, p := range *problems {
+	for _, p := range problems {
 		problemsMap[p.ID] = p
 	}
 
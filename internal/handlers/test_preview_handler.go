@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/dto"
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/scoring"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const testPreviewTemplate = "test_preview.html"
+const testPreviewResultTemplate = "test_preview_result.html"
+
+// responseFieldPrefix prefixes a problem's ID in the preview form's field names.
+const responseFieldPrefix = "p-"
+
+// PreviewTest renders the test as a student takes it, so editors can try it before publishing.
+// Nothing is recorded. Query params: id.
+func (h *TestsHandler) PreviewTest(responseWriter http.ResponseWriter, request *http.Request) {
+	testPtr, problems, key, ok := h.previewKey(responseWriter, request)
+	if !ok {
+		return
+	}
+	byID := make(map[int]*models.Problem, len(problems))
+	for _, p := range problems {
+		byID[p.ID] = p
+	}
+
+	data := dto.TestPreviewData{
+		TestPtr:         testPtr,
+		LangCodes:       previewLangCodes(problems),
+		DurationSeconds: utils.StringToInt(testPtr.TypeParams.Duration) * 60,
+	}
+	if len(testPtr.CurriculumGrades) > 0 {
+		data.CurriculumID = testPtr.CurriculumGrades[0].CurriculumID
+		data.GradeID = testPtr.CurriculumGrades[0].GradeID
+	}
+	number := 0
+	for i, subject := range key.Subjects {
+		testSubject := testPtr.TypeParams.Subjects[i]
+		for j, sec := range subject.Sections {
+			section := dto.PreviewSection{SubjectName: testSubject.Name, Name: views.GetSectionName(sec.Type, sec.Name)}
+			add := func(p grading.Problem, optional bool, layout *models.OptionLayout) {
+				number++
+				section.Problems = append(section.Problems, dto.PreviewProblem{Number: number, Optional: optional,
+					Problem: byID[p.ID], Key: p, OptionLayout: layout})
+			}
+			refs := testSubject.Sections[j]
+			for k, p := range sec.Compulsory {
+				add(p, false, refs.Compulsory.Problems[k].OptionLayout)
+			}
+			if sec.Optional != nil {
+				section.MandatoryCount = sec.Optional.MandatoryCount
+				for k, p := range sec.Optional.Problems {
+					add(p, true, refs.Optional.Problems[k].OptionLayout)
+				}
+			}
+			data.Sections = append(data.Sections, section)
+		}
+	}
+
+	views.ExecuteTemplates(responseWriter, data, template.FuncMap{
+		"langName":     utils.LangName,
+		"labels":       optionLabels,
+		"previewInput": previewInput,
+		"optionCount":  previewOptionCount,
+		"defaultLang":  previewDefaultLang,
+		"marksLabel":   marksLabel,
+	}, baseTemplate, testPreviewTemplate)
+}
+
+// GradePreview scores the preview form with the test's marking scheme and renders the result with the
+// answer key beside each response. Query params: id. Form: p-<problem id> (repeated for options).
+func (h *TestsHandler) GradePreview(responseWriter http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		http.Error(responseWriter, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	testPtr, problems, key, ok := h.previewKey(responseWriter, request)
+	if !ok {
+		return
+	}
+	codes := make(map[int]string, len(problems))
+	for _, p := range problems {
+		codes[p.ID] = p.Code
+	}
+
+	responses := previewResponses(request.PostForm, key)
+	result := scoring.ScoreKey(key, responses)
+	data := dto.PreviewResultData{Result: result}
+	number := 0
+	for i, subject := range result.Subjects {
+		for j, sec := range subject.Sections {
+			keySection := key.Subjects[i].Sections[j]
+			keyProblems := keySection.Compulsory
+			if keySection.Optional != nil {
+				keyProblems = append(slices.Clip(keyProblems), keySection.Optional.Problems...)
+			}
+			section := dto.PreviewResultSection{SubjectName: testPtr.TypeParams.Subjects[i].Name,
+				Name: views.GetSectionName(sec.Type, sec.Name), Marks: sec.Marks, MaxMarks: sec.MaxMarks}
+			for k, r := range sec.Problems {
+				number++
+				section.Rows = append(section.Rows, dto.PreviewResultRow{Number: number, Code: codes[r.ID],
+					Response: responseText(responses[r.ID]), Answer: answerText(keyProblems[k].Answer), ProblemResult: r})
+			}
+			data.Sections = append(data.Sections, section)
+		}
+	}
+	views.ExecuteTemplate(testPreviewResultTemplate, responseWriter, data, nil)
+}
+
+// previewKey fetches the test named by the id query param with its problems and answer key. It writes
+// the error response itself when it returns false.
+func (h *TestsHandler) previewKey(responseWriter http.ResponseWriter, request *http.Request) (*models.Test,
+	[]*models.Problem, grading.Key, bool) {
+	testPtr, code, err := h.getTest(responseWriter, request)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), code)
+		return nil, nil, grading.Key{}, false
+	}
+	problems := h.getTestProblems(responseWriter, request)
+	if problems == nil {
+		return nil, nil, grading.Key{}, false
+	}
+	return testPtr, *problems, grading.NewKey(testPtr, *problems), true
+}
+
+// previewResponses reads each problem's p-<id> fields: option indices for the choice subtypes, else
+// the value entered.
+func previewResponses(form url.Values, key grading.Key) map[int]scoring.Response {
+	responses := map[int]scoring.Response{}
+	read := func(p grading.Problem) {
+		values := form[responseFieldPrefix+strconv.Itoa(p.ID)]
+		if len(values) == 0 {
+			return
+		}
+		var r scoring.Response
+		if kind := previewInput(p.Subtype); kind == "radio" || kind == "checkbox" {
+			for _, v := range values {
+				if i, err := strconv.Atoi(v); err == nil && i >= 0 && i < len(optionLabels()) {
+					r.Options = append(r.Options, i)
+				}
+			}
+		} else {
+			r.Value = strings.TrimSpace(values[0])
+		}
+		responses[p.ID] = r
+	}
+	for _, s := range key.Subjects {
+		for _, sec := range s.Sections {
+			for _, p := range sec.Compulsory {
+				read(p)
+			}
+			if sec.Optional != nil {
+				for _, p := range sec.Optional.Problems {
+					read(p)
+				}
+			}
+		}
+	}
+	return responses
+}
+
+// previewInput is how a student answers a problem of subtype: radio, checkbox, integer, decimal or
+// text.
+func previewInput(subtype string) string {
+	switch subtype {
+	case grading.SingleAnswer, grading.MatrixMatch:
+		return "radio"
+	case grading.MultipleAnswer:
+		return "checkbox"
+	case grading.IntegerType:
+		return "integer"
+	case grading.Numerical, grading.Comprehension:
+		return "decimal"
+	}
+	return "text"
+}
+
+// previewOptionCount is the number of options of the problem's English version, else its first.
+func previewOptionCount(p *models.Problem) int {
+	if version := p.GetLangVersion(previewDefaultLang(p)); version != nil {
+		return len(version.MetaData.Options)
+	}
+	return len(p.MetaData.Options)
+}
+
+// previewDefaultLang is the language a problem shows in until another is picked, and whenever the
+// picked one is missing: English, else its first version.
+func previewDefaultLang(p *models.Problem) string {
+	if p.GetLangVersion("en") == nil && len(p.LangVersions) > 0 {
+		return p.LangVersions[0].LangCode
+	}
+	return "en"
+}
+
+// previewLangCodes lists the languages of problems in the order of the language picker, English first.
+func previewLangCodes(problems []*models.Problem) []string {
+	present := map[string]bool{"en": true}
+	for _, p := range problems {
+		for _, lv := range p.LangVersions {
+			present[lv.LangCode] = true
+		}
+	}
+	codes := []string{"en"}
+	for _, code := range utils.LangCodes() {
+		if code != "en" && present[code] {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// marksLabel shows a problem's marking scheme, e.g. "+4 / -1".
+func marksLabel(p grading.Problem) string {
+	label := fmt.Sprintf("+%d", p.FullMarks)
+	if len(p.NegMarks) > 0 {
+		label += fmt.Sprintf(" / -%d", slices.Max(p.NegMarks))
+	}
+	return label
+}
+
+// answerText shows a key's answer as option letters or a value or range.
+func answerText(a grading.Answer) string {
+	switch a.Kind {
+	case grading.Choice:
+		return optionLetters(a.Options)
+	case grading.Numeric:
+		lo, hi := strconv.FormatFloat(a.Min, 'f', -1, 64), strconv.FormatFloat(a.Max, 'f', -1, 64)
+		if lo == hi {
+			return lo
+		}
+		return lo + " to " + hi
+	}
+	return "—"
+}
+
+func responseText(r scoring.Response) string {
+	if len(r.Options) > 0 {
+		return optionLetters(r.Options)
+	}
+	if r.Value != "" {
+		return r.Value
+	}
+	return "—"
+}
+
+func optionLetters(options []int) string {
+	letters := make([]string, 0, len(options))
+	for _, o := range slices.Sorted(slices.Values(options)) {
+		letters = append(letters, string(rune('A'+o)))
+	}
+	return strings.Join(letters, ", ")
+}
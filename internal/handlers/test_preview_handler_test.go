@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/scoring"
+)
+
+func TestPreviewResponses(t *testing.T) {
+	key := grading.Key{Subjects: []grading.Subject{{Sections: []grading.Section{{
+		Compulsory: []grading.Problem{
+			{ID: 1, Subtype: grading.SingleAnswer},
+			{ID: 2, Subtype: grading.MultipleAnswer},
+			{ID: 3, Subtype: grading.Numerical},
+		},
+		Optional: &grading.Optional{Problems: []grading.Problem{{ID: 4, Subtype: grading.IntegerType}}},
+	}}}}}
+
+	tests := []struct {
+		name string
+		form url.Values
+		want map[int]scoring.Response
+	}{
+		{"nothing answered", url.Values{}, map[int]scoring.Response{}},
+		{"every kind of answer",
+			url.Values{"p-1": {"2"}, "p-2": {"0", "3"}, "p-3": {" 4.5 "}, "p-4": {"7"}},
+			map[int]scoring.Response{1: {Options: []int{2}}, 2: {Options: []int{0, 3}}, 3: {Value: "4.5"},
+				4: {Value: "7"}}},
+		{"options out of range are dropped",
+			url.Values{"p-1": {"-1"}, "p-2": {"1", "10", "x"}},
+			map[int]scoring.Response{1: {}, 2: {Options: []int{1}}}},
+		{"problems outside the key are ignored", url.Values{"p-9": {"1"}}, map[int]scoring.Response{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := previewResponses(tc.form, key); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("previewResponses = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAnswerText(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer grading.Answer
+		want   string
+	}{
+		{"single option", grading.Answer{Kind: grading.Choice, Options: []int{1}}, "B"},
+		{"several options", grading.Answer{Kind: grading.Choice, Options: []int{0, 3}}, "A, D"},
+		{"exact value", grading.Answer{Kind: grading.Numeric, Min: 9.8, Max: 9.8}, "9.8"},
+		{"range", grading.Answer{Kind: grading.Numeric, Min: -1, Max: 2.5}, "-1 to 2.5"},
+		{"no answer", grading.Answer{Kind: grading.None}, "—"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := answerText(tc.answer); got != tc.want {
+				t.Errorf("answerText = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOptionLetters(t *testing.T) {
+	tests := []struct {
+		options []int
+		want    string
+	}{
+		{nil, ""},
+		{[]int{0}, "A"},
+		{[]int{3, 0, 2}, "A, C, D"},
+	}
+	for _, tc := range tests {
+		if got := optionLetters(tc.options); got != tc.want {
+			t.Errorf("optionLetters(%v) = %q, want %q", tc.options, got, tc.want)
+		}
+	}
+}
+
+func TestMarksLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem grading.Problem
+		want    string
+	}{
+		{"no negative marking", grading.Problem{FullMarks: 3}, "+3"},
+		{"negative marking", grading.Problem{FullMarks: 4, NegMarks: []int{1}}, "+4 / -1"},
+		{"largest penalty", grading.Problem{FullMarks: 4, NegMarks: []int{1, 2}}, "+4 / -2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := marksLabel(tc.problem); got != tc.want {
+				t.Errorf("marksLabel = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPreviewDefaultLang(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []models.LangVersion
+		want     string
+	}{
+		{"English", []models.LangVersion{{LangCode: "hi"}, {LangCode: "en"}}, "en"},
+		{"no English version", []models.LangVersion{{LangCode: "hi"}, {LangCode: "mr"}}, "hi"},
+		{"no versions", nil, "en"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := previewDefaultLang(&models.Problem{LangVersions: tc.versions}); got != tc.want {
+				t.Errorf("previewDefaultLang = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,17 +3,27 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/avantifellows/nex-gen-cms/internal/assembly"
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
 	"github.com/avantifellows/nex-gen-cms/internal/models"
+	servicev1 "github.com/avantifellows/nex-gen-cms/internal/serviceapi/v1"
+	"github.com/avantifellows/nex-gen-cms/internal/workflow"
+	"github.com/avantifellows/nex-gen-cms/utils"
 )
 
 // AssembledTest is the service-API contract consumed by quiz-backend's CMS->quiz mapper:
 // the Test (structure + marks cascade at test/subject/section/problem levels inside
 // type_params) plus a flat list of fully-resolved Problems (text, options, answer,
-// paragraph — images already base64-inline in the HTML from db-service). The mapper joins
-// each problem to its ResProblem reference by ID. See task lms-cms-tests for the locked
-// contract.
+// paragraph — images already base64-inline in the HTML from db-service, unless images=url).
+// The mapper joins each problem to its ResProblem reference by ID. See task lms-cms-tests for
+// the locked contract. Deprecated: new callers use /api/service/v1, whose response types (package
+// serviceapi/v1) are decoupled from the internal models; this shape changes whenever they do.
 type AssembledTest struct {
 	Test     *models.Test      `json:"test"`
 	Problems []*models.Problem `json:"problems"`
@@ -22,7 +32,8 @@ type AssembledTest struct {
 // GetTestsJSON is the JSON sibling of GetTests (which renders HTMX rows). It lists active
 // tests for a curriculum/grade/subtype so a session-creation surface (af_lms,
 // quiz-creator) can present a picker instead of pasting a CMS URL. Query params mirror the
-// HTMX route: curriculum-dropdown, grade-dropdown, testtype-dropdown.
+// HTMX route: curriculum-dropdown, grade-dropdown, testtype-dropdown. Only published tests are
+// listed unless include_unpublished=true. Deprecated: see GetTestsV1.
 func (h *TestsHandler) GetTestsJSON(responseWriter http.ResponseWriter, request *http.Request) {
 	urlVals := request.URL.Query()
 
@@ -32,8 +43,7 @@ func (h *TestsHandler) GetTestsJSON(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	tests, err := h.listTests(curriculumId, gradeId, urlVals.Get(TESTTYPE_DROPDOWN_NAME),
-		urlVals.Get("sortColumn"), urlVals.Get("sortOrder"))
+	tests, err := h.listServiceTests(curriculumId, gradeId, urlVals.Get(TESTTYPE_DROPDOWN_NAME), urlVals)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error fetching tests: %v", err), http.StatusInternalServerError)
 		return
@@ -45,26 +55,197 @@ func (h *TestsHandler) GetTestsJSON(responseWriter http.ResponseWriter, request
 // GetAssembledTestJSON returns a single test with all its problems inlined — the input
 // contract for quiz-backend ingest. It reuses the same resolution the PDF/detail views use
 // (getTest + getTestProblems), so the assembled shape stays in lockstep with what the CMS
-// renders. Query params: id (test id).
+// renders. Query params: id (test id), include_unpublished (true to fetch a test that hasn't
+// been published yet, e.g. for a preview), lang, render, images, omit_answers (see assembleTest).
+// Deprecated: see GetAssembledTestV1.
 func (h *TestsHandler) GetAssembledTestJSON(responseWriter http.ResponseWriter, request *http.Request) {
 	if request.URL.Query().Get("id") == "" {
 		http.Error(responseWriter, "id is required", http.StatusBadRequest)
 		return
 	}
 
+	testPtr, problems, ok := h.assembleTest(responseWriter, request)
+	if !ok {
+		return
+	}
+	writeJSON(responseWriter, AssembledTest{Test: testPtr, Problems: problems})
+}
+
+// GetTestsV1 serves GET /api/service/v1/tests. Query params: curriculum_id, grade_id, subtype
+// (optional), include_unpublished.
+func (h *TestsHandler) GetTestsV1(responseWriter http.ResponseWriter, request *http.Request) {
+	urlVals := request.URL.Query()
+	curriculumId, err1 := utils.StringToIntType[int16](urlVals.Get("curriculum_id"))
+	gradeId, err2 := utils.StringToIntType[int8](urlVals.Get("grade_id"))
+	if err1 != nil || err2 != nil || curriculumId == 0 || gradeId == 0 {
+		http.Error(responseWriter, "curriculum_id and grade_id are required", http.StatusBadRequest)
+		return
+	}
+
+	tests, err := h.listServiceTests(curriculumId, gradeId, urlVals.Get("subtype"), urlVals)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching tests: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeServiceJSON(responseWriter, request, servicev1.NewTestList(*tests))
+}
+
+// GetAssembledTestV1 serves GET /api/service/v1/tests/{id}, the v1 equivalent of GetAssembledTestJSON.
+// Query params: include_unpublished, lang, render, images, omit_answers.
+func (h *TestsHandler) GetAssembledTestV1(responseWriter http.ResponseWriter, request *http.Request) {
+	if !pathIDToQuery(responseWriter, request) {
+		return
+	}
+	testPtr, problems, ok := h.assembleTest(responseWriter, request)
+	if !ok {
+		return
+	}
+	writeServiceJSON(responseWriter, request, servicev1.NewAssembledTest(testPtr, problems))
+}
+
+// GetGradingKeyV1 serves GET /api/service/v1/tests/{id}/grading-key: the test's answers and resolved
+// marking scheme without the problems' content (see package grading). Query params: include_unpublished.
+func (h *TestsHandler) GetGradingKeyV1(responseWriter http.ResponseWriter, request *http.Request) {
+	if !pathIDToQuery(responseWriter, request) {
+		return
+	}
+	testPtr, problems, ok := h.loadTest(responseWriter, request)
+	if !ok {
+		return
+	}
+	writeServiceJSON(responseWriter, request, servicev1.NewGradingKey(grading.NewKey(testPtr, problems)))
+}
+
+// DownloadServicePdf is the service-API sibling of DownloadPdf: it renders the same PDF, but only of a
+// published test (see loadTest). Query params: id, type, lang_code, include_unpublished.
+// Deprecated: see DownloadPdfV1.
+func (h *TestsHandler) DownloadServicePdf(responseWriter http.ResponseWriter, request *http.Request) {
+	testPtr, problems, ok := h.loadTest(responseWriter, request)
+	if !ok {
+		return
+	}
+	h.writePdf(responseWriter, request, testPtr, problems)
+}
+
+// DownloadPdfV1 serves GET /api/service/v1/tests/{id}/pdf. Query params: type, include_unpublished.
+func (h *TestsHandler) DownloadPdfV1(responseWriter http.ResponseWriter, request *http.Request) {
+	if !pathIDToQuery(responseWriter, request) {
+		return
+	}
+	h.DownloadServicePdf(responseWriter, request)
+}
+
+// GetServiceOpenAPI serves the OpenAPI document describing /api/service/v1.
+func GetServiceOpenAPI(responseWriter http.ResponseWriter, request *http.Request) {
+	writeJSON(responseWriter, servicev1.OpenAPI())
+}
+
+// listServiceTests lists active tests like the HTMX list, dropping unpublished ones unless
+// include_unpublished=true.
+func (h *TestsHandler) listServiceTests(curriculumId int16, gradeId int8, subtype string,
+	urlVals url.Values) (*[]*models.Test, error) {
+	tests, err := h.listTests("", curriculumId, gradeId, subtype, urlVals.Get("sortColumn"), urlVals.Get("sortOrder"))
+	if err != nil {
+		return nil, err
+	}
+	if !includeUnpublished(urlVals) {
+		published := (*tests)[:0]
+		for _, t := range *tests {
+			if workflow.IsPublished(t.StatusID) {
+				published = append(published, t)
+			}
+		}
+		*tests = published
+	}
+	return tests, nil
+}
+
+// assembleTest loads the test named by the id query param with its problems (see loadTest), shaped by
+// the lang, render, images and omit_answers query params (see package assembly); without them they are
+// returned as the CMS holds them. It writes the error response itself when it returns false.
+func (h *TestsHandler) assembleTest(responseWriter http.ResponseWriter, request *http.Request) (*models.Test,
+	[]*models.Problem, bool) {
+	opts, err := assembly.ParseOptions(request.URL.Query())
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	testPtr, problems, ok := h.loadTest(responseWriter, request)
+	if !ok {
+		return nil, nil, false
+	}
+
+	images := serviceImages{repo: h.images, baseURL: publicBaseURL(request)}
+	shapedTest, shapedProblems, err := assembly.Apply(request.Context(), testPtr, problems, opts, images)
+	if err != nil {
+		log.Printf("assemble test=%d: %v", testPtr.ID, err)
+		http.Error(responseWriter, "Could not store the test's images", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return shapedTest, shapedProblems, true
+}
+
+// loadTest fetches the test named by the id query param with its problems, refusing unpublished tests,
+// and published ones holding unpublished problems, unless include_unpublished=true. It records the
+// delivery of a published test. It writes the error response itself when it returns false.
+func (h *TestsHandler) loadTest(responseWriter http.ResponseWriter, request *http.Request) (*models.Test,
+	[]*models.Problem, bool) {
 	testPtr, code, err := h.getTest(responseWriter, request)
 	if err != nil {
 		http.Error(responseWriter, err.Error(), code)
-		return
+		return nil, nil, false
+	}
+	unpublished := !workflow.IsPublished(testPtr.StatusID)
+	if unpublished && !includeUnpublished(request.URL.Query()) {
+		http.Error(responseWriter, "Test is not published", http.StatusNotFound)
+		return nil, nil, false
 	}
 
-	// getTestProblems writes its own http.Error and returns nil on failure.
-	problems := h.getTestProblems(responseWriter, request)
+	// fetchTestProblems writes its own http.Error and returns nil on failure.
+	problems := h.fetchTestProblems(responseWriter, request, "")
 	if problems == nil {
-		return
+		return nil, nil, false
+	}
+	// a published test can still hold a problem that was edited since and is back in review
+	if !includeUnpublished(request.URL.Query()) {
+		var unpublishedIds []string
+		for _, p := range *problems {
+			if !workflow.IsPublished(p.StatusID) {
+				unpublishedIds = append(unpublishedIds, strconv.Itoa(p.ID))
+			}
+		}
+		if len(unpublishedIds) > 0 {
+			http.Error(responseWriter, "Test has unpublished problems: "+strings.Join(unpublishedIds, ", "),
+				http.StatusNotFound)
+			return nil, nil, false
+		}
 	}
 
-	writeJSON(responseWriter, AssembledTest{Test: testPtr, Problems: *problems})
+	// a fetched published test counts as delivered: restoring an older version later asks for
+	// confirmation. Previews of unpublished tests don't.
+	if !unpublished {
+		if err := h.versions.RecordDelivery(request.Context(), testPtr.ID); err != nil {
+			log.Printf("test delivery test=%d: %v", testPtr.ID, err)
+		}
+	}
+	return testPtr, *problems, true
+}
+
+// pathIDToQuery copies the {id} path value into the id query param the shared test lookups read.
+func pathIDToQuery(responseWriter http.ResponseWriter, request *http.Request) bool {
+	id := request.PathValue("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		http.Error(responseWriter, "Invalid test id", http.StatusBadRequest)
+		return false
+	}
+	query := request.URL.Query()
+	query.Set("id", id)
+	request.URL.RawQuery = query.Encode()
+	return true
+}
+
+func includeUnpublished(urlVals url.Values) bool {
+	return urlVals.Get("include_unpublished") == "true"
 }
 
 // writeJSON marshals v as an application/json response.
@@ -74,3 +255,22 @@ func writeJSON(responseWriter http.ResponseWriter, v any) {
 		http.Error(responseWriter, fmt.Sprintf("Error encoding JSON: %v", err), http.StatusInternalServerError)
 	}
 }
+
+// writeServiceJSON writes a /api/service/v1 response with an ETag, answering 304 when the caller
+// already holds this body. Callers revalidate on every use (no-cache), so edits show up at once.
+func writeServiceJSON(responseWriter http.ResponseWriter, request *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error encoding JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+	etag := servicev1.ETag(body)
+	responseWriter.Header().Set("ETag", etag)
+	responseWriter.Header().Set("Cache-Control", "private, no-cache")
+	if servicev1.NotModified(request, etag) {
+		responseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	_, _ = responseWriter.Write(append(body, '\n'))
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+)
+
+// serviceTestsHandler serves the test 9, published or not, holding a published problem 4 and the
+// problem 6 with problemStatus. Both problems are in the topic 5 as well.
+func serviceTestsHandler(t *testing.T, testStatus, problemStatus int8) *TestsHandler {
+	test, _ := json.Marshal(models.Test{ID: 9, StatusID: testStatus})
+	problems, _ := json.Marshal([]models.Problem{{ID: 4, StatusID: constants.StatusPublished},
+		{ID: 6, StatusID: problemStatus}})
+	newFakeDBService(t, map[string]string{
+		"resource/9":               string(test),
+		"resource/test/9/problems": string(problems),
+		"problems":                 string(problems),
+		"subject":                  "[]",
+	})
+	deliveries := newScriptDB(func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return nil, nil, nil
+	})
+	return NewTestsHandler(newTestService[models.Test](), newTestService[models.Subject](),
+		newTestService[models.Problem](), nil, nil, nil, nil, nil, nil, db.NewTestVersionRepo(deliveries), nil, nil)
+}
+
+func TestAssembledTestUnpublishedProblems(t *testing.T) {
+	tests := []struct {
+		name, query   string
+		problemStatus int8
+		wantCode      int
+	}{
+		{"all problems published", "", constants.StatusPublished, http.StatusOK},
+		{"problem in review", "", constants.StatusInReview, http.StatusNotFound},
+		{"problem in review, unpublished included", "?include_unpublished=true", constants.StatusInReview, http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := serviceTestsHandler(t, constants.StatusPublished, tc.problemStatus)
+			req := httptest.NewRequest(http.MethodGet, "/api/service/v1/tests/9"+tc.query, nil)
+			req.SetPathValue("id", "9")
+			rec := httptest.NewRecorder()
+			h.GetAssembledTestV1(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d %q, want %d", rec.Code, rec.Body, tc.wantCode)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var assembled struct {
+				Problems []struct {
+					ID int `json:"id"`
+				} `json:"problems"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &assembled); err != nil {
+				t.Fatalf("response: %v", err)
+			}
+			if len(assembled.Problems) != 2 {
+				t.Errorf("served %d problems, want 2", len(assembled.Problems))
+			}
+		})
+	}
+}
+
+func TestServicePdfUnpublished(t *testing.T) {
+	tests := []struct {
+		name                      string
+		testStatus, problemStatus int8
+	}{
+		{"draft test", constants.StatusDraft, constants.StatusPublished},
+		{"published test with a problem in review", constants.StatusPublished, constants.StatusInReview},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := serviceTestsHandler(t, tc.testStatus, tc.problemStatus)
+			rec := httptest.NewRecorder()
+			h.DownloadServicePdf(rec, httptest.NewRequest(http.MethodGet, "/api/service/test-pdf?id=9&type=questions", nil))
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d %q, want 404", rec.Code, rec.Body)
+			}
+			if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/pdf") {
+				t.Error("served a PDF of unpublished content")
+			}
+		})
+	}
+}
+
+func TestServiceReadsSkipUICache(t *testing.T) {
+	h := serviceTestsHandler(t, constants.StatusPublished, constants.StatusPublished)
+	problems := NewProblemsHandler(h.problemsService, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/service/v1/topics/5/problems", nil)
+	req.SetPathValue("id", "5")
+	rec := httptest.NewRecorder()
+	problems.GetTopicProblemsV1(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("topic problems: status = %d %q", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/service/v1/tests/9", nil)
+	req.SetPathValue("id", "9")
+	rec = httptest.NewRecorder()
+	h.GetAssembledTestV1(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("assembled test: status = %d %q", rec.Code, rec.Body)
+	}
+
+	if cached, _ := h.problemsService.GetList("", problemsKey, true, false); cached != nil {
+		t.Errorf("service reads cached %d problems under the UI key", len(*cached))
+	}
+	if cached, _ := h.subjectsService.GetList("", handlerutils.SubjectsKey, true, false); cached != nil {
+		t.Error("service reads cached the subjects under the UI key")
+	}
+}
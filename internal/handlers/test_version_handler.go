@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/dto"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/testdiff"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/internal/workflow"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const testHistoryTemplate = "test_history.html"
+const testVersionDiffTemplate = "test_version_diff.html"
+
+// GetTestHistory renders the history panel listing every recorded version of a test, along with
+// whether the test is published or has already been delivered to af_lms. Query params: id (test id).
+func (h *TestsHandler) GetTestHistory(responseWriter http.ResponseWriter, request *http.Request) {
+	testId := utils.StringToInt(request.URL.Query().Get("id"))
+	versions, err := h.versions.List(request.Context(), testId)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching versions: %v", err), http.StatusInternalServerError)
+		return
+	}
+	delivery, err := h.versions.GetDelivery(request.Context(), testId)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching delivery: %v", err), http.StatusInternalServerError)
+		return
+	}
+	current, err := h.testsService.GetObject(strconv.Itoa(testId), func(test *models.Test) bool {
+		return test.ID == testId
+	}, testsKey, resourcesEndPoint)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching test: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"TestID":    testId,
+		"Versions":  versions,
+		"Delivery":  delivery,
+		"Published": workflow.IsPublished(current.StatusID),
+	}
+	views.ExecuteTemplate(testHistoryTemplate, responseWriter, data, nil)
+}
+
+// GetTestVersionDiff renders a structural diff of two versions of a test. Query params: id (test
+// id), to (version), from (optional; defaults to the version before to).
+func (h *TestsHandler) GetTestVersionDiff(responseWriter http.ResponseWriter, request *http.Request) {
+	urlVals := request.URL.Query()
+	testId := utils.StringToInt(urlVals.Get("id"))
+	toVersion := utils.StringToInt(urlVals.Get("to"))
+	fromVersion := utils.StringToIntOrDefault(urlVals.Get("from"), toVersion-1, 0)
+
+	to, code, err := h.getTestVersion(request.Context(), testId, toVersion)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), code)
+		return
+	}
+	// the first version is diffed against an empty test
+	from := &models.Test{}
+	if fromVersion > 0 {
+		if from, code, err = h.getTestVersion(request.Context(), testId, fromVersion); err != nil {
+			http.Error(responseWriter, err.Error(), code)
+			return
+		}
+	}
+	h.fillSubjectNames(responseWriter, from)
+	h.fillSubjectNames(responseWriter, to)
+
+	data := map[string]any{
+		"TestID":      testId,
+		"FromVersion": fromVersion,
+		"ToVersion":   toVersion,
+		"Report":      testdiff.Diff(from, to),
+	}
+	views.ExecuteTemplate(testVersionDiffTemplate, responseWriter, data, template.FuncMap{
+		"getSectionName": views.GetSectionName,
+	})
+}
+
+// RestoreTest saves an earlier version of a test as its current state, recording the restore as a
+// new version. A test that is published, or that af_lms has already fetched, is only restored when
+// the request carries acknowledge-published=true, since learners may already have attempted the
+// current version.
+// Query params: id, version.
+func (h *TestsHandler) RestoreTest(responseWriter http.ResponseWriter, request *http.Request) {
+	urlVals := request.URL.Query()
+	testIdStr := urlVals.Get("id")
+	testId := utils.StringToInt(testIdStr)
+	version := utils.StringToInt(urlVals.Get("version"))
+
+	current, err := h.testsService.GetObject(testIdStr, func(test *models.Test) bool {
+		return test.ID == testId
+	}, testsKey, resourcesEndPoint)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching test: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// a published test is live in af_lms, and one af_lms has fetched may still be cached there
+	delivery, err := h.versions.GetDelivery(request.Context(), testId)
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error fetching delivery: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if (workflow.IsPublished(current.StatusID) || delivery != nil) && request.FormValue("acknowledge-published") != "true" {
+		http.Error(responseWriter, "Test has already been published to af_lms; confirm to restore anyway",
+			http.StatusConflict)
+		return
+	}
+
+	snapshot, code, err := h.getTestVersion(request.Context(), testId, version)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), code)
+		return
+	}
+	snapshot.ID = testId
+	// restoring content doesn't restore its review status: the restored test is reviewed again
+	snapshot.StatusID = workflow.AfterRestore(current.StatusID)
+
+	h.recordTestBaseline(request.Context(), testId)
+	auditBefore(request.Context(), h.testsService, testIdStr, func(test *models.Test) bool {
+		return test.ID == testId
+	}, testsKey, resourcesEndPoint)
+	audit.SetAfter(request.Context(), snapshot)
+	if _, err = h.testsService.UpdateObject(testIdStr, resourcesEndPoint, snapshot, testsKey,
+		func(test *models.Test) bool {
+			return test.ID == testId
+		}); err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error restoring test: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.recordTestVersion(request.Context(), snapshot, db.VersionActionRevert, fmt.Sprintf("Restored version %d", version))
+	h.recordExposure(request.Context(), snapshot)
+
+	responseWriter.Header().Set("HX-Refresh", "true")
+}
+
+func (h *TestsHandler) getTestVersion(ctx context.Context, testId, version int) (*models.Test, int, error) {
+	versionPtr, err := h.versions.Get(ctx, testId, version)
+	if errors.Is(err, db.ErrVersionNotFound) {
+		return nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error fetching version: %v", err)
+	}
+	testPtr, err := versionPtr.Test()
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error reading version: %v", err)
+	}
+	return testPtr, http.StatusOK, nil
+}
+
+// recordTestBaseline stores the current db-service state of a test as its first version, unless
+// the CMS has already recorded versions for it.
+func (h *TestsHandler) recordTestBaseline(ctx context.Context, testId int) {
+	exists, err := h.versions.Exists(ctx, testId)
+	if err != nil || exists {
+		return
+	}
+	current, err := h.testsService.GetObject(strconv.Itoa(testId),
+		func(test *models.Test) bool {
+			return test.ID == testId
+		}, testsKey, resourcesEndPoint)
+	if err != nil {
+		log.Printf("test baseline test=%d: %v", testId, err)
+		return
+	}
+	h.recordTestVersion(ctx, current, db.VersionActionBaseline, "")
+}
+
+// recordTestVersion appends a version attributed to the signed-in user and returns its number, or 0
+// when nothing was recorded. Failures are logged only, so that history never blocks a save.
+func (h *TestsHandler) recordTestVersion(ctx context.Context, test *models.Test, action, note string) int {
+	if test == nil || test.ID == 0 {
+		return 0
+	}
+	version, err := newTestVersion(ctx, test, action, note)
+	if err != nil {
+		log.Printf("test snapshot test=%d: %v", test.ID, err)
+		return 0
+	}
+	number, err := h.versions.Insert(ctx, version)
+	if err != nil {
+		log.Printf("test version test=%d action=%s: %v", test.ID, action, err)
+		return 0
+	}
+	return number
+}
+
+func newTestVersion(ctx context.Context, test *models.Test, action, note string) (*models.TestVersion, error) {
+	snapshot, err := json.Marshal(test)
+	if err != nil {
+		return nil, err
+	}
+	version := &models.TestVersion{TestID: test.ID, Action: action, Note: note, Snapshot: snapshot}
+	if claims := auth.FromContext(ctx); claims != nil {
+		version.ActorUserID = &claims.UserID
+		version.ActorEmail = claims.Email
+	}
+	return version, nil
+}
+
+// claimTestVersion records test as the update a save from an edit screen is about to make, before it
+// reaches db-service, and only if no other save recorded a version since the one the editor loaded.
+// It returns the claimed version, or 0 for saves that aren't checked (see checkedToken), which record
+// their version once saved. Otherwise it answers 409 with a conflict prompt, or 500 when the version
+// can't be recorded, since a missing version would let the next stale save through, and reports
+// that the save may not go ahead.
+func (h *TestsHandler) claimTestVersion(responseWriter http.ResponseWriter, request *http.Request,
+	test *models.Test) (int, bool) {
+	token, checked := checkedToken(request)
+	if !checked {
+		return 0, true
+	}
+	version, err := newTestVersion(request.Context(), test, db.VersionActionUpdate, "")
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error recording version: %v", err), http.StatusInternalServerError)
+		return 0, false
+	}
+	number, err := h.versions.InsertIfLatest(request.Context(), version, token)
+	if errors.Is(err, db.ErrVersionConflict) {
+		latest, err := h.versions.Latest(request.Context(), test.ID)
+		if err != nil || latest == nil {
+			http.Error(responseWriter, "This test was saved by someone else; reload it", http.StatusConflict)
+			return 0, false
+		}
+		writeTestConflict(responseWriter, test.ID, token, latest)
+		return 0, false
+	}
+	if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error recording version: %v", err), http.StatusInternalServerError)
+		return 0, false
+	}
+	return number, true
+}
+
+// releaseTestVersion gives back a version claimed by a save that db-service then rejected.
+func (h *TestsHandler) releaseTestVersion(ctx context.Context, testId, version int) {
+	if version == 0 {
+		return
+	}
+	if err := h.versions.Delete(ctx, testId, version); err != nil {
+		log.Printf("test version release test=%d version=%d: %v", testId, version, err)
+	}
+}
+
+// testVersionToken returns the version token the edit screen loads a test with: its latest
+// CMS-saved version, or 0 when it has none.
+func (h *TestsHandler) testVersionToken(ctx context.Context, testId int) int {
+	latest, err := h.versions.Latest(ctx, testId)
+	if err != nil {
+		log.Printf("test version token test=%d: %v", testId, err)
+		return 0
+	}
+	if latest == nil {
+		return 0
+	}
+	return latest.Version
+}
+
+// checkTestVersion answers 409 with a conflict prompt when a save is based on an older version of
+// the test than the latest one (see staleSave), and reports whether the save may go ahead. It only
+// spares an obviously stale save the work of saving: claimTestVersion has the final say. When the
+// latest version can't be read the save goes ahead to that claim.
+func (h *TestsHandler) checkTestVersion(responseWriter http.ResponseWriter, request *http.Request, testId int) bool {
+	latest, err := h.versions.Latest(request.Context(), testId)
+	if err != nil {
+		log.Printf("test version check test=%d: %v", testId, err)
+		return true
+	}
+	if latest == nil {
+		return true
+	}
+	token, stale := staleSave(request, latest.Version)
+	if !stale {
+		return true
+	}
+	writeTestConflict(responseWriter, testId, token, latest)
+	return false
+}
+
+func writeTestConflict(responseWriter http.ResponseWriter, testId, token int, latest *models.TestVersion) {
+	writeEditConflict(responseWriter, dto.EditConflict{
+		EntityType:  reviewEntityTest,
+		EntityID:    testId,
+		Token:       token,
+		Latest:      latest.Version,
+		LatestEmail: latest.ActorEmail,
+		LatestAt:    latest.CreatedAt,
+		DiffURL:     conflictDiffURL("/tests/history", testId, token, latest.Version),
+	})
+}
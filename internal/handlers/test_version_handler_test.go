@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+)
+
+func TestRestorePublishedTest(t *testing.T) {
+	test, _ := json.Marshal(models.Test{ID: 9, StatusID: constants.StatusPublished})
+	fake := newFakeDBService(t, map[string]string{"resource/9": string(test)})
+	// af_lms has never fetched the test
+	neverFetched := newScriptDB(func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"test_id", "first_fetched_at", "last_fetched_at", "fetch_count"}, nil, nil
+	})
+	h := NewTestsHandler(newTestService[models.Test](), nil, nil, nil, nil, nil, nil, nil, nil,
+		db.NewTestVersionRepo(neverFetched), nil, nil)
+
+	req := withUser(httptest.NewRequest(http.MethodPost, "/tests/restore?id=9&version=1", nil), auth.RoleEditor)
+	rec := httptest.NewRecorder()
+	h.RestoreTest(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d %q, want 409", rec.Code, rec.Body)
+	}
+	if fake.patch("resource/9") != nil {
+		t.Error("published test was restored without confirmation")
+	}
+}
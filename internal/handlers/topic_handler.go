@@ -7,6 +7,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
 	"github.com/avantifellows/nex-gen-cms/internal/constants"
 	"github.com/avantifellows/nex-gen-cms/internal/dto"
 	"github.com/avantifellows/nex-gen-cms/internal/handlers/handlerutils"
@@ -74,6 +75,8 @@ func (h *TopicsHandler) AddTopic(responseWriter http.ResponseWriter, request *ht
 		http.Error(responseWriter, fmt.Sprintf("Error adding topic: %v", err), http.StatusInternalServerError)
 		return
 	}
+	audit.SetEntity(request.Context(), newTopicPtr.ID)
+	audit.SetAfter(request.Context(), newTopicPtr)
 	// The POST response may include curriculums from all curricula the topic belongs to.
 	// AddObject appended this to the cache alongside the existing GET-cached entry for the
 	// same topic, creating a duplicate. Invalidate so the next read fetches a clean list.
@@ -81,9 +84,10 @@ func (h *TopicsHandler) AddTopic(responseWriter http.ResponseWriter, request *ht
 	newTopicPtr.NormalizeCurriculums()
 
 	topicPtrs := []*models.Topic{newTopicPtr}
-	views.ExecuteTemplate(topicRowTemplate, responseWriter, topicPtrs, template.FuncMap{
+	scopes, _ := h.TopicScope(request)
+	views.ExecuteTemplate(topicRowTemplate, responseWriter, topicPtrs, scopeFuncs(request, template.FuncMap{
 		"getName": getTopicName,
-	})
+	}, scopes...))
 }
 
 func getTopicName(t models.Topic, lang string) string {
@@ -101,6 +105,9 @@ func (h *TopicsHandler) ArchiveTopic(responseWriter http.ResponseWriter, request
 	topicMap := map[string]any{
 		"cms_status_id": constants.StatusArchived,
 	}
+	auditBefore(request.Context(), h.service, topicIdStr, func(topic *models.Topic) bool {
+		return topic.ID == topicId
+	}, handlerutils.TopicsKey, handlerutils.TopicsEndPoint)
 
 	err = h.service.ArchiveObject(topicIdStr, handlerutils.TopicsEndPoint, topicMap, handlerutils.TopicsKey,
 		func(topic *models.Topic) bool {
@@ -139,6 +146,9 @@ func (h *TopicsHandler) UpdateTopic(responseWriter http.ResponseWriter, request
 	dummyTopicPtr := &models.Topic{}
 	topicMap := dummyTopicPtr.BuildMap(topicCode, topicName)
 
+	auditBefore(request.Context(), h.service, topicIdStr, func(topic *models.Topic) bool {
+		return topic.ID == topicId
+	}, handlerutils.TopicsKey, handlerutils.TopicsEndPoint)
 	_, err = h.service.UpdateObject(topicIdStr, handlerutils.TopicsEndPoint, topicMap, handlerutils.TopicsKey,
 		func(topic *models.Topic) bool {
 			return topic.ID == topicId
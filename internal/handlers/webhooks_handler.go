@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+	"github.com/avantifellows/nex-gen-cms/internal/repositories/db"
+	"github.com/avantifellows/nex-gen-cms/internal/views"
+	"github.com/avantifellows/nex-gen-cms/internal/webhook"
+	"github.com/avantifellows/nex-gen-cms/utils"
+)
+
+const (
+	adminWebhooksTemplate          = "admin_webhooks.html"
+	adminWebhookTemplate           = "admin_webhook.html"
+	adminWebhookDeliveriesTemplate = "admin_webhook_deliveries.html"
+)
+
+// deliveryLogSize is how many of an endpoint's latest deliveries the log shows.
+const deliveryLogSize = 50
+
+// WebhooksHandler serves the admin screens of outbound webhooks: the endpoints, the events they
+// subscribe to and their delivery log.
+type WebhooksHandler struct {
+	webhooks *db.WebhookRepo
+}
+
+func NewWebhooksHandler(webhooks *db.WebhookRepo) *WebhooksHandler {
+	return &WebhooksHandler{webhooks: webhooks}
+}
+
+// List renders the webhooks page.
+func (h *WebhooksHandler) List(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := h.webhooks.ListEndpoints(r.Context())
+	if err != nil {
+		log.Printf("webhooks list: %v", err)
+		http.Error(w, "Could not load webhooks", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]any{
+		"Endpoints":  endpoints,
+		"EventTypes": webhook.EventTypes(),
+	}
+	views.ExecuteTemplates(w, data, webhookFuncs(), baseTemplate, adminWebhooksTemplate, adminWebhookTemplate,
+		adminNavTemplate)
+}
+
+// Create registers an endpoint and shows its signing secret once. Form: url, description, event
+// (repeated).
+func (h *WebhooksHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	endpoint := &models.WebhookEndpoint{
+		URL:         strings.TrimSpace(r.FormValue("url")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		EventTypes:  r.Form["event"],
+	}
+	if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "URL must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	if len(endpoint.EventTypes) == 0 {
+		http.Error(w, "Pick at least one event", http.StatusBadRequest)
+		return
+	}
+	for _, eventType := range endpoint.EventTypes {
+		if !webhook.ValidEventType(eventType) {
+			http.Error(w, "Invalid event", http.StatusBadRequest)
+			return
+		}
+	}
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		endpoint.CreatedBy = claims.Email
+	}
+
+	var err error
+	if endpoint.Secret, err = webhook.NewSecret(); err != nil {
+		log.Printf("webhooks new secret: %v", err)
+		http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+		return
+	}
+	id, err := h.webhooks.CreateEndpoint(r.Context(), endpoint)
+	if err != nil {
+		log.Printf("webhooks create: %v", err)
+		http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+		return
+	}
+	audit.SetEntity(r.Context(), id)
+	audit.SetAfter(r.Context(), endpoint)
+	h.renderEndpoint(w, r, id, endpoint.Secret)
+}
+
+// Disable stops deliveries to an endpoint; its queued deliveries are failed. Query params: id.
+func (h *WebhooksHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	audit.SetEntity(r.Context(), id)
+	if err := h.webhooks.DisableEndpoint(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrWebhookEndpointNotFound) {
+			http.Error(w, "Webhook not found or already disabled", http.StatusNotFound)
+			return
+		}
+		log.Printf("webhooks disable id=%d: %v", id, err)
+		http.Error(w, "Could not disable webhook", http.StatusInternalServerError)
+		return
+	}
+	h.renderEndpoint(w, r, id, "")
+}
+
+// Deliveries renders an endpoint's delivery log. Query params: id.
+func (h *WebhooksHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	h.renderDeliveries(w, r, id)
+}
+
+// Replay queues a delivery again, as a new delivery due now, and re-renders the log. Query params:
+// id (delivery), endpoint.
+func (h *WebhooksHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	endpointID, err := strconv.ParseInt(r.URL.Query().Get("endpoint"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid endpoint", http.StatusBadRequest)
+		return
+	}
+	audit.SetEntity(r.Context(), endpointID)
+	newID, err := h.webhooks.Replay(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrWebhookDeliveryNotFound) {
+			http.Error(w, "Delivery not found or its webhook is disabled", http.StatusNotFound)
+			return
+		}
+		log.Printf("webhooks replay delivery=%d: %v", id, err)
+		http.Error(w, "Could not replay delivery", http.StatusInternalServerError)
+		return
+	}
+	audit.SetAfter(r.Context(), map[string]int64{"delivery_id": newID, "replay_of": id})
+	h.renderDeliveries(w, r, endpointID)
+}
+
+// renderEndpoint renders one endpoint card. newSecret, when set, is shown once.
+func (h *WebhooksHandler) renderEndpoint(w http.ResponseWriter, r *http.Request, id int64, newSecret string) {
+	endpoint, err := h.webhooks.GetEndpoint(r.Context(), id)
+	if err != nil {
+		log.Printf("webhooks reload id=%d: %v", id, err)
+		http.Error(w, "Could not reload webhook", http.StatusInternalServerError)
+		return
+	}
+	views.ExecuteTemplate(adminWebhookTemplate, w, map[string]any{
+		"Endpoint":  endpoint,
+		"NewSecret": newSecret,
+	}, webhookFuncs())
+}
+
+func (h *WebhooksHandler) renderDeliveries(w http.ResponseWriter, r *http.Request, endpointID int64) {
+	deliveries, err := h.webhooks.ListDeliveries(r.Context(), endpointID, deliveryLogSize)
+	if err != nil {
+		log.Printf("webhooks deliveries endpoint=%d: %v", endpointID, err)
+		http.Error(w, "Could not load deliveries", http.StatusInternalServerError)
+		return
+	}
+	views.ExecuteTemplate(adminWebhookDeliveriesTemplate, w, map[string]any{
+		"EndpointID": endpointID,
+		"Deliveries": deliveries,
+	}, webhookFuncs())
+}
+
+func webhookFuncs() template.FuncMap {
+	return template.FuncMap{
+		"dict": utils.Dict,
+	}
+}
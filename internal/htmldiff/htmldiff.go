@@ -0,0 +1,118 @@
+// Package htmldiff produces word-level, side-by-side diffs of rich-text HTML fragments such as
+// problem questions, options and solutions.
+package htmldiff
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// maxCells bounds the LCS table; beyond it the two sides are shown as a whole replacement.
+const maxCells = 4_000_000
+
+// tokenRe splits HTML into tags (kept atomic so markup is never cut in half), whitespace runs and
+// words. Inline TeX stays inside word tokens, so "\(x^2\)" changes as a unit.
+var tokenRe = regexp.MustCompile(`<[^>]*>|\s+|[^<\s]+`)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind  opKind
+	token string
+}
+
+// Diff compares two HTML fragments and returns them re-rendered with removed words wrapped in
+// <del class="diff-del"> on the old side and added words wrapped in <ins class="diff-ins"> on the
+// new side. Tags pass through untouched so both sides still render as the original HTML.
+func Diff(oldHTML, newHTML string) (left, right template.HTML, changed bool) {
+	if oldHTML == newHTML {
+		return template.HTML(oldHTML), template.HTML(newHTML), false
+	}
+
+	a := tokenRe.FindAllString(oldHTML, -1)
+	b := tokenRe.FindAllString(newHTML, -1)
+	if len(a)*len(b) > maxCells {
+		return wrapAll(a, "del", "diff-del"), wrapAll(b, "ins", "diff-ins"), true
+	}
+
+	var l, r strings.Builder
+	for _, o := range diffTokens(a, b) {
+		switch o.kind {
+		case opEqual:
+			l.WriteString(o.token)
+			r.WriteString(o.token)
+		case opDelete:
+			writeMarked(&l, o.token, "del", "diff-del")
+		case opInsert:
+			writeMarked(&r, o.token, "ins", "diff-ins")
+		}
+	}
+	return template.HTML(l.String()), template.HTML(r.String()), true
+}
+
+// diffTokens is a plain LCS diff; problem fields are a few hundred tokens at most.
+func diffTokens(a, b []string) []op {
+	n, m := len(a), len(b)
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]op, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{opEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{opDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, op{opInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{opDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{opInsert, b[j]})
+	}
+	return ops
+}
+
+// writeMarked wraps a changed token. Tags and bare whitespace are written as-is: wrapping a tag
+// would produce invalid nesting, and a highlighted space is invisible anyway.
+func writeMarked(sb *strings.Builder, token, tag, class string) {
+	if strings.HasPrefix(token, "<") || strings.TrimSpace(token) == "" {
+		sb.WriteString(token)
+		return
+	}
+	sb.WriteString("<" + tag + ` class="` + class + `">` + token + "</" + tag + ">")
+}
+
+func wrapAll(tokens []string, tag, class string) template.HTML {
+	var sb strings.Builder
+	for _, token := range tokens {
+		writeMarked(&sb, token, tag, class)
+	}
+	return template.HTML(sb.String())
+}
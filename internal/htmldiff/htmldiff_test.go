@@ -0,0 +1,54 @@
+package htmldiff
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, new    string
+		wantLeft    string
+		wantRight   string
+		wantChanged bool
+	}{
+		{
+			name: "identical", old: "<p>same</p>", new: "<p>same</p>",
+			wantLeft: "<p>same</p>", wantRight: "<p>same</p>", wantChanged: false,
+		},
+		{
+			name: "word replaced", old: "<p>find the speed</p>", new: "<p>find the velocity</p>",
+			wantLeft:    `<p>find the <del class="diff-del">speed</del></p>`,
+			wantRight:   `<p>find the <ins class="diff-ins">velocity</ins></p>`,
+			wantChanged: true,
+		},
+		{
+			name: "tags are never wrapped", old: "a", new: "<b>a</b>",
+			wantLeft: "a", wantRight: "<b>a</b>", wantChanged: true,
+		},
+		{
+			name: "inline math changes as one token", old: `x = \(a^2\)`, new: `x = \(a^3\)`,
+			wantLeft:    `x = <del class="diff-del">\(a^2\)</del>`,
+			wantRight:   `x = <ins class="diff-ins">\(a^3\)</ins>`,
+			wantChanged: true,
+		},
+		{
+			name: "added from empty", old: "", new: "new text",
+			wantLeft:    "",
+			wantRight:   `<ins class="diff-ins">new</ins> <ins class="diff-ins">text</ins>`,
+			wantChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, right, changed := Diff(tt.old, tt.new)
+			if string(left) != tt.wantLeft {
+				t.Errorf("left = %q, want %q", left, tt.wantLeft)
+			}
+			if string(right) != tt.wantRight {
+				t.Errorf("right = %q, want %q", right, tt.wantRight)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
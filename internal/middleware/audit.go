@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// maxAuditPayload caps the request body kept as an audit entry's default after-payload. Problem
+// bodies can carry base64 images; those are recorded as a size only.
+const maxAuditPayload = 256 << 10
+
+// AuditRecorder persists audit entries; *db.AuditLogRepo implements it.
+type AuditRecorder interface {
+	Insert(ctx context.Context, e *models.AuditEntry) error
+}
+
+// Audit wraps a mutating route so that every request to it is appended to the audit log once the
+// handler returns, whether it succeeded or not. The entity ID defaults to the id query/form value
+// and the after-payload to the request body; handlers refine both, and add the before-state,
+// through the audit package. It must sit inside RequireLogin/RequireRole so the actor is known.
+// Recording failures are logged only, so that auditing never fails a save.
+func Audit(recorder AuditRecorder, entityType, action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(audit.RequestIDHeader)
+		if requestID == "" {
+			requestID = audit.NewRequestID()
+		}
+		w.Header().Set(audit.RequestIDHeader, requestID)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		entry := &models.AuditEntry{
+			RequestID:  requestID,
+			Action:     action,
+			EntityType: entityType,
+			EntityID:   requestEntityID(r, body),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			After:      requestPayload(r.Header.Get("Content-Type"), body),
+		}
+		if claims := auth.FromContext(r.Context()); claims != nil {
+			entry.ActorUserID = &claims.UserID
+			entry.ActorEmail = claims.Email
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(audit.WithEntry(r.Context(), entry)))
+		entry.Status = rec.status
+
+		if err := recorder.Insert(context.WithoutCancel(r.Context()), entry); err != nil {
+			log.Printf("audit %s %s id=%s: %v", entityType, action, entry.EntityID, err)
+		}
+	})
+}
+
+// AuditFunc is the http.HandlerFunc-flavored convenience wrapper.
+func AuditFunc(recorder AuditRecorder, entityType, action string, h http.HandlerFunc) http.HandlerFunc {
+	return Audit(recorder, entityType, action, h).ServeHTTP
+}
+
+func requestEntityID(r *http.Request, body []byte) string {
+	if id := r.URL.Query().Get("id"); id != "" {
+		return id
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if vals, err := url.ParseQuery(string(body)); err == nil {
+			return vals.Get("id")
+		}
+	}
+	return ""
+}
+
+// requestPayload converts a JSON or form body to JSON for the audit log. Other bodies are skipped.
+func requestPayload(contentType string, body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if len(body) > maxAuditPayload {
+		return audit.Payload(map[string]any{"truncated": true, "bytes": len(body)})
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		vals, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		form := make(map[string]any, len(vals))
+		for k, v := range vals {
+			if len(v) == 1 {
+				form[k] = v[0]
+			} else {
+				form[k] = v
+			}
+		}
+		return audit.Payload(form)
+	}
+	if json.Valid(body) {
+		return body
+	}
+	return nil
+}
+
+// statusRecorder remembers the status code the wrapped handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = code, true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
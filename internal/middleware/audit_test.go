@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/audit"
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type fakeRecorder struct {
+	entries []*models.AuditEntry
+}
+
+func (f *fakeRecorder) Insert(_ context.Context, e *models.AuditEntry) error {
+	f.entries = append(f.entries, e)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		contentType  string
+		body         string
+		handler      http.HandlerFunc
+		wantStatus   int
+		wantEntityID string
+		wantBefore   string
+		wantAfter    string
+	}{
+		{
+			name: "form body and id query", target: "/update-topic?id=7",
+			contentType: "application/x-www-form-urlencoded", body: "name=Optics",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK, wantEntityID: "7", wantAfter: `{"name":"Optics"}`,
+		},
+		{
+			name: "handler sets entity and states", target: "/create-problem",
+			contentType: "application/json", body: `{"code":"P1"}`,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				audit.SetEntity(r.Context(), 42)
+				audit.SetBefore(r.Context(), map[string]int{"v": 1})
+				audit.SetAfter(r.Context(), map[string]int{"v": 2})
+			},
+			wantStatus: http.StatusOK, wantEntityID: "42", wantBefore: `{"v":1}`, wantAfter: `{"v":2}`,
+		},
+		{
+			name: "failures are recorded with their status", target: "/archive-test?id=3",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "boom", http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusInternalServerError, wantEntityID: "3",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &fakeRecorder{}
+			req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			req = req.WithContext(auth.WithSession(req.Context(), &auth.SessionClaims{UserID: 5, Email: "a@b.org"}))
+			rec := httptest.NewRecorder()
+
+			Audit(recorder, "thing", "act", tc.handler).ServeHTTP(rec, req)
+
+			if len(recorder.entries) != 1 {
+				t.Fatalf("recorded %d entries, want 1", len(recorder.entries))
+			}
+			e := recorder.entries[0]
+			if e.Status != tc.wantStatus || e.EntityID != tc.wantEntityID {
+				t.Errorf("status, entity = %d, %q; want %d, %q", e.Status, e.EntityID, tc.wantStatus, tc.wantEntityID)
+			}
+			if string(e.Before) != tc.wantBefore || string(e.After) != tc.wantAfter {
+				t.Errorf("before, after = %s, %s; want %s, %s", e.Before, e.After, tc.wantBefore, tc.wantAfter)
+			}
+			if e.ActorEmail != "a@b.org" || e.RequestID == "" || rec.Header().Get(audit.RequestIDHeader) != e.RequestID {
+				t.Errorf("actor %q, request id %q, header %q", e.ActorEmail, e.RequestID, rec.Header().Get(audit.RequestIDHeader))
+			}
+		})
+	}
+}
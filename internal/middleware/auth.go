@@ -1,19 +1,36 @@
 package middleware
 
 import (
+	"context"
 	"crypto/subtle"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
 
 	"github.com/avantifellows/nex-gen-cms/config"
 	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
 )
 
+// SessionExpiredHeader marks the 401 sent to htmx requests whose session has ended.
+const SessionExpiredHeader = "X-Session-Expired"
+
 // RequireLogin verifies the session cookie. Unauthenticated requests are redirected to /login
-// (or sent HX-Redirect for htmx requests). Exception paths skip the check entirely.
+// (or get a 401 with SessionExpiredHeader for htmx requests). Exception paths skip the check entirely;
+// an exception ending in "/" covers every path under it. A request already authenticated by
+// PersonalToken passes without a cookie.
 func RequireLogin(next http.Handler, exceptions ...string) http.Handler {
 	exceptionSet := make(map[string]struct{}, len(exceptions))
+	var exceptionPrefixes []string
 	for _, e := range exceptions {
+		if strings.HasSuffix(e, "/") {
+			exceptionPrefixes = append(exceptionPrefixes, e)
+			continue
+		}
 		exceptionSet[e] = struct{}{}
 	}
 
@@ -22,7 +39,17 @@ func RequireLogin(next http.Handler, exceptions ...string) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
+		for _, prefix := range exceptionPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
 
+		if auth.PersonalTokenFromContext(r.Context()) != 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
 		claims := auth.ReadSession(r)
 		if claims == nil {
 			redirectToLogin(w, r)
@@ -33,6 +60,124 @@ func RequireLogin(next http.Handler, exceptions ...string) http.Handler {
 	})
 }
 
+// PersonalTokenSource looks up personal access tokens and logs their use (db.PersonalTokenRepo).
+type PersonalTokenSource interface {
+	// Lookup returns nils when no token has the hash.
+	Lookup(ctx context.Context, hash string) (*models.PersonalToken, *models.CmsUser, error)
+	RecordUse(ctx context.Context, use *models.TokenUse) error
+}
+
+// PersonalToken accepts a personal access token (auth.NewPersonalToken) in an Authorization: Bearer
+// header as an alternative to the session cookie. The request runs as the token's owner with their
+// current role; a revoked or expired token, or an inactive owner, gets a 401. Every request made
+// with a token is logged once the handler returns. It goes outside RequireLogin; requests without
+// a personal token, including service-token ones, pass through untouched.
+func PersonalToken(tokens PersonalTokenSource, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hasBearer || !auth.IsPersonalToken(got) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, user, err := tokens.Lookup(r.Context(), auth.HashToken(got))
+		if err != nil {
+			log.Printf("personal token lookup: %v", err)
+			http.Error(w, "Error checking token", http.StatusInternalServerError)
+			return
+		}
+		if token == nil || !token.Active(time.Now()) || !user.IsActive {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Invalid, expired or revoked token", http.StatusUnauthorized)
+			return
+		}
+
+		claims := &auth.SessionClaims{UserID: user.ID, Email: user.Email, Role: user.Role}
+		ctx := auth.WithPersonalToken(auth.WithSession(r.Context(), claims), token.ID)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		use := &models.TokenUse{TokenID: token.ID, UserID: user.ID, Method: r.Method, Path: r.URL.RequestURI(),
+			Status: rec.status, IP: auth.ClientIP(r)}
+		if err := tokens.RecordUse(context.WithoutCancel(r.Context()), use); err != nil {
+			log.Printf("personal token use token=%d: %v", token.ID, err)
+		}
+	})
+}
+
+// SessionStore checks server-side session records (db.SessionRepo).
+type SessionStore interface {
+	// Check returns the user's current role and whether the session is still live and was seen
+	// within idle.
+	Check(ctx context.Context, id string, idle time.Duration) (role string, ok bool, err error)
+	// Extend moves a session's expiry forward when its cookie is renewed.
+	Extend(ctx context.Context, id string, expiresAt time.Time) error
+}
+
+// sessionCheckTTL is how long a session check is cached, and so the longest a revocation,
+// deactivation or role change takes to reach an open session.
+const sessionCheckTTL = 30 * time.Second
+
+type sessionCheck struct {
+	role string
+	ok   bool
+}
+
+// VerifySession checks the signed-in session against its cms_session record, so that revoked
+// sessions and deactivated users are signed out, and role changes apply without signing in again.
+// It goes inside RequireLogin. Cookies without a session ID predate the session store and are
+// signed out too. Personal-token requests have no session and are left alone. Sessions idle for longer than auth.IdleTimeout end, and sessions past half their
+// lifetime get a renewed cookie.
+func VerifySession(store SessionStore, next http.Handler) http.Handler {
+	checks := cache.New(sessionCheckTTL, 2*sessionCheckTTL)
+	idle := auth.IdleTimeout()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+		if claims == nil || auth.PersonalTokenFromContext(r.Context()) != 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var check sessionCheck
+		if cached, found := checks.Get(claims.ID); found {
+			check = cached.(sessionCheck)
+		} else if claims.ID != "" {
+			role, ok, err := store.Check(r.Context(), claims.ID, idle)
+			if err != nil {
+				log.Printf("session check user=%d: %v", claims.UserID, err)
+				http.Error(w, "Error checking session", http.StatusInternalServerError)
+				return
+			}
+			check = sessionCheck{role: role, ok: ok}
+			checks.SetDefault(claims.ID, check)
+		}
+		if !check.ok {
+			auth.ClearSession(w)
+			redirectToLogin(w, r)
+			return
+		}
+
+		if check.role != claims.Role {
+			refreshed := *claims
+			refreshed.Role = check.role
+			claims = &refreshed
+			auth.SetRoleCookie(w, check.role)
+		}
+		if now := time.Now(); auth.NeedsRenewal(claims, now) {
+			// sliding renewal: a failure here only means the cookie isn't renewed on this request
+			renewed := auth.Renewed(claims, now)
+			if err := store.Extend(r.Context(), claims.ID, renewed.ExpiresAt.Time); err != nil {
+				log.Printf("session renew user=%d: %v", claims.UserID, err)
+			} else if err := auth.IssueSession(w, renewed); err != nil {
+				log.Printf("session renew user=%d: %v", claims.UserID, err)
+			} else {
+				claims = renewed
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithSession(r.Context(), claims)))
+	})
+}
+
 // RequireRole wraps a handler so that only sessions with role >= need can reach it.
 // Lower roles get 403 (or HX-equivalent). Unauthenticated requests fall through to /login.
 func RequireRole(need string, next http.Handler) http.Handler {
@@ -46,12 +191,7 @@ func RequireRole(need string, next http.Handler) http.Handler {
 			return
 		}
 		if !auth.AtLeast(claims.Role, need) {
-			if r.Header.Get("HX-Request") == "true" {
-				w.Header().Set("HX-Reswap", "none")
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			forbid(w, r)
 			return
 		}
 		next.ServeHTTP(w, r.WithContext(auth.WithSession(r.Context(), claims)))
@@ -63,6 +203,79 @@ func RequireRoleFunc(need string, h http.HandlerFunc) http.HandlerFunc {
 	return RequireRole(need, h).ServeHTTP
 }
 
+// GrantSource loads a user's scoped grants (db.UserGrantRepo).
+type GrantSource interface {
+	ListByUser(ctx context.Context, userID int64) ([]models.UserGrant, error)
+}
+
+// LoadGrants attaches the signed-in user's scoped grants to the request context, for Authorize
+// and for list views deciding which rows get edit controls. It goes inside RequireLogin. If the
+// grants can't be loaded the user keeps only their global role.
+func LoadGrants(source GrantSource, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+		if claims == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		grants, err := source.ListByUser(r.Context(), claims.UserID)
+		if err != nil {
+			log.Printf("load grants user=%d: %v", claims.UserID, err)
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithGrants(r.Context(), grants)))
+	})
+}
+
+// ScopeResolver returns the scopes of the content a request touches (see auth.RoleIn), e.g. the
+// curriculum, grade and subject of the chapter named by its id param.
+type ScopeResolver func(r *http.Request) ([]models.Scope, error)
+
+// Authorize is the scope-aware RequireRole for content routes: the user needs at least need on
+// every scope resolve returns, counting both their global role and their scoped grants. A nil
+// resolve means the route touches no single piece of content, so need held on any scope will do.
+// A resolver that finds no scopes fails closed instead, rather than falling back to the highest role
+// held anywhere. Users whose global role already suffices skip resolving.
+func Authorize(need string, resolve ScopeResolver, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+		if claims == nil {
+			redirectToLogin(w, r)
+			return
+		}
+		if !auth.AtLeast(claims.Role, need) {
+			var scopes []models.Scope
+			if resolve != nil {
+				var err error
+				if scopes, err = resolve(r); err != nil {
+					http.Error(w, fmt.Sprintf("Error checking permissions: %v", err), http.StatusInternalServerError)
+					return
+				}
+				if len(scopes) == 0 {
+					forbid(w, r)
+					return
+				}
+			}
+			if !auth.Allowed(r.Context(), need, scopes...) {
+				forbid(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthorizeFunc is the http.HandlerFunc-flavored convenience wrapper.
+func AuthorizeFunc(need string, resolve ScopeResolver, h http.HandlerFunc) http.HandlerFunc {
+	return Authorize(need, resolve, h).ServeHTTP
+}
+
+func forbid(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Reswap", "none")
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
 // RequireServiceToken guards server-to-server API routes with a shared bearer token
 // (CMS_SERVICE_TOKEN). It is the inbound counterpart to the outbound DB_SERVICE_TOKEN
 // bearer that api_repository uses when calling db-service. Routes wrapped with this are
@@ -70,9 +283,8 @@ func RequireRoleFunc(need string, h http.HandlerFunc) http.HandlerFunc {
 // entirely. Fails closed: an unset CMS_SERVICE_TOKEN rejects every request.
 func RequireServiceToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		want := config.GetEnv("CMS_SERVICE_TOKEN", "")
 		got, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
-		if want == "" || !hasBearer || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		if !hasBearer || !sharedServiceToken(got) {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -85,9 +297,66 @@ func RequireServiceTokenFunc(h http.HandlerFunc) http.HandlerFunc {
 	return RequireServiceToken(h).ServeHTTP
 }
 
+// sharedServiceToken reports whether got is the shared CMS_SERVICE_TOKEN. Fails closed when it's unset.
+func sharedServiceToken(got string) bool {
+	want := config.GetEnv("CMS_SERVICE_TOKEN", "")
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// ServiceClientSource looks up per-client service tokens (see db.ServiceClientRepo).
+type ServiceClientSource interface {
+	// Lookup returns nils when no token has the hash.
+	Lookup(ctx context.Context, hash string) (*models.ServiceClient, *models.ServiceToken, error)
+	Touch(ctx context.Context, tokenID int64) error
+}
+
+// RequireServiceScope guards a service API route with a bearer token from the service-client
+// registry: the token must be active, its client not revoked, and the client must hold scope. The
+// shared CMS_SERVICE_TOKEN is still accepted with every scope, so callers can move to their own
+// tokens one at a time.
+func RequireServiceScope(clients ServiceClientSource, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hasBearer || got == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if sharedServiceToken(got) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client, token, err := clients.Lookup(r.Context(), auth.HashToken(got))
+		if err != nil {
+			log.Printf("service token lookup: %v", err)
+			http.Error(w, "Error checking token", http.StatusInternalServerError)
+			return
+		}
+		if token == nil || client.RevokedAt != nil || !token.Active(time.Now()) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !client.HasScope(scope) {
+			http.Error(w, fmt.Sprintf("Token lacks scope %s", scope), http.StatusForbidden)
+			return
+		}
+		if err := clients.Touch(r.Context(), token.ID); err != nil {
+			log.Printf("service token touch client=%s token=%d: %v", client.Name, token.ID, err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireServiceScopeFunc is the http.HandlerFunc-flavored convenience wrapper.
+func RequireServiceScopeFunc(clients ServiceClientSource, scope string, h http.HandlerFunc) http.HandlerFunc {
+	return RequireServiceScope(clients, scope, h).ServeHTTP
+}
+
 func redirectToLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("HX-Request") == "true" {
-		w.Header().Set("HX-Redirect", "/login")
+		// No HX-Redirect: the page keeps the failed request, asks for a sign-in in a popup and
+		// retries it, so unsaved work survives an expired session.
+		w.Header().Set(SessionExpiredHeader, "true")
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestAuthorize(t *testing.T) {
+	physics := int8(3)
+	physicsEditor := []models.UserGrant{{SubjectID: &physics, Role: auth.RoleEditor}}
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	scopeOf := func(subjectID int8) ScopeResolver {
+		return func(*http.Request) ([]models.Scope, error) {
+			return []models.Scope{{CurriculumID: 1, SubjectID: subjectID}}, nil
+		}
+	}
+	failing := func(*http.Request) ([]models.Scope, error) {
+		return nil, errors.New("db-service down")
+	}
+
+	tests := []struct {
+		name       string
+		role       string
+		grants     []models.UserGrant
+		resolve    ScopeResolver
+		wantStatus int
+	}{
+		{"global editor skips resolving", auth.RoleEditor, nil, failing, http.StatusOK},
+		{"viewer without grants", auth.RoleViewer, nil, scopeOf(physics), http.StatusForbidden},
+		{"viewer with covering grant", auth.RoleViewer, physicsEditor, scopeOf(physics), http.StatusOK},
+		{"viewer with grant elsewhere", auth.RoleViewer, physicsEditor, scopeOf(4), http.StatusForbidden},
+		{"unscoped route accepts a grant anywhere", auth.RoleViewer, physicsEditor, nil, http.StatusOK},
+		{"content route resolving no scopes", auth.RoleViewer, physicsEditor, func(*http.Request) ([]models.Scope, error) {
+			return nil, nil
+		}, http.StatusForbidden},
+		{"resolver error", auth.RoleViewer, physicsEditor, failing, http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update-problem?id=1", nil)
+			ctx := auth.WithSession(req.Context(), &auth.SessionClaims{UserID: 7, Role: tc.role})
+			req = req.WithContext(auth.WithGrants(ctx, tc.grants))
+			rec := httptest.NewRecorder()
+
+			Authorize(auth.RoleEditor, tc.resolve, okHandler).ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
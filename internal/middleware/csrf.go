@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+)
+
+// CSRF requires the session's CSRF token (auth.CSRFToken) on every request that isn't GET, HEAD or
+// OPTIONS, in the X-CSRF-Token header or, failing that, a csrf_token form field. Safe requests keep
+// the cms_csrf cookie in step with the session, for home.html to copy into the header. It goes
+// inside VerifySession; requests without a session (RequireLogin's exceptions) pass through, and so
+// do personal-token requests, which carry no cookie a forged cross-site request could ride on.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+		if claims == nil || auth.PersonalTokenFromContext(r.Context()) != 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			token := auth.CSRFToken(claims)
+			if cookie, err := r.Cookie(auth.CSRFCookieName); err != nil || cookie.Value != token {
+				auth.SetCSRFCookie(w, token)
+			}
+		default:
+			got := r.Header.Get(auth.CSRFHeader)
+			if got == "" {
+				// only parses url-encoded and multipart bodies; JSON bodies are left unread
+				got = r.PostFormValue(auth.CSRFFormField)
+			}
+			if !auth.ValidCSRFToken(claims, got) {
+				if r.Header.Get("HX-Request") == "true" {
+					w.Header().Set("HX-Reswap", "none")
+				}
+				http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
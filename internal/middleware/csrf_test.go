@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+)
+
+func TestCSRF(t *testing.T) {
+	t.Setenv("SESSION_SECRET", "test-secret")
+	claims := &auth.SessionClaims{UserID: 1, Role: auth.RoleEditor, RegisteredClaims: jwt.RegisteredClaims{ID: "s1"}}
+	token := auth.CSRFToken(claims)
+	otherToken := auth.CSRFToken(&auth.SessionClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "s2"}})
+
+	tests := []struct {
+		name       string
+		method     string
+		signedIn   bool
+		header     string
+		formToken  string
+		wantStatus int
+		wantCookie bool
+	}{
+		{"GET sets the cookie", http.MethodGet, true, "", "", http.StatusOK, true},
+		{"POST with the header", http.MethodPost, true, token, "", http.StatusOK, false},
+		{"POST without a token", http.MethodPost, true, "", "", http.StatusForbidden, false},
+		{"token of another session", http.MethodPatch, true, otherToken, "", http.StatusForbidden, false},
+		{"DELETE with the header", http.MethodDelete, true, token, "", http.StatusOK, false},
+		{"form field, as sent by sendBeacon", http.MethodPost, true, "", token, http.StatusOK, false},
+		{"no session", http.MethodPost, false, "", "", http.StatusOK, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := CSRF(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			var body *strings.Reader
+			if tc.formToken != "" {
+				body = strings.NewReader(url.Values{auth.CSRFFormField: {tc.formToken}}.Encode())
+			} else {
+				body = strings.NewReader("")
+			}
+			req := httptest.NewRequest(tc.method, "/edit-lock/release?entity=test&id=1", body)
+			if tc.formToken != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tc.header != "" {
+				req.Header.Set(auth.CSRFHeader, tc.header)
+			}
+			if tc.signedIn {
+				req = req.WithContext(auth.WithSession(req.Context(), claims))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			gotCookie := false
+			for _, c := range rec.Result().Cookies() {
+				gotCookie = gotCookie || (c.Name == auth.CSRFCookieName && c.Value == token)
+			}
+			if gotCookie != tc.wantCookie {
+				t.Errorf("cms_csrf cookie set = %v, want %v", gotCookie, tc.wantCookie)
+			}
+		})
+	}
+}
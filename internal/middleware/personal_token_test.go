@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type fakePersonalTokens struct {
+	token *models.PersonalToken
+	user  *models.CmsUser
+	hash  string
+	uses  []models.TokenUse
+}
+
+func (f *fakePersonalTokens) Lookup(_ context.Context, hash string) (*models.PersonalToken, *models.CmsUser, error) {
+	if hash != f.hash {
+		return nil, nil, nil
+	}
+	return f.token, f.user, nil
+}
+
+func (f *fakePersonalTokens) RecordUse(_ context.Context, use *models.TokenUse) error {
+	f.uses = append(f.uses, *use)
+	return nil
+}
+
+func TestPersonalToken(t *testing.T) {
+	t.Setenv("SESSION_SECRET", "test-secret")
+	const personal = "cmsp_personal-token"
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		authHeader string
+		token      models.PersonalToken
+		userActive bool
+		wantStatus int
+		wantRole   string
+	}{
+		{"valid token, no CSRF token needed", "Bearer " + personal, models.PersonalToken{ID: 7, ExpiresAt: future},
+			true, http.StatusCreated, auth.RoleEditor},
+		{"expired token", "Bearer " + personal, models.PersonalToken{ID: 7, ExpiresAt: past}, true,
+			http.StatusUnauthorized, ""},
+		{"revoked token", "Bearer " + personal, models.PersonalToken{ID: 7, ExpiresAt: future, RevokedAt: &past}, true,
+			http.StatusUnauthorized, ""},
+		{"inactive owner", "Bearer " + personal, models.PersonalToken{ID: 7, ExpiresAt: future}, false,
+			http.StatusUnauthorized, ""},
+		{"unknown token", "Bearer cmsp_other", models.PersonalToken{ID: 7, ExpiresAt: future}, true,
+			http.StatusUnauthorized, ""},
+		{"service token falls through to the session check", "Bearer cms_service", models.PersonalToken{ID: 7,
+			ExpiresAt: future}, true, http.StatusSeeOther, ""},
+		{"no header", "", models.PersonalToken{ID: 7, ExpiresAt: future}, true, http.StatusSeeOther, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens := &fakePersonalTokens{
+				token: &tc.token,
+				user:  &models.CmsUser{ID: 3, Email: "a@avantifellows.org", Role: auth.RoleEditor, IsActive: tc.userActive},
+				hash:  auth.HashToken(personal),
+			}
+			var gotRole string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRole = auth.FromContext(r.Context()).Role
+				w.WriteHeader(http.StatusCreated)
+			})
+			// the chain cmd/main.go builds, minus LoadGrants
+			handler := PersonalToken(tokens, RequireLogin(VerifySession(&fakeSessionStore{}, CSRF(next))))
+
+			req := httptest.NewRequest(http.MethodPost, "/create-problem?x=1", nil)
+			if tc.authHeader != "" {
+				req.Header.Set("Authorization", tc.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if gotRole != tc.wantRole {
+				t.Errorf("role = %q, want %q", gotRole, tc.wantRole)
+			}
+			wantUses := 0
+			if tc.wantRole != "" {
+				wantUses = 1
+			}
+			if len(tokens.uses) != wantUses {
+				t.Fatalf("%d uses logged, want %d", len(tokens.uses), wantUses)
+			}
+			if wantUses == 1 {
+				use := tokens.uses[0]
+				if use.TokenID != 7 || use.UserID != 3 || use.Path != "/create-problem?x=1" ||
+					use.Status != http.StatusCreated {
+					t.Errorf("use = %+v", use)
+				}
+			}
+		})
+	}
+}
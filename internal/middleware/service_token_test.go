@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
 )
 
 func TestRequireServiceToken(t *testing.T) {
@@ -46,3 +51,112 @@ func TestRequireServiceToken(t *testing.T) {
 		})
 	}
 }
+
+type fakeServiceClients struct {
+	client  *models.ServiceClient
+	token   *models.ServiceToken
+	hash    string
+	touched []int64
+}
+
+func (f *fakeServiceClients) Lookup(_ context.Context, hash string) (*models.ServiceClient, *models.ServiceToken, error) {
+	if hash != f.hash {
+		return nil, nil, nil
+	}
+	return f.client, f.token, nil
+}
+
+func (f *fakeServiceClients) Touch(_ context.Context, tokenID int64) error {
+	f.touched = append(f.touched, tokenID)
+	return nil
+}
+
+func TestRequireServiceScope(t *testing.T) {
+	const shared = "shared-token"
+	const clientToken = "cms_client-token"
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		authHeader string
+		client     models.ServiceClient
+		token      models.ServiceToken
+		wantStatus int
+		wantTouch  bool
+	}{
+		{"shared token has every scope", "Bearer " + shared, models.ServiceClient{}, models.ServiceToken{},
+			http.StatusOK, false},
+		{"client token with scope", "Bearer " + clientToken,
+			models.ServiceClient{Scopes: []string{auth.ScopeTestsRead}}, models.ServiceToken{ID: 7, ExpiresAt: &future},
+			http.StatusOK, true},
+		{"client token without scope", "Bearer " + clientToken,
+			models.ServiceClient{Scopes: []string{auth.ScopePDFRender}}, models.ServiceToken{ID: 7},
+			http.StatusForbidden, false},
+		{"expired token", "Bearer " + clientToken,
+			models.ServiceClient{Scopes: []string{auth.ScopeTestsRead}}, models.ServiceToken{ID: 7, ExpiresAt: &past},
+			http.StatusUnauthorized, false},
+		{"revoked token", "Bearer " + clientToken,
+			models.ServiceClient{Scopes: []string{auth.ScopeTestsRead}}, models.ServiceToken{ID: 7, RevokedAt: &past},
+			http.StatusUnauthorized, false},
+		{"revoked client", "Bearer " + clientToken,
+			models.ServiceClient{Scopes: []string{auth.ScopeTestsRead}, RevokedAt: &past}, models.ServiceToken{ID: 7},
+			http.StatusUnauthorized, false},
+		{"unknown token", "Bearer nope", models.ServiceClient{}, models.ServiceToken{},
+			http.StatusUnauthorized, false},
+		{"missing header", "", models.ServiceClient{}, models.ServiceToken{}, http.StatusUnauthorized, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CMS_SERVICE_TOKEN", shared)
+			clients := &fakeServiceClients{client: &tc.client, token: &tc.token,
+				hash: auth.HashToken(clientToken)}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/service/tests", nil)
+			if tc.authHeader != "" {
+				req.Header.Set("Authorization", tc.authHeader)
+			}
+			rec := httptest.NewRecorder()
+
+			RequireServiceScope(clients, auth.ScopeTestsRead, okHandler).ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if touched := len(clients.touched) > 0; touched != tc.wantTouch {
+				t.Errorf("touched = %v, want %v", touched, tc.wantTouch)
+			}
+		})
+	}
+}
+
+func TestRequireLoginExceptions(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := RequireLogin(next, "/api/service/tests", "/api/service/v1/")
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/api/service/tests", http.StatusOK},
+		{"/api/service/tests/extra", http.StatusSeeOther},
+		{"/api/service/v1/tests/12", http.StatusOK},
+		{"/api/service/v1/openapi.json", http.StatusOK},
+		{"/api/service/v1", http.StatusSeeOther},
+		{"/api/service/v2/tests", http.StatusSeeOther},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
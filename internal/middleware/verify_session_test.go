@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+)
+
+type fakeSessionStore struct {
+	role     string
+	ok       bool
+	err      error
+	calls    int
+	extended int
+}
+
+func (f *fakeSessionStore) Check(context.Context, string, time.Duration) (string, bool, error) {
+	f.calls++
+	return f.role, f.ok, f.err
+}
+
+func (f *fakeSessionStore) Extend(context.Context, string, time.Time) error {
+	f.extended++
+	return nil
+}
+
+func TestVerifySession(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionID  string
+		store      fakeSessionStore
+		wantStatus int
+		wantRole   string
+	}{
+		{"live session", "s1", fakeSessionStore{role: auth.RoleEditor, ok: true}, http.StatusOK, auth.RoleEditor},
+		{"role refreshed from the db", "s1", fakeSessionStore{role: auth.RoleViewer, ok: true}, http.StatusOK,
+			auth.RoleViewer},
+		{"revoked or inactive", "s1", fakeSessionStore{}, http.StatusSeeOther, ""},
+		{"cookie without session id", "", fakeSessionStore{role: auth.RoleEditor, ok: true}, http.StatusSeeOther, ""},
+		{"store error", "s1", fakeSessionStore{err: errors.New("db down")}, http.StatusInternalServerError, ""},
+	}
+	t.Setenv("SESSION_SECRET", "test-secret")
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotRole string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRole = auth.FromContext(r.Context()).Role
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := VerifySession(&tc.store, next)
+			claims := &auth.SessionClaims{UserID: 1, Role: auth.RoleEditor,
+				RegisteredClaims: jwt.RegisteredClaims{ID: tc.sessionID, IssuedAt: jwt.NewNumericDate(time.Now())}}
+
+			// twice, so the second request is served from the cache
+			for range 2 {
+				req := httptest.NewRequest(http.MethodGet, "/home", nil)
+				req = req.WithContext(auth.WithSession(req.Context(), claims))
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code != tc.wantStatus {
+					t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+				}
+				if gotRole != tc.wantRole {
+					t.Errorf("role = %q, want %q", gotRole, tc.wantRole)
+				}
+			}
+			if tc.sessionID != "" && tc.store.err == nil && tc.store.calls != 1 {
+				t.Errorf("store checked %d times, want 1", tc.store.calls)
+			}
+		})
+	}
+}
+
+func TestVerifySessionRenewal(t *testing.T) {
+	t.Setenv("SESSION_SECRET", "test-secret")
+	tests := []struct {
+		name        string
+		age         time.Duration
+		wantRenewed bool
+	}{
+		{"fresh session", time.Hour, false},
+		{"past half its lifetime", 7 * time.Hour, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeSessionStore{role: auth.RoleEditor, ok: true}
+			var got *auth.SessionClaims
+			handler := VerifySession(store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = auth.FromContext(r.Context())
+			}))
+			issued := time.Now().Add(-tc.age)
+			claims := &auth.SessionClaims{UserID: 1, Role: auth.RoleEditor, RegisteredClaims: jwt.RegisteredClaims{
+				ID: "s1", IssuedAt: jwt.NewNumericDate(issued), ExpiresAt: jwt.NewNumericDate(issued.Add(12 * time.Hour)),
+			}}
+			req := httptest.NewRequest(http.MethodGet, "/home", nil)
+			req = req.WithContext(auth.WithSession(req.Context(), claims))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			renewed := false
+			for _, c := range rec.Result().Cookies() {
+				renewed = renewed || (c.Name == auth.SessionCookieName && c.Value != "")
+			}
+			if renewed != tc.wantRenewed || (store.extended == 1) != tc.wantRenewed {
+				t.Fatalf("cookie renewed = %v, session extended %d times, want renewed = %v", renewed,
+					store.extended, tc.wantRenewed)
+			}
+			if got.ID != "s1" || got.ExpiresAt.After(issued.Add(12*time.Hour)) != tc.wantRenewed {
+				t.Errorf("claims = %+v, want same session id with renewed expiry %v", got, tc.wantRenewed)
+			}
+		})
+	}
+}
+
+func TestVerifySessionExpiredHTMX(t *testing.T) {
+	handler := VerifySession(&fakeSessionStore{}, http.NotFoundHandler())
+	claims := &auth.SessionClaims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{ID: "s1"}}
+	req := httptest.NewRequest(http.MethodPost, "/update-test", nil)
+	req.Header.Set("HX-Request", "true")
+	req = req.WithContext(auth.WithSession(req.Context(), claims))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(SessionExpiredHeader) != "true" {
+		t.Fatalf("status = %d, %s = %q; want 401 and true", rec.Code, SessionExpiredHeader,
+			rec.Header().Get(SessionExpiredHeader))
+	}
+	if rec.Header().Get("HX-Redirect") != "" {
+		t.Errorf("HX-Redirect set; the page should re-auth in place")
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one row of the append-only cms_audit_log table: who changed what through which
+// route, with the entity's state before and after where the handler could capture it.
+type AuditEntry struct {
+	ID          int64           `json:"id"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	RequestID   string          `json:"request_id"`
+	ActorUserID *int64          `json:"actor_user_id,omitempty"`
+	ActorEmail  string          `json:"actor_email"`
+	Action      string          `json:"action"`
+	EntityType  string          `json:"entity_type"`
+	EntityID    string          `json:"entity_id"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Status      int             `json:"status"`
+	Before      json.RawMessage `json:"before,omitempty"`
+	After       json.RawMessage `json:"after,omitempty"`
+}
+
+// Succeeded reports whether the audited request completed without an error status.
+func (e *AuditEntry) Succeeded() bool {
+	return e.Status < 400
+}
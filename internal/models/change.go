@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ChangeLogEntry is one content write recorded in the cms_change_log table. ID orders the log and is
+// the change feed's cursor.
+type ChangeLogEntry struct {
+	ID         int64     `json:"id"`
+	EntityType string    `json:"entity_type"`
+	EntityID   int64     `json:"entity_id"`
+	Operation  string    `json:"operation"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
@@ -49,3 +49,8 @@ func (ch *Chapter) GetNameByLang(langCode string) string {
 	}
 	return ""
 }
+
+// Scope returns where the chapter lives, for scoped permissions.
+func (c *Chapter) Scope() Scope {
+	return Scope{CurriculumID: c.CurriculumID, GradeID: c.GradeID, SubjectID: c.SubjectID}
+}
@@ -11,4 +11,6 @@ type CmsUser struct {
 	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
 	InsertedAt  time.Time  `json:"inserted_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
+	// Invitation is filled in by the admin pages, not the user queries.
+	Invitation *Invitation `json:"invitation,omitempty"`
 }
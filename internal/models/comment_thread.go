@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Comment thread states.
+const (
+	ThreadOpen     = "open"
+	ThreadResolved = "resolved"
+)
+
+// Problem fields a comment thread can be anchored to. CommentFieldGeneral is the problem as a whole.
+const (
+	CommentFieldGeneral   = "general"
+	CommentFieldQuestion  = "question"
+	CommentFieldOption    = "option"
+	CommentFieldSolution  = "solution"
+	CommentFieldParagraph = "paragraph"
+)
+
+var commentFields = []string{CommentFieldGeneral, CommentFieldQuestion, CommentFieldOption, CommentFieldSolution,
+	CommentFieldParagraph}
+
+// CommentFields returns the fields a thread can be anchored to, in display order.
+func CommentFields() []string {
+	return commentFields
+}
+
+// ValidCommentField reports whether field is one of CommentFields.
+func ValidCommentField(field string) bool {
+	for _, f := range commentFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// CommentThread is a review conversation about one spot of a problem: a field, an option or
+// solution index where the field has several, and a language. Kept in the CMS-owned
+// cms_comment_thread table, with its comments in cms_comment.
+type CommentThread struct {
+	ID              int64      `json:"id"`
+	ProblemID       int        `json:"problem_id"`
+	Field           string     `json:"field"`
+	FieldIndex      *int       `json:"field_index,omitempty"`
+	LangCode        string     `json:"lang_code,omitempty"`
+	Status          string     `json:"status"`
+	CreatedByUserID *int64     `json:"created_by_user_id,omitempty"`
+	CreatedByEmail  string     `json:"created_by_email"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	ResolvedByEmail string     `json:"resolved_by_email,omitempty"`
+	Comments        []Comment  `json:"comments,omitempty"`
+}
+
+// Comment is one message in a CommentThread.
+type Comment struct {
+	ID           int64     `json:"id"`
+	ThreadID     int64     `json:"thread_id"`
+	Body         string    `json:"body"`
+	AuthorUserID *int64    `json:"author_user_id,omitempty"`
+	AuthorEmail  string    `json:"author_email"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Open reports whether the thread still needs attention.
+func (t *CommentThread) Open() bool {
+	return t.Status == ThreadOpen
+}
+
+// AnchorLabel describes where the thread is anchored, e.g. "Option C · hi" or "Solution 1 · en".
+func (t *CommentThread) AnchorLabel() string {
+	var label string
+	switch {
+	case t.Field == CommentFieldOption && t.FieldIndex != nil:
+		label = fmt.Sprintf("Option %c", 'A'+*t.FieldIndex)
+	case t.Field == CommentFieldSolution && t.FieldIndex != nil:
+		label = fmt.Sprintf("Solution %d", *t.FieldIndex+1)
+	default:
+		label = strings.ToUpper(t.Field[:1]) + t.Field[1:]
+	}
+	if t.LangCode != "" {
+		label += " · " + t.LangCode
+	}
+	return label
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// EditLock is a soft lock: one user having a test or problem open in its edit screen, kept alive
+// by heartbeats in the CMS-owned cms_edit_lock table. It never blocks saving; it only tells other
+// editors that someone else is working on the same content.
+type EditLock struct {
+	EntityType  string    `json:"entity_type"`
+	EntityID    int       `json:"entity_id"`
+	UserID      int64     `json:"user_id"`
+	Email       string    `json:"email"`
+	OpenedAt    time.Time `json:"opened_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
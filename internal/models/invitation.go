@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Invitation records that an admin added a user, manually or by CSV import. It is pending until
+// the user first signs in. Kept in the CMS-owned cms_user_invitation table.
+type Invitation struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Email      string     `json:"email"`
+	Source     string     `json:"source"`
+	InvitedBy  string     `json:"invited_by,omitempty"`
+	InvitedAt  time.Time  `json:"invited_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+// Invitation sources.
+const (
+	InvitationManual = "manual"
+	InvitationImport = "import"
+)
+
+// Pending reports whether the invited user has not signed in yet.
+func (i *Invitation) Pending() bool {
+	return i.AcceptedAt == nil
+}
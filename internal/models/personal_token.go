@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// PersonalToken is a user's personal access token for scripting against the CMS as themselves,
+// kept in the CMS-owned cms_personal_token table. Like a ServiceToken only its hash is stored. It
+// carries no role of its own: requests get the owner's current role and grants.
+type PersonalToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Active reports whether the token is neither revoked nor expired at now.
+func (t *PersonalToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// TokenUse is one request authenticated by a personal token.
+type TokenUse struct {
+	ID      int64     `json:"id"`
+	TokenID int64     `json:"token_id"`
+	UserID  int64     `json:"user_id"`
+	UsedAt  time.Time `json:"used_at"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Status  int       `json:"status"`
+	IP      string    `json:"ip"`
+}
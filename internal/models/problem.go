@@ -101,3 +101,9 @@ func (p *Problem) CopyTo(topic *Topic, curriculumID int16, gradeID int8, subject
 
 	return copied
 }
+
+// Scope returns where the problem lives, for scoped permissions. Curriculum and grade are only
+// filled on problems fetched one at a time, so listed problems have a subject-only scope.
+func (p *Problem) Scope() Scope {
+	return Scope{CurriculumID: p.CurriculumID, GradeID: p.GradeID, SubjectID: p.SubjectID}
+}
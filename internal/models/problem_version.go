@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ProblemVersion is one saved state of a problem, kept in the CMS-owned cms_problem_version table.
+// Snapshot is the problem JSON as saved (the models.Problem fields plus request-only keys such as
+// concept_ids), so it can be replayed to db-service on revert.
+type ProblemVersion struct {
+	ID          int64           `json:"id"`
+	ProblemID   int             `json:"problem_id"`
+	Version     int             `json:"version"`
+	Action      string          `json:"action"`
+	Note        string          `json:"note,omitempty"`
+	ActorUserID *int64          `json:"actor_user_id,omitempty"`
+	ActorEmail  string          `json:"actor_email"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Snapshot    json.RawMessage `json:"snapshot,omitempty"`
+}
+
+// Problem decodes the snapshot.
+func (v *ProblemVersion) Problem() (*Problem, error) {
+	var p Problem
+	if err := json.Unmarshal(v.Snapshot, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -48,6 +48,19 @@ func NewResource(code string, name string, resourceType string, subtype string,
 	return resource
 }
 
+// Scopes returns where the resource lives, for scoped permissions: one scope per curriculum grade,
+// each with the resource's subject.
+func (resourcePtr *Resource) Scopes() []Scope {
+	if len(resourcePtr.CurriculumGrades) == 0 {
+		return []Scope{{SubjectID: resourcePtr.SubjectID}}
+	}
+	scopes := make([]Scope, 0, len(resourcePtr.CurriculumGrades))
+	for _, cg := range resourcePtr.CurriculumGrades {
+		scopes = append(scopes, Scope{CurriculumID: cg.CurriculumID, GradeID: cg.GradeID, SubjectID: resourcePtr.SubjectID})
+	}
+	return scopes
+}
+
 func (resourcePtr *Resource) BuildMap(code string, name string, resourceType string, subtype string, srcLink string) map[string]any {
 	resourceMap := map[string]any{
 		"code": code,
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ReviewComment is a reviewer's note on a test or problem, kept in the CMS-owned
+// cms_review_comment table. Comments left while changing status carry the transition; plain
+// comments have an empty Action.
+type ReviewComment struct {
+	ID          int64     `json:"id"`
+	EntityType  string    `json:"entity_type"`
+	EntityID    int       `json:"entity_id"`
+	Action      string    `json:"action,omitempty"`
+	FromStatus  *int8     `json:"from_status,omitempty"`
+	ToStatus    *int8     `json:"to_status,omitempty"`
+	Body        string    `json:"body"`
+	ActorUserID *int64    `json:"actor_user_id,omitempty"`
+	ActorEmail  string    `json:"actor_email"`
+	CreatedAt   time.Time `json:"created_at"`
+}
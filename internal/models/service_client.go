@@ -0,0 +1,43 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// ServiceClient is a named caller of the /api/service routes (e.g. af_lms, quiz-creator), kept in
+// the CMS-owned cms_service_client table with the scopes its tokens may use.
+type ServiceClient struct {
+	ID         int64          `json:"id"`
+	Name       string         `json:"name"`
+	Scopes     []string       `json:"scopes"`
+	CreatedAt  time.Time      `json:"created_at"`
+	CreatedBy  string         `json:"created_by,omitempty"`
+	RevokedAt  *time.Time     `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`
+	Tokens     []ServiceToken `json:"tokens,omitempty"`
+}
+
+// HasScope reports whether the client may use scope.
+func (c *ServiceClient) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// ServiceToken is one bearer token of a service client. Only its hash is stored, plus the first
+// characters so admins can tell tokens apart. A client may hold several active tokens at once,
+// which is what lets a rotation overlap.
+type ServiceToken struct {
+	ID         int64      `json:"id"`
+	ClientID   int64      `json:"client_id"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Active reports whether the token is neither revoked nor expired at now.
+func (t *ServiceToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
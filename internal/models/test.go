@@ -176,3 +176,23 @@ func (t *Test) RecalculateTotalMarksFromSubjects() {
 
 	t.TypeParams.Marks = total
 }
+
+// Scopes returns every (curriculum, grade, subject) the test spans, for scoped permissions: each
+// of its curriculum grades paired with each of its subjects.
+func (t *Test) Scopes() []Scope {
+	var scopes []Scope
+	for _, cg := range t.CurriculumGrades {
+		if len(t.TypeParams.Subjects) == 0 {
+			scopes = append(scopes, Scope{CurriculumID: cg.CurriculumID, GradeID: cg.GradeID})
+		}
+		for _, subject := range t.TypeParams.Subjects {
+			scopes = append(scopes, Scope{CurriculumID: cg.CurriculumID, GradeID: cg.GradeID, SubjectID: subject.SubjectID})
+		}
+	}
+	if len(t.CurriculumGrades) == 0 {
+		for _, subject := range t.TypeParams.Subjects {
+			scopes = append(scopes, Scope{SubjectID: subject.SubjectID})
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TestVersion is one saved state of a test, kept in the CMS-owned cms_test_version table.
+type TestVersion struct {
+	ID          int64           `json:"id"`
+	TestID      int             `json:"test_id"`
+	Version     int             `json:"version"`
+	Action      string          `json:"action"`
+	Note        string          `json:"note,omitempty"`
+	ActorUserID *int64          `json:"actor_user_id,omitempty"`
+	ActorEmail  string          `json:"actor_email"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Snapshot    json.RawMessage `json:"snapshot,omitempty"`
+}
+
+// Test decodes the snapshot.
+func (v *TestVersion) Test() (*Test, error) {
+	var t Test
+	if err := json.Unmarshal(v.Snapshot, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// TestDelivery records a test being fetched through the service API (by af_lms or quiz-creator),
+// i.e. published to learners.
+type TestDelivery struct {
+	TestID         int       `json:"test_id"`
+	FirstFetchedAt time.Time `json:"first_fetched_at"`
+	LastFetchedAt  time.Time `json:"last_fetched_at"`
+	FetchCount     int       `json:"fetch_count"`
+}
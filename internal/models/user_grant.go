@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Scope is where a piece of content lives: the curriculum, grade and subject of a chapter, topic,
+// problem or test. A zero field is unknown or not applicable (e.g. a "Common" chapter has no
+// grade), so only grants that leave that field open cover it.
+type Scope struct {
+	CurriculumID int16 `json:"curriculum_id,omitempty"`
+	GradeID      int8  `json:"grade_id,omitempty"`
+	SubjectID    int8  `json:"subject_id,omitempty"`
+}
+
+// UserGrant gives a user a role within one (curriculum, grade, subject) scope, on top of their
+// global cms_user_permission role. It is kept in the CMS-owned cms_user_grant table. A nil field
+// matches any value, so a grant with only SubjectID set covers that subject everywhere.
+type UserGrant struct {
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	CurriculumID *int16    `json:"curriculum_id,omitempty"`
+	GradeID      *int8     `json:"grade_id,omitempty"`
+	SubjectID    *int8     `json:"subject_id,omitempty"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+}
+
+// Covers reports whether the grant applies to content in scope s. It fails closed: a field the
+// grant pins must be known in s and equal.
+func (g *UserGrant) Covers(s Scope) bool {
+	return (g.CurriculumID == nil || *g.CurriculumID == s.CurriculumID) &&
+		(g.GradeID == nil || *g.GradeID == s.GradeID) &&
+		(g.SubjectID == nil || *g.SubjectID == s.SubjectID)
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// WebhookEndpoint is a URL that receives signed content-change events (see package webhook), kept in
+// the CMS-owned cms_webhook_endpoint table.
+type WebhookEndpoint struct {
+	ID          int64      `json:"id"`
+	URL         string     `json:"url"`
+	Description string     `json:"description,omitempty"`
+	EventTypes  []string   `json:"event_types"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+	// Secret signs deliveries. It is only shown to the admin when the endpoint is created.
+	Secret string `json:"-"`
+}
+
+// Subscribes reports whether the endpoint receives events of eventType.
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	return e.DisabledAt == nil && slices.Contains(e.EventTypes, eventType)
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event on its way to one endpoint, with the outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	EndpointID    int64           `json:"endpoint_id"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastAttemptAt *time.Time      `json:"last_attempt_at,omitempty"`
+	LastStatus    int             `json:"last_status,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	// ReplayOf is the delivery this one re-sends, when an admin replayed it.
+	ReplayOf *int64 `json:"replay_of,omitempty"`
+
+	// URL and Secret are the endpoint's, filled in when a delivery is claimed for sending.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookAttempt is the outcome of one POST of a delivery.
+type WebhookAttempt struct {
+	At       time.Time
+	Status   int // HTTP status, 0 when no response came back
+	Error    string
+	Duration time.Duration
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// AuditFilter narrows AuditLogRepo.List. Zero values are ignored; To is exclusive.
+type AuditFilter struct {
+	ActorEmail string
+	EntityType string
+	EntityID   string
+	From, To   time.Time
+	Limit      int
+	Offset     int
+}
+
+// AuditLogRepo reads and appends cms_audit_log. There is deliberately no update or delete.
+type AuditLogRepo struct {
+	db *sql.DB
+}
+
+func NewAuditLogRepo(db *sql.DB) *AuditLogRepo {
+	return &AuditLogRepo{db: db}
+}
+
+// Insert appends e.
+func (r *AuditLogRepo) Insert(ctx context.Context, e *models.AuditEntry) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cms_audit_log (request_id, actor_user_id, actor_email, action, entity_type, entity_id,
+			method, path, status, before, after)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		e.RequestID, e.ActorUserID, e.ActorEmail, e.Action, e.EntityType, e.EntityID, e.Method, e.Path,
+		e.Status, nullableJSON(e.Before), nullableJSON(e.After))
+	return err
+}
+
+// List returns matching entries newest first.
+func (r *AuditLogRepo) List(ctx context.Context, f AuditFilter) ([]models.AuditEntry, error) {
+	var where []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorEmail != "" {
+		add("actor_email = $%d", f.ActorEmail)
+	}
+	if f.EntityType != "" {
+		add("entity_type = $%d", f.EntityType)
+	}
+	if f.EntityID != "" {
+		add("entity_id = $%d", f.EntityID)
+	}
+	if !f.From.IsZero() {
+		add("occurred_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("occurred_at < $%d", f.To)
+	}
+
+	query := `SELECT id, occurred_at, request_id, actor_user_id, actor_email, action, entity_type, entity_id,
+		method, path, status, before, after FROM cms_audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, f.Offset)
+	query += fmt.Sprintf(" ORDER BY occurred_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.OccurredAt, &e.RequestID, &e.ActorUserID, &e.ActorEmail, &e.Action,
+			&e.EntityType, &e.EntityID, &e.Method, &e.Path, &e.Status, &before, &after); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// Actors returns the distinct actor emails in the log, for the filter dropdown.
+func (r *AuditLogRepo) Actors(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT DISTINCT actor_email FROM cms_audit_log WHERE actor_email <> '' ORDER BY actor_email`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		out = append(out, email)
+	}
+	return out, rows.Err()
+}
+
+// nullableJSON stores absent payloads as SQL NULL rather than an empty (invalid) JSONB value.
+func nullableJSON(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
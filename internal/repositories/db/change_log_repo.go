@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// ChangeLogSettle is how old an entry must be before the feed returns it. IDs are taken when a row is
+// inserted but become visible when it commits, so a just-committed entry can carry a lower ID than one
+// already read; holding recent entries back keeps a cursor from skipping past it.
+const ChangeLogSettle = 5 * time.Second
+
+// ChangeLogRepo appends to and reads the cms_change_log table (see package changelog).
+type ChangeLogRepo struct {
+	db *sql.DB
+}
+
+func NewChangeLogRepo(db *sql.DB) *ChangeLogRepo {
+	return &ChangeLogRepo{db: db}
+}
+
+// Append records one write.
+func (r *ChangeLogRepo) Append(ctx context.Context, entityType string, entityID int64, operation string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO cms_change_log (entity_type, entity_id, operation) VALUES ($1, $2, $3)`,
+		entityType, entityID, operation)
+	return err
+}
+
+// List returns up to limit settled entries after the one with ID after, oldest first, optionally only
+// of entityTypes.
+func (r *ChangeLogRepo) List(ctx context.Context, after int64, entityTypes []string, limit int) ([]*models.ChangeLogEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, entity_type, entity_id, operation, changed_at FROM cms_change_log
+		WHERE id > $1 AND (cardinality($2::TEXT[]) = 0 OR entity_type = ANY ($2))
+			AND changed_at <= NOW() - make_interval(secs => $4)
+		ORDER BY id LIMIT $3`, after, pq.Array(entityTypes), limit, ChangeLogSettle.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.ChangeLogEntry
+	for rows.Next() {
+		var e models.ChangeLogEntry
+		if err := rows.Scan(&e.ID, &e.EntityType, &e.EntityID, &e.Operation, &e.ChangedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &e)
+	}
+	return out, rows.Err()
+}
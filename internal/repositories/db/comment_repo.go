@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+var ErrThreadNotFound = errors.New("comment thread not found")
+
+type CommentRepo struct {
+	db *sql.DB
+}
+
+func NewCommentRepo(db *sql.DB) *CommentRepo {
+	return &CommentRepo{db: db}
+}
+
+const threadColumns = `t.id, t.problem_id, t.field, t.field_index, t.lang_code, t.status, t.created_by_user_id,
+	t.created_by_email, t.created_at, t.resolved_at, t.resolved_by_email`
+
+func scanThread(row interface{ Scan(...any) error }) (*models.CommentThread, error) {
+	var t models.CommentThread
+	if err := row.Scan(&t.ID, &t.ProblemID, &t.Field, &t.FieldIndex, &t.LangCode, &t.Status, &t.CreatedByUserID,
+		&t.CreatedByEmail, &t.CreatedAt, &t.ResolvedAt, &t.ResolvedByEmail); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateThread opens thread t with first as its first comment and returns the thread id.
+func (r *CommentRepo) CreateThread(ctx context.Context, t *models.CommentThread, first *models.Comment) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO cms_comment_thread (problem_id, field, field_index, lang_code, created_by_user_id, created_by_email)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		t.ProblemID, t.Field, t.FieldIndex, t.LangCode, t.CreatedByUserID, t.CreatedByEmail).Scan(&id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO cms_comment (thread_id, body, author_user_id, author_email) VALUES ($1, $2, $3, $4)`,
+		id, first.Body, first.AuthorUserID, first.AuthorEmail); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Reply appends c to its thread.
+func (r *CommentRepo) Reply(ctx context.Context, c *models.Comment) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cms_comment (thread_id, body, author_user_id, author_email) VALUES ($1, $2, $3, $4)`,
+		c.ThreadID, c.Body, c.AuthorUserID, c.AuthorEmail)
+	return err
+}
+
+// Resolve marks a thread resolved by email. Reopen clears the resolution.
+func (r *CommentRepo) Resolve(ctx context.Context, threadID int64, email string) error {
+	return r.execThread(ctx, `UPDATE cms_comment_thread SET status = 'resolved', resolved_at = NOW(),
+		resolved_by_email = $2 WHERE id = $1`, threadID, email)
+}
+
+func (r *CommentRepo) Reopen(ctx context.Context, threadID int64) error {
+	return r.execThread(ctx, `UPDATE cms_comment_thread SET status = 'open', resolved_at = NULL,
+		resolved_by_email = '' WHERE id = $1`, threadID)
+}
+
+func (r *CommentRepo) execThread(ctx context.Context, query string, args ...any) error {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrThreadNotFound
+	}
+	return nil
+}
+
+// GetThread returns one thread with its comments, or ErrThreadNotFound.
+func (r *CommentRepo) GetThread(ctx context.Context, threadID int64) (*models.CommentThread, error) {
+	t, err := scanThread(r.db.QueryRowContext(ctx,
+		`SELECT `+threadColumns+` FROM cms_comment_thread t WHERE t.id = $1`, threadID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrThreadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, r.fillComments(ctx, []*models.CommentThread{t})
+}
+
+// ListByProblem returns a problem's threads with their comments, open threads first.
+func (r *CommentRepo) ListByProblem(ctx context.Context, problemID int) ([]*models.CommentThread, error) {
+	threads, err := r.queryThreads(ctx,
+		`SELECT `+threadColumns+` FROM cms_comment_thread t WHERE t.problem_id = $1
+		 ORDER BY t.status = 'resolved', t.created_at`, problemID)
+	if err != nil {
+		return nil, err
+	}
+	return threads, r.fillComments(ctx, threads)
+}
+
+// Inbox returns the open threads on problems authored by userID, oldest first, with their
+// comments. The author of a problem is whoever created it through the CMS, as recorded by its create
+// version. db-service keeps no authorship, so problems created before version history (or whose
+// create version failed to record) have no known author and reach no inbox: their first editor
+// needn't be their author.
+func (r *CommentRepo) Inbox(ctx context.Context, userID int64) ([]*models.CommentThread, error) {
+	threads, err := r.queryThreads(ctx,
+		`SELECT `+threadColumns+` FROM cms_comment_thread t
+		 WHERE t.status = 'open' AND EXISTS (
+			SELECT 1 FROM cms_problem_version v
+			WHERE v.problem_id = t.problem_id AND v.action = $2 AND v.actor_user_id = $1)
+		 ORDER BY t.created_at`, userID, VersionActionCreate)
+	if err != nil {
+		return nil, err
+	}
+	return threads, r.fillComments(ctx, threads)
+}
+
+func (r *CommentRepo) queryThreads(ctx context.Context, query string, args ...any) ([]*models.CommentThread, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.CommentThread
+	for rows.Next() {
+		t, err := scanThread(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *CommentRepo) fillComments(ctx context.Context, threads []*models.CommentThread) error {
+	if len(threads) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*models.CommentThread, len(threads))
+	ids := make([]int64, len(threads))
+	for i, t := range threads {
+		byID[t.ID] = t
+		ids[i] = t.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, thread_id, body, author_user_id, author_email, created_at FROM cms_comment
+		 WHERE thread_id = ANY($1) ORDER BY created_at, id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c models.Comment
+		if err := rows.Scan(&c.ID, &c.ThreadID, &c.Body, &c.AuthorUserID, &c.AuthorEmail, &c.CreatedAt); err != nil {
+			return err
+		}
+		byID[c.ThreadID].Comments = append(byID[c.ThreadID].Comments, c)
+	}
+	return rows.Err()
+}
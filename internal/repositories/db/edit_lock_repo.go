@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type EditLockRepo struct {
+	db *sql.DB
+}
+
+func NewEditLockRepo(db *sql.DB) *EditLockRepo {
+	return &EditLockRepo{db: db}
+}
+
+// Heartbeat takes or refreshes the user's lock on an entity.
+func (r *EditLockRepo) Heartbeat(ctx context.Context, entityType string, entityID int, userID int64,
+	email string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cms_edit_lock (entity_type, entity_id, user_id, email) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (entity_type, entity_id, user_id) DO UPDATE SET heartbeat_at = NOW(), email = EXCLUDED.email`,
+		entityType, entityID, userID, email)
+	return err
+}
+
+// Others returns the locks other users hold on an entity whose last heartbeat is within ttl,
+// earliest opened first. Expired rows are cleared on the way.
+func (r *EditLockRepo) Others(ctx context.Context, entityType string, entityID int, userID int64,
+	ttl time.Duration) ([]models.EditLock, error) {
+	cutoff := time.Now().Add(-ttl)
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM cms_edit_lock WHERE heartbeat_at < $1`, cutoff); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT entity_type, entity_id, user_id, email, opened_at, heartbeat_at FROM cms_edit_lock
+		 WHERE entity_type = $1 AND entity_id = $2 AND user_id <> $3
+		 ORDER BY opened_at`, entityType, entityID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.EditLock
+	for rows.Next() {
+		var l models.EditLock
+		if err := rows.Scan(&l.EntityType, &l.EntityID, &l.UserID, &l.Email, &l.OpenedAt,
+			&l.HeartbeatAt); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// Release drops the user's lock on an entity, e.g. when the edit screen is closed.
+func (r *EditLockRepo) Release(ctx context.Context, entityType string, entityID int, userID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM cms_edit_lock WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3`,
+		entityType, entityID, userID)
+	return err
+}
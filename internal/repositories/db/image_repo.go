@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+var ErrImageNotFound = errors.New("image not found")
+
+// ImageRepo stores images content-addressed in the cms_image table.
+type ImageRepo struct {
+	db *sql.DB
+	// saved remembers the hashes this process has stored, so an assembled test re-fetched many times
+	// doesn't send its images to Postgres on every request.
+	saved sync.Map
+}
+
+func NewImageRepo(db *sql.DB) *ImageRepo {
+	return &ImageRepo{db: db}
+}
+
+// Save stores an image unless it is already stored, and returns its hash: the hex SHA-256 of data.
+func (r *ImageRepo) Save(ctx context.Context, contentType string, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if _, ok := r.saved.Load(hash); ok {
+		return hash, nil
+	}
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO cms_image (hash, content_type, data) VALUES ($1, $2, $3)
+		ON CONFLICT (hash) DO NOTHING`, hash, contentType, data); err != nil {
+		return "", err
+	}
+	r.saved.Store(hash, struct{}{})
+	return hash, nil
+}
+
+// Get returns an image's content type and bytes, or ErrImageNotFound.
+func (r *ImageRepo) Get(ctx context.Context, hash string) (string, []byte, error) {
+	var contentType string
+	var data []byte
+	err := r.db.QueryRowContext(ctx, `SELECT content_type, data FROM cms_image WHERE hash = $1`, hash).
+		Scan(&contentType, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrImageNotFound
+	}
+	return contentType, data, err
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type InvitationRepo struct {
+	db *sql.DB
+}
+
+func NewInvitationRepo(db *sql.DB) *InvitationRepo {
+	return &InvitationRepo{db: db}
+}
+
+// Create records an invitation for a newly added user. A user is only ever invited once.
+func (r *InvitationRepo) Create(ctx context.Context, inv *models.Invitation) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cms_user_invitation (user_id, email, source, invited_by) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id) DO NOTHING`,
+		inv.UserID, inv.Email, inv.Source, inv.InvitedBy)
+	return err
+}
+
+// Accept marks a user's invitation accepted, if they have a pending one.
+func (r *InvitationRepo) Accept(ctx context.Context, userID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE cms_user_invitation SET accepted_at = NOW() WHERE user_id = $1 AND accepted_at IS NULL`, userID)
+	return err
+}
+
+// ByUser returns all invitations keyed by user ID, for the admin user list.
+func (r *InvitationRepo) ByUser(ctx context.Context) (map[int64]*models.Invitation, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, user_id, email, source, invited_by, invited_at, accepted_at FROM cms_user_invitation`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]*models.Invitation{}
+	for rows.Next() {
+		var inv models.Invitation
+		if err := rows.Scan(&inv.ID, &inv.UserID, &inv.Email, &inv.Source, &inv.InvitedBy, &inv.InvitedAt,
+			&inv.AcceptedAt); err != nil {
+			return nil, err
+		}
+		out[inv.UserID] = &inv
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+var ErrPersonalTokenNotFound = errors.New("personal token not found")
+
+type PersonalTokenRepo struct {
+	db *sql.DB
+}
+
+func NewPersonalTokenRepo(db *sql.DB) *PersonalTokenRepo {
+	return &PersonalTokenRepo{db: db}
+}
+
+const personalTokenColumns = `id, user_id, name, prefix, created_at, expires_at, revoked_at, last_used_at`
+
+// ListByUser returns a user's tokens, live ones first, newest first.
+func (r *PersonalTokenRepo) ListByUser(ctx context.Context, userID int64) ([]models.PersonalToken, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+personalTokenColumns+` FROM cms_personal_token WHERE user_id = $1
+		 ORDER BY revoked_at IS NOT NULL, expires_at < NOW(), created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.PersonalToken
+	for rows.Next() {
+		var t models.PersonalToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.CreatedAt, &t.ExpiresAt, &t.RevokedAt,
+			&t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Create stores a new token's hash and returns its ID.
+func (r *PersonalTokenRepo) Create(ctx context.Context, t *models.PersonalToken, hash string) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO cms_personal_token (user_id, name, token_hash, prefix, expires_at)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		t.UserID, t.Name, hash, t.Prefix, t.ExpiresAt).Scan(&id)
+	return id, err
+}
+
+// Revoke revokes one of a user's tokens.
+func (r *PersonalTokenRepo) Revoke(ctx context.Context, userID, id int64) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE cms_personal_token SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPersonalTokenNotFound
+	}
+	return nil
+}
+
+// Lookup returns the token a hash belongs to and its owner, or nils when no token has that hash.
+// It doesn't check revocation, expiry or whether the owner is active.
+func (r *PersonalTokenRepo) Lookup(ctx context.Context, hash string) (*models.PersonalToken, *models.CmsUser, error) {
+	var t models.PersonalToken
+	var u models.CmsUser
+	err := r.db.QueryRowContext(ctx,
+		`SELECT t.id, t.name, t.prefix, t.expires_at, t.revoked_at, u.id, u.email, u.role, u.is_active
+		 FROM cms_personal_token t JOIN cms_user_permission u ON u.id = t.user_id
+		 WHERE t.token_hash = $1`, hash).
+		Scan(&t.ID, &t.Name, &t.Prefix, &t.ExpiresAt, &t.RevokedAt, &u.ID, &u.Email, &u.Role, &u.IsActive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	t.UserID = u.ID
+	return &t, &u, nil
+}
+
+// RecordUse logs one request made with a token and marks the token as just used.
+func (r *PersonalTokenRepo) RecordUse(ctx context.Context, use *models.TokenUse) error {
+	_, err := r.db.ExecContext(ctx,
+		`WITH u AS (
+			INSERT INTO cms_personal_token_use (token_id, user_id, method, path, status, ip)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING token_id
+		 )
+		 UPDATE cms_personal_token SET last_used_at = NOW() WHERE id IN (SELECT token_id FROM u)`,
+		use.TokenID, use.UserID, use.Method, use.Path, use.Status, use.IP)
+	return err
+}
+
+// ListUses returns the latest uses of one of a user's tokens, newest first.
+func (r *PersonalTokenRepo) ListUses(ctx context.Context, userID, tokenID int64, limit int) ([]models.TokenUse, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, token_id, user_id, used_at, method, path, status, ip FROM cms_personal_token_use
+		 WHERE token_id = $1 AND user_id = $2 ORDER BY used_at DESC LIMIT $3`, tokenID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.TokenUse
+	for rows.Next() {
+		var u models.TokenUse
+		if err := rows.Scan(&u.ID, &u.TokenID, &u.UserID, &u.UsedAt, &u.Method, &u.Path, &u.Status, &u.IP); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
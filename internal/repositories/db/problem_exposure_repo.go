@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/avantifellows/nex-gen-cms/internal/exposure"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// ProblemExposureRepo keeps the cms_problem_exposure table (see package exposure).
+type ProblemExposureRepo struct {
+	db *sql.DB
+}
+
+func NewProblemExposureRepo(db *sql.DB) *ProblemExposureRepo {
+	return &ProblemExposureRepo{db: db}
+}
+
+// Sync makes the recorded appearances of a test match appearances. New appearances are dated now;
+// those already recorded keep their date.
+func (r *ProblemExposureRepo) Sync(ctx context.Context, testID int, appearances []exposure.Appearance) error {
+	return r.sync(ctx, testID, appearances, `NOW()`)
+}
+
+// Backfill is Sync for tests saved before exposure was tracked. New appearances are dated when the test
+// was first fetched for students, else when the CMS first versioned it, else left undated.
+func (r *ProblemExposureRepo) Backfill(ctx context.Context, testID int, appearances []exposure.Appearance) error {
+	return r.sync(ctx, testID, appearances, `COALESCE(
+		(SELECT first_fetched_at FROM cms_test_delivery WHERE test_id = $1),
+		(SELECT MIN(created_at) FROM cms_test_version WHERE test_id = $1))`)
+}
+
+func (r *ProblemExposureRepo) sync(ctx context.Context, testID int, appearances []exposure.Appearance,
+	addedAt string) error {
+	problemIDs := make([]int64, len(appearances))
+	curriculumIDs := make([]int64, len(appearances))
+	gradeIDs := make([]int64, len(appearances))
+	subtypes := make([]string, len(appearances))
+	for i, a := range appearances {
+		problemIDs[i], curriculumIDs[i], gradeIDs[i] = int64(a.ProblemID), int64(a.CurriculumID), int64(a.GradeID)
+		subtypes[i] = a.TestSubtype
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM cms_problem_exposure e WHERE e.test_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM unnest($2::INTEGER[], $3::SMALLINT[], $4::SMALLINT[]) AS a (problem_id, curriculum_id, grade_id)
+			WHERE a.problem_id = e.problem_id AND a.curriculum_id = e.curriculum_id AND a.grade_id = e.grade_id)`,
+		testID, pq.Array(problemIDs), pq.Array(curriculumIDs), pq.Array(gradeIDs)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO cms_problem_exposure (test_id, problem_id, curriculum_id, grade_id, test_subtype, added_at)
+		 SELECT $1::INTEGER, a.problem_id, a.curriculum_id, a.grade_id, a.test_subtype, `+addedAt+`
+		 FROM unnest($2::INTEGER[], $3::SMALLINT[], $4::SMALLINT[], $5::TEXT[])
+			AS a (problem_id, curriculum_id, grade_id, test_subtype)
+		 ON CONFLICT (test_id, problem_id, curriculum_id, grade_id) DO UPDATE SET test_subtype = EXCLUDED.test_subtype`,
+		testID, pq.Array(problemIDs), pq.Array(curriculumIDs), pq.Array(gradeIDs), pq.Array(subtypes)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Summaries returns the usage of each of problemIDs in tests other than excludeTestID, keyed by problem.
+// Unused problems are left out. Recent counts the tests for any of pairs dated on or after since.
+func (r *ProblemExposureRepo) Summaries(ctx context.Context, problemIDs []int, excludeTestID int,
+	pairs []models.CurriculumGrade, since time.Time) (map[int]exposure.Summary, error) {
+	ids := make([]int64, len(problemIDs))
+	for i, id := range problemIDs {
+		ids[i] = int64(id)
+	}
+	curriculumIDs := make([]int64, len(pairs))
+	gradeIDs := make([]int64, len(pairs))
+	for i, p := range pairs {
+		curriculumIDs[i], gradeIDs[i] = int64(p.CurriculumID), int64(p.GradeID)
+	}
+
+	// a test has one subtype, so per-subtype test counts add up to the problem's total
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT e.problem_id, e.test_subtype, COUNT(DISTINCT e.test_id), MAX(e.added_at),
+			COUNT(DISTINCT e.test_id) FILTER (WHERE e.added_at >= $3 AND EXISTS (
+				SELECT 1 FROM unnest($4::SMALLINT[], $5::SMALLINT[]) AS p (curriculum_id, grade_id)
+				WHERE p.curriculum_id = e.curriculum_id AND p.grade_id = e.grade_id))
+		 FROM cms_problem_exposure e
+		 WHERE e.problem_id = ANY ($1) AND e.test_id <> $2
+		 GROUP BY e.problem_id, e.test_subtype`,
+		pq.Array(ids), excludeTestID, since, pq.Array(curriculumIDs), pq.Array(gradeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int]exposure.Summary{}
+	for rows.Next() {
+		var (
+			problemID, tests, recent int
+			subtype                  string
+			lastUsed                 sql.NullTime
+		)
+		if err := rows.Scan(&problemID, &subtype, &tests, &lastUsed, &recent); err != nil {
+			return nil, err
+		}
+		s, ok := out[problemID]
+		if !ok {
+			s = exposure.Summary{ProblemID: problemID, BySubtype: map[string]int{}}
+		}
+		s.Tests += tests
+		s.BySubtype[subtype] = tests
+		s.Recent += recent
+		if lastUsed.Valid && lastUsed.Time.After(s.LastUsed) {
+			s.LastUsed = lastUsed.Time
+		}
+		out[problemID] = s
+	}
+	return out, rows.Err()
+}
+
+// MostUsed returns the IDs of up to limit problems that appear in the most tests, most first.
+func (r *ProblemExposureRepo) MostUsed(ctx context.Context, limit int) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT problem_id FROM cms_problem_exposure
+		 GROUP BY problem_id ORDER BY COUNT(DISTINCT test_id) DESC, problem_id LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Count returns how many problems and tests have appearances recorded.
+func (r *ProblemExposureRepo) Count(ctx context.Context) (problems, tests int, err error) {
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT problem_id), COUNT(DISTINCT test_id) FROM cms_problem_exposure`).Scan(&problems, &tests)
+	return problems, tests, err
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/avantifellows/nex-gen-cms/internal/similarity"
+)
+
+type ProblemFingerprintRepo struct {
+	db *sql.DB
+}
+
+func NewProblemFingerprintRepo(db *sql.DB) *ProblemFingerprintRepo {
+	return &ProblemFingerprintRepo{db: db}
+}
+
+// Upsert stores (or replaces) the fingerprint for a problem.
+func (r *ProblemFingerprintRepo) Upsert(ctx context.Context, fp similarity.Fingerprint) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cms_problem_fingerprint (problem_id, code, subject_id, signature, updated_at)
+		 VALUES ($1, $2, $3, $4, NOW())
+		 ON CONFLICT (problem_id) DO UPDATE
+		 SET code = EXCLUDED.code, subject_id = EXCLUDED.subject_id, signature = EXCLUDED.signature, updated_at = NOW()`,
+		fp.ProblemID, fp.Code, fp.SubjectID, pq.Array(fp.Signature.ToInt64s()))
+	return err
+}
+
+// Delete drops a problem from the index (e.g. when it is archived).
+func (r *ProblemFingerprintRepo) Delete(ctx context.Context, problemID int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM cms_problem_fingerprint WHERE problem_id = $1`, problemID)
+	return err
+}
+
+// ListBySubject returns every fingerprint for one subject.
+func (r *ProblemFingerprintRepo) ListBySubject(ctx context.Context, subjectID int8) ([]similarity.Fingerprint, error) {
+	return r.query(ctx,
+		`SELECT problem_id, code, subject_id, signature FROM cms_problem_fingerprint WHERE subject_id = $1`, subjectID)
+}
+
+// List returns every fingerprint in the index.
+func (r *ProblemFingerprintRepo) List(ctx context.Context) ([]similarity.Fingerprint, error) {
+	return r.query(ctx, `SELECT problem_id, code, subject_id, signature FROM cms_problem_fingerprint`)
+}
+
+// Count returns the number of indexed problems.
+func (r *ProblemFingerprintRepo) Count(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cms_problem_fingerprint`).Scan(&n)
+	return n, err
+}
+
+func (r *ProblemFingerprintRepo) query(ctx context.Context, query string, args ...any) ([]similarity.Fingerprint, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []similarity.Fingerprint
+	for rows.Next() {
+		var fp similarity.Fingerprint
+		var signature []int64
+		if err := rows.Scan(&fp.ProblemID, &fp.Code, &fp.SubjectID, pq.Array(&signature)); err != nil {
+			return nil, err
+		}
+		sig, ok := similarity.FromInt64s(signature)
+		if !ok {
+			// Signature from an older SignatureSize; it is rewritten on the next rebuild.
+			continue
+		}
+		fp.Signature = sig
+		out = append(out, fp)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+var (
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrVersionConflict means another save recorded a version after the one a save was based on.
+	ErrVersionConflict = errors.New("a newer version was saved")
+)
+
+// Version actions, shared by problem and test history.
+const (
+	VersionActionBaseline = "baseline" // state found in db-service before the CMS first recorded a save
+	VersionActionCreate   = "create"
+	VersionActionUpdate   = "update"
+	VersionActionRevert   = "revert"
+)
+
+type ProblemVersionRepo struct {
+	db *sql.DB
+}
+
+func NewProblemVersionRepo(db *sql.DB) *ProblemVersionRepo {
+	return &ProblemVersionRepo{db: db}
+}
+
+// Insert appends the next version for v.ProblemID and returns its number. Version numbers are
+// per problem and start at 1.
+func (r *ProblemVersionRepo) Insert(ctx context.Context, v *models.ProblemVersion) (int, error) {
+	return r.insert(ctx, v, nil)
+}
+
+// InsertIfLatest appends the next version like Insert, but only while the latest CMS-saved version
+// (baselines aside, as in Latest) is still expected; otherwise it returns ErrVersionConflict.
+func (r *ProblemVersionRepo) InsertIfLatest(ctx context.Context, v *models.ProblemVersion, expected int) (int, error) {
+	return r.insert(ctx, v, &expected)
+}
+
+func (r *ProblemVersionRepo) insert(ctx context.Context, v *models.ProblemVersion, expected *int) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersions(ctx, tx, "cms_problem_version", v.ProblemID); err != nil {
+		return 0, err
+	}
+	var version int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO cms_problem_version (problem_id, version, action, note, actor_user_id, actor_email, snapshot)
+		 SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6
+		 FROM cms_problem_version WHERE problem_id = $1
+		 HAVING $7::INTEGER IS NULL OR COALESCE(MAX(version) FILTER (WHERE action <> $8), 0) = $7
+		 RETURNING version`,
+		v.ProblemID, v.Action, v.Note, v.ActorUserID, v.ActorEmail, []byte(v.Snapshot), expected,
+		VersionActionBaseline).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrVersionConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+// Delete removes one version; a save whose version was claimed before it reached db-service gives
+// the version back when db-service rejects it.
+func (r *ProblemVersionRepo) Delete(ctx context.Context, problemID, version int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM cms_problem_version WHERE problem_id = $1 AND version = $2`, problemID, version)
+	return err
+}
+
+// lockVersions serializes the saves numbering one entity's versions in table until tx ends, so that
+// concurrent saves can't both read the same MAX(version). The table's oid keeps problem and test ids
+// apart in the advisory lock space.
+func lockVersions(ctx context.Context, tx *sql.Tx, table string, id int) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1::regclass::oid::integer, $2)`, table, id)
+	return err
+}
+
+// Exists reports whether any version has been recorded for the problem.
+func (r *ProblemVersionRepo) Exists(ctx context.Context, problemID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM cms_problem_version WHERE problem_id = $1)`, problemID).Scan(&exists)
+	return exists, err
+}
+
+// Latest returns the newest version saved through the CMS, without its snapshot, or nil when
+// there is none. Baselines are skipped: they record what db-service already held, not a save.
+func (r *ProblemVersionRepo) Latest(ctx context.Context, problemID int) (*models.ProblemVersion, error) {
+	var v models.ProblemVersion
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, problem_id, version, action, note, actor_user_id, actor_email, created_at
+		 FROM cms_problem_version WHERE problem_id = $1 AND action <> $2
+		 ORDER BY version DESC LIMIT 1`, problemID, VersionActionBaseline).
+		Scan(&v.ID, &v.ProblemID, &v.Version, &v.Action, &v.Note, &v.ActorUserID, &v.ActorEmail, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// List returns a problem's versions newest first, without snapshots.
+func (r *ProblemVersionRepo) List(ctx context.Context, problemID int) ([]models.ProblemVersion, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, problem_id, version, action, note, actor_user_id, actor_email, created_at
+		 FROM cms_problem_version WHERE problem_id = $1 ORDER BY version DESC`, problemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.ProblemVersion
+	for rows.Next() {
+		var v models.ProblemVersion
+		if err := rows.Scan(&v.ID, &v.ProblemID, &v.Version, &v.Action, &v.Note, &v.ActorUserID,
+			&v.ActorEmail, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// Get returns one version including its snapshot, or ErrVersionNotFound.
+func (r *ProblemVersionRepo) Get(ctx context.Context, problemID, version int) (*models.ProblemVersion, error) {
+	var v models.ProblemVersion
+	var snapshot []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, problem_id, version, action, note, actor_user_id, actor_email, created_at, snapshot
+		 FROM cms_problem_version WHERE problem_id = $1 AND version = $2`, problemID, version).
+		Scan(&v.ID, &v.ProblemID, &v.Version, &v.Action, &v.Note, &v.ActorUserID, &v.ActorEmail,
+			&v.CreatedAt, &snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Snapshot = snapshot
+	return &v, nil
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type ReviewCommentRepo struct {
+	db *sql.DB
+}
+
+func NewReviewCommentRepo(db *sql.DB) *ReviewCommentRepo {
+	return &ReviewCommentRepo{db: db}
+}
+
+// Insert appends c and returns its id.
+func (r *ReviewCommentRepo) Insert(ctx context.Context, c *models.ReviewComment) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO cms_review_comment (entity_type, entity_id, action, from_status, to_status, body,
+			actor_user_id, actor_email)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		c.EntityType, c.EntityID, c.Action, c.FromStatus, c.ToStatus, c.Body, c.ActorUserID, c.ActorEmail).Scan(&id)
+	return id, err
+}
+
+// List returns the comments on one test or problem, oldest first.
+func (r *ReviewCommentRepo) List(ctx context.Context, entityType string, entityID int) ([]models.ReviewComment, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, entity_type, entity_id, action, from_status, to_status, body, actor_user_id, actor_email, created_at
+		 FROM cms_review_comment WHERE entity_type = $1 AND entity_id = $2 ORDER BY created_at, id`,
+		entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.ReviewComment
+	for rows.Next() {
+		var c models.ReviewComment
+		if err := rows.Scan(&c.ID, &c.EntityType, &c.EntityID, &c.Action, &c.FromStatus, &c.ToStatus, &c.Body,
+			&c.ActorUserID, &c.ActorEmail, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// schema holds the DDL for the tables the CMS owns itself. cms_user_permission is created
+// by the db-service migration and is not listed here. Every statement must be idempotent
+// (IF NOT EXISTS, OR REPLACE, DROP ... IF EXISTS) because EnsureSchema runs on each startup.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS cms_problem_fingerprint (
+		problem_id  INTEGER PRIMARY KEY,
+		code        TEXT NOT NULL DEFAULT '',
+		subject_id  SMALLINT NOT NULL,
+		signature   BIGINT[] NOT NULL,
+		updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_problem_fingerprint_subject_idx ON cms_problem_fingerprint (subject_id)`,
+	`CREATE TABLE IF NOT EXISTS cms_problem_version (
+		id             BIGSERIAL PRIMARY KEY,
+		problem_id     INTEGER NOT NULL,
+		version        INTEGER NOT NULL,
+		action         TEXT NOT NULL,
+		note           TEXT NOT NULL DEFAULT '',
+		actor_user_id  BIGINT,
+		actor_email    TEXT NOT NULL DEFAULT '',
+		snapshot       JSONB NOT NULL,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (problem_id, version)
+	)`,
+	`CREATE TABLE IF NOT EXISTS cms_test_version (
+		id             BIGSERIAL PRIMARY KEY,
+		test_id        INTEGER NOT NULL,
+		version        INTEGER NOT NULL,
+		action         TEXT NOT NULL,
+		note           TEXT NOT NULL DEFAULT '',
+		actor_user_id  BIGINT,
+		actor_email    TEXT NOT NULL DEFAULT '',
+		snapshot       JSONB NOT NULL,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (test_id, version)
+	)`,
+	`CREATE TABLE IF NOT EXISTS cms_test_delivery (
+		test_id           INTEGER PRIMARY KEY,
+		first_fetched_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_fetched_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		fetch_count       INTEGER NOT NULL DEFAULT 1
+	)`,
+	`CREATE TABLE IF NOT EXISTS cms_review_comment (
+		id             BIGSERIAL PRIMARY KEY,
+		entity_type    TEXT NOT NULL,
+		entity_id      INTEGER NOT NULL,
+		action         TEXT NOT NULL DEFAULT '',
+		from_status    SMALLINT,
+		to_status      SMALLINT,
+		body           TEXT NOT NULL DEFAULT '',
+		actor_user_id  BIGINT,
+		actor_email    TEXT NOT NULL DEFAULT '',
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_review_comment_entity_idx ON cms_review_comment (entity_type, entity_id)`,
+	`CREATE TABLE IF NOT EXISTS cms_comment_thread (
+		id                  BIGSERIAL PRIMARY KEY,
+		problem_id          INTEGER NOT NULL,
+		field               TEXT NOT NULL,
+		field_index         INTEGER,
+		lang_code           TEXT NOT NULL DEFAULT '',
+		status              TEXT NOT NULL DEFAULT 'open',
+		created_by_user_id  BIGINT,
+		created_by_email    TEXT NOT NULL DEFAULT '',
+		created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		resolved_at         TIMESTAMPTZ,
+		resolved_by_email   TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_comment_thread_problem_idx ON cms_comment_thread (problem_id)`,
+	`CREATE TABLE IF NOT EXISTS cms_comment (
+		id              BIGSERIAL PRIMARY KEY,
+		thread_id       BIGINT NOT NULL REFERENCES cms_comment_thread (id),
+		body            TEXT NOT NULL,
+		author_user_id  BIGINT,
+		author_email    TEXT NOT NULL DEFAULT '',
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_comment_thread_idx ON cms_comment (thread_id)`,
+	`CREATE TABLE IF NOT EXISTS cms_audit_log (
+		id             BIGSERIAL PRIMARY KEY,
+		occurred_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		request_id     TEXT NOT NULL DEFAULT '',
+		actor_user_id  BIGINT,
+		actor_email    TEXT NOT NULL DEFAULT '',
+		action         TEXT NOT NULL,
+		entity_type    TEXT NOT NULL,
+		entity_id      TEXT NOT NULL DEFAULT '',
+		method         TEXT NOT NULL,
+		path           TEXT NOT NULL,
+		status         INTEGER NOT NULL,
+		before         JSONB,
+		after          JSONB
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_audit_log_occurred_idx ON cms_audit_log (occurred_at DESC)`,
+	`CREATE INDEX IF NOT EXISTS cms_audit_log_entity_idx ON cms_audit_log (entity_type, entity_id)`,
+	// The audit log is append-only: reject UPDATE and DELETE at the database, not just in the repo.
+	`CREATE OR REPLACE FUNCTION cms_audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'cms_audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS cms_audit_log_append_only ON cms_audit_log`,
+	`CREATE TRIGGER cms_audit_log_append_only BEFORE UPDATE OR DELETE ON cms_audit_log
+		FOR EACH ROW EXECUTE FUNCTION cms_audit_log_append_only()`,
+	`CREATE TABLE IF NOT EXISTS cms_edit_lock (
+		entity_type   TEXT NOT NULL,
+		entity_id     INTEGER NOT NULL,
+		user_id       BIGINT NOT NULL,
+		email         TEXT NOT NULL DEFAULT '',
+		opened_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		heartbeat_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (entity_type, entity_id, user_id)
+	)`,
+	// Scoped roles on top of cms_user_permission.role; a NULL scope column means "any".
+	`CREATE TABLE IF NOT EXISTS cms_user_grant (
+		id             BIGSERIAL PRIMARY KEY,
+		user_id        BIGINT NOT NULL,
+		curriculum_id  SMALLINT,
+		grade_id       SMALLINT,
+		subject_id     SMALLINT,
+		role           TEXT NOT NULL,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		created_by     TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS cms_user_grant_scope_idx ON cms_user_grant
+		(user_id, COALESCE(curriculum_id, 0), COALESCE(grade_id, 0), COALESCE(subject_id, 0))`,
+	`CREATE TABLE IF NOT EXISTS cms_service_client (
+		id            BIGSERIAL PRIMARY KEY,
+		name          TEXT NOT NULL UNIQUE,
+		scopes        TEXT[] NOT NULL DEFAULT '{}',
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		created_by    TEXT NOT NULL DEFAULT '',
+		revoked_at    TIMESTAMPTZ,
+		last_used_at  TIMESTAMPTZ
+	)`,
+	// Service tokens are stored as SHA-256 hashes; prefix is the first characters, for display.
+	`CREATE TABLE IF NOT EXISTS cms_service_token (
+		id            BIGSERIAL PRIMARY KEY,
+		client_id     BIGINT NOT NULL REFERENCES cms_service_client (id),
+		token_hash    TEXT NOT NULL UNIQUE,
+		prefix        TEXT NOT NULL DEFAULT '',
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		created_by    TEXT NOT NULL DEFAULT '',
+		expires_at    TIMESTAMPTZ,
+		revoked_at    TIMESTAMPTZ,
+		last_used_at  TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_service_token_client_idx ON cms_service_token (client_id)`,
+	// One row per session cookie, keyed by its jti.
+	`CREATE TABLE IF NOT EXISTS cms_session (
+		id            TEXT PRIMARY KEY,
+		user_id       BIGINT NOT NULL,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		expires_at    TIMESTAMPTZ NOT NULL,
+		last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		user_agent    TEXT NOT NULL DEFAULT '',
+		ip            TEXT NOT NULL DEFAULT '',
+		revoked_at    TIMESTAMPTZ,
+		revoked_by    TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_session_user_idx ON cms_session (user_id)`,
+	// One invitation per user added by an admin; accepted_at is set on their first sign-in.
+	`CREATE TABLE IF NOT EXISTS cms_user_invitation (
+		id           BIGSERIAL PRIMARY KEY,
+		user_id      BIGINT NOT NULL UNIQUE,
+		email        TEXT NOT NULL,
+		source       TEXT NOT NULL DEFAULT 'manual',
+		invited_by   TEXT NOT NULL DEFAULT '',
+		invited_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		accepted_at  TIMESTAMPTZ
+	)`,
+	// Personal access tokens, stored as SHA-256 hashes like service tokens.
+	`CREATE TABLE IF NOT EXISTS cms_personal_token (
+		id            BIGSERIAL PRIMARY KEY,
+		user_id       BIGINT NOT NULL,
+		name          TEXT NOT NULL,
+		token_hash    TEXT NOT NULL UNIQUE,
+		prefix        TEXT NOT NULL,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		expires_at    TIMESTAMPTZ NOT NULL,
+		revoked_at    TIMESTAMPTZ,
+		last_used_at  TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_personal_token_user_idx ON cms_personal_token (user_id)`,
+	// One row per request made with a personal token.
+	`CREATE TABLE IF NOT EXISTS cms_personal_token_use (
+		id        BIGSERIAL PRIMARY KEY,
+		token_id  BIGINT NOT NULL REFERENCES cms_personal_token (id),
+		user_id   BIGINT NOT NULL,
+		used_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		method    TEXT NOT NULL,
+		path      TEXT NOT NULL,
+		status    INT NOT NULL,
+		ip        TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_personal_token_use_token_idx ON cms_personal_token_use (token_id, used_at DESC)`,
+	// Outbound webhooks: registered endpoints, and one delivery row per event per endpoint that the
+	// webhook worker sends and retries.
+	`CREATE TABLE IF NOT EXISTS cms_webhook_endpoint (
+		id           BIGSERIAL PRIMARY KEY,
+		url          TEXT NOT NULL,
+		description  TEXT NOT NULL DEFAULT '',
+		event_types  TEXT[] NOT NULL,
+		secret       TEXT NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		created_by   TEXT NOT NULL DEFAULT '',
+		disabled_at  TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS cms_webhook_delivery (
+		id               BIGSERIAL PRIMARY KEY,
+		endpoint_id      BIGINT NOT NULL REFERENCES cms_webhook_endpoint (id),
+		event_id         TEXT NOT NULL,
+		event_type       TEXT NOT NULL,
+		payload          JSONB NOT NULL,
+		status           TEXT NOT NULL DEFAULT 'pending',
+		attempts         INT NOT NULL DEFAULT 0,
+		next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_attempt_at  TIMESTAMPTZ,
+		last_status      INT NOT NULL DEFAULT 0,
+		last_error       TEXT NOT NULL DEFAULT '',
+		created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		replay_of        BIGINT REFERENCES cms_webhook_delivery (id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_webhook_delivery_due_idx ON cms_webhook_delivery (next_attempt_at)
+		WHERE status = 'pending'`,
+	`CREATE INDEX IF NOT EXISTS cms_webhook_delivery_endpoint_idx ON cms_webhook_delivery (endpoint_id, created_at DESC)`,
+	// Append-only log of content writes, read by /api/service/v1/changes; id is the feed cursor.
+	`CREATE TABLE IF NOT EXISTS cms_change_log (
+		id           BIGSERIAL PRIMARY KEY,
+		entity_type  TEXT NOT NULL,
+		entity_id    BIGINT NOT NULL,
+		operation    TEXT NOT NULL,
+		changed_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_change_log_entity_idx ON cms_change_log (entity_type, id)`,
+	// Images lifted out of problem HTML for the service API, keyed by the SHA-256 of their bytes and
+	// served at /images/{hash}.
+	`CREATE TABLE IF NOT EXISTS cms_image (
+		hash          TEXT PRIMARY KEY,
+		content_type  TEXT NOT NULL,
+		data          BYTEA NOT NULL,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	// Problem appearances in tests, one row per curriculum/grade pair of the test (see package exposure).
+	// added_at is NULL for appearances backfilled from tests with no delivery or version history.
+	`CREATE TABLE IF NOT EXISTS cms_problem_exposure (
+		test_id        INTEGER NOT NULL,
+		problem_id     INTEGER NOT NULL,
+		curriculum_id  SMALLINT NOT NULL DEFAULT 0,
+		grade_id       SMALLINT NOT NULL DEFAULT 0,
+		test_subtype   TEXT NOT NULL DEFAULT '',
+		added_at       TIMESTAMPTZ,
+		PRIMARY KEY (test_id, problem_id, curriculum_id, grade_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS cms_problem_exposure_problem_idx ON cms_problem_exposure (problem_id)`,
+}
+
+// EnsureSchema creates the CMS-owned tables if they don't exist yet.
+func EnsureSchema(db *sql.DB) error {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("ensure schema: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+var ErrServiceClientNotFound = errors.New("service client not found")
+
+type ServiceClientRepo struct {
+	db *sql.DB
+}
+
+func NewServiceClientRepo(db *sql.DB) *ServiceClientRepo {
+	return &ServiceClientRepo{db: db}
+}
+
+// touchInterval limits last-used writes to one per token per minute.
+const touchInterval = time.Minute
+
+const (
+	serviceClientColumns = `id, name, scopes, created_at, created_by, revoked_at, last_used_at`
+	serviceTokenColumns  = `id, client_id, prefix, created_at, created_by, expires_at, revoked_at, last_used_at`
+)
+
+// List returns every service client with its tokens, newest first.
+func (r *ServiceClientRepo) List(ctx context.Context) ([]*models.ServiceClient, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+serviceClientColumns+` FROM cms_service_client ORDER BY revoked_at NULLS FIRST, created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.ServiceClient
+	byID := make(map[int64]*models.ServiceClient)
+	for rows.Next() {
+		c, err := scanServiceClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+		byID[c.ID] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tokens, err := r.tokens(ctx, `SELECT `+serviceTokenColumns+` FROM cms_service_token ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		if c := byID[t.ClientID]; c != nil {
+			c.Tokens = append(c.Tokens, t)
+		}
+	}
+	return out, nil
+}
+
+// Get returns a service client with its tokens, or ErrServiceClientNotFound.
+func (r *ServiceClientRepo) Get(ctx context.Context, id int64) (*models.ServiceClient, error) {
+	c, err := scanServiceClient(r.db.QueryRowContext(ctx,
+		`SELECT `+serviceClientColumns+` FROM cms_service_client WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrServiceClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Tokens, err = r.tokens(ctx, `SELECT `+serviceTokenColumns+` FROM cms_service_token
+		WHERE client_id = $1 ORDER BY created_at DESC`, id); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Create adds a service client and returns its ID.
+func (r *ServiceClientRepo) Create(ctx context.Context, c *models.ServiceClient) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO cms_service_client (name, scopes, created_by) VALUES ($1, $2, $3) RETURNING id`,
+		c.Name, pq.Array(c.Scopes), c.CreatedBy).Scan(&id)
+	return id, err
+}
+
+// Revoke revokes a client together with all of its tokens.
+func (r *ServiceClientRepo) Revoke(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE cms_service_client SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrServiceClientNotFound
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE cms_service_token SET revoked_at = NOW() WHERE client_id = $1 AND revoked_at IS NULL`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IssueToken stores a new token hash for t.ClientID. With retireAfter set, it is a rotation: the
+// client's other active tokens stop working retireAfter from now (or earlier, if they already
+// expire sooner), so callers can switch over without downtime.
+func (r *ServiceClientRepo) IssueToken(ctx context.Context, t *models.ServiceToken, hash string,
+	retireAfter *time.Duration) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if retireAfter != nil {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE cms_service_token SET expires_at = LEAST(COALESCE(expires_at, $2), $2)
+			 WHERE client_id = $1 AND revoked_at IS NULL`,
+			t.ClientID, time.Now().Add(*retireAfter)); err != nil {
+			return 0, err
+		}
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO cms_service_token (client_id, token_hash, prefix, created_by, expires_at)
+		 SELECT $1, $2, $3, $4, $5 FROM cms_service_client WHERE id = $1 AND revoked_at IS NULL
+		 RETURNING id`,
+		t.ClientID, hash, t.Prefix, t.CreatedBy, t.ExpiresAt).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrServiceClientNotFound
+		}
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// RevokeToken revokes one of a client's tokens.
+func (r *ServiceClientRepo) RevokeToken(ctx context.Context, clientID, tokenID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE cms_service_token SET revoked_at = NOW() WHERE id = $1 AND client_id = $2 AND revoked_at IS NULL`,
+		tokenID, clientID)
+	return err
+}
+
+// Lookup returns the client and token a token hash belongs to, or nils when no token has that
+// hash. It doesn't check revocation or expiry; see ServiceToken.Active.
+func (r *ServiceClientRepo) Lookup(ctx context.Context, hash string) (*models.ServiceClient, *models.ServiceToken, error) {
+	var c models.ServiceClient
+	var t models.ServiceToken
+	err := r.db.QueryRowContext(ctx,
+		`SELECT c.id, c.name, c.scopes, c.revoked_at, t.id, t.prefix, t.expires_at, t.revoked_at
+		 FROM cms_service_token t JOIN cms_service_client c ON c.id = t.client_id
+		 WHERE t.token_hash = $1`, hash).
+		Scan(&c.ID, &c.Name, pq.Array(&c.Scopes), &c.RevokedAt, &t.ID, &t.Prefix, &t.ExpiresAt, &t.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	t.ClientID = c.ID
+	return &c, &t, nil
+}
+
+// Touch records that a token, and so its client, was just used. Writes are throttled to one per
+// token per minute.
+func (r *ServiceClientRepo) Touch(ctx context.Context, tokenID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`WITH t AS (
+			UPDATE cms_service_token SET last_used_at = NOW()
+			WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - $2 * INTERVAL '1 second')
+			RETURNING client_id
+		 )
+		 UPDATE cms_service_client SET last_used_at = NOW() WHERE id IN (SELECT client_id FROM t)`,
+		tokenID, touchInterval.Seconds())
+	return err
+}
+
+func (r *ServiceClientRepo) tokens(ctx context.Context, query string, args ...any) ([]models.ServiceToken, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.ServiceToken
+	for rows.Next() {
+		var t models.ServiceToken
+		if err := rows.Scan(&t.ID, &t.ClientID, &t.Prefix, &t.CreatedAt, &t.CreatedBy, &t.ExpiresAt, &t.RevokedAt,
+			&t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanServiceClient(row rowScanner) (*models.ServiceClient, error) {
+	var c models.ServiceClient
+	if err := row.Scan(&c.ID, &c.Name, pq.Array(&c.Scopes), &c.CreatedAt, &c.CreatedBy, &c.RevokedAt,
+		&c.LastUsedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
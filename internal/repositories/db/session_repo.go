@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type SessionRepo struct {
+	db *sql.DB
+}
+
+func NewSessionRepo(db *sql.DB) *SessionRepo {
+	return &SessionRepo{db: db}
+}
+
+// Create records a new session.
+func (r *SessionRepo) Create(ctx context.Context, s *models.Session) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cms_session (id, user_id, expires_at, user_agent, ip) VALUES ($1, $2, $3, $4, $5)`,
+		s.ID, s.UserID, s.ExpiresAt, s.UserAgent, s.IP)
+	return err
+}
+
+// Check reports whether a session is still live (known, not revoked, not expired, seen within
+// idle, and its user still active) and returns the user's current role from cms_user_permission.
+// A live session's last_seen_at is bumped on the way.
+func (r *SessionRepo) Check(ctx context.Context, id string, idle time.Duration) (role string, ok bool, err error) {
+	err = r.db.QueryRowContext(ctx,
+		`UPDATE cms_session s SET last_seen_at = NOW()
+		 FROM cms_user_permission u
+		 WHERE s.id = $1 AND u.id = s.user_id AND u.is_active
+		   AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		   AND s.last_seen_at > NOW() - make_interval(secs => $2)
+		 RETURNING u.role`, id, idle.Seconds()).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return role, true, nil
+}
+
+// Extend moves a live session's expiry forward when its cookie is renewed.
+func (r *SessionRepo) Extend(ctx context.Context, id string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE cms_session SET expires_at = $2 WHERE id = $1 AND revoked_at IS NULL`, id, expiresAt)
+	return err
+}
+
+// ListActive returns a user's live sessions (not idle for longer than idle), most recently seen first.
+func (r *SessionRepo) ListActive(ctx context.Context, userID int64, idle time.Duration) ([]models.Session, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, user_id, created_at, expires_at, last_seen_at, user_agent, ip FROM cms_session
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		   AND last_seen_at > NOW() - make_interval(secs => $2)
+		 ORDER BY last_seen_at DESC`, userID, idle.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.Session
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.LastSeenAt, &s.UserAgent,
+			&s.IP); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// Revoke ends one of a user's sessions. by is the email of whoever revoked it.
+func (r *SessionRepo) Revoke(ctx context.Context, userID int64, id, by string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE cms_session SET revoked_at = NOW(), revoked_by = $3
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID, by)
+	return err
+}
+
+// RevokeAll ends every live session of a user and returns how many there were.
+func (r *SessionRepo) RevokeAll(ctx context.Context, userID int64, by string) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE cms_session SET revoked_at = NOW(), revoked_by = $2
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()`, userID, by)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
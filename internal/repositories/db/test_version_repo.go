@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type TestVersionRepo struct {
+	db *sql.DB
+}
+
+func NewTestVersionRepo(db *sql.DB) *TestVersionRepo {
+	return &TestVersionRepo{db: db}
+}
+
+// Insert appends the next version for v.TestID and returns its number.
+func (r *TestVersionRepo) Insert(ctx context.Context, v *models.TestVersion) (int, error) {
+	return r.insert(ctx, v, nil)
+}
+
+// InsertIfLatest appends the next version like Insert, but only while the latest CMS-saved version
+// (baselines aside, as in Latest) is still expected; otherwise it returns ErrVersionConflict.
+func (r *TestVersionRepo) InsertIfLatest(ctx context.Context, v *models.TestVersion, expected int) (int, error) {
+	return r.insert(ctx, v, &expected)
+}
+
+func (r *TestVersionRepo) insert(ctx context.Context, v *models.TestVersion, expected *int) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersions(ctx, tx, "cms_test_version", v.TestID); err != nil {
+		return 0, err
+	}
+	var version int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO cms_test_version (test_id, version, action, note, actor_user_id, actor_email, snapshot)
+		 SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6
+		 FROM cms_test_version WHERE test_id = $1
+		 HAVING $7::INTEGER IS NULL OR COALESCE(MAX(version) FILTER (WHERE action <> $8), 0) = $7
+		 RETURNING version`,
+		v.TestID, v.Action, v.Note, v.ActorUserID, v.ActorEmail, []byte(v.Snapshot), expected,
+		VersionActionBaseline).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrVersionConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+// Delete removes one version; a save whose version was claimed before it reached db-service gives
+// the version back when db-service rejects it.
+func (r *TestVersionRepo) Delete(ctx context.Context, testID, version int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM cms_test_version WHERE test_id = $1 AND version = $2`, testID, version)
+	return err
+}
+
+// Exists reports whether any version has been recorded for the test.
+func (r *TestVersionRepo) Exists(ctx context.Context, testID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM cms_test_version WHERE test_id = $1)`, testID).Scan(&exists)
+	return exists, err
+}
+
+// Latest returns the newest version saved through the CMS, without its snapshot, or nil when
+// there is none. Baselines are skipped: they record what db-service already held, not a save.
+func (r *TestVersionRepo) Latest(ctx context.Context, testID int) (*models.TestVersion, error) {
+	var v models.TestVersion
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, test_id, version, action, note, actor_user_id, actor_email, created_at
+		 FROM cms_test_version WHERE test_id = $1 AND action <> $2
+		 ORDER BY version DESC LIMIT 1`, testID, VersionActionBaseline).
+		Scan(&v.ID, &v.TestID, &v.Version, &v.Action, &v.Note, &v.ActorUserID, &v.ActorEmail, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// List returns a test's versions newest first, without snapshots.
+func (r *TestVersionRepo) List(ctx context.Context, testID int) ([]models.TestVersion, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, test_id, version, action, note, actor_user_id, actor_email, created_at
+		 FROM cms_test_version WHERE test_id = $1 ORDER BY version DESC`, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.TestVersion
+	for rows.Next() {
+		var v models.TestVersion
+		if err := rows.Scan(&v.ID, &v.TestID, &v.Version, &v.Action, &v.Note, &v.ActorUserID,
+			&v.ActorEmail, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// Get returns one version including its snapshot, or ErrVersionNotFound.
+func (r *TestVersionRepo) Get(ctx context.Context, testID, version int) (*models.TestVersion, error) {
+	var v models.TestVersion
+	var snapshot []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, test_id, version, action, note, actor_user_id, actor_email, created_at, snapshot
+		 FROM cms_test_version WHERE test_id = $1 AND version = $2`, testID, version).
+		Scan(&v.ID, &v.TestID, &v.Version, &v.Action, &v.Note, &v.ActorUserID, &v.ActorEmail,
+			&v.CreatedAt, &snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Snapshot = snapshot
+	return &v, nil
+}
+
+// RecordDelivery notes that a test was fetched through the service API.
+func (r *TestVersionRepo) RecordDelivery(ctx context.Context, testID int) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cms_test_delivery (test_id) VALUES ($1)
+		 ON CONFLICT (test_id) DO UPDATE
+		 SET last_fetched_at = NOW(), fetch_count = cms_test_delivery.fetch_count + 1`, testID)
+	return err
+}
+
+// GetDelivery returns the delivery record of a test, or nil if it was never fetched.
+func (r *TestVersionRepo) GetDelivery(ctx context.Context, testID int) (*models.TestDelivery, error) {
+	var d models.TestDelivery
+	err := r.db.QueryRowContext(ctx,
+		`SELECT test_id, first_fetched_at, last_fetched_at, fetch_count FROM cms_test_delivery WHERE test_id = $1`,
+		testID).Scan(&d.TestID, &d.FirstFetchedAt, &d.LastFetchedAt, &d.FetchCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
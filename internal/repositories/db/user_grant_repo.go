@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type UserGrantRepo struct {
+	db *sql.DB
+}
+
+func NewUserGrantRepo(db *sql.DB) *UserGrantRepo {
+	return &UserGrantRepo{db: db}
+}
+
+const grantColumns = `id, user_id, curriculum_id, grade_id, subject_id, role, created_at, created_by`
+
+// ListByUser returns a user's scoped grants, broadest first.
+func (r *UserGrantRepo) ListByUser(ctx context.Context, userID int64) ([]models.UserGrant, error) {
+	return r.list(ctx, `SELECT `+grantColumns+` FROM cms_user_grant WHERE user_id = $1
+		ORDER BY curriculum_id NULLS FIRST, grade_id NULLS FIRST, subject_id NULLS FIRST`, userID)
+}
+
+// Upsert grants g.Role on g's scope, replacing the role of an existing grant on the same scope.
+func (r *UserGrantRepo) Upsert(ctx context.Context, g *models.UserGrant) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO cms_user_grant (user_id, curriculum_id, grade_id, subject_id, role, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (user_id, COALESCE(curriculum_id, 0), COALESCE(grade_id, 0), COALESCE(subject_id, 0))
+		 DO UPDATE SET role = EXCLUDED.role, created_at = NOW(), created_by = EXCLUDED.created_by
+		 RETURNING id`,
+		g.UserID, g.CurriculumID, g.GradeID, g.SubjectID, g.Role, g.CreatedBy).Scan(&id)
+	return id, err
+}
+
+// Delete removes one of a user's grants.
+func (r *UserGrantRepo) Delete(ctx context.Context, userID, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM cms_user_grant WHERE id = $1 AND user_id = $2`, id, userID)
+	return err
+}
+
+func (r *UserGrantRepo) list(ctx context.Context, query string, args ...any) ([]models.UserGrant, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.UserGrant
+	for rows.Next() {
+		var g models.UserGrant
+		if err := rows.Scan(&g.ID, &g.UserID, &g.CurriculumID, &g.GradeID, &g.SubjectID, &g.Role, &g.CreatedAt,
+			&g.CreatedBy); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+var (
+	ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// WebhookRepo stores webhook endpoints and their delivery queue (see package webhook).
+type WebhookRepo struct {
+	db *sql.DB
+}
+
+func NewWebhookRepo(db *sql.DB) *WebhookRepo {
+	return &WebhookRepo{db: db}
+}
+
+const (
+	webhookEndpointColumns = `id, url, description, event_types, created_at, created_by, disabled_at`
+	webhookDeliveryColumns = `d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+		d.next_attempt_at, d.last_attempt_at, d.last_status, d.last_error, d.created_at, d.replay_of`
+)
+
+// ListEndpoints returns every endpoint, active ones first, newest first.
+func (r *WebhookRepo) ListEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookEndpointColumns+` FROM cms_webhook_endpoint
+		ORDER BY disabled_at NULLS FIRST, created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.WebhookEndpoint
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// GetEndpoint returns an endpoint, or ErrWebhookEndpointNotFound.
+func (r *WebhookRepo) GetEndpoint(ctx context.Context, id int64) (*models.WebhookEndpoint, error) {
+	e, err := scanWebhookEndpoint(r.db.QueryRowContext(ctx,
+		`SELECT `+webhookEndpointColumns+` FROM cms_webhook_endpoint WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookEndpointNotFound
+	}
+	return e, err
+}
+
+// CreateEndpoint adds an endpoint with its signing secret and returns its ID.
+func (r *WebhookRepo) CreateEndpoint(ctx context.Context, e *models.WebhookEndpoint) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `INSERT INTO cms_webhook_endpoint (url, description, event_types, secret, created_by)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		e.URL, e.Description, pq.Array(e.EventTypes), e.Secret, e.CreatedBy).Scan(&id)
+	return id, err
+}
+
+// DisableEndpoint stops deliveries to an endpoint, failing the ones still queued for it.
+func (r *WebhookRepo) DisableEndpoint(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE cms_webhook_endpoint SET disabled_at = NOW() WHERE id = $1 AND disabled_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE cms_webhook_delivery SET status = $2, last_error = 'endpoint disabled'
+		WHERE endpoint_id = $1 AND status = $3`, id, models.DeliveryFailed, models.DeliveryPending); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Enqueue adds a delivery of the event for every active endpoint subscribed to eventType.
+func (r *WebhookRepo) Enqueue(ctx context.Context, eventID, eventType string, payload []byte) (int, error) {
+	res, err := r.db.ExecContext(ctx, `INSERT INTO cms_webhook_delivery (endpoint_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3 FROM cms_webhook_endpoint WHERE disabled_at IS NULL AND $2 = ANY (event_types)`,
+		eventID, eventType, payload)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// ClaimDue returns up to limit due pending deliveries with their endpoint's URL and secret, and moves
+// their next attempt lease ahead so no other worker claims them meanwhile.
+func (r *WebhookRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `UPDATE cms_webhook_delivery d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM cms_webhook_endpoint e
+		WHERE e.id = d.endpoint_id AND d.id IN (
+			SELECT id FROM cms_webhook_delivery WHERE status = $3 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns+`, e.url, e.secret`, limit, lease.Seconds(), models.DeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// RecordAttempt saves the delivery's state after an attempt (see webhook.Worker).
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, d *models.WebhookDelivery, a models.WebhookAttempt) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE cms_webhook_delivery SET status = $2, attempts = $3, next_attempt_at = $4,
+		last_attempt_at = $5, last_status = $6, last_error = $7 WHERE id = $1`,
+		d.ID, d.Status, d.Attempts, d.NextAttemptAt, a.At, a.Status, a.Error)
+	return err
+}
+
+// ListDeliveries returns an endpoint's latest deliveries, newest first.
+func (r *WebhookRepo) ListDeliveries(ctx context.Context, endpointID int64, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookDeliveryColumns+` FROM cms_webhook_delivery d
+		WHERE d.endpoint_id = $1 ORDER BY d.created_at DESC, d.id DESC LIMIT $2`, endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// Replay queues a new delivery of the same event to the same endpoint, due now, and returns its ID.
+// Deliveries of disabled endpoints can't be replayed.
+func (r *WebhookRepo) Replay(ctx context.Context, id int64) (int64, error) {
+	var newID int64
+	err := r.db.QueryRowContext(ctx, `INSERT INTO cms_webhook_delivery (endpoint_id, event_id, event_type, payload, replay_of)
+		SELECT d.endpoint_id, d.event_id, d.event_type, d.payload, d.id
+		FROM cms_webhook_delivery d JOIN cms_webhook_endpoint e ON e.id = d.endpoint_id
+		WHERE d.id = $1 AND e.disabled_at IS NULL
+		RETURNING id`, id).Scan(&newID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrWebhookDeliveryNotFound
+	}
+	return newID, err
+}
+
+func scanWebhookEndpoint(row rowScanner) (*models.WebhookEndpoint, error) {
+	var e models.WebhookEndpoint
+	if err := row.Scan(&e.ID, &e.URL, &e.Description, pq.Array(&e.EventTypes), &e.CreatedAt, &e.CreatedBy,
+		&e.DisabledAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func scanWebhookDelivery(row rowScanner, withEndpoint bool) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	dest := []any{&d.ID, &d.EndpointID, &d.EventID, &d.EventType, (*[]byte)(&d.Payload), &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastAttemptAt, &d.LastStatus, &d.LastError, &d.CreatedAt, &d.ReplayOf}
+	if withEndpoint {
+		dest = append(dest, &d.URL, &d.Secret)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
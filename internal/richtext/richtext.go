@@ -0,0 +1,203 @@
+// Package richtext converts the rich-text HTML fragments problems and tests are written in (question,
+// options, solutions, paragraphs, instructions) for service callers that can't or shouldn't take raw
+// HTML: plain text, Markdown, and HTML whose inline base64 images are swapped for URLs.
+//
+// TeX is left verbatim, delimiters included, in every mode: callers typeset it themselves.
+package richtext
+
+import (
+	"encoding/base64"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Mode is an output format of Render.
+type Mode string
+
+const (
+	HTML     Mode = "html"
+	Text     Mode = "text"
+	Markdown Mode = "markdown"
+)
+
+// ParseMode reads a render query param; empty means HTML.
+func ParseMode(s string) (Mode, bool) {
+	switch m := Mode(s); m {
+	case "":
+		return HTML, true
+	case HTML, Text, Markdown:
+		return m, true
+	}
+	return "", false
+}
+
+var (
+	// tokenRe splits HTML into tags and the text between them.
+	tokenRe  = regexp.MustCompile(`<[^>]*>|[^<]+`)
+	tagRe    = regexp.MustCompile(`^<\s*(/?)\s*([a-zA-Z0-9]+)`)
+	srcRe    = regexp.MustCompile(`(?i)\bsrc\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	altRe    = regexp.MustCompile(`(?i)\balt\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	blankRe  = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+	spacesRe = regexp.MustCompile(`[ \t\r\f\v\x{00a0}]+`)
+)
+
+// Render converts an HTML fragment to mode. HTML returns it unchanged.
+func Render(fragment string, mode Mode) string {
+	switch mode {
+	case Text:
+		return render(fragment, false)
+	case Markdown:
+		return render(fragment, true)
+	}
+	return fragment
+}
+
+// render walks the fragment's tags. Text keeps only line structure; Markdown also keeps emphasis,
+// lists, images and line breaks. Sub- and superscripts stay HTML in Markdown, which allows inline HTML.
+func render(fragment string, markdown bool) string {
+	var b strings.Builder
+	var lists []string // "ul" or "ol", innermost last
+	for _, token := range tokenRe.FindAllString(fragment, -1) {
+		if token[0] != '<' {
+			b.WriteString(spacesRe.ReplaceAllString(html.UnescapeString(token), " "))
+			continue
+		}
+		m := tagRe.FindStringSubmatch(token)
+		if m == nil {
+			continue // comment, doctype or a stray "<"
+		}
+		closing, name := m[1] == "/", strings.ToLower(m[2])
+		switch name {
+		case "br":
+			if markdown {
+				b.WriteString("  ")
+			}
+			b.WriteString("\n")
+		case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "blockquote":
+			b.WriteString("\n\n")
+		case "tr":
+			newline(&b)
+		case "td", "th":
+			if !closing {
+				b.WriteString(" ")
+			}
+		case "ul", "ol":
+			if closing {
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			} else {
+				lists = append(lists, name)
+			}
+			newline(&b)
+		case "li":
+			if closing {
+				continue
+			}
+			newline(&b)
+			if markdown {
+				// indent survives tidy's trimming as NUL, turned back into spaces at the end
+				b.WriteString(strings.Repeat("\x00\x00", max(len(lists)-1, 0)))
+				if len(lists) > 0 && lists[len(lists)-1] == "ol" {
+					b.WriteString("1. ")
+				} else {
+					b.WriteString("- ")
+				}
+			}
+		case "strong", "b":
+			if markdown {
+				b.WriteString("**")
+			}
+		case "em", "i":
+			if markdown {
+				b.WriteString("*")
+			}
+		case "sub", "sup":
+			if markdown {
+				b.WriteString("<" + m[1] + name + ">")
+			}
+		case "img":
+			b.WriteString(image(token, markdown))
+		}
+	}
+	return strings.ReplaceAll(tidy(b.String()), "\x00", " ")
+}
+
+// newline ends the current line unless it is already ended.
+func newline(b *strings.Builder) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		b.WriteString("\n")
+	}
+}
+
+// image renders an <img>: a Markdown image, or "[image]" in text. Inline data URIs aren't repeated
+// in text, where they would only be noise.
+func image(tag string, markdown bool) string {
+	src, alt := attr(srcRe, tag), attr(altRe, tag)
+	if markdown {
+		return "![" + alt + "](" + src + ")"
+	}
+	if src == "" || strings.HasPrefix(src, "data:") {
+		return "[image]"
+	}
+	return "[image: " + src + "]"
+}
+
+func attr(re *regexp.Regexp, tag string) string {
+	m := re.FindStringSubmatch(tag)
+	if m == nil {
+		return ""
+	}
+	return html.UnescapeString(m[1] + m[2])
+}
+
+// tidy trims each line and collapses runs of blank lines into one.
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		// Markdown's hard line break is two trailing spaces; keep it
+		hard := strings.HasSuffix(line, "  ") && i < len(lines)-1 && strings.TrimSpace(line) != ""
+		lines[i] = strings.TrimSpace(line)
+		if hard {
+			lines[i] += "  "
+		}
+	}
+	s = blankRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.Trim(s, "\n")
+}
+
+// imgDataRe matches an <img> whose src is a base64 data URI, capturing the tag up to the URI, the
+// media type, the data and the closing quote.
+var imgDataRe = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*["'])data:(image/(?:png|jpeg|jpg|gif|webp));base64,([^"']*)(["'])`)
+
+// ExtractImages replaces the base64 images inlined in fragment with the URLs save returns for them.
+// Only raster images are extracted; SVG stays inline, since it could carry script once served from
+// the CMS origin. Images that don't decode are left as they are.
+func ExtractImages(fragment string, save func(contentType string, data []byte) (string, error)) (string, error) {
+	var saveErr error
+	out := imgDataRe.ReplaceAllStringFunc(fragment, func(match string) string {
+		if saveErr != nil {
+			return match
+		}
+		m := imgDataRe.FindStringSubmatch(match)
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(m[3]), ""))
+		if err != nil || len(data) == 0 {
+			return match
+		}
+		contentType := strings.ToLower(m[2])
+		if contentType == "image/jpg" {
+			contentType = "image/jpeg"
+		}
+		url, err := save(contentType, data)
+		if err != nil {
+			saveErr = err
+			return match
+		}
+		return m[1] + html.EscapeString(url) + m[4]
+	})
+	if saveErr != nil {
+		return fragment, saveErr
+	}
+	return out, nil
+}
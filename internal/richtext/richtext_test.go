@@ -0,0 +1,98 @@
+package richtext
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		mode Mode
+		want string
+	}{
+		{"html is untouched", `<p>A <b>ball</b></p>`, HTML, `<p>A <b>ball</b></p>`},
+		{"text strips tags", `<p>A <b>ball</b> is thrown.</p><p>Find &lt;v&gt;.</p>`, Text,
+			"A ball is thrown.\n\nFind <v>."},
+		{"markdown emphasis", `<p>A <strong>ball</strong> and <em>air</em></p>`, Markdown, "A **ball** and *air*"},
+		{"tex stays verbatim", `<p>Solve \(x^2 = 4\)</p>`, Text, `Solve \(x^2 = 4\)`},
+		{"markdown keeps sub and sup", `H<sub>2</sub>O`, Markdown, "H<sub>2</sub>O"},
+		{"text drops sub and sup", `H<sub>2</sub>O`, Text, "H2O"},
+		{"br", `one<br>two`, Text, "one\ntwo"},
+		{"markdown hard break", `one<br/>two`, Markdown, "one  \ntwo"},
+		{"lists", `<ul><li>a</li><li>b<ol><li>c</li></ol></li></ul>`, Markdown, "- a\n- b\n  1. c"},
+		{"text lists", `<ul><li>a</li><li>b</li></ul>`, Text, "a\nb"},
+		{"markdown image", `<img alt="graph" src="/images/ab">`, Markdown, "![graph](/images/ab)"},
+		{"text image url", `See <img src="/images/ab">`, Text, "See [image: /images/ab]"},
+		{"text inline image", `<img src="data:image/png;base64,AAAA">`, Text, "[image]"},
+		{"nbsp and blank runs", `<p>a&nbsp;&nbsp;b</p><p></p><div></div><p>c</p>`, Text, "a b\n\nc"},
+		{"table", `<table><tr><td>1</td><td>2</td></tr></table>`, Text, "1 2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Render(tc.in, tc.mode); got != tc.want {
+				t.Errorf("Render = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": HTML, "html": HTML, "text": Text, "markdown": Markdown} {
+		if got, ok := ParseMode(in); !ok || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v", in, got, ok)
+		}
+	}
+	if _, ok := ParseMode("pdf"); ok {
+		t.Error("ParseMode(pdf) ok, want false")
+	}
+}
+
+func TestExtractImages(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("png-bytes"))
+	var saved []string
+	save := func(contentType string, data []byte) (string, error) {
+		saved = append(saved, contentType+":"+string(data))
+		return "https://cms.example.org/images/h" + string(rune('0'+len(saved))), nil
+	}
+
+	tests := []struct {
+		name      string
+		in        string
+		want      string
+		wantSaved []string
+	}{
+		{"png", `<p><img class="w" src="data:image/png;base64,` + png + `" alt="x"></p>`,
+			`<p><img class="w" src="https://cms.example.org/images/h1" alt="x"></p>`, []string{"image/png:png-bytes"}},
+		{"jpg is jpeg, single quotes", `<img src='data:image/jpg;base64,` + png + `'>`,
+			`<img src='https://cms.example.org/images/h1'>`, []string{"image/jpeg:png-bytes"}},
+		{"svg stays inline", `<img src="data:image/svg+xml;base64,` + png + `">`,
+			`<img src="data:image/svg+xml;base64,` + png + `">`, nil},
+		{"bad base64 stays inline", `<img src="data:image/png;base64,@@@">`, `<img src="data:image/png;base64,@@@">`, nil},
+		{"plain url untouched", `<img src="/a.png">`, `<img src="/a.png">`, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			saved = nil
+			got, err := ExtractImages(tc.in, save)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("ExtractImages = %q, want %q", got, tc.want)
+			}
+			if strings.Join(saved, ",") != strings.Join(tc.wantSaved, ",") {
+				t.Errorf("saved %v, want %v", saved, tc.wantSaved)
+			}
+		})
+	}
+
+	in := `<img src="data:image/png;base64,` + png + `">`
+	got, err := ExtractImages(in, func(string, []byte) (string, error) { return "", errors.New("db down") })
+	if err == nil || got != in {
+		t.Errorf("on save error got %q, %v; want the input and an error", got, err)
+	}
+}
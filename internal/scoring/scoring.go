@@ -0,0 +1,195 @@
+// Package scoring marks a student's responses to a test with the test's marking scheme, as resolved by
+// package grading.
+//
+// A right answer earns the problem's full marks and a wrong one loses the largest of its NegMarks; an
+// unanswered problem scores 0. An mcq_multiple_answer response that picks some of the right options
+// and no wrong one earns partial marks: the other PosMarks, smallest first, are the marks for picking 1,
+// 2, ... right options. With PosMarks [4, 3, 2, 1] and four right options, picking three earns 3; with
+// PosMarks [4] it earns nothing. In an optional block only the student's best MandatoryCount attempts
+// count.
+package scoring
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Problem outcomes.
+const (
+	Unanswered = "unanswered"
+	Correct    = "correct"
+	Partial    = "partial"
+	Wrong      = "wrong"
+	// Ungraded problems were answered but have no answer a machine can check (see grading.None).
+	Ungraded = "ungraded"
+)
+
+// Response is a student's answer to one problem: the zero-based indices of the options picked, or the
+// value entered for integer and numerical problems. A response with neither is unanswered.
+type Response struct {
+	Options []int
+	Value   string
+}
+
+func (r Response) answered() bool {
+	return len(r.Options) > 0 || strings.TrimSpace(r.Value) != ""
+}
+
+type Result struct {
+	TestID   int
+	Marks    int
+	MaxMarks int
+	Subjects []SubjectResult
+}
+
+type SubjectResult struct {
+	SubjectID int
+	Marks     int
+	MaxMarks  int
+	Sections  []SectionResult
+}
+
+type SectionResult struct {
+	Type     string
+	Name     string
+	Marks    int
+	MaxMarks int
+	// Problems are the compulsory problems, then the optional ones.
+	Problems []ProblemResult
+}
+
+type ProblemResult struct {
+	ID       int
+	Optional bool
+	Status   string
+	Marks    int
+	// Counted is false for an optional problem outside the student's best MandatoryCount attempts; its
+	// Marks are left out of the section's.
+	Counted bool
+}
+
+// Score marks responses, keyed by problem ID, against test and its problems.
+func Score(test *models.Test, problems []*models.Problem, responses map[int]Response) Result {
+	return ScoreKey(grading.NewKey(test, problems), responses)
+}
+
+// ScoreKey marks responses against an answer key.
+func ScoreKey(key grading.Key, responses map[int]Response) Result {
+	result := Result{TestID: key.TestID, MaxMarks: key.Marks, Subjects: make([]SubjectResult, 0, len(key.Subjects))}
+	for _, s := range key.Subjects {
+		subject := SubjectResult{SubjectID: s.SubjectID, Sections: make([]SectionResult, 0, len(s.Sections))}
+		for _, sec := range s.Sections {
+			section := scoreSection(sec, responses)
+			subject.Marks += section.Marks
+			subject.MaxMarks += section.MaxMarks
+			subject.Sections = append(subject.Sections, section)
+		}
+		result.Marks += subject.Marks
+		result.Subjects = append(result.Subjects, subject)
+	}
+	return result
+}
+
+func scoreSection(sec grading.Section, responses map[int]Response) SectionResult {
+	section := SectionResult{Type: sec.Type, Name: sec.Name, MaxMarks: sec.MaxMarks(),
+		Problems: make([]ProblemResult, 0, len(sec.Compulsory))}
+	for _, p := range sec.Compulsory {
+		r := scoreProblem(p, responses[p.ID])
+		section.Marks += r.Marks
+		section.Problems = append(section.Problems, r)
+	}
+	if sec.Optional == nil {
+		return section
+	}
+
+	optional := make([]ProblemResult, 0, len(sec.Optional.Problems))
+	var attempted []int // indices into optional
+	for _, p := range sec.Optional.Problems {
+		r := scoreProblem(p, responses[p.ID])
+		r.Optional = true
+		if r.Status != Unanswered {
+			attempted = append(attempted, len(optional))
+		}
+		optional = append(optional, r)
+	}
+	// best marks first; ties go to the problem that comes first in the test
+	slices.SortStableFunc(attempted, func(a, b int) int { return cmp.Compare(optional[b].Marks, optional[a].Marks) })
+	for rank, i := range attempted {
+		if rank >= sec.Optional.MandatoryCount {
+			optional[i].Counted = false
+			continue
+		}
+		section.Marks += optional[i].Marks
+	}
+	section.Problems = append(section.Problems, optional...)
+	return section
+}
+
+func scoreProblem(p grading.Problem, r Response) ProblemResult {
+	result := ProblemResult{ID: p.ID, Counted: true, Status: Unanswered}
+	if !r.answered() {
+		return result
+	}
+	switch p.Answer.Kind {
+	case grading.Choice:
+		result.Status = choiceStatus(p, r.Options)
+	case grading.Numeric:
+		result.Status = Wrong
+		if v, err := strconv.ParseFloat(strings.TrimSpace(r.Value), 64); err == nil &&
+			v >= p.Answer.Min-p.Answer.Tolerance && v <= p.Answer.Max+p.Answer.Tolerance {
+			result.Status = Correct
+		}
+	default:
+		result.Status = Ungraded
+	}
+
+	switch result.Status {
+	case Correct:
+		result.Marks = p.FullMarks
+	case Partial:
+		result.Marks = partialMarks(p, len(r.Options))
+	case Wrong:
+		if len(p.NegMarks) > 0 {
+			result.Marks = -slices.Max(p.NegMarks)
+		}
+	}
+	return result
+}
+
+// choiceStatus compares the options picked with the right ones.
+func choiceStatus(p grading.Problem, picked []int) string {
+	picked = slices.Compact(slices.Sorted(slices.Values(picked)))
+	for _, o := range picked {
+		if !slices.Contains(p.Answer.Options, o) {
+			return Wrong
+		}
+	}
+	if p.Subtype != grading.MultipleAnswer {
+		// any one right option, alone
+		if len(picked) == 1 {
+			return Correct
+		}
+		return Wrong
+	}
+	if len(picked) == len(p.Answer.Options) {
+		return Correct
+	}
+	return Partial
+}
+
+// partialMarks is what picking n of a multiple-answer problem's right options, and no wrong one, earns.
+func partialMarks(p grading.Problem, n int) int {
+	partial := slices.Sorted(slices.Values(p.PosMarks))
+	if len(partial) > 0 {
+		partial = partial[:len(partial)-1] // the full marks
+	}
+	if len(partial) == 0 {
+		return 0
+	}
+	return partial[min(n, len(partial))-1]
+}
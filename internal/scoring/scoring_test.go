@@ -0,0 +1,173 @@
+package scoring
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestScoreProblem(t *testing.T) {
+	single := grading.Problem{ID: 1, Subtype: grading.SingleAnswer, PosMarks: []int{4}, NegMarks: []int{1}, FullMarks: 4,
+		Answer: grading.Answer{Kind: grading.Choice, Options: []int{2}}}
+	multiple := grading.Problem{ID: 2, Subtype: grading.MultipleAnswer, PosMarks: []int{4, 3, 2, 1}, NegMarks: []int{2},
+		FullMarks: 4, Answer: grading.Answer{Kind: grading.Choice, Options: []int{0, 1, 3}}}
+	noPartial := multiple
+	noPartial.PosMarks = []int{4}
+	twoLevels := multiple
+	twoLevels.PosMarks = []int{1, 4}
+	numerical := grading.Problem{ID: 3, Subtype: grading.Numerical, PosMarks: []int{3}, FullMarks: 3,
+		Answer: grading.Answer{Kind: grading.Numeric, Min: 1.5, Max: 1.6, Tolerance: grading.NumericTolerance}}
+	integer := grading.Problem{ID: 4, Subtype: grading.IntegerType, PosMarks: []int{4}, NegMarks: []int{1, 2},
+		FullMarks: 4, Answer: grading.Answer{Kind: grading.Numeric, Min: 7, Max: 7}}
+	subjective := grading.Problem{ID: 5, Subtype: "subjective", PosMarks: []int{5}, NegMarks: []int{1}, FullMarks: 5,
+		Answer: grading.Answer{Kind: grading.None}}
+
+	tests := []struct {
+		name       string
+		problem    grading.Problem
+		response   Response
+		wantStatus string
+		wantMarks  int
+	}{
+		{"single right", single, Response{Options: []int{2}}, Correct, 4},
+		{"single wrong", single, Response{Options: []int{0}}, Wrong, -1},
+		{"single with two picked", single, Response{Options: []int{2, 3}}, Wrong, -1},
+		{"single picked twice", single, Response{Options: []int{2, 2}}, Correct, 4},
+		{"unanswered", single, Response{}, Unanswered, 0},
+		{"blank value is unanswered", numerical, Response{Value: "  "}, Unanswered, 0},
+		{"multiple all right", multiple, Response{Options: []int{3, 0, 1}}, Correct, 4},
+		{"multiple two of three", multiple, Response{Options: []int{0, 3}}, Partial, 2},
+		{"multiple one of three", multiple, Response{Options: []int{1}}, Partial, 1},
+		{"multiple with a wrong one", multiple, Response{Options: []int{0, 1, 2}}, Wrong, -2},
+		{"multiple partial without partial marks", noPartial, Response{Options: []int{0}}, Partial, 0},
+		{"multiple partial past the last level", twoLevels, Response{Options: []int{0, 1}}, Partial, 1},
+		{"numerical in range", numerical, Response{Value: "1.55"}, Correct, 3},
+		{"numerical rounds into range", numerical, Response{Value: "1.604"}, Correct, 3},
+		{"numerical outside range", numerical, Response{Value: "1.61"}, Wrong, 0},
+		{"numerical not a number", numerical, Response{Value: "abc"}, Wrong, 0},
+		{"integer right", integer, Response{Value: "7"}, Correct, 4},
+		{"integer off by a little", integer, Response{Value: "7.001"}, Wrong, -2},
+		{"no checkable answer", subjective, Response{Value: "an essay"}, Ungraded, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := scoreProblem(tc.problem, tc.response)
+			if got.Status != tc.wantStatus || got.Marks != tc.wantMarks || !got.Counted {
+				t.Errorf("scoreProblem = %+v, want status %s, marks %d, counted", got, tc.wantStatus, tc.wantMarks)
+			}
+		})
+	}
+}
+
+func optionalSection(mandatory int) grading.Section {
+	problem := func(id, full int) grading.Problem {
+		return grading.Problem{ID: id, Subtype: grading.IntegerType, PosMarks: []int{full}, NegMarks: []int{1},
+			FullMarks: full, Answer: grading.Answer{Kind: grading.Numeric, Min: float64(id), Max: float64(id)}}
+	}
+	return grading.Section{
+		Type:       "integer_type",
+		Compulsory: []grading.Problem{problem(1, 4)},
+		Optional: &grading.Optional{MandatoryCount: mandatory, Problems: []grading.Problem{
+			problem(2, 4), problem(3, 4), problem(4, 6),
+		}},
+	}
+}
+
+func TestScoreSectionBestOfOptional(t *testing.T) {
+	right := func(id int) Response { return Response{Value: []string{"", "1", "2", "3", "4"}[id]} }
+	wrong := Response{Value: "0"}
+
+	tests := []struct {
+		name        string
+		mandatory   int
+		responses   map[int]Response
+		wantMarks   int
+		wantMax     int
+		wantCounted map[int]bool // of the optional problems
+	}{
+		{"fewer attempted than mandatory all count", 2,
+			map[int]Response{1: right(1), 2: wrong}, 4 - 1, 4 + 10,
+			map[int]bool{2: true, 3: true, 4: true}},
+		{"best two of three", 2,
+			map[int]Response{1: right(1), 2: right(2), 3: wrong, 4: right(4)}, 4 + 4 + 6, 4 + 10,
+			map[int]bool{2: true, 3: false, 4: true}},
+		{"a wrong attempt counts when it is among the best", 2,
+			map[int]Response{2: wrong, 4: right(4)}, 6 - 1, 4 + 10,
+			map[int]bool{2: true, 3: true, 4: true}},
+		{"ties go to the earlier problem", 1,
+			map[int]Response{2: right(2), 3: right(3)}, 4, 4 + 6,
+			map[int]bool{2: true, 3: false, 4: true}},
+		{"mandatory count zero counts nothing optional", 0,
+			map[int]Response{1: right(1), 4: right(4)}, 4, 4,
+			map[int]bool{2: true, 3: true, 4: false}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := scoreSection(optionalSection(tc.mandatory), tc.responses)
+			if got.Marks != tc.wantMarks || got.MaxMarks != tc.wantMax {
+				t.Errorf("marks = %d of %d, want %d of %d", got.Marks, got.MaxMarks, tc.wantMarks, tc.wantMax)
+			}
+			if len(got.Problems) != 4 || got.Problems[0].Optional || !got.Problems[0].Counted {
+				t.Fatalf("problems = %+v, want the compulsory one first, counted", got.Problems)
+			}
+			for _, p := range got.Problems[1:] {
+				if !p.Optional || p.Counted != tc.wantCounted[p.ID] {
+					t.Errorf("problem %d: optional %v, counted %v; want optional, counted %v", p.ID, p.Optional,
+						p.Counted, tc.wantCounted[p.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	test := &models.Test{
+		ID: 501,
+		TypeParams: models.ResTypeParams{
+			PosMarks: []int8{4},
+			NegMarks: []int8{1},
+			Subjects: []models.ResSubject{
+				{SubjectID: 3, Sections: []models.ResSection{{
+					Type: "mcq_single_answer", Name: "A",
+					Compulsory: models.ResCompulsory{Problems: []models.ResProblem{{ID: 11}, {ID: 12}}},
+				}}},
+				{SubjectID: 4, PosMarks: []int8{4, 3, 2, 1}, NegMarks: []int8{2}, Sections: []models.ResSection{{
+					Type: "mcq_multiple_answer", Name: "B",
+					Compulsory: models.ResCompulsory{Problems: []models.ResProblem{{ID: 21}}},
+				}}},
+			},
+		},
+	}
+	problems := []*models.Problem{
+		{ID: 11, Subtype: grading.SingleAnswer, MetaData: models.ProbMetaData{Answers: []string{"1"}}},
+		{ID: 12, Subtype: grading.SingleAnswer, MetaData: models.ProbMetaData{Answers: []string{"2"}}},
+		{ID: 21, Subtype: grading.MultipleAnswer, MetaData: models.ProbMetaData{Answers: []string{"1", "2", "4"}}},
+	}
+	responses := map[int]Response{
+		11: {Options: []int{0}},
+		12: {Options: []int{0}},
+		21: {Options: []int{0, 3}},
+	}
+
+	want := Result{
+		TestID: 501, Marks: 4 - 1 + 2, MaxMarks: 12,
+		Subjects: []SubjectResult{
+			{SubjectID: 3, Marks: 3, MaxMarks: 8, Sections: []SectionResult{{Type: "mcq_single_answer", Name: "A",
+				Marks: 3, MaxMarks: 8, Problems: []ProblemResult{
+					{ID: 11, Status: Correct, Marks: 4, Counted: true},
+					{ID: 12, Status: Wrong, Marks: -1, Counted: true},
+				}}}},
+			{SubjectID: 4, Marks: 2, MaxMarks: 4, Sections: []SectionResult{{Type: "mcq_multiple_answer", Name: "B",
+				Marks: 2, MaxMarks: 4, Problems: []ProblemResult{
+					{ID: 21, Status: Partial, Marks: 2, Counted: true},
+				}}}},
+		},
+	}
+	if got := Score(test, problems, responses); !reflect.DeepEqual(got, want) {
+		t.Errorf("Score =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package v1
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Change is one entry of the change feed: a content write made in the CMS.
+type Change struct {
+	Cursor     string    `json:"cursor" doc:"Position of this entry in the feed; opaque"`
+	EntityType string    `json:"entity_type" doc:"test, problem, chapter, topic or resource"`
+	EntityID   int64     `json:"entity_id"`
+	Operation  string    `json:"operation" doc:"created, updated, archived, deleted or moved"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// ChangeList is one page of the change feed, oldest first.
+type ChangeList struct {
+	Changes    []Change `json:"changes"`
+	NextCursor string   `json:"next_cursor" doc:"Pass as cursor to read on; the cursor sent when there were no changes"`
+	HasMore    bool     `json:"has_more" doc:"More changes are waiting; fetch again right away"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ParseChangesQuery reads cursor (empty for the start of the feed) and limit (default DefaultLimit, at
+// most MaxLimit).
+func ParseChangesQuery(query url.Values) (after int64, limit int, err error) {
+	if s := query.Get("cursor"); s != "" {
+		if after, err = strconv.ParseInt(s, 10, 64); err != nil || after < 0 {
+			return 0, 0, ErrInvalidCursor
+		}
+	}
+	limit = DefaultLimit
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > MaxLimit {
+			return 0, 0, ErrInvalidPaging
+		}
+	}
+	return after, limit, nil
+}
+
+// NewChangeList builds the page for entries read after cursor after. The caller asks the log for one
+// more entry than limit so has_more needs no count.
+func NewChangeList(entries []*models.ChangeLogEntry, after int64, limit int) ChangeList {
+	list := ChangeList{Changes: []Change{}, NextCursor: cursor(after)}
+	if len(entries) > limit {
+		entries, list.HasMore = entries[:limit], true
+	}
+	for _, e := range entries {
+		list.Changes = append(list.Changes, Change{Cursor: cursor(e.ID), EntityType: e.EntityType,
+			EntityID: e.EntityID, Operation: e.Operation, ChangedAt: e.ChangedAt.UTC()})
+	}
+	if n := len(list.Changes); n > 0 {
+		list.NextCursor = list.Changes[n-1].Cursor
+	}
+	return list
+}
+
+func cursor(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
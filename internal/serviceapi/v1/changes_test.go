@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestParseChangesQuery(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantAfter int64
+		wantLimit int
+		wantErr   bool
+	}{
+		{"", 0, DefaultLimit, false},
+		{"cursor=120&limit=20", 120, 20, false},
+		{"cursor=abc", 0, 0, true},
+		{"cursor=-5", 0, 0, true},
+		{"limit=501", 0, 0, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tc.query)
+			after, limit, err := ParseChangesQuery(query)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if after != tc.wantAfter || limit != tc.wantLimit {
+				t.Errorf("after, limit = %d, %d, want %d, %d", after, limit, tc.wantAfter, tc.wantLimit)
+			}
+		})
+	}
+}
+
+func TestNewChangeList(t *testing.T) {
+	entries := func(ids ...int64) []*models.ChangeLogEntry {
+		var out []*models.ChangeLogEntry
+		for _, id := range ids {
+			out = append(out, &models.ChangeLogEntry{ID: id, EntityType: "test", EntityID: 9, Operation: "updated"})
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		entries     []*models.ChangeLogEntry
+		after       int64
+		limit       int
+		wantLen     int
+		wantCursor  string
+		wantHasMore bool
+	}{
+		{"no changes keeps the cursor", nil, 40, 10, 0, "40", false},
+		{"partial page", entries(41, 45), 40, 10, 2, "45", false},
+		{"extra entry means more", entries(41, 42, 43), 40, 2, 2, "42", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			list := NewChangeList(tc.entries, tc.after, tc.limit)
+			if len(list.Changes) != tc.wantLen || list.NextCursor != tc.wantCursor || list.HasMore != tc.wantHasMore {
+				t.Errorf("got %d changes, next %q, more %v; want %d, %q, %v", len(list.Changes), list.NextCursor,
+					list.HasMore, tc.wantLen, tc.wantCursor, tc.wantHasMore)
+			}
+			if list.Changes == nil {
+				t.Error("changes is nil, want []")
+			}
+		})
+	}
+}
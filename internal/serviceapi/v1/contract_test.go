@@ -0,0 +1,304 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Run with -update to rewrite the golden files after an intended (additive) change.
+var update = flag.Bool("update", false, "rewrite testdata golden files")
+
+func fixtureTest() *models.Test {
+	chapter := int16(12)
+	return &models.Test{
+		ID:               501,
+		Name:             []models.ResName{{LangCode: "en", Resource: "Kinematics chapter test"}, {LangCode: "hi", Resource: "शुद्धगतिकी"}},
+		Code:             "T-501",
+		Type:             "test",
+		Subtype:          "chapter_test",
+		ExamIDs:          []int8{1},
+		SkillIDs:         []int16{4},
+		CurriculumGrades: []models.CurriculumGrade{{CurriculumID: 2, GradeID: 11}},
+		StatusID:         3,
+		TypeParams: models.ResTypeParams{
+			Duration:     "60",
+			Marks:        12,
+			PosMarks:     []int8{4},
+			NegMarks:     []int8{1},
+			ChapterID:    &chapter,
+			Instructions: "<p>Attempt all questions.</p>",
+			InstructionLangVersions: []models.InstructionLangVersion{
+				{LangCode: "hi", Instructions: "<p>सभी प्रश्न हल करें।</p>"},
+			},
+			Subjects: []models.ResSubject{{
+				SubjectID: 3,
+				Name:      "Physics",
+				Marks:     12,
+				Sections: []models.ResSection{{
+					Type:  "single_choice",
+					Name:  "Section A",
+					Marks: 12,
+					Compulsory: models.ResCompulsory{Problems: []models.ResProblem{{
+						ID: 901, PosMarks: []int8{4}, DifficultyLevel: "easy",
+						OptionLayout: &models.OptionLayout{Rows: 2, Cols: 2},
+					}}},
+					Optional: &models.ResOptional{MandatoryCount: 2, Problems: []models.ResProblem{
+						{ID: 902, DifficultyLevel: "medium"},
+						{ID: 903, DifficultyLevel: "hard"},
+					}},
+				}},
+			}},
+		},
+	}
+}
+
+func fixtureProblems() []*models.Problem {
+	return []*models.Problem{
+		{
+			ID: 901, Code: "P-901", Type: "problem", Subtype: "single_choice",
+			SubjectID: 3, ChapterID: 12, TopicID: 40, DifficultyLevel: "easy",
+			SkillIDs: []int16{4}, TagIDs: []int{7},
+			Paragraph: &models.ProblemParagraph{ID: 30, Body: "<p>A car starts from rest.</p>"},
+			MetaData: models.ProbMetaData{
+				Question:  "<p>Its speed after 2 s at 1 m/s²?</p>",
+				Options:   []template.HTML{"1 m/s", "2 m/s"},
+				Answers:   []string{"1"},
+				Solutions: []models.Solution{{Type: "text", Value: "<p>v = at</p>"}},
+			},
+			LangVersions: []models.LangVersion{{LangCode: "hi", MetaData: models.ProbMetaData{Question: "<p>गति?</p>"}}},
+			// internal fields that must not reach callers
+			Skills:   []models.Skill{{ID: 4, Name: "Recall"}},
+			Subject:  models.Subject{ID: 3, Code: "PHY"},
+			TagNames: []string{"motion"},
+			StatusID: 3,
+		},
+		{ID: 902, Subtype: "numerical", MetaData: models.ProbMetaData{Question: "<p>g?</p>", Answers: []string{"9.8"}}},
+		{ID: 903, Subtype: "subjective"},
+	}
+}
+
+// TestAssembledTestContract pins the JSON callers get from GET /tests/{id}. A diff here is a breaking
+// change unless it only adds keys.
+func TestAssembledTestContract(t *testing.T) {
+	got, err := json.MarshalIndent(NewAssembledTest(fixtureTest(), fixtureProblems()), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "assembled_test.json", got)
+}
+
+func TestTestListContract(t *testing.T) {
+	got, err := json.MarshalIndent(NewTestList([]*models.Test{fixtureTest(), {ID: 502, Type: "test"}}), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "test_list.json", got)
+}
+
+func TestChapterListContract(t *testing.T) {
+	priority := int16(2)
+	text := "High"
+	chapter := &models.Chapter{
+		ID: 12, Code: "PHY-11-03", Name: []models.ChapterLang{{ChapterName: "Kinematics", LangCode: "en"}},
+		CurriculumID: 2, GradeID: 11, SubjectID: 3,
+		Topics: []*models.Topic{{
+			ID: 40, Code: "PHY-11-03-01", Name: []models.TopicLang{{LangCode: "en", TopicName: "Motion in a line"}},
+			ChapterID: 12, Curriculums: []models.TopicCurriculum{{CurriculumID: 2, Priority: &priority, PriorityText: &text}},
+		}},
+	}
+	var list ChapterList
+	list.Chapters, list.Page = Paginate(Convert([]*models.Chapter{chapter, {ID: 13}}, NewChapter), 0, 1)
+	got, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "chapter_list.json", got)
+}
+
+func TestChangeListContract(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	list := NewChangeList([]*models.ChangeLogEntry{
+		{ID: 101, EntityType: "test", EntityID: 501, Operation: "updated", ChangedAt: at},
+		{ID: 102, EntityType: "problem", EntityID: 7001, Operation: "moved", ChangedAt: at},
+	}, 100, 100)
+	got, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "change_list.json", got)
+}
+
+func TestGradingKeyContract(t *testing.T) {
+	problems := []*models.Problem{
+		{ID: 901, Subtype: "mcq_single_answer", MetaData: models.ProbMetaData{
+			Options: []template.HTML{"1 m/s", "2 m/s"}, Answers: []string{"2"}}},
+		{ID: 902, Subtype: "numerical_answer", MetaData: models.ProbMetaData{Answers: []string{"9.7", "9.9"}}},
+		{ID: 903, Subtype: "subjective"},
+	}
+	got, err := json.MarshalIndent(NewGradingKey(grading.NewKey(fixtureTest(), problems)), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "grading_key.json", got)
+}
+
+// TestEmptyValuesArePresent checks a bare model still encodes every key, with [] and null.
+func TestEmptyValuesArePresent(t *testing.T) {
+	b, err := json.Marshal(NewAssembledTest(&models.Test{ID: 1}, []*models.Problem{{ID: 2}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"name":[]`, `"subjects":[]`, `"instruction_lang_versions":[]`,
+		`"chapter_id":null`, `"paragraph":null`, `"options":[]`, `"lang_versions":[]`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("missing %s in %s", want, b)
+		}
+	}
+	for _, leaked := range []string{`"Skills"`, `"Subject"`, `"TagNames"`} {
+		if strings.Contains(string(b), leaked) {
+			t.Errorf("%s leaked into %s", leaked, b)
+		}
+	}
+}
+
+// TestOpenAPIDescribesContract checks every key the golden responses carry is a property of the
+// matching schema, and every $ref in the document resolves.
+func TestOpenAPIDescribesContract(t *testing.T) {
+	raw, err := json.Marshal(OpenAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	var refs []string
+	collectRefs(doc, &refs)
+	for _, ref := range refs {
+		if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+			t.Errorf("unresolved $ref %s", ref)
+		}
+	}
+
+	for file, schema := range map[string]string{"assembled_test.json": "AssembledTest", "test_list.json": "TestList",
+		"chapter_list.json": "ChapterList", "change_list.json": "ChangeList", "grading_key.json": "GradingKey"} {
+		b, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Fatal(err)
+		}
+		checkAgainstSchema(t, file, v, map[string]any{"$ref": "#/components/schemas/" + schema}, schemas)
+	}
+}
+
+func checkAgainstSchema(t *testing.T, path string, v any, schema map[string]any, schemas map[string]any) {
+	t.Helper()
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+	}
+	if allOf, ok := schema["allOf"].([]any); ok {
+		if v == nil {
+			if schema["nullable"] != true {
+				t.Errorf("%s: null but not nullable", path)
+			}
+			return
+		}
+		schema = allOf[0].(map[string]any)
+		if ref, ok := schema["$ref"].(string); ok {
+			schema = schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		if schema["nullable"] != true {
+			t.Errorf("%s: null but not nullable", path)
+		}
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := props[k].(map[string]any)
+			if !ok {
+				t.Errorf("%s.%s: not in the schema", path, k)
+				continue
+			}
+			checkAgainstSchema(t, path+"."+k, v[k], prop, schemas)
+		}
+		for _, k := range schema["required"].([]any) {
+			if _, ok := v[k.(string)]; !ok {
+				t.Errorf("%s.%s: required but missing", path, k)
+			}
+		}
+	case []any:
+		if schema["type"] != "array" {
+			t.Errorf("%s: array but schema type is %v", path, schema["type"])
+			return
+		}
+		for _, item := range v {
+			checkAgainstSchema(t, path+"[]", item, schema["items"].(map[string]any), schemas)
+		}
+	case string:
+		if schema["type"] != "string" {
+			t.Errorf("%s: string but schema type is %v", path, schema["type"])
+		}
+	case float64:
+		if schema["type"] != "integer" && schema["type"] != "number" {
+			t.Errorf("%s: number but schema type is %v", path, schema["type"])
+		}
+	}
+}
+
+func collectRefs(v any, refs *[]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok && k == "$ref" {
+				*refs = append(*refs, s)
+			}
+			collectRefs(e, refs)
+		}
+	case []any:
+		for _, e := range v {
+			collectRefs(e, refs)
+		}
+	}
+}
+
+func golden(t *testing.T, file string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", file)
+	got = append(got, '\n')
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed; if intended, run go test ./internal/serviceapi/v1 -update and review the diff.\ngot:\n%s",
+			path, got)
+	}
+}
@@ -0,0 +1,163 @@
+package v1
+
+import (
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+type Curriculum struct {
+	ID   int    `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type Grade struct {
+	ID     int `json:"id"`
+	Number int `json:"number" doc:"e.g. 11 for class 11"`
+}
+
+type Subject struct {
+	ID       int    `json:"id"`
+	Code     string `json:"code"`
+	Name     []Text `json:"name"`
+	ParentID *int   `json:"parent_id" doc:"Set on sub-subjects, e.g. Botany under Biology"`
+}
+
+type Chapter struct {
+	ID           int     `json:"id"`
+	Code         string  `json:"code"`
+	Name         []Text  `json:"name"`
+	CurriculumID int     `json:"curriculum_id"`
+	GradeID      int     `json:"grade_id"`
+	SubjectID    int     `json:"subject_id"`
+	Topics       []Topic `json:"topics" doc:"The chapter's topics in this curriculum; empty when include_topics=false"`
+}
+
+type Topic struct {
+	ID          int               `json:"id"`
+	Code        string            `json:"code"`
+	Name        []Text            `json:"name"`
+	ChapterID   int               `json:"chapter_id"`
+	Curriculums []TopicCurriculum `json:"curriculums"`
+}
+
+// TopicCurriculum is a curriculum a topic is taught in, with its priority there.
+type TopicCurriculum struct {
+	CurriculumID int     `json:"curriculum_id"`
+	Priority     *int    `json:"priority"`
+	PriorityText *string `json:"priority_text"`
+}
+
+type Concept struct {
+	ID      int    `json:"id"`
+	Name    []Text `json:"name"`
+	TopicID int    `json:"topic_id"`
+}
+
+type CurriculumList struct {
+	Curriculums []Curriculum `json:"curriculums"`
+	Page        Page         `json:"page"`
+}
+
+type GradeList struct {
+	Grades []Grade `json:"grades"`
+	Page   Page    `json:"page"`
+}
+
+type SubjectList struct {
+	Subjects []Subject `json:"subjects"`
+	Page     Page      `json:"page"`
+}
+
+type ChapterList struct {
+	Chapters []Chapter `json:"chapters"`
+	Page     Page      `json:"page"`
+}
+
+type ConceptList struct {
+	Concepts []Concept `json:"concepts"`
+	Page     Page      `json:"page"`
+}
+
+type ProblemList struct {
+	Problems []Problem `json:"problems"`
+	Page     Page      `json:"page"`
+}
+
+func NewCurriculum(c *models.Curriculum) Curriculum {
+	return Curriculum{ID: int(c.ID), Code: c.Code, Name: c.Name}
+}
+
+func NewGrade(g *models.Grade) Grade {
+	return Grade{ID: int(g.ID), Number: int(g.Number)}
+}
+
+func NewSubject(s *models.Subject) Subject {
+	subject := Subject{ID: int(s.ID), Code: s.Code, Name: make([]Text, 0, len(s.Name))}
+	for _, n := range s.Name {
+		subject.Name = append(subject.Name, Text{LangCode: n.LangCode, Resource: n.SubName})
+	}
+	if s.ParentID != 0 {
+		parent := int(s.ParentID)
+		subject.ParentID = &parent
+	}
+	return subject
+}
+
+// NewChapter converts a chapter with the topics already attached to it.
+func NewChapter(c *models.Chapter) Chapter {
+	chapter := Chapter{
+		ID:           int(c.ID),
+		Code:         c.Code,
+		Name:         make([]Text, 0, len(c.Name)),
+		CurriculumID: int(c.CurriculumID),
+		GradeID:      int(c.GradeID),
+		SubjectID:    int(c.SubjectID),
+		Topics:       make([]Topic, 0, len(c.Topics)),
+	}
+	for _, n := range c.Name {
+		chapter.Name = append(chapter.Name, Text{LangCode: n.LangCode, Resource: n.ChapterName})
+	}
+	for _, t := range c.Topics {
+		chapter.Topics = append(chapter.Topics, NewTopic(t))
+	}
+	return chapter
+}
+
+func NewTopic(t *models.Topic) Topic {
+	t.NormalizeCurriculums()
+	topic := Topic{
+		ID:          int(t.ID),
+		Code:        t.Code,
+		Name:        make([]Text, 0, len(t.Name)),
+		ChapterID:   int(t.ChapterID),
+		Curriculums: make([]TopicCurriculum, 0, len(t.Curriculums)),
+	}
+	for _, n := range t.Name {
+		topic.Name = append(topic.Name, Text{LangCode: n.LangCode, Resource: n.TopicName})
+	}
+	for _, c := range t.Curriculums {
+		topic.Curriculums = append(topic.Curriculums, TopicCurriculum{
+			CurriculumID: int(c.CurriculumID),
+			Priority:     intPtr(c.Priority),
+			PriorityText: c.PriorityText,
+		})
+	}
+	return topic
+}
+
+func NewConcept(c *models.Concept) Concept {
+	concept := Concept{ID: int(c.ID), TopicID: int(c.TopicID), Name: make([]Text, 0, len(c.Name))}
+	for _, n := range c.Name {
+		concept.Name = append(concept.Name, Text{LangCode: n.LangCode, Resource: n.ConceptName})
+	}
+	return concept
+}
+
+// Convert converts each model with fn, for building the list responses.
+func Convert[M, D any](items []*M, fn func(*M) D) []D {
+	out := make([]D, 0, len(items))
+	for _, m := range items {
+		out = append(out, fn(m))
+	}
+	return out
+}
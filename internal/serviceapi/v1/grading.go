@@ -0,0 +1,85 @@
+package v1
+
+import (
+	"github.com/avantifellows/nex-gen-cms/internal/grading"
+)
+
+// GradingKey is the response of GET /tests/{id}/grading-key: what a grader needs and nothing else. It
+// mirrors the test's subject and section structure; the marks cascade is already applied.
+type GradingKey struct {
+	TestID   int              `json:"test_id"`
+	Marks    int              `json:"marks" doc:"Most a student can score, counting each optional block's best mandatory_count problems"`
+	Subjects []GradingSubject `json:"subjects"`
+}
+
+type GradingSubject struct {
+	SubjectID int              `json:"subject_id"`
+	Sections  []GradingSection `json:"sections"`
+}
+
+type GradingSection struct {
+	Type       string       `json:"type"`
+	Name       string       `json:"name"`
+	Compulsory []ProblemKey `json:"compulsory"`
+	Optional   *OptionalKey `json:"optional" doc:"null when the section has no optional block"`
+}
+
+type OptionalKey struct {
+	MandatoryCount int          `json:"mandatory_count" doc:"Problems a student answers; if they answer more, the best this many count"`
+	Problems       []ProblemKey `json:"problems"`
+}
+
+type ProblemKey struct {
+	ID        int       `json:"id"`
+	Subtype   string    `json:"subtype" doc:"Empty when the problem no longer exists"`
+	PosMarks  []int     `json:"pos_marks" doc:"From the problem, else its section, subject or test"`
+	NegMarks  []int     `json:"neg_marks" doc:"Deducted for a wrong answer; from the same level as pos_marks"`
+	FullMarks int       `json:"full_marks" doc:"The largest of pos_marks"`
+	Answer    AnswerKey `json:"answer"`
+}
+
+type AnswerKey struct {
+	Kind      string   `json:"kind" doc:"choice, numeric or none (no answer a machine can check)"`
+	Options   []int    `json:"options" doc:"Choice: zero-based indices of the correct options. Single-answer subtypes accept any one; mcq_multiple_answer needs all. A matrix_match option holds a full pairing"`
+	Min       *float64 `json:"min" doc:"Numeric: lowest right value; null for other kinds"`
+	Max       *float64 `json:"max" doc:"Numeric: highest right value, equal to min for a single value"`
+	Tolerance *float64 `json:"tolerance" doc:"Numeric: slack on both sides of [min, max]; 0.005 for numerical_answer, whose answers have two decimals"`
+}
+
+// NewGradingKey converts a test's answer key.
+func NewGradingKey(key grading.Key) GradingKey {
+	out := GradingKey{TestID: key.TestID, Marks: key.Marks, Subjects: make([]GradingSubject, 0, len(key.Subjects))}
+	for _, s := range key.Subjects {
+		subject := GradingSubject{SubjectID: s.SubjectID, Sections: make([]GradingSection, 0, len(s.Sections))}
+		for _, sec := range s.Sections {
+			section := GradingSection{Type: sec.Type, Name: sec.Name, Compulsory: problemKeys(sec.Compulsory)}
+			if sec.Optional != nil {
+				section.Optional = &OptionalKey{MandatoryCount: sec.Optional.MandatoryCount,
+					Problems: problemKeys(sec.Optional.Problems)}
+			}
+			subject.Sections = append(subject.Sections, section)
+		}
+		out.Subjects = append(out.Subjects, subject)
+	}
+	return out
+}
+
+func problemKeys(problems []grading.Problem) []ProblemKey {
+	out := make([]ProblemKey, 0, len(problems))
+	for _, p := range problems {
+		answer := AnswerKey{Kind: p.Answer.Kind, Options: make([]int, 0, len(p.Answer.Options))}
+		answer.Options = append(answer.Options, p.Answer.Options...)
+		if p.Answer.Kind == grading.Numeric {
+			answer.Min, answer.Max, answer.Tolerance = &p.Answer.Min, &p.Answer.Max, &p.Answer.Tolerance
+		}
+		out = append(out, ProblemKey{
+			ID:        p.ID,
+			Subtype:   p.Subtype,
+			PosMarks:  append(make([]int, 0, len(p.PosMarks)), p.PosMarks...),
+			NegMarks:  append(make([]int, 0, len(p.NegMarks)), p.NegMarks...),
+			FullMarks: p.FullMarks,
+			Answer:    answer,
+		})
+	}
+	return out
+}
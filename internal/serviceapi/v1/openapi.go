@@ -0,0 +1,235 @@
+package v1
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// BasePath prefixes every v1 route.
+const BasePath = "/api/service/v1"
+
+// Schema is the subset of an OpenAPI 3.0 schema object the generator emits.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AllOf wraps a $ref that needs siblings such as nullable, which 3.0 ignores next to $ref.
+	AllOf []*Schema `json:"allOf,omitempty"`
+}
+
+// OpenAPI builds the OpenAPI 3.0 document for v1. Component schemas are generated from the response
+// types above, so the document can't drift from what the handlers encode; paths are declared here.
+func OpenAPI() map[string]any {
+	components := map[string]*Schema{}
+	ref := func(v any) *Schema { return schemaRef(reflect.TypeOf(v), components) }
+
+	idParam := map[string]any{
+		"name": "id", "in": "path", "required": true, "description": "Test ID",
+		"schema": map[string]any{"type": "integer"},
+	}
+	unpublishedParam := queryParam("include_unpublished", "true to include content that isn't published yet",
+		&Schema{Type: "boolean"})
+	paging := []any{
+		queryParam("limit", "Page size, 1-500", &Schema{Type: "integer", Description: "Default 100"}),
+		queryParam("offset", "Items to skip; take it from page.next_offset", &Schema{Type: "integer"}),
+	}
+	curriculumRead := func(id, summary string, response *Schema, params ...any) map[string]any {
+		return map[string]any{"get": operation(id, summary+" Scope: curriculum:read.", append(params, paging...),
+			jsonResponse("One page of results", response))}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Nex-Gen CMS service API",
+			"version": "1",
+			"description": "Read access to CMS content for other Avanti services. Authenticate with a service " +
+				"client token (Authorization: Bearer cms_...) issued at /admin/service-clients; each operation " +
+				"names the scope it needs. Fields are never omitted: empty lists are [] and missing values null. " +
+				"JSON responses carry an ETag; send it back in If-None-Match to get a 304 when nothing changed.",
+		},
+		"servers":  []map[string]any{{"url": BasePath}},
+		"security": []map[string][]string{{"bearer": {}}},
+		"paths": map[string]any{
+			"/tests": map[string]any{"get": operation("listTests",
+				"List tests for a curriculum and grade. Scope: tests:read.",
+				[]any{
+					queryParam("curriculum_id", "Curriculum ID", &Schema{Type: "integer"}, true),
+					queryParam("grade_id", "Grade ID", &Schema{Type: "integer"}, true),
+					queryParam("subtype", "Only tests of this subtype, e.g. chapter_test", &Schema{Type: "string"}),
+					unpublishedParam,
+				},
+				jsonResponse("The tests", ref(TestList{})))},
+			"/tests/{id}": map[string]any{"get": operation("getAssembledTest",
+				"Get a test with every problem it references. Fetching a published test records it as "+
+					"delivered. Scope: tests:read.",
+				[]any{idParam, unpublishedParam,
+					queryParam("lang", "Only this language's versions, or English where it is missing",
+						&Schema{Type: "string", Description: "e.g. hi; default every language"}),
+					queryParam("render", "Format of rich-text fields; TeX stays verbatim",
+						&Schema{Type: "string", Description: "html (default), text or markdown"}),
+					queryParam("images", "inline keeps base64 images in the HTML; url swaps them for "+
+						"immutable, public /images/{hash} URLs", &Schema{Type: "string", Description: "inline (default) or url"}),
+					queryParam("omit_answers", "true to empty every answer and solution, for student-facing clients",
+						&Schema{Type: "boolean"}),
+				},
+				jsonResponse("The assembled test", ref(AssembledTest{})))},
+			"/tests/{id}/grading-key": map[string]any{"get": operation("getGradingKey",
+				"Get a test's answers and marking scheme, for grading. Fetching a published test records it as "+
+					"delivered. Scope: tests:read.",
+				[]any{idParam, unpublishedParam},
+				jsonResponse("The grading key", ref(GradingKey{})))},
+			"/tests/{id}/pdf": map[string]any{"get": operation("getTestPdf",
+				"Render the test as a PDF. Fetching a published test records it as delivered. Scope: pdf:render.",
+				[]any{idParam, unpublishedParam, queryParam("type", "What to print", &Schema{Type: "string",
+					Description: "questions, questions_with_answers or answers"}, true)},
+				map[string]any{"description": "The PDF", "content": map[string]any{
+					"application/pdf": map[string]any{"schema": &Schema{Type: "string", Format: "binary"}},
+				}})},
+			"/curriculums": curriculumRead("listCurriculums", "List curriculums.", ref(CurriculumList{})),
+			"/grades":      curriculumRead("listGrades", "List grades.", ref(GradeList{})),
+			"/subjects": curriculumRead("listSubjects", "List subjects.", ref(SubjectList{}),
+				queryParam("parent_id", "Only the sub-subjects of this subject", &Schema{Type: "integer"})),
+			"/chapters": curriculumRead("listChapters", "List a subject's chapters in a curriculum, with their topics.",
+				ref(ChapterList{}),
+				queryParam("curriculum_id", "Curriculum ID", &Schema{Type: "integer"}, true),
+				queryParam("subject_id", "Subject ID", &Schema{Type: "integer"}, true),
+				queryParam("grade_id", "Only chapters of this grade", &Schema{Type: "integer"}),
+				queryParam("q", "Only chapters whose code or a name contains this, ignoring case", &Schema{Type: "string"}),
+				queryParam("include_topics", "false to leave topics empty", &Schema{Type: "boolean"})),
+			"/concepts": curriculumRead("listConcepts", "List a topic's concepts.", ref(ConceptList{}),
+				queryParam("topic_id", "Topic ID", &Schema{Type: "integer"}, true)),
+			"/topics/{id}/problems": curriculumRead("listTopicProblems", "List a topic's problems.", ref(ProblemList{}),
+				map[string]any{"name": "id", "in": "path", "required": true, "description": "Topic ID",
+					"schema": map[string]any{"type": "integer"}},
+				map[string]any{"name": "difficulty", "in": "query", "description": "Only these difficulties; repeatable",
+					"schema": &Schema{Type: "array", Items: &Schema{Type: "string"}}, "explode": true},
+				queryParam("subtype", "Only problems of this subtype, e.g. numerical", &Schema{Type: "string"}),
+				unpublishedParam),
+			"/changes": map[string]any{"get": operation("listChanges",
+				"Content writes after a cursor, oldest first, for incremental sync. Entries appear a few seconds "+
+					"after the write. Scope: changes:read.",
+				[]any{
+					queryParam("cursor", "next_cursor of the previous page; omit to read from the start",
+						&Schema{Type: "string"}),
+					map[string]any{"name": "entity_type", "in": "query",
+						"description": "Only these entity types (test, problem, chapter, topic, resource); repeatable",
+						"schema":      &Schema{Type: "array", Items: &Schema{Type: "string"}}, "explode": true},
+					queryParam("limit", "Page size, 1-500", &Schema{Type: "integer", Description: "Default 100"}),
+				},
+				jsonResponse("One page of changes", ref(ChangeList{})))},
+			"/openapi.json": map[string]any{"get": map[string]any{
+				"operationId": "getOpenAPI",
+				"summary":     "This document. No authentication.",
+				"security":    []any{},
+				"responses": map[string]any{"200": map[string]any{"description": "OpenAPI document",
+					"content": map[string]any{"application/json": map[string]any{}}}},
+			}},
+		},
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func operation(id, summary string, params []any, ok map[string]any) map[string]any {
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{"description": description, "content": map[string]any{
+			"text/plain": map[string]any{"schema": &Schema{Type: "string"}},
+		}}
+	}
+	responses := map[string]any{
+		"200": ok,
+		"400": errorResponse("Missing or invalid parameters"),
+		"401": errorResponse("Missing or unknown token"),
+		"403": errorResponse("The token lacks the scope"),
+		"404": errorResponse("Not found, or not published"),
+		"500": errorResponse("Upstream or internal error"),
+	}
+	if _, isJSON := ok["content"].(map[string]any)["application/json"]; isJSON {
+		responses["304"] = map[string]any{"description": "Unchanged since the ETag in If-None-Match"}
+	}
+	return map[string]any{
+		"operationId": id,
+		"summary":     summary,
+		"parameters":  params,
+		"responses":   responses,
+	}
+}
+
+func queryParam(name, description string, schema *Schema, required ...bool) map[string]any {
+	return map[string]any{
+		"name": name, "in": "query", "description": description, "schema": schema,
+		"required": len(required) > 0 && required[0],
+	}
+}
+
+func jsonResponse(description string, schema *Schema) map[string]any {
+	return map[string]any{"description": description, "content": map[string]any{
+		"application/json": map[string]any{"schema": schema},
+	}}
+}
+
+// schemaRef returns a $ref to t's component schema, generating it (and those of the types it uses)
+// into components first.
+func schemaRef(t reflect.Type, components map[string]*Schema) *Schema {
+	if _, ok := components[t.Name()]; !ok {
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		components[t.Name()] = s // before the fields, so a recursive type terminates
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			prop := schemaFor(f.Type, f.Tag.Get("format"), components)
+			if doc := f.Tag.Get("doc"); doc != "" {
+				if prop.Ref != "" {
+					prop = &Schema{AllOf: []*Schema{prop}}
+				}
+				prop.Description = doc
+			}
+			s.Properties[name] = prop
+			// every field is always encoded; nullable ones as null
+			s.Required = append(s.Required, name)
+		}
+	}
+	return &Schema{Ref: "#/components/schemas/" + t.Name()}
+}
+
+func schemaFor(t reflect.Type, format string, components map[string]*Schema) *Schema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schemaFor(t.Elem(), format, components)
+		if s.Ref != "" {
+			s = &Schema{AllOf: []*Schema{s}}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem(), format, components)}
+	case reflect.Struct:
+		return schemaRef(t, components)
+	case reflect.String:
+		return &Schema{Type: "string", Format: format}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+	panic("v1: no OpenAPI schema for " + t.String())
+}
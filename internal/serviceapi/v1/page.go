@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 500
+)
+
+var ErrInvalidPaging = errors.New("limit must be 1-500 and offset 0 or more")
+
+// Page describes which slice of a list a response holds. List endpoints take limit and offset
+// query params; follow next_offset until it is null.
+type Page struct {
+	Total      int  `json:"total" doc:"Items matching the filters, across all pages"`
+	Offset     int  `json:"offset"`
+	Limit      int  `json:"limit"`
+	NextOffset *int `json:"next_offset" doc:"offset of the next page; null on the last one"`
+}
+
+// ParsePaging reads limit (default DefaultLimit, at most MaxLimit) and offset (default 0).
+func ParsePaging(query url.Values) (offset, limit int, err error) {
+	limit = DefaultLimit
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > MaxLimit {
+			return 0, 0, ErrInvalidPaging
+		}
+	}
+	if s := query.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, ErrInvalidPaging
+		}
+	}
+	return offset, limit, nil
+}
+
+// Paginate returns the items of the page at offset, and that page's description.
+func Paginate[T any](items []T, offset, limit int) ([]T, Page) {
+	page := Page{Total: len(items), Offset: offset, Limit: limit}
+	if offset >= len(items) {
+		return items[:0], page
+	}
+	end := min(offset+limit, len(items))
+	if end < len(items) {
+		page.NextOffset = &end
+	}
+	return items[offset:end], page
+}
+
+// ETag is the strong entity tag of a response body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified reports whether the request's If-None-Match already names etag, so a 304 can be sent
+// instead of the body. Weak comparison, as RFC 9110 prescribes for If-None-Match.
+func NotModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
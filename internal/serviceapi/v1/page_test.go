@@ -0,0 +1,99 @@
+package v1
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParsePaging(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantOffset int
+		wantLimit  int
+		wantErr    bool
+	}{
+		{"", 0, DefaultLimit, false},
+		{"limit=20&offset=40", 40, 20, false},
+		{"limit=500", 0, 500, false},
+		{"limit=501", 0, 0, true},
+		{"limit=0", 0, 0, true},
+		{"offset=-1", 0, 0, true},
+		{"limit=ten", 0, 0, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tc.query)
+			offset, limit, err := ParsePaging(query)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if offset != tc.wantOffset || limit != tc.wantLimit {
+				t.Errorf("offset, limit = %d, %d, want %d, %d", offset, limit, tc.wantOffset, tc.wantLimit)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []int
+		wantNext      int // -1 for none
+	}{
+		{"first page", 0, 2, []int{1, 2}, 2},
+		{"middle page", 2, 2, []int{3, 4}, 4},
+		{"last page", 4, 2, []int{5}, -1},
+		{"exact fit", 0, 5, []int{1, 2, 3, 4, 5}, -1},
+		{"past the end", 9, 2, []int{}, -1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, page := Paginate(items, tc.offset, tc.limit)
+			if len(got) != len(tc.want) {
+				t.Fatalf("items = %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("items = %v, want %v", got, tc.want)
+				}
+			}
+			if page.Total != 5 || page.Offset != tc.offset || page.Limit != tc.limit {
+				t.Errorf("page = %+v", page)
+			}
+			if tc.wantNext < 0 && page.NextOffset != nil || tc.wantNext >= 0 &&
+				(page.NextOffset == nil || *page.NextOffset != tc.wantNext) {
+				t.Errorf("next_offset = %v, want %d", page.NextOffset, tc.wantNext)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	etag := ETag([]byte(`{"grades":[]}`))
+	if etag != ETag([]byte(`{"grades":[]}`)) || etag == ETag([]byte(`{"grades":[{}]}`)) {
+		t.Fatal("ETag must depend only on the body")
+	}
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{etag, true},
+		{"W/" + etag, true},
+		{`"other", ` + etag, true},
+		{"*", true},
+		{`"other"`, false},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", "/api/service/v1/grades", nil)
+		if tc.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", tc.ifNoneMatch)
+		}
+		if got := NotModified(r, etag); got != tc.want {
+			t.Errorf("If-None-Match %q: NotModified = %v, want %v", tc.ifNoneMatch, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+// Package v1 is version 1 of the service API under /api/service/v1: the response types callers such
+// as quiz-backend and af_lms code against, and the OpenAPI document describing them. The types are
+// deliberately separate from internal/models, so that a field added to a model doesn't reach
+// callers until it's added here. Within v1, changes must be additive.
+//
+// Every field is always present: lists are empty rather than missing, and optional values are null.
+package v1
+
+import (
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Text is one language's version of a name.
+type Text struct {
+	LangCode string `json:"lang_code" doc:"ISO 639-1 code, e.g. en, hi"`
+	Resource string `json:"resource"`
+}
+
+type CurriculumGrade struct {
+	CurriculumID int `json:"curriculum_id"`
+	GradeID      int `json:"grade_id" doc:"0 when the test isn't tied to a grade"`
+}
+
+// TestSummary is a test as listed by GET /tests, without its problems.
+type TestSummary struct {
+	ID               int               `json:"id"`
+	Code             string            `json:"code"`
+	Name             []Text            `json:"name"`
+	Type             string            `json:"type"`
+	Subtype          string            `json:"subtype" doc:"chapter_test, part_test, major_test, ..."`
+	ExamIDs          []int             `json:"exam_ids"`
+	CurriculumGrades []CurriculumGrade `json:"curriculum_grades"`
+	ChapterID        *int              `json:"chapter_id" doc:"Set on chapter tests whose problems resolve to one chapter"`
+	Marks            int               `json:"marks"`
+	Duration         string            `json:"duration" doc:"Minutes"`
+	ProblemCount     int               `json:"problem_count" doc:"Problems a student attempts, counting each optional block's mandatory_count"`
+	StatusID         int               `json:"cms_status_id" doc:"CMS workflow status; 3 is published"`
+}
+
+// TestList is the response of GET /tests.
+type TestList struct {
+	Tests []TestSummary `json:"tests"`
+}
+
+// AssembledTest is the response of GET /tests/{id}: the test's structure, with the marks cascade at
+// test, subject, section and problem level, plus every problem it references, fully resolved.
+// Problems are joined to their ProblemRef by ID.
+type AssembledTest struct {
+	Test     Test      `json:"test"`
+	Problems []Problem `json:"problems"`
+}
+
+type Test struct {
+	ID               int               `json:"id"`
+	Code             string            `json:"code"`
+	Name             []Text            `json:"name"`
+	Type             string            `json:"type"`
+	Subtype          string            `json:"subtype"`
+	ExamIDs          []int             `json:"exam_ids"`
+	SkillIDs         []int             `json:"skill_ids"`
+	CurriculumGrades []CurriculumGrade `json:"curriculum_grades"`
+	TypeParams       TestParams        `json:"type_params"`
+	StatusID         int               `json:"cms_status_id"`
+}
+
+type TestParams struct {
+	Duration  string        `json:"duration" doc:"Minutes"`
+	Marks     int           `json:"marks"`
+	PosMarks  []int         `json:"pos_marks" doc:"Default marks for a correct answer, inherited by subjects that set none"`
+	NegMarks  []int         `json:"neg_marks" doc:"Default marks deducted for a wrong answer"`
+	ChapterID *int          `json:"chapter_id"`
+	Subjects  []TestSubject `json:"subjects"`
+	// Instructions always has an "en" entry when the test has instructions.
+	Instructions []Instructions `json:"instruction_lang_versions"`
+}
+
+type Instructions struct {
+	LangCode     string `json:"lang_code"`
+	Instructions string `json:"instructions" format:"html"`
+}
+
+type TestSubject struct {
+	SubjectID int       `json:"subject_id"`
+	Name      string    `json:"name" doc:"English subject name"`
+	Marks     int       `json:"marks"`
+	PosMarks  []int     `json:"pos_marks"`
+	NegMarks  []int     `json:"neg_marks"`
+	Sections  []Section `json:"sections"`
+}
+
+type Section struct {
+	Type       string          `json:"type" doc:"System identifier of the section type"`
+	Name       string          `json:"name" doc:"Display name"`
+	Marks      int             `json:"marks"`
+	PosMarks   []int           `json:"pos_marks"`
+	NegMarks   []int           `json:"neg_marks"`
+	Compulsory CompulsoryBlock `json:"compulsory"`
+	Optional   *OptionalBlock  `json:"optional" doc:"Problems of which a student answers mandatory_count; null when the section has none"`
+}
+
+type CompulsoryBlock struct {
+	Problems []ProblemRef `json:"problems"`
+}
+
+type OptionalBlock struct {
+	MandatoryCount int          `json:"mandatory_count"`
+	Problems       []ProblemRef `json:"problems"`
+}
+
+// ProblemRef places a problem in a section. Empty marks inherit the section's.
+type ProblemRef struct {
+	ID              int           `json:"id"`
+	PosMarks        []int         `json:"pos_marks"`
+	NegMarks        []int         `json:"neg_marks"`
+	DifficultyLevel string        `json:"difficulty_level" doc:"easy, medium or hard"`
+	OptionLayout    *OptionLayout `json:"option_layout"`
+}
+
+type OptionLayout struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+// Problem is a fully resolved problem. Images are inlined in the HTML as data URLs.
+type Problem struct {
+	ID              int               `json:"id"`
+	Code            string            `json:"code"`
+	Type            string            `json:"type"`
+	Subtype         string            `json:"subtype" doc:"single_choice, multi_choice, numerical, subjective, matrix_match, ..."`
+	SubjectID       int               `json:"subject_id"`
+	ChapterID       int               `json:"chapter_id"`
+	TopicID         int               `json:"topic_id"`
+	DifficultyLevel string            `json:"difficulty_level"`
+	SkillIDs        []int             `json:"skill_ids"`
+	TagIDs          []int             `json:"tag_ids"`
+	Paragraph       *Paragraph        `json:"paragraph" doc:"Shared passage of a paragraph-based problem"`
+	MetaData        ProblemContent    `json:"meta_data" doc:"English content"`
+	LangVersions    []ProblemLanguage `json:"lang_versions"`
+}
+
+type Paragraph struct {
+	ID   int    `json:"id"`
+	Body string `json:"body" format:"html"`
+}
+
+type ProblemLanguage struct {
+	LangCode string         `json:"lang_code"`
+	MetaData ProblemContent `json:"meta_data"`
+}
+
+type ProblemContent struct {
+	Text      string     `json:"text" format:"html"`
+	Options   []string   `json:"options" format:"html"`
+	Answers   []string   `json:"answer" doc:"Option indices for choice problems, values for numerical ones"`
+	Solutions []Solution `json:"solutions"`
+}
+
+type Solution struct {
+	Type  string `json:"type"`
+	Value string `json:"value" format:"html"`
+}
+
+// NewTestList converts listed tests.
+func NewTestList(tests []*models.Test) TestList {
+	list := TestList{Tests: make([]TestSummary, 0, len(tests))}
+	for _, t := range tests {
+		list.Tests = append(list.Tests, TestSummary{
+			ID:               t.ID,
+			Code:             t.Code,
+			Name:             names(t.Name),
+			Type:             t.Type,
+			Subtype:          t.Subtype,
+			ExamIDs:          ints(t.ExamIDs),
+			CurriculumGrades: curriculumGrades(t.CurriculumGrades),
+			ChapterID:        intPtr(t.TypeParams.ChapterID),
+			Marks:            int(t.TypeParams.Marks),
+			Duration:         t.TypeParams.Duration,
+			ProblemCount:     t.ProblemCount(),
+			StatusID:         int(t.StatusID),
+		})
+	}
+	return list
+}
+
+// NewAssembledTest converts a test and its problems.
+func NewAssembledTest(test *models.Test, problems []*models.Problem) AssembledTest {
+	assembled := AssembledTest{Test: newTest(test), Problems: make([]Problem, 0, len(problems))}
+	for _, p := range problems {
+		assembled.Problems = append(assembled.Problems, NewProblem(p))
+	}
+	return assembled
+}
+
+func newTest(t *models.Test) Test {
+	params := TestParams{
+		Duration:     t.TypeParams.Duration,
+		Marks:        int(t.TypeParams.Marks),
+		PosMarks:     ints(t.TypeParams.PosMarks),
+		NegMarks:     ints(t.TypeParams.NegMarks),
+		ChapterID:    intPtr(t.TypeParams.ChapterID),
+		Subjects:     make([]TestSubject, 0, len(t.TypeParams.Subjects)),
+		Instructions: make([]Instructions, 0, len(t.TypeParams.InstructionLangVersions)+1),
+	}
+	for _, v := range t.TypeParams.InstructionLangVersions {
+		params.Instructions = append(params.Instructions, Instructions{LangCode: v.LangCode, Instructions: string(v.Instructions)})
+	}
+	// tests not yet migrated to instruction_lang_versions keep English in the legacy field
+	if models.FindInstructionLangVersion(t.TypeParams.InstructionLangVersions, "en") == nil && t.TypeParams.Instructions != "" {
+		params.Instructions = append(params.Instructions, Instructions{LangCode: "en", Instructions: string(t.TypeParams.Instructions)})
+	}
+	for _, s := range t.TypeParams.Subjects {
+		subject := TestSubject{
+			SubjectID: int(s.SubjectID),
+			Name:      s.Name,
+			Marks:     s.Marks,
+			PosMarks:  ints(s.PosMarks),
+			NegMarks:  ints(s.NegMarks),
+			Sections:  make([]Section, 0, len(s.Sections)),
+		}
+		for _, sec := range s.Sections {
+			section := Section{
+				Type:       sec.Type,
+				Name:       sec.Name,
+				Marks:      int(sec.Marks),
+				PosMarks:   ints(sec.PosMarks),
+				NegMarks:   ints(sec.NegMarks),
+				Compulsory: CompulsoryBlock{Problems: problemRefs(sec.Compulsory.Problems)},
+			}
+			if sec.Optional != nil {
+				section.Optional = &OptionalBlock{
+					MandatoryCount: int(sec.Optional.MandatoryCount),
+					Problems:       problemRefs(sec.Optional.Problems),
+				}
+			}
+			subject.Sections = append(subject.Sections, section)
+		}
+		params.Subjects = append(params.Subjects, subject)
+	}
+
+	return Test{
+		ID:               t.ID,
+		Code:             t.Code,
+		Name:             names(t.Name),
+		Type:             t.Type,
+		Subtype:          t.Subtype,
+		ExamIDs:          ints(t.ExamIDs),
+		SkillIDs:         ints(t.SkillIDs),
+		CurriculumGrades: curriculumGrades(t.CurriculumGrades),
+		TypeParams:       params,
+		StatusID:         int(t.StatusID),
+	}
+}
+
+func problemRefs(refs []models.ResProblem) []ProblemRef {
+	out := make([]ProblemRef, 0, len(refs))
+	for _, r := range refs {
+		ref := ProblemRef{
+			ID:              r.ID,
+			PosMarks:        ints(r.PosMarks),
+			NegMarks:        ints(r.NegMarks),
+			DifficultyLevel: r.DifficultyLevel,
+		}
+		if r.OptionLayout != nil {
+			ref.OptionLayout = &OptionLayout{Rows: int(r.OptionLayout.Rows), Cols: int(r.OptionLayout.Cols)}
+		}
+		out = append(out, ref)
+	}
+	return out
+}
+
+// NewProblem converts a problem as assembled tests and topic problem lists carry it.
+func NewProblem(p *models.Problem) Problem {
+	problem := Problem{
+		ID:              p.ID,
+		Code:            p.Code,
+		Type:            p.Type,
+		Subtype:         p.Subtype,
+		SubjectID:       int(p.SubjectID),
+		ChapterID:       int(p.ChapterID),
+		TopicID:         int(p.TopicID),
+		DifficultyLevel: p.DifficultyLevel,
+		SkillIDs:        ints(p.SkillIDs),
+		TagIDs:          ints(p.TagIDs),
+		MetaData:        problemContent(p.MetaData),
+		LangVersions:    make([]ProblemLanguage, 0, len(p.LangVersions)),
+	}
+	if p.Paragraph != nil {
+		problem.Paragraph = &Paragraph{ID: p.Paragraph.ID, Body: string(p.Paragraph.Body)}
+	}
+	for _, v := range p.LangVersions {
+		problem.LangVersions = append(problem.LangVersions, ProblemLanguage{LangCode: v.LangCode,
+			MetaData: problemContent(v.MetaData)})
+	}
+	return problem
+}
+
+func problemContent(m models.ProbMetaData) ProblemContent {
+	content := ProblemContent{
+		Text:      string(m.Question),
+		Options:   make([]string, 0, len(m.Options)),
+		Answers:   make([]string, 0, len(m.Answers)),
+		Solutions: make([]Solution, 0, len(m.Solutions)),
+	}
+	for _, o := range m.Options {
+		content.Options = append(content.Options, string(o))
+	}
+	content.Answers = append(content.Answers, m.Answers...)
+	for _, s := range m.Solutions {
+		content.Solutions = append(content.Solutions, Solution{Type: s.Type, Value: string(s.Value)})
+	}
+	return content
+}
+
+func names(in []models.ResName) []Text {
+	out := make([]Text, 0, len(in))
+	for _, n := range in {
+		out = append(out, Text{LangCode: n.LangCode, Resource: n.Resource})
+	}
+	return out
+}
+
+func curriculumGrades(in []models.CurriculumGrade) []CurriculumGrade {
+	out := make([]CurriculumGrade, 0, len(in))
+	for _, cg := range in {
+		out = append(out, CurriculumGrade{CurriculumID: int(cg.CurriculumID), GradeID: int(cg.GradeID)})
+	}
+	return out
+}
+
+func ints[T int | int8 | int16](in []T) []int {
+	out := make([]int, 0, len(in))
+	for _, v := range in {
+		out = append(out, int(v))
+	}
+	return out
+}
+
+func intPtr(v *int16) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+	return &i
+}
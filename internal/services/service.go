@@ -14,6 +14,22 @@ import (
 type Service[T any] struct {
 	cacheRepository *local_repo.CacheRepository
 	apiRepository   *remote_repo.APIRepository
+	listeners       []func(Change)
+}
+
+// Kinds of Change.
+const (
+	Created  = "created"
+	Updated  = "updated"
+	Archived = "archived"
+	Deleted  = "deleted"
+	Moved    = "moved"
+)
+
+// Change describes a successful write through a Service: its kind and the id of the object.
+type Change struct {
+	Kind string
+	ID   string
 }
 
 // NewService creates a new instance of Service
@@ -24,6 +40,26 @@ func NewService[T any](cacheRepo *local_repo.CacheRepository, apiRepo *remote_re
 	}
 }
 
+// OnChange registers fn to be called after each successful create, update, archive or delete. It must
+// be called during setup, before the service is used.
+func (s *Service[T]) OnChange(fn func(Change)) {
+	s.listeners = append(s.listeners, fn)
+}
+
+func (s *Service[T]) changed(kind, id string) {
+	for _, fn := range s.listeners {
+		fn(Change{Kind: kind, ID: id})
+	}
+}
+
+// Changed reports writes made through Post, which the Service can't tell apart from reads (moves,
+// batch creates), to the OnChange listeners: one Change of kind per id.
+func (s *Service[T]) Changed(kind string, ids ...string) {
+	for _, id := range ids {
+		s.changed(kind, id)
+	}
+}
+
 // GetList returns data from cache or API
 func (s *Service[T]) GetList(urlEndPoint string, cacheKey string, onlyCache bool, onlyRemote bool) (*[]*T, error) {
 
@@ -114,6 +150,7 @@ func (s *Service[T]) UpdateObject(objIdStr string, urlEndPoint string, body any,
 		}
 	}
 
+	s.changed(Updated, objIdStr)
 	return objPtr, nil
 }
 
@@ -135,6 +172,7 @@ func (s *Service[T]) AddObject(body any, cacheKey string, urlEndPoint string) (*
 	if list != nil {
 		*list = append(*list, objPtr)
 	}
+	s.changed(Created, createdID(respBytes))
 	return objPtr, nil
 }
 
@@ -154,6 +192,7 @@ func (s *Service[T]) DeleteObject(objIdStr string, objKeepingPredicate func(*T)
 	if list != nil {
 		*list = funk.Filter(*list, objKeepingPredicate).([]*T)
 	}
+	s.changed(Deleted, objIdStr)
 	return nil
 }
 
@@ -169,6 +208,31 @@ func (s *Service[T]) ArchiveObject(objIdStr string, urlEndPoint string, body any
 	if list != nil {
 		*list = funk.Filter(*list, objKeepingPredicate).([]*T)
 	}
+	s.changed(Archived, objIdStr)
+	return nil
+}
+
+// createdID reads the id of a created object from the API response, whatever T calls it.
+func createdID(respBytes []byte) string {
+	var obj struct {
+		ID json.Number `json:"id"`
+	}
+	_ = json.Unmarshal(respBytes, &obj)
+	return obj.ID.String()
+}
+
+// Get fetches urlEndPoint straight from the API, bypassing the cache, and decodes it into result.
+func (s *Service[T]) Get(urlEndPoint string, result any) error {
+
+	respBytes, err := s.apiRepository.CallAPI(urlEndPoint, http.MethodGet, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(respBytes, result); err != nil {
+		return fmt.Errorf("error parsing response: %v", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,122 @@
+package similarity
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Fingerprint is the indexed form of one problem.
+type Fingerprint struct {
+	ProblemID int
+	Code      string
+	SubjectID int8
+	Signature Signature
+}
+
+// Match is a fingerprint paired with its estimated similarity to some query.
+type Match struct {
+	Fingerprint
+	Score float64
+}
+
+// Cluster is a group of problems connected by pairwise similarity at or above the
+// threshold. MaxScore is the strongest pair inside the group.
+type Cluster struct {
+	Members  []Fingerprint
+	MaxScore float64
+}
+
+// FindSimilar returns the candidates whose similarity to sig is at least threshold,
+// most similar first. excludeID skips the problem being checked (0 for a new problem).
+func FindSimilar(sig Signature, candidates []Fingerprint, excludeID int, threshold float64) []Match {
+	var matches []Match
+	for _, c := range candidates {
+		if c.ProblemID == excludeID {
+			continue
+		}
+		if score := Similarity(sig, c.Signature); score >= threshold {
+			matches = append(matches, Match{Fingerprint: c, Score: score})
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return matches
+}
+
+// Clusters groups likely duplicates across the whole set. LSH banding narrows the pairs
+// compared in full to those sharing a band within the same subject, so the scan stays
+// close to linear for a bank of tens of thousands of problems.
+func Clusters(fps []Fingerprint, threshold float64) []Cluster {
+	type bucketKey struct {
+		subjectID int8
+		band      int
+		key       uint64
+	}
+	buckets := make(map[bucketKey][]int)
+	for i, fp := range fps {
+		for band, key := range BandKeys(fp.Signature) {
+			k := bucketKey{fp.SubjectID, band, key}
+			buckets[k] = append(buckets[k], i)
+		}
+	}
+
+	parent := make([]int, len(fps))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	type pair struct{ a, b int }
+	compared := make(map[pair]bool)
+	best := make(map[int]float64)
+	for _, members := range buckets {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				p := pair{members[x], members[y]}
+				if compared[p] {
+					continue
+				}
+				compared[p] = true
+				score := Similarity(fps[p.a].Signature, fps[p.b].Signature)
+				if score < threshold {
+					continue
+				}
+				ra, rb := find(p.a), find(p.b)
+				if ra != rb {
+					parent[rb] = ra
+				}
+				root := find(p.a)
+				best[root] = max(best[root], best[ra], best[rb], score)
+			}
+		}
+	}
+
+	groups := make(map[int][]Fingerprint)
+	for i := range fps {
+		root := find(i)
+		groups[root] = append(groups[root], fps[i])
+	}
+
+	var clusters []Cluster
+	for root, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		slices.SortFunc(members, func(a, b Fingerprint) int { return cmp.Compare(a.ProblemID, b.ProblemID) })
+		clusters = append(clusters, Cluster{Members: members, MaxScore: best[root]})
+	}
+	slices.SortFunc(clusters, func(a, b Cluster) int {
+		if c := cmp.Compare(len(b.Members), len(a.Members)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Members[0].ProblemID, b.Members[0].ProblemID)
+	})
+	return clusters
+}
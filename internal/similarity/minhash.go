@@ -0,0 +1,136 @@
+package similarity
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+const (
+	// ShingleSize is the character n-gram length used to shingle normalized text.
+	ShingleSize = 5
+	// SignatureSize is the number of MinHash permutations per signature.
+	SignatureSize = 64
+	// bandRows × bandCount must equal SignatureSize. 16 bands of 4 rows puts the LSH
+	// candidate threshold at roughly (1/16)^(1/4) ≈ 0.5 Jaccard.
+	bandRows  = 4
+	bandCount = SignatureSize / bandRows
+
+	// DuplicateThreshold is the estimated Jaccard similarity at or above which two
+	// problems are flagged as likely duplicates.
+	DuplicateThreshold = 0.8
+)
+
+// Signature is a MinHash signature: the minimum permuted shingle hash per permutation.
+type Signature [SignatureSize]uint64
+
+// permutations holds the (a, b) coefficients of the hash family a*x + b. They are derived
+// from a fixed seed so signatures stay comparable across restarts and machines.
+var permutations = func() [SignatureSize][2]uint64 {
+	var perms [SignatureSize][2]uint64
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range perms {
+		perms[i][0] = splitMix64(&seed) | 1 // odd multiplier keeps the map a bijection
+		perms[i][1] = splitMix64(&seed)
+	}
+	return perms
+}()
+
+func splitMix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Shingles returns the distinct hashed character n-grams of text. Text shorter than
+// ShingleSize yields a single shingle of the whole string so it is still comparable.
+func Shingles(text string) map[uint64]struct{} {
+	runes := []rune(text)
+	set := make(map[uint64]struct{})
+	if len(runes) == 0 {
+		return set
+	}
+	if len(runes) < ShingleSize {
+		set[hashString(text)] = struct{}{}
+		return set
+	}
+	for i := 0; i+ShingleSize <= len(runes); i++ {
+		set[hashString(string(runes[i:i+ShingleSize]))] = struct{}{}
+	}
+	return set
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// Compute builds the MinHash signature of already-normalized text.
+func Compute(text string) Signature {
+	var sig Signature
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+	for shingle := range Shingles(text) {
+		for i, p := range permutations {
+			if v := p[0]*shingle + p[1]; v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// Similarity estimates the Jaccard similarity of the shingle sets behind two signatures.
+func Similarity(a, b Signature) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / SignatureSize
+}
+
+// BandKeys returns one hash per LSH band. Two signatures that share any band key are
+// candidate duplicates worth comparing in full.
+func BandKeys(sig Signature) [bandCount]uint64 {
+	var keys [bandCount]uint64
+	for band := range keys {
+		h := fnv.New64a()
+		buf := make([]byte, 8)
+		buf[0] = byte(band)
+		_, _ = h.Write(buf[:1])
+		for _, v := range sig[band*bandRows : (band+1)*bandRows] {
+			for j := range buf {
+				buf[j] = byte(v >> (8 * j))
+			}
+			_, _ = h.Write(buf)
+		}
+		keys[band] = h.Sum64()
+	}
+	return keys
+}
+
+// ToInt64s and FromInt64s convert a signature to and from the signed form Postgres
+// bigint[] columns can store.
+func (s Signature) ToInt64s() []int64 {
+	out := make([]int64, len(s))
+	for i, v := range s {
+		out[i] = int64(v)
+	}
+	return out
+}
+
+func FromInt64s(values []int64) (Signature, bool) {
+	var sig Signature
+	if len(values) != SignatureSize {
+		return sig, false
+	}
+	for i, v := range values {
+		sig[i] = uint64(v)
+	}
+	return sig, true
+}
@@ -0,0 +1,77 @@
+package similarity
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+var (
+	imgTagRe    = regexp.MustCompile(`(?is)<img[^>]*>`)
+	blockTagRe  = regexp.MustCompile(`(?i)</?(p|div|br|li|tr|td|h[1-6])[^>]*>`)
+	anyTagRe    = regexp.MustCompile(`(?s)<[^>]*>`)
+	texDelimRe  = regexp.MustCompile(`\\[()\[\]]|\$\$?`)
+	texSpaceRe  = regexp.MustCompile(`\\[,;:! ]|\\q?quad|~`)
+	texSizingRe = regexp.MustCompile(`\\(left|right|big|Big|bigg|Bigg)\b`)
+)
+
+// texAliases folds TeX commands that render identically onto one spelling, so that
+// "\dfrac" and "\frac" fingerprint the same.
+var texAliases = strings.NewReplacer(
+	`\dfrac`, `\frac`,
+	`\tfrac`, `\frac`,
+	`\displaystyle`, ``,
+	`\textstyle`, ``,
+	`\mathrm`, ``,
+	`\text`, ``,
+	`\cdot`, `*`,
+	`\times`, `*`,
+	`\le `, `\leq `,
+	`\ge `, `\geq `,
+)
+
+// Normalize reduces problem HTML to a canonical plain-text form for fingerprinting:
+// images are dropped, tags stripped, entities decoded, TeX delimiters and spacing
+// commands removed, equivalent TeX commands folded, and whitespace/case collapsed.
+func Normalize(body string) string {
+	s := imgTagRe.ReplaceAllString(body, " ")
+	s = blockTagRe.ReplaceAllString(s, " ")
+	s = anyTagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	s = texDelimRe.ReplaceAllString(s, " ")
+	s = texSpaceRe.ReplaceAllString(s, " ")
+	s = texSizingRe.ReplaceAllString(s, "")
+	s = texAliases.Replace(s + " ")
+
+	// Braces only group in TeX; "x^{2}" and "x^2" are the same problem.
+	s = strings.NewReplacer("{", "", "}", "").Replace(s)
+
+	s = strings.ToLower(s)
+	// Fields (unlike \s) also splits on the &nbsp; rich-text editors emit.
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ProblemText is the normalized text a problem is fingerprinted on: the English question
+// followed by its options (falling back to the first language version when English is missing),
+// prefixed by the comprehension paragraph if there is one.
+func ProblemText(p *models.Problem) string {
+	lv := p.GetLangVersion("en")
+	if lv == nil && len(p.LangVersions) > 0 {
+		lv = &p.LangVersions[0]
+	}
+
+	var parts []string
+	if p.Paragraph != nil {
+		parts = append(parts, string(p.Paragraph.Body))
+	}
+	if lv != nil {
+		parts = append(parts, string(lv.MetaData.Question))
+		for _, option := range lv.MetaData.Options {
+			parts = append(parts, string(option))
+		}
+	}
+	return Normalize(strings.Join(parts, " "))
+}
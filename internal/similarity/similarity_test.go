@@ -0,0 +1,94 @@
+package similarity
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"strips tags and entities", "<p>Find&nbsp;<b>x</b></p>", "find x"},
+		{"drops images", `<div>Look <img src="data:image/png;base64,AAAA"> here</div>`, "look here"},
+		{"inline math delimiters", `\(x^2\) and $$y$$`, "x^2 and y"},
+		{"folds dfrac into frac", `\(\dfrac{1}{2}\)`, `\frac12`},
+		{"braces and sizing", `\left( x^{2} \right)`, "( x^2 )"},
+		{"case and whitespace", "  A   B\n C ", "a b c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemTextFallsBackToFirstLanguage(t *testing.T) {
+	p := &models.Problem{LangVersions: []models.LangVersion{
+		{LangCode: "hi", MetaData: models.ProbMetaData{Question: "<p>Q</p>", Options: []template.HTML{"A", "B"}}},
+	}}
+	if got := ProblemText(p); got != "q a b" {
+		t.Errorf("ProblemText = %q, want %q", got, "q a b")
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	base := Normalize(`<p>A ball is thrown vertically upward with speed \(20\,m/s\). Find the maximum height.</p>`)
+	sameMath := Normalize(`<div>A ball is thrown vertically upward with speed $$20 m/s$$. Find the maximum height.</div>`)
+	other := Normalize(`<p>Calculate the molar mass of sodium chloride.</p>`)
+
+	if s := Similarity(Compute(base), Compute(sameMath)); s < DuplicateThreshold {
+		t.Errorf("reformatted copy similarity = %.2f, want >= %.2f", s, DuplicateThreshold)
+	}
+	if s := Similarity(Compute(base), Compute(other)); s >= DuplicateThreshold {
+		t.Errorf("unrelated problem similarity = %.2f, want < %.2f", s, DuplicateThreshold)
+	}
+	if s := Similarity(Compute(""), Compute("")); s != 1 {
+		t.Errorf("empty vs empty similarity = %.2f, want 1", s)
+	}
+}
+
+func TestSignatureRoundTrip(t *testing.T) {
+	sig := Compute("round trip through postgres bigint[]")
+	got, ok := FromInt64s(sig.ToInt64s())
+	if !ok || got != sig {
+		t.Fatalf("FromInt64s(ToInt64s()) did not round-trip")
+	}
+	if _, ok := FromInt64s([]int64{1, 2}); ok {
+		t.Errorf("FromInt64s accepted a short slice")
+	}
+}
+
+func TestFindSimilarAndClusters(t *testing.T) {
+	q := "a car accelerates uniformly from rest to 30 m/s in 10 s. find its acceleration."
+	fps := []Fingerprint{
+		{ProblemID: 1, Code: "P1", SubjectID: 1, Signature: Compute(q)},
+		{ProblemID: 2, Code: "P2", SubjectID: 1, Signature: Compute(q)},
+		{ProblemID: 3, Code: "P3", SubjectID: 1, Signature: Compute("state newton's third law of motion with an example.")},
+		// Same text in another subject is not clustered with subject 1.
+		{ProblemID: 4, Code: "P4", SubjectID: 2, Signature: Compute(q)},
+	}
+
+	matches := FindSimilar(Compute(q), fps, 1, DuplicateThreshold)
+	if len(matches) != 2 || matches[0].ProblemID == 1 {
+		t.Fatalf("FindSimilar = %+v, want problems 2 and 4 (excluding 1)", matches)
+	}
+
+	clusters := Clusters(fps, DuplicateThreshold)
+	if len(clusters) != 1 {
+		t.Fatalf("Clusters returned %d clusters, want 1", len(clusters))
+	}
+	got := clusters[0]
+	if len(got.Members) != 2 || got.Members[0].ProblemID != 1 || got.Members[1].ProblemID != 2 {
+		t.Errorf("cluster members = %+v, want problems 1 and 2", got.Members)
+	}
+	if got.MaxScore != 1 {
+		t.Errorf("cluster MaxScore = %.2f, want 1", got.MaxScore)
+	}
+}
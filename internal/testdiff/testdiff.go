@@ -0,0 +1,312 @@
+// Package testdiff compares two versions of a test structurally: subjects, sections and problems
+// added, removed or reordered, and marks changes at each level of the test → subject → section →
+// problem cascade.
+package testdiff
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Status of a subject, section or problem between the two versions.
+const (
+	Unchanged = "unchanged"
+	Changed   = "changed"
+	Added     = "added"
+	Removed   = "removed"
+	Moved     = "moved"
+)
+
+// FieldChange is one scalar difference, e.g. marks 40 → 48.
+type FieldChange struct {
+	Field    string
+	Old, New string
+}
+
+type Report struct {
+	Test     []FieldChange
+	Subjects []SubjectDiff
+}
+
+type SubjectDiff struct {
+	SubjectID int8
+	Name      string
+	Status    string
+	Changes   []FieldChange
+	Sections  []SectionDiff
+}
+
+type SectionDiff struct {
+	Type     string
+	Name     string
+	Status   string
+	Changes  []FieldChange
+	Problems []ProblemDiff
+}
+
+// ProblemDiff describes a problem that was added, removed, moved or re-marked. Position is
+// 1-based within its list (compulsory or optional); OldPosition is set for moved problems.
+type ProblemDiff struct {
+	ID          int
+	Optional    bool
+	Status      string
+	Position    int
+	OldPosition int
+	Changes     []FieldChange
+}
+
+// Empty reports whether the two versions are structurally identical.
+func (r Report) Empty() bool {
+	if len(r.Test) > 0 {
+		return false
+	}
+	for _, s := range r.Subjects {
+		if s.Status != Unchanged {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff compares old and new. Subjects are matched by subject ID, sections within a subject by
+// type (and occurrence, should a type repeat), problems by ID within the compulsory and
+// optional lists of a section.
+func Diff(old, new *models.Test) Report {
+	var r Report
+	r.Test = marksChanges(
+		marks{int(old.TypeParams.Marks), old.TypeParams.PosMarks, old.TypeParams.NegMarks},
+		marks{int(new.TypeParams.Marks), new.TypeParams.PosMarks, new.TypeParams.NegMarks})
+	if old.TypeParams.Duration != new.TypeParams.Duration {
+		r.Test = append(r.Test, FieldChange{"Duration", old.TypeParams.Duration, new.TypeParams.Duration})
+	}
+
+	oldSubjects := map[int8]*models.ResSubject{}
+	for i := range old.TypeParams.Subjects {
+		oldSubjects[old.TypeParams.Subjects[i].SubjectID] = &old.TypeParams.Subjects[i]
+	}
+	seen := map[int8]bool{}
+	for i := range new.TypeParams.Subjects {
+		newSubject := &new.TypeParams.Subjects[i]
+		seen[newSubject.SubjectID] = true
+		r.Subjects = append(r.Subjects, diffSubject(oldSubjects[newSubject.SubjectID], newSubject))
+	}
+	for i := range old.TypeParams.Subjects {
+		if oldSubject := &old.TypeParams.Subjects[i]; !seen[oldSubject.SubjectID] {
+			r.Subjects = append(r.Subjects, diffSubject(oldSubject, nil))
+		}
+	}
+	return r
+}
+
+func diffSubject(old, new *models.ResSubject) SubjectDiff {
+	d := SubjectDiff{Status: Unchanged}
+	switch {
+	case old == nil:
+		d.SubjectID, d.Name, d.Status = new.SubjectID, new.Name, Added
+		old = &models.ResSubject{}
+	case new == nil:
+		d.SubjectID, d.Name, d.Status = old.SubjectID, old.Name, Removed
+		new = &models.ResSubject{}
+	default:
+		d.SubjectID, d.Name = new.SubjectID, new.Name
+	}
+
+	d.Changes = marksChanges(marks{old.Marks, old.PosMarks, old.NegMarks}, marks{new.Marks, new.PosMarks, new.NegMarks})
+
+	oldSections, newSections := keyedSections(old.Sections), keyedSections(new.Sections)
+	for _, key := range newSections.keys {
+		d.Sections = append(d.Sections, diffSection(oldSections.sections[key], newSections.sections[key]))
+	}
+	for _, key := range oldSections.keys {
+		if _, ok := newSections.sections[key]; !ok {
+			d.Sections = append(d.Sections, diffSection(oldSections.sections[key], nil))
+		}
+	}
+
+	if d.Status == Unchanged && len(d.Changes) > 0 {
+		d.Status = Changed
+	}
+	for _, s := range d.Sections {
+		if d.Status == Unchanged && s.Status != Unchanged {
+			d.Status = Changed
+		}
+	}
+	return d
+}
+
+func diffSection(old, new *models.ResSection) SectionDiff {
+	d := SectionDiff{Status: Unchanged}
+	switch {
+	case old == nil:
+		d.Type, d.Name, d.Status = new.Type, new.Name, Added
+		old = &models.ResSection{}
+	case new == nil:
+		d.Type, d.Name, d.Status = old.Type, old.Name, Removed
+		new = &models.ResSection{}
+	default:
+		d.Type, d.Name = new.Type, new.Name
+		if old.Name != new.Name {
+			d.Changes = append(d.Changes, FieldChange{"Name", old.Name, new.Name})
+		}
+	}
+
+	d.Changes = append(d.Changes, marksChanges(
+		marks{int(old.Marks), old.PosMarks, old.NegMarks}, marks{int(new.Marks), new.PosMarks, new.NegMarks})...)
+	if oldCount, newCount := mandatoryCount(old), mandatoryCount(new); oldCount != newCount {
+		d.Changes = append(d.Changes, FieldChange{"Mandatory count", fmt.Sprint(oldCount), fmt.Sprint(newCount)})
+	}
+
+	d.Problems = diffProblems(old.Compulsory.Problems, new.Compulsory.Problems, false)
+	d.Problems = append(d.Problems, diffProblems(optionalProblems(old), optionalProblems(new), true)...)
+
+	if d.Status == Unchanged && (len(d.Changes) > 0 || len(d.Problems) > 0) {
+		d.Status = Changed
+	}
+	return d
+}
+
+// diffProblems reports added, removed, moved and re-marked problems in one list. Moves are the
+// problems present in both versions but outside their longest common subsequence, so that
+// inserting one problem doesn't flag everything after it as moved.
+func diffProblems(old, new []models.ResProblem, optional bool) []ProblemDiff {
+	oldPos := map[int]int{}
+	for i, p := range old {
+		oldPos[p.ID] = i
+	}
+	newPos := map[int]int{}
+	for i, p := range new {
+		newPos[p.ID] = i
+	}
+
+	var oldCommon, newCommon []int
+	for _, p := range old {
+		if _, ok := newPos[p.ID]; ok {
+			oldCommon = append(oldCommon, p.ID)
+		}
+	}
+	for _, p := range new {
+		if _, ok := oldPos[p.ID]; ok {
+			newCommon = append(newCommon, p.ID)
+		}
+	}
+	stayed := lcs(oldCommon, newCommon)
+
+	var diffs []ProblemDiff
+	for i, p := range new {
+		d := ProblemDiff{ID: p.ID, Optional: optional, Position: i + 1, Status: Unchanged}
+		j, existed := oldPos[p.ID]
+		switch {
+		case !existed:
+			d.Status = Added
+		default:
+			if !stayed[p.ID] {
+				d.Status, d.OldPosition = Moved, j+1
+			}
+			d.Changes = marksChanges(marks{0, old[j].PosMarks, old[j].NegMarks}, marks{0, p.PosMarks, p.NegMarks})
+			if d.Status == Unchanged && len(d.Changes) > 0 {
+				d.Status = Changed
+			}
+		}
+		if d.Status != Unchanged {
+			diffs = append(diffs, d)
+		}
+	}
+	for i, p := range old {
+		if _, ok := newPos[p.ID]; !ok {
+			diffs = append(diffs, ProblemDiff{ID: p.ID, Optional: optional, Position: i + 1, Status: Removed})
+		}
+	}
+	return diffs
+}
+
+// lcs returns the IDs of a longest common subsequence of a and b.
+func lcs(a, b []int) map[int]bool {
+	n, m := len(a), len(b)
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+	common := map[int]bool{}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a[i] == b[j]:
+			common[a[i]] = true
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return common
+}
+
+type marks struct {
+	total    int
+	pos, neg []int8
+}
+
+func marksChanges(old, new marks) []FieldChange {
+	var changes []FieldChange
+	if old.total != new.total {
+		changes = append(changes, FieldChange{"Marks", fmt.Sprint(old.total), fmt.Sprint(new.total)})
+	}
+	if !slices.Equal(old.pos, new.pos) {
+		changes = append(changes, FieldChange{"Positive marks", formatMarks(old.pos), formatMarks(new.pos)})
+	}
+	if !slices.Equal(old.neg, new.neg) {
+		changes = append(changes, FieldChange{"Negative marks", formatMarks(old.neg), formatMarks(new.neg)})
+	}
+	return changes
+}
+
+func formatMarks(values []int8) string {
+	if len(values) == 0 {
+		return "—"
+	}
+	return fmt.Sprint(values)
+}
+
+func mandatoryCount(s *models.ResSection) int8 {
+	if s.Optional == nil {
+		return 0
+	}
+	return s.Optional.MandatoryCount
+}
+
+func optionalProblems(s *models.ResSection) []models.ResProblem {
+	if s.Optional == nil {
+		return nil
+	}
+	return s.Optional.Problems
+}
+
+// sectionList keys sections by type plus occurrence ("mcq_single_answer#2") while keeping order.
+type sectionList struct {
+	keys     []string
+	sections map[string]*models.ResSection
+}
+
+func keyedSections(sections []models.ResSection) sectionList {
+	l := sectionList{sections: map[string]*models.ResSection{}}
+	occurrences := map[string]int{}
+	for i := range sections {
+		occurrences[sections[i].Type]++
+		key := fmt.Sprintf("%s#%d", sections[i].Type, occurrences[sections[i].Type])
+		l.keys = append(l.keys, key)
+		l.sections[key] = &sections[i]
+	}
+	return l
+}
@@ -0,0 +1,95 @@
+package testdiff
+
+import (
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func problems(ids ...int) []models.ResProblem {
+	out := make([]models.ResProblem, len(ids))
+	for i, id := range ids {
+		out[i] = models.ResProblem{ID: id, PosMarks: []int8{4}}
+	}
+	return out
+}
+
+func testWith(subjects ...models.ResSubject) *models.Test {
+	return &models.Test{TypeParams: models.ResTypeParams{Marks: 100, Duration: "180", Subjects: subjects}}
+}
+
+func subject(id int8, sections ...models.ResSection) models.ResSubject {
+	return models.ResSubject{SubjectID: id, Marks: 40, Sections: sections}
+}
+
+func section(sectionType string, ids ...int) models.ResSection {
+	return models.ResSection{Type: sectionType, Compulsory: models.ResCompulsory{Problems: problems(ids...)}}
+}
+
+func TestDiffProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []int
+		new  []int
+		want []ProblemDiff
+	}{
+		{"unchanged", []int{1, 2, 3}, []int{1, 2, 3}, nil},
+		{"insert does not move followers", []int{1, 2, 3}, []int{1, 9, 2, 3},
+			[]ProblemDiff{{ID: 9, Status: Added, Position: 2}}},
+		{"removed", []int{1, 2, 3}, []int{1, 3},
+			[]ProblemDiff{{ID: 2, Status: Removed, Position: 2}}},
+		{"moved to front", []int{1, 2, 3}, []int{3, 1, 2},
+			[]ProblemDiff{{ID: 3, Status: Moved, Position: 1, OldPosition: 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffProblems(problems(tt.old...), problems(tt.new...), false)
+			if len(got) != len(tt.want) {
+				t.Fatalf("diffProblems = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.ID != w.ID || g.Status != w.Status || g.Position != w.Position || g.OldPosition != w.OldPosition {
+					t.Errorf("diff[%d] = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffCascade(t *testing.T) {
+	old := testWith(
+		subject(1, section("mcq_single_answer", 1, 2)),
+		subject(2, section("numerical_answer", 5)),
+	)
+	new := testWith(
+		subject(1, section("mcq_single_answer", 1, 2), section("integer_type", 7)),
+	)
+	new.TypeParams.Marks = 120
+	new.TypeParams.Subjects[0].Sections[0].Compulsory.Problems[1].PosMarks = []int8{3}
+
+	r := Diff(old, new)
+	if r.Empty() {
+		t.Fatal("Diff reported no changes")
+	}
+	if len(r.Test) != 1 || r.Test[0].Field != "Marks" || r.Test[0].Old != "100" || r.Test[0].New != "120" {
+		t.Errorf("test-level changes = %+v, want Marks 100 → 120", r.Test)
+	}
+	if len(r.Subjects) != 2 || r.Subjects[0].Status != Changed || r.Subjects[1].Status != Removed {
+		t.Fatalf("subjects = %+v, want subject 1 changed and subject 2 removed", r.Subjects)
+	}
+
+	sections := r.Subjects[0].Sections
+	if len(sections) != 2 || sections[0].Status != Changed || sections[1].Status != Added {
+		t.Fatalf("sections = %+v, want mcq changed and integer added", sections)
+	}
+	remarked := sections[0].Problems
+	if len(remarked) != 1 || remarked[0].ID != 2 || remarked[0].Status != Changed ||
+		remarked[0].Changes[0].Field != "Positive marks" {
+		t.Errorf("problems = %+v, want problem 2 re-marked", remarked)
+	}
+
+	if !Diff(old, old).Empty() {
+		t.Error("Diff of a test with itself is not empty")
+	}
+}
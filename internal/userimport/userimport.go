@@ -0,0 +1,226 @@
+// Package userimport parses and validates the CSV used to add CMS users in bulk. A file has a header
+// row naming its columns: email and role are required; full_name, scopes and scope_role are optional.
+//
+// scopes is a ;-separated list of curriculum/grade/subject paths, each granted scope_role (editor by
+// default) on top of the user's global role, e.g. "CBSE/10/Physics; CBSE/9/*". A curriculum is
+// matched by name or code, a grade by number and a subject by English name or code; * or an empty
+// part means any.
+package userimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// MaxRows caps how many users one file may add.
+const MaxRows = 500
+
+var (
+	ErrMissingColumns = errors.New("the header row must name the email and role columns")
+	ErrTooManyRows    = fmt.Errorf("at most %d users can be imported at once", MaxRows)
+)
+
+// Row is one user line of the file, with the problems found in it.
+type Row struct {
+	Line     int
+	Email    string
+	Role     string
+	FullName string
+	// Grants are the scoped grants to add; UserID is filled in once the user exists.
+	Grants      []models.UserGrant
+	ScopeLabels []string
+	// Exists marks a user who is already in the CMS; such rows are skipped, not errors.
+	Exists bool
+	Errors []string
+}
+
+// Valid reports whether the row can be imported.
+func (r *Row) Valid() bool {
+	return len(r.Errors) == 0 && !r.Exists
+}
+
+// Options supplies what validation checks rows against.
+type Options struct {
+	// AllowEmail reports whether an email can sign in at all (see auth.OIDCProviders.AcceptsEmail).
+	AllowEmail func(email string) bool
+	// Existing holds the lower-cased emails of current users.
+	Existing map[string]bool
+	Lookup   Lookup
+}
+
+// Lookup resolves the names used in scope paths to IDs.
+type Lookup struct {
+	curriculums map[string]int16
+	grades      map[string]int8
+	subjects    map[string]int8
+}
+
+// NewLookup indexes curriculums, grades and subjects for scope paths.
+func NewLookup(curriculums []*models.Curriculum, grades []*models.Grade, subjects []*models.Subject) Lookup {
+	l := Lookup{curriculums: map[string]int16{}, grades: map[string]int8{}, subjects: map[string]int8{}}
+	for _, c := range curriculums {
+		l.curriculums[strings.ToLower(c.Name)] = c.ID
+		if c.Code != "" {
+			l.curriculums[strings.ToLower(c.Code)] = c.ID
+		}
+	}
+	for _, g := range grades {
+		l.grades[strconv.Itoa(int(g.Number))] = g.ID
+	}
+	for _, s := range subjects {
+		l.subjects[strings.ToLower(s.GetNameByLang("en"))] = s.ID
+		if s.Code != "" {
+			l.subjects[strings.ToLower(s.Code)] = s.ID
+		}
+	}
+	return l
+}
+
+// Parse reads and validates a CSV file. Problems with individual rows are reported on the rows;
+// an error is returned only when the file as a whole can't be used.
+func Parse(r io.Reader, opts Options) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrMissingColumns
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, ErrMissingColumns
+	}
+	if _, ok := columns["role"]; !ok {
+		return nil, ErrMissingColumns
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []Row
+	seen := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if len(rows) == MaxRows {
+			return nil, ErrTooManyRows
+		}
+		line, _ := reader.FieldPos(0)
+		row := Row{
+			Line:     line,
+			Email:    field(record, "email"),
+			Role:     strings.ToLower(field(record, "role")),
+			FullName: field(record, "full_name"),
+		}
+		key := strings.ToLower(row.Email)
+
+		switch {
+		case row.Email == "" || !strings.Contains(row.Email, "@"):
+			row.Errors = append(row.Errors, "invalid email")
+		case opts.AllowEmail != nil && !opts.AllowEmail(row.Email):
+			row.Errors = append(row.Errors, "email domain can't sign in")
+		case seen[key] != 0:
+			row.Errors = append(row.Errors, fmt.Sprintf("duplicate of line %d", seen[key]))
+		case opts.Existing[key]:
+			row.Exists = true
+		}
+		if seen[key] == 0 {
+			seen[key] = line
+		}
+		if !auth.ValidRole(row.Role) {
+			row.Errors = append(row.Errors, fmt.Sprintf("invalid role %q", row.Role))
+		}
+
+		scopeRole := strings.ToLower(field(record, "scope_role"))
+		if scopeRole == "" {
+			scopeRole = auth.RoleEditor
+		}
+		if scopes := field(record, "scopes"); scopes != "" {
+			if !auth.ValidRole(scopeRole) {
+				row.Errors = append(row.Errors, fmt.Sprintf("invalid scope_role %q", scopeRole))
+			}
+			for _, path := range strings.Split(scopes, ";") {
+				if path = strings.TrimSpace(path); path == "" {
+					continue
+				}
+				grant, err := opts.Lookup.grant(path, scopeRole)
+				if err != nil {
+					row.Errors = append(row.Errors, err.Error())
+					continue
+				}
+				row.Grants = append(row.Grants, grant)
+				row.ScopeLabels = append(row.ScopeLabels, path)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// grant resolves a curriculum/grade/subject path to a grant of role on that scope.
+func (l Lookup) grant(path, role string) (models.UserGrant, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) > 3 {
+		return models.UserGrant{}, fmt.Errorf("scope %q: use curriculum/grade/subject", path)
+	}
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	for i := range parts {
+		if parts[i] = strings.TrimSpace(parts[i]); parts[i] == "*" {
+			parts[i] = ""
+		}
+	}
+
+	grant := models.UserGrant{Role: role}
+	if name := parts[0]; name != "" {
+		id, ok := l.curriculums[strings.ToLower(name)]
+		if !ok {
+			return grant, fmt.Errorf("scope %q: unknown curriculum %q", path, name)
+		}
+		grant.CurriculumID = &id
+	}
+	if name := parts[1]; name != "" {
+		id, ok := l.grades[name]
+		if !ok {
+			return grant, fmt.Errorf("scope %q: unknown grade %q", path, name)
+		}
+		grant.GradeID = &id
+	}
+	if name := parts[2]; name != "" {
+		id, ok := l.subjects[strings.ToLower(name)]
+		if !ok {
+			return grant, fmt.Errorf("scope %q: unknown subject %q", path, name)
+		}
+		grant.SubjectID = &id
+	}
+	if grant.CurriculumID == nil && grant.GradeID == nil && grant.SubjectID == nil {
+		return grant, fmt.Errorf("scope %q names no curriculum, grade or subject", path)
+	}
+	return grant, nil
+}
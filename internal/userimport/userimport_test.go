@@ -0,0 +1,126 @@
+package userimport
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+func testOptions() Options {
+	return Options{
+		AllowEmail: func(email string) bool { return strings.HasSuffix(strings.ToLower(email), "@avantifellows.org") },
+		Existing:   map[string]bool{"old@avantifellows.org": true},
+		Lookup: NewLookup(
+			[]*models.Curriculum{{ID: 1, Name: "CBSE", Code: "cbse"}, {ID: 2, Name: "JEE Mains", Code: "jee"}},
+			[]*models.Grade{{ID: 3, Number: 9}, {ID: 4, Number: 10}},
+			[]*models.Subject{{ID: 5, Code: "phy", Name: []models.SubjectLang{{LangCode: "en", SubName: "Physics"}}}},
+		),
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		csv        string
+		wantErr    error
+		wantValid  []bool
+		wantErrors []string // first error on each row, "" for none
+		wantGrants []int
+	}{
+		{
+			name:       "valid rows",
+			csv:        "email,role,full_name\na@avantifellows.org,editor,A\nb@avantifellows.org,Viewer,\n",
+			wantValid:  []bool{true, true},
+			wantErrors: []string{"", ""},
+			wantGrants: []int{0, 0},
+		},
+		{
+			name:       "header is case-insensitive and column order is free",
+			csv:        "\ufeffRole, Email\nadmin,a@avantifellows.org\n",
+			wantValid:  []bool{true},
+			wantErrors: []string{""},
+			wantGrants: []int{0},
+		},
+		{
+			name: "invalid rows",
+			csv: "email,role\nnot-an-email,editor\nx@gmail.com,editor\na@avantifellows.org,owner\n" +
+				"a@avantifellows.org,editor\nA@avantifellows.org,editor\n",
+			wantValid: []bool{false, false, false, false, false},
+			wantErrors: []string{"invalid email", "email domain can't sign in", `invalid role "owner"`,
+				"duplicate of line 4", "duplicate of line 4"},
+			wantGrants: []int{0, 0, 0, 0, 0},
+		},
+		{
+			name:       "existing users are skipped",
+			csv:        "email,role\nOld@avantifellows.org,editor\n",
+			wantValid:  []bool{false},
+			wantErrors: []string{""},
+			wantGrants: []int{0},
+		},
+		{
+			name: "scopes",
+			csv: "email,role,scopes,scope_role\na@avantifellows.org,viewer,CBSE/10/Physics; jee/*/phy ;cbse/9,\n" +
+				"b@avantifellows.org,viewer,*/10,admin\n",
+			wantValid:  []bool{true, true},
+			wantErrors: []string{"", ""},
+			wantGrants: []int{3, 1},
+		},
+		{
+			name: "bad scopes",
+			csv: "email,role,scopes,scope_role\na@avantifellows.org,viewer,ICSE/10,\nb@avantifellows.org,viewer,*/*/*,\n" +
+				"c@avantifellows.org,viewer,CBSE/11,\nd@avantifellows.org,viewer,CBSE/10/Physics/x,\n" +
+				"e@avantifellows.org,viewer,CBSE,owner\n",
+			wantValid: []bool{false, false, false, false, false},
+			wantErrors: []string{`scope "ICSE/10": unknown curriculum "ICSE"`,
+				`scope "*/*/*" names no curriculum, grade or subject`, `scope "CBSE/11": unknown grade "11"`,
+				`scope "CBSE/10/Physics/x": use curriculum/grade/subject`, `invalid scope_role "owner"`},
+			wantGrants: []int{0, 0, 0, 0, 1},
+		},
+		{name: "missing role column", csv: "email,full_name\na@avantifellows.org,A\n", wantErr: ErrMissingColumns},
+		{name: "empty file", csv: "", wantErr: ErrMissingColumns},
+		{name: "too many rows", csv: "email,role\n" + strings.Repeat("a@avantifellows.org,editor\n", MaxRows+1),
+			wantErr: ErrTooManyRows},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rows, err := Parse(strings.NewReader(tc.csv), testOptions())
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if len(rows) != len(tc.wantValid) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tc.wantValid))
+			}
+			for i, row := range rows {
+				if row.Valid() != tc.wantValid[i] {
+					t.Errorf("row %d valid = %v, want %v (errors %v)", i, row.Valid(), tc.wantValid[i], row.Errors)
+				}
+				first := ""
+				if len(row.Errors) > 0 {
+					first = row.Errors[0]
+				}
+				if first != tc.wantErrors[i] {
+					t.Errorf("row %d error = %q, want %q", i, first, tc.wantErrors[i])
+				}
+				if len(row.Grants) != tc.wantGrants[i] {
+					t.Errorf("row %d has %d grants, want %d", i, len(row.Grants), tc.wantGrants[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseResolvesScopes(t *testing.T) {
+	rows, err := Parse(strings.NewReader("email,role,scopes,scope_role\na@avantifellows.org,viewer,cbse/10/physics,admin\n"),
+		testOptions())
+	if err != nil || len(rows) != 1 || len(rows[0].Grants) != 1 {
+		t.Fatalf("rows = %+v, err = %v", rows, err)
+	}
+	g := rows[0].Grants[0]
+	if g.CurriculumID == nil || *g.CurriculumID != 1 || g.GradeID == nil || *g.GradeID != 4 ||
+		g.SubjectID == nil || *g.SubjectID != 5 || g.Role != "admin" {
+		t.Errorf("grant = %+v", g)
+	}
+}
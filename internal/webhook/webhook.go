@@ -0,0 +1,188 @@
+// Package webhook tells downstream systems (quiz-backend, af_lms) when content changes, so they can
+// re-fetch it instead of serving stale copies. Admins register endpoints and the event types they want
+// at /admin/webhooks. A successful Service write publishes an event. The event is queued as one
+// delivery per subscribed endpoint, and the Worker POSTs it, signed with the endpoint's secret,
+// retrying with backoff.
+//
+// Events are thin: they name the entity, and receivers fetch its current state from /api/service/v1.
+// Delivery is at least once; retries of a delivery carry the same X-CMS-Delivery header.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/services"
+)
+
+// Event types an endpoint can subscribe to.
+const (
+	TestUpdated     = "test.updated"
+	TestArchived    = "test.archived"
+	ProblemUpdated  = "problem.updated"
+	ChapterArchived = "chapter.archived"
+)
+
+// EventTypes lists the event types in the order the admin screen offers them.
+func EventTypes() []string {
+	return []string{TestUpdated, TestArchived, ProblemUpdated, ChapterArchived}
+}
+
+// ValidEventType reports whether t is one of EventTypes.
+func ValidEventType(t string) bool {
+	return slices.Contains(EventTypes(), t)
+}
+
+// Request headers of a delivery.
+const (
+	SignatureHeader = "X-CMS-Signature"
+	EventHeader     = "X-CMS-Event"
+	DeliveryHeader  = "X-CMS-Delivery"
+)
+
+// Event is the JSON body POSTed to endpoints.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       EventData `json:"data"`
+}
+
+type EventData struct {
+	EntityType string `json:"entity_type"`
+	EntityID   int    `json:"entity_id"`
+}
+
+// Queue stores published events as deliveries (db.WebhookRepo).
+type Queue interface {
+	// Enqueue adds a delivery of the event for every active endpoint subscribed to eventType, and
+	// returns how many it added.
+	Enqueue(ctx context.Context, eventID, eventType string, payload []byte) (int, error)
+}
+
+// Notifier publishes events to the queue and wakes the worker.
+type Notifier struct {
+	queue  Queue
+	worker *Worker
+	now    func() time.Time
+}
+
+func NewNotifier(queue Queue, worker *Worker) *Notifier {
+	return &Notifier{queue: queue, worker: worker, now: time.Now}
+}
+
+// enqueueTimeout bounds the queue insert done in the request that made the change.
+const enqueueTimeout = 5 * time.Second
+
+// Publish queues an event of type entityType + "." + kind. Changes no endpoint can subscribe to are
+// dropped. A failure to queue is logged, not returned: the content write it follows has already
+// succeeded.
+func (n *Notifier) Publish(entityType, kind, entityID string) {
+	eventType := entityType + "." + kind
+	if !ValidEventType(eventType) {
+		return
+	}
+	id, err := strconv.Atoi(entityID)
+	if err != nil {
+		log.Printf("webhook %s: bad entity id %q", eventType, entityID)
+		return
+	}
+	event := Event{Type: eventType, OccurredAt: n.now().UTC(), Data: EventData{EntityType: entityType, EntityID: id}}
+	if event.ID, err = randomID("evt_"); err != nil {
+		log.Printf("webhook %s id=%d: %v", eventType, id, err)
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("webhook %s id=%d: %v", eventType, id, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), enqueueTimeout)
+	defer cancel()
+	queued, err := n.queue.Enqueue(ctx, event.ID, eventType, payload)
+	if err != nil {
+		log.Printf("webhook enqueue %s id=%d: %v", eventType, id, err)
+		return
+	}
+	if queued > 0 && n.worker != nil {
+		n.worker.Wake()
+	}
+}
+
+// Watch publishes the changes made through svc as events about entityType, e.g. "test".
+func Watch[T any](svc *services.Service[T], n *Notifier, entityType string) {
+	svc.OnChange(func(c services.Change) {
+		n.Publish(entityType, c.Kind, c.ID)
+	})
+}
+
+// NewSecret returns a fresh signing secret for an endpoint.
+func NewSecret() (string, error) {
+	return randomID("whsec_")
+}
+
+// Sign returns the SignatureHeader value for body sent at t: "t=<unix seconds>,v1=<hex HMAC-SHA256
+// of "<unix seconds>.<body>">". The timestamp is signed so a captured request can't be replayed later.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, body)
+}
+
+var (
+	ErrBadSignature   = errors.New("webhook signature mismatch")
+	ErrStaleSignature = errors.New("webhook signature timestamp outside tolerance")
+)
+
+// Verify checks a SignatureHeader value the way receivers should: the HMAC must match and the
+// timestamp must be within tolerance of now.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("malformed %s header", SignatureHeader)
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return ErrBadSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return ErrStaleSignature
+	}
+	return nil
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomID(prefix string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+const testSecret = "whsec_test"
+
+// fakeStore hands out its pending deliveries once per ClaimDue and keeps the recorded attempts.
+type fakeStore struct {
+	mu       sync.Mutex
+	pending  []*models.WebhookDelivery
+	attempts []models.WebhookAttempt
+}
+
+func (s *fakeStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimed := s.pending
+	s.pending = nil
+	return claimed, nil
+}
+
+func (s *fakeStore) RecordAttempt(ctx context.Context, d *models.WebhookDelivery, a models.WebhookAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+// receiver is a local endpoint that verifies each request's signature before answering with status.
+type receiver struct {
+	status  int
+	mu      sync.Mutex
+	got     []*http.Request
+	bodies  [][]byte
+	sigErrs []error
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	rc.got = append(rc.got, r)
+	rc.bodies = append(rc.bodies, body)
+	rc.sigErrs = append(rc.sigErrs, Verify(testSecret, r.Header.Get(SignatureHeader), body, time.Now(), 5*time.Minute))
+	rc.mu.Unlock()
+	if rc.status == http.StatusFound {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		return
+	}
+	w.WriteHeader(rc.status)
+	_, _ = w.Write([]byte("receiver says " + strconv.Itoa(rc.status)))
+}
+
+func delivery(url string, attempts int) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		ID:        7,
+		EventID:   "evt_1",
+		EventType: TestUpdated,
+		Payload:   json.RawMessage(`{"id":"evt_1","type":"test.updated"}`),
+		Status:    models.DeliveryPending,
+		Attempts:  attempts,
+		URL:       url,
+		Secret:    testSecret,
+	}
+}
+
+func TestWorkerDeliverDue(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		status       int
+		unreachable  bool
+		priorTries   int
+		wantStatus   string
+		wantAttempts int
+		wantNext     time.Time
+		wantErrPart  string
+	}{
+		{"success", http.StatusNoContent, false, 0, models.DeliverySucceeded, 1, time.Time{}, ""},
+		{"server error retries after first backoff", http.StatusInternalServerError, false, 0,
+			models.DeliveryPending, 1, now.Add(time.Minute), "receiver says 500"},
+		{"later failure backs off further", http.StatusBadGateway, false, 3, models.DeliveryPending, 4,
+			now.Add(2 * time.Hour), "502"},
+		{"last attempt fails for good", http.StatusInternalServerError, false, MaxAttempts - 1,
+			models.DeliveryFailed, MaxAttempts, time.Time{}, "500"},
+		{"redirect is not followed", http.StatusFound, false, 0, models.DeliveryPending, 1,
+			now.Add(time.Minute), "302"},
+		{"unreachable endpoint retries", 0, true, 0, models.DeliveryPending, 1, now.Add(time.Minute), "connect"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &receiver{status: tc.status}
+			srv := httptest.NewServer(rc)
+			url := srv.URL
+			if tc.unreachable {
+				srv.Close()
+			} else {
+				defer srv.Close()
+			}
+
+			d := delivery(url, tc.priorTries)
+			store := &fakeStore{pending: []*models.WebhookDelivery{d}}
+			w := NewWorker(store)
+			// the fixed clock makes the signature stale to the receiver; TestSignedRequestVerifies covers it
+			w.now = func() time.Time { return now }
+
+			n, err := w.DeliverDue(context.Background())
+			if err != nil || n != 1 {
+				t.Fatalf("DeliverDue = %d, %v; want 1, nil", n, err)
+			}
+			if d.Status != tc.wantStatus || d.Attempts != tc.wantAttempts {
+				t.Errorf("status, attempts = %s, %d; want %s, %d", d.Status, d.Attempts, tc.wantStatus, tc.wantAttempts)
+			}
+			if !tc.wantNext.IsZero() && !d.NextAttemptAt.Equal(tc.wantNext) {
+				t.Errorf("next attempt = %v, want %v", d.NextAttemptAt, tc.wantNext)
+			}
+			if !strings.Contains(d.LastError, tc.wantErrPart) {
+				t.Errorf("last error = %q, want it to contain %q", d.LastError, tc.wantErrPart)
+			}
+			if len(store.attempts) != 1 {
+				t.Fatalf("recorded %d attempts, want 1", len(store.attempts))
+			}
+
+			if tc.unreachable {
+				return
+			}
+			if len(rc.got) != 1 {
+				t.Fatalf("receiver got %d requests, want 1", len(rc.got))
+			}
+			req := rc.got[0]
+			if req.Header.Get(EventHeader) != TestUpdated || req.Header.Get(DeliveryHeader) != "7" {
+				t.Errorf("headers = %v", req.Header)
+			}
+			if string(rc.bodies[0]) != string(d.Payload) {
+				t.Errorf("body = %s, want %s", rc.bodies[0], d.Payload)
+			}
+		})
+	}
+}
+
+func TestSignedRequestVerifies(t *testing.T) {
+	rc := &receiver{status: http.StatusOK}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := delivery(srv.URL, 0)
+	if _, err := NewWorker(&fakeStore{pending: []*models.WebhookDelivery{d}}).DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.sigErrs) != 1 || rc.sigErrs[0] != nil {
+		t.Fatalf("receiver signature check = %v, want nil", rc.sigErrs)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	sentAt := time.Unix(1_800_000_000, 0)
+	header := Sign(testSecret, sentAt, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+		wantAny bool // any error will do
+	}{
+		{"valid", testSecret, header, body, sentAt.Add(time.Minute), nil, false},
+		{"tampered body", testSecret, header, []byte(`{"id":"evt_2"}`), sentAt, ErrBadSignature, false},
+		{"wrong secret", "whsec_other", header, body, sentAt, ErrBadSignature, false},
+		{"too old", testSecret, header, body, sentAt.Add(10 * time.Minute), ErrStaleSignature, false},
+		{"from the future", testSecret, header, body, sentAt.Add(-10 * time.Minute), ErrStaleSignature, false},
+		{"timestamp swapped", testSecret, strings.Replace(header, "t=1800000000", "t=1800000001", 1), body,
+			sentAt, ErrBadSignature, false},
+		{"malformed", testSecret, "v1=abc", body, sentAt, nil, true},
+		{"empty", testSecret, "", body, sentAt, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(tc.secret, tc.header, tc.body, tc.now, 5*time.Minute)
+			if tc.wantAny {
+				if err == nil {
+					t.Error("Verify = nil, want an error")
+				}
+				return
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Verify = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+type fakeQueue struct {
+	eventTypes []string
+	payloads   [][]byte
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, eventID, eventType string, payload []byte) (int, error) {
+	q.eventTypes = append(q.eventTypes, eventType)
+	q.payloads = append(q.payloads, payload)
+	return 1, nil
+}
+
+func TestPublish(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		entityType string
+		kind       string
+		id         string
+		wantType   string // empty when nothing should be queued
+	}{
+		{"test updated", "test", "updated", "42", TestUpdated},
+		{"test archived", "test", "archived", "42", TestArchived},
+		{"problem updated", "problem", "updated", "9", ProblemUpdated},
+		{"chapter archived", "chapter", "archived", "3", ChapterArchived},
+		{"no event for test created", "test", "created", "42", ""},
+		{"no event for chapter updated", "chapter", "updated", "3", ""},
+		{"bad id dropped", "test", "updated", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q := &fakeQueue{}
+			n := NewNotifier(q, nil)
+			n.now = func() time.Time { return now }
+			n.Publish(tc.entityType, tc.kind, tc.id)
+
+			if tc.wantType == "" {
+				if len(q.eventTypes) != 0 {
+					t.Fatalf("queued %v, want nothing", q.eventTypes)
+				}
+				return
+			}
+			if len(q.eventTypes) != 1 || q.eventTypes[0] != tc.wantType {
+				t.Fatalf("queued %v, want [%s]", q.eventTypes, tc.wantType)
+			}
+			var e Event
+			if err := json.Unmarshal(q.payloads[0], &e); err != nil {
+				t.Fatal(err)
+			}
+			wantID, _ := strconv.Atoi(tc.id)
+			if e.Type != tc.wantType || !e.OccurredAt.Equal(now) || !strings.HasPrefix(e.ID, "evt_") ||
+				e.Data != (EventData{EntityType: tc.entityType, EntityID: wantID}) {
+				t.Errorf("event = %+v", e)
+			}
+		})
+	}
+}
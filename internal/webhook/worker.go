@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avantifellows/nex-gen-cms/internal/models"
+)
+
+// Backoff is the wait before each retry of a failed delivery. A delivery that fails once more after
+// the last wait is given up as failed, about a day and a half after the event.
+var Backoff = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour,
+	24 * time.Hour}
+
+// MaxAttempts is the number of times a delivery is sent before it is failed.
+var MaxAttempts = len(Backoff) + 1
+
+const (
+	pollInterval   = 15 * time.Second
+	claimBatch     = 20
+	requestTimeout = 10 * time.Second
+	// claimLease is how long a claimed delivery stays invisible to other workers. It outlasts a
+	// request, so a delivery is only claimed twice when a worker dies mid-send.
+	claimLease = 2 * time.Minute
+	// maxErrorBody is how much of a failed response is kept in the delivery log.
+	maxErrorBody = 300
+)
+
+// Store hands out due deliveries and records their attempts (db.WebhookRepo).
+type Store interface {
+	// ClaimDue returns up to limit pending deliveries whose next attempt is due, with their endpoint's
+	// URL and secret, and pushes their next attempt lease into the future.
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	// RecordAttempt saves the outcome of an attempt: the delivery's new status, attempts, next attempt
+	// and last result.
+	RecordAttempt(ctx context.Context, d *models.WebhookDelivery, a models.WebhookAttempt) error
+}
+
+// Worker sends queued deliveries. It polls the store, and Wake makes it look right away.
+type Worker struct {
+	store  Store
+	client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+func NewWorker(store Store) *Worker {
+	return &Worker{
+		store: store,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// a redirect is a misconfigured endpoint; following it would send the payload elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		wake: make(chan struct{}, 1),
+		now:  time.Now,
+	}
+}
+
+// Run delivers until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := w.DeliverDue(ctx)
+			if err != nil {
+				log.Printf("webhook worker: %v", err)
+			}
+			// a full batch may mean more are waiting
+			if err != nil || n < claimBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// Wake makes a running worker look for due deliveries now rather than at its next poll.
+func (w *Worker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// DeliverDue sends one batch of due deliveries and returns how many it claimed.
+func (w *Worker) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := w.store.ClaimDue(ctx, claimBatch, claimLease)
+	if err != nil {
+		return 0, fmt.Errorf("claim deliveries: %w", err)
+	}
+	for _, d := range deliveries {
+		attempt := w.send(ctx, d)
+		settle(d, attempt)
+		if err := w.store.RecordAttempt(ctx, d, attempt); err != nil {
+			log.Printf("webhook record attempt delivery=%d: %v", d.ID, err)
+		}
+	}
+	return len(deliveries), nil
+}
+
+// send POSTs a delivery once.
+func (w *Worker) send(ctx context.Context, d *models.WebhookDelivery) models.WebhookAttempt {
+	attempt := models.WebhookAttempt{At: w.now()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nex-gen-cms-webhooks/1")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, attempt.At, d.Payload))
+
+	resp, err := w.client.Do(req)
+	attempt.Duration = w.now().Sub(attempt.At)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	attempt.Status = resp.StatusCode
+	if !succeeded(resp.StatusCode) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		attempt.Error = strings.TrimSpace(resp.Status + " " + string(body))
+	}
+	return attempt
+}
+
+// settle applies an attempt to the delivery: succeeded, scheduled for a retry, or failed for good.
+func settle(d *models.WebhookDelivery, a models.WebhookAttempt) {
+	d.Attempts++
+	at := a.At
+	d.LastAttemptAt = &at
+	d.LastStatus = a.Status
+	d.LastError = a.Error
+	switch {
+	case a.Error == "" && succeeded(a.Status):
+		d.Status = models.DeliverySucceeded
+	case d.Attempts >= MaxAttempts:
+		d.Status = models.DeliveryFailed
+	default:
+		d.Status = models.DeliveryPending
+		d.NextAttemptAt = a.At.Add(Backoff[d.Attempts-1])
+	}
+}
+
+func succeeded(status int) bool {
+	return status >= 200 && status < 300
+}
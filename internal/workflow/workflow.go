@@ -0,0 +1,116 @@
+// Package workflow is the review lifecycle of tests and problems, stored in cms_status_id:
+// draft → in review → approved → published. Editors submit their drafts; admins approve,
+// publish, or send content back to draft with a comment.
+package workflow
+
+import (
+	"errors"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+)
+
+var ErrTransitionNotAllowed = errors.New("transition not allowed")
+
+// Transition is one move between statuses that users with at least Role may make.
+type Transition struct {
+	Action       string
+	Label        string
+	From, To     int8
+	Role         string
+	NeedsComment bool // sending content back requires telling the author why
+}
+
+var transitions = []Transition{
+	{Action: "submit", Label: "Submit for review", From: constants.StatusDraft, To: constants.StatusInReview,
+		Role: auth.RoleEditor},
+	{Action: "withdraw", Label: "Withdraw", From: constants.StatusInReview, To: constants.StatusDraft,
+		Role: auth.RoleEditor},
+	{Action: "request-changes", Label: "Request changes", From: constants.StatusInReview, To: constants.StatusDraft,
+		Role: auth.RoleAdmin, NeedsComment: true},
+	{Action: "approve", Label: "Approve", From: constants.StatusInReview, To: constants.StatusApproved,
+		Role: auth.RoleAdmin},
+	{Action: "publish", Label: "Publish", From: constants.StatusApproved, To: constants.StatusPublished,
+		Role: auth.RoleAdmin},
+	{Action: "reopen", Label: "Back to draft", From: constants.StatusApproved, To: constants.StatusDraft,
+		Role: auth.RoleAdmin, NeedsComment: true},
+	{Action: "unpublish", Label: "Unpublish", From: constants.StatusPublished, To: constants.StatusDraft,
+		Role: auth.RoleAdmin, NeedsComment: true},
+}
+
+// Normalize maps content that predates the workflow (no cms_status_id) to published, since it
+// has been live all along.
+func Normalize(status int8) int8 {
+	if status == 0 {
+		return constants.StatusPublished
+	}
+	return status
+}
+
+// IsPublished reports whether content with this status may be served to af_lms.
+func IsPublished(status int8) bool {
+	return Normalize(status) == constants.StatusPublished
+}
+
+// AfterEdit is the status content with status moves to when a user with role saves changes to it.
+// Admins edit in place; anyone else's edit sends approved or published content back to review, so
+// that it isn't served until an admin approves it again.
+func AfterEdit(status int8, role string) int8 {
+	if auth.AtLeast(role, auth.RoleAdmin) {
+		return status
+	}
+	switch Normalize(status) {
+	case constants.StatusApproved, constants.StatusPublished:
+		return constants.StatusInReview
+	}
+	return status
+}
+
+// AfterRestore is the status content with status moves to when an old version of it is restored.
+// Whoever restores it, the restored content is reviewed again before it is served; drafts stay drafts.
+func AfterRestore(status int8) int8 {
+	switch Normalize(status) {
+	case constants.StatusDraft, constants.StatusArchived:
+		return status
+	}
+	return constants.StatusInReview
+}
+
+// StatusName is the display name of a status.
+func StatusName(status int8) string {
+	switch Normalize(status) {
+	case constants.StatusArchived:
+		return "Archived"
+	case constants.StatusDraft:
+		return "Draft"
+	case constants.StatusInReview:
+		return "In review"
+	case constants.StatusApproved:
+		return "Approved"
+	case constants.StatusPublished:
+		return "Published"
+	}
+	return "Unknown"
+}
+
+// Available returns the transitions a user with role may make from status, in display order.
+func Available(status int8, role string) []Transition {
+	var out []Transition
+	for _, t := range transitions {
+		if t.From == Normalize(status) && auth.AtLeast(role, t.Role) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Find returns the transition named action from status, or ErrTransitionNotAllowed if there is
+// none or role is too low for it.
+func Find(status int8, action, role string) (Transition, error) {
+	for _, t := range Available(status, role) {
+		if t.Action == action {
+			return t, nil
+		}
+	}
+	return Transition{}, ErrTransitionNotAllowed
+}
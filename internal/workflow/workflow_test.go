@@ -0,0 +1,80 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/avantifellows/nex-gen-cms/internal/auth"
+	"github.com/avantifellows/nex-gen-cms/internal/constants"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int8
+		action string
+		role   string
+		wantTo int8
+		wantOK bool
+	}{
+		{"editor submits draft", constants.StatusDraft, "submit", auth.RoleEditor, constants.StatusInReview, true},
+		{"viewer cannot submit", constants.StatusDraft, "submit", auth.RoleViewer, 0, false},
+		{"editor cannot approve", constants.StatusInReview, "approve", auth.RoleEditor, 0, false},
+		{"admin approves", constants.StatusInReview, "approve", auth.RoleAdmin, constants.StatusApproved, true},
+		{"publish needs approval first", constants.StatusInReview, "publish", auth.RoleAdmin, 0, false},
+		{"admin publishes approved", constants.StatusApproved, "publish", auth.RoleAdmin, constants.StatusPublished, true},
+		{"legacy content counts as published", 0, "unpublish", auth.RoleAdmin, constants.StatusDraft, true},
+		{"archived is final", constants.StatusArchived, "submit", auth.RoleAdmin, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Find(tt.status, tt.action, tt.role)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("Find err = %v, want ok %v", err, tt.wantOK)
+			}
+			if tt.wantOK && got.To != tt.wantTo {
+				t.Errorf("Find to = %d, want %d", got.To, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestAfterEdit(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int8
+		role   string
+		want   int8
+	}{
+		{"editor keeps draft", constants.StatusDraft, auth.RoleEditor, constants.StatusDraft},
+		{"editor keeps in review", constants.StatusInReview, auth.RoleEditor, constants.StatusInReview},
+		{"editor sends approved back", constants.StatusApproved, auth.RoleEditor, constants.StatusInReview},
+		{"editor sends published back", constants.StatusPublished, auth.RoleEditor, constants.StatusInReview},
+		{"editor sends legacy content back", 0, auth.RoleEditor, constants.StatusInReview},
+		{"admin edits published in place", constants.StatusPublished, auth.RoleAdmin, constants.StatusPublished},
+		{"admin edits legacy in place", 0, auth.RoleAdmin, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AfterEdit(tt.status, tt.role); got != tt.want {
+				t.Errorf("AfterEdit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAfterRestore(t *testing.T) {
+	tests := []struct {
+		status int8
+		want   int8
+	}{
+		{constants.StatusDraft, constants.StatusDraft},
+		{constants.StatusApproved, constants.StatusInReview},
+		{constants.StatusPublished, constants.StatusInReview},
+		{0, constants.StatusInReview},
+	}
+	for _, tt := range tests {
+		if got := AfterRestore(tt.status); got != tt.want {
+			t.Errorf("AfterRestore(%d) = %d, want %d", tt.status, got, tt.want)
+		}
+	}
+}
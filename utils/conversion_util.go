@@ -166,3 +166,11 @@ func StringSliceToIntSlice(values []string) []int {
 	}
 	return result
 }
+
+func IntSliceToStringSlice(values []int) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = strconv.Itoa(v)
+	}
+	return result
+}